@@ -1,12 +1,33 @@
 package api
 
 import (
+	"context"
 	"database/sql"
+	"fmt"
 	"net/http"
+	"time"
 
+	"github.com/LikheKeto/Suraksheet/config"
+	"github.com/LikheKeto/Suraksheet/mail"
+	"github.com/LikheKeto/Suraksheet/service/account"
+	"github.com/LikheKeto/Suraksheet/service/apikey"
+	"github.com/LikheKeto/Suraksheet/service/audit"
+	"github.com/LikheKeto/Suraksheet/service/auth"
 	"github.com/LikheKeto/Suraksheet/service/bin"
 	"github.com/LikheKeto/Suraksheet/service/document"
+	"github.com/LikheKeto/Suraksheet/service/importer"
+	"github.com/LikheKeto/Suraksheet/service/jwtkey"
+	"github.com/LikheKeto/Suraksheet/service/limiter"
+	"github.com/LikheKeto/Suraksheet/service/oidc"
+	"github.com/LikheKeto/Suraksheet/service/organization"
+	"github.com/LikheKeto/Suraksheet/service/permission"
+	"github.com/LikheKeto/Suraksheet/service/quota"
+	"github.com/LikheKeto/Suraksheet/service/session"
+	"github.com/LikheKeto/Suraksheet/service/share"
+	"github.com/LikheKeto/Suraksheet/service/template"
+	"github.com/LikheKeto/Suraksheet/service/trash"
 	"github.com/LikheKeto/Suraksheet/service/user"
+	"github.com/LikheKeto/Suraksheet/types"
 	"github.com/elastic/go-elasticsearch/v8"
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
@@ -42,7 +63,7 @@ func (s *APIServer) Run() error {
 		// AllowedOrigins:   []string{"https://foo.com"}, // Use this to allow specific origin hosts
 		AllowedOrigins: []string{"https://*", "http://*"},
 		// AllowOriginFunc:  func(r *http.Request, origin string) bool { return true },
-		AllowedMethods:   []string{"GET", "POST", "PATCH", "DELETE", "OPTIONS"},
+		AllowedMethods:   []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
 		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token"},
 		ExposedHeaders:   []string{"Link"},
 		AllowCredentials: false,
@@ -52,19 +73,99 @@ func (s *APIServer) Run() error {
 	subrouter := chi.NewRouter()
 	router.Mount("/api/v1", subrouter)
 
+	rotator, err := jwtkey.NewRotator(jwtkey.NewStore(s.db), auth.Keys, config.Envs.JWTSecret, config.Envs.JWTAlgorithm,
+		time.Second*time.Duration(config.Envs.JWTKeyRotationInSeconds),
+		time.Second*time.Duration(config.Envs.JWTKeyOverlapInSeconds))
+	if err != nil {
+		return err
+	}
+	if err := rotator.Refresh(); err != nil {
+		return fmt.Errorf("unable to load jwt keys: %v", err)
+	}
+	auth.Keys.SetRefresh(rotator.Refresh)
+	go rotator.Run(context.Background(), time.Minute)
+
+	jwksHandler := jwtkey.NewHandler(auth.Keys)
+	jwksHandler.RegisterRoutes(router)
+
 	userStore := user.NewStore(s.db)
+	sessionStore := session.NewStore(s.db)
+	deletionStore := account.NewStore(s.db)
+	apiKeyStore := apikey.NewStore(s.db)
 	binStore := bin.NewStore(s.db)
 	documentStore := document.NewStore(s.db)
+	shareStore := share.NewStore(s.db)
+	orgStore := organization.NewStore(s.db)
+	trashStore := trash.NewStore(s.db)
+	importStore := importer.NewStore(s.db)
+	quotaStore := quota.NewStore(s.db)
+	templateStore := template.NewStore(s.db)
+
+	mailer := mail.NewMailer()
 
-	userHandler := user.NewHandler(userStore)
+	auditStore := audit.NewStore(s.db)
+	var ipLimiter, accountLimiter types.LoginLimiter
+	if config.Envs.LoginLimiter == "memory" {
+		ipLimiter = limiter.NewMemory(limiter.IPPolicy())
+		accountLimiter = limiter.NewMemory(limiter.AccountPolicy())
+	} else {
+		ipLimiter = limiter.NewStore(s.db, limiter.IPPolicy())
+		accountLimiter = limiter.NewStore(s.db, limiter.AccountPolicy())
+	}
+
+	userHandler := user.NewHandler(userStore, sessionStore, deletionStore, mailer, ipLimiter, accountLimiter, auditStore)
 	userHandler.RegisterRoutes(subrouter)
 
-	binHandler := bin.NewHandler(binStore, userStore, documentStore, s.minio)
+	sessionHandler := session.NewHandler(sessionStore, userStore)
+	sessionHandler.RegisterRoutes(subrouter)
+
+	// OIDC login is only offered when an identity provider is configured
+	if config.Envs.OIDCIssuer != "" {
+		provider := oidc.NewProvider(config.Envs.OIDCIssuer, config.Envs.OIDCClientID, config.Envs.OIDCClientSecret, config.Envs.OIDCRedirectURL)
+		oidcHandler := oidc.NewHandler(oidc.NewStore(s.db), userStore, sessionStore, provider, config.Envs.OIDCFrontendURL)
+		oidcHandler.RegisterRoutes(subrouter)
+	}
+
+	apiKeyHandler := apikey.NewHandler(apiKeyStore, userStore, sessionStore)
+	apiKeyHandler.RegisterRoutes(subrouter)
+
+	permissions := permission.NewChecker(binStore, documentStore, shareStore, userStore, orgStore)
+
+	orgHandler := organization.NewHandler(orgStore, documentStore, userStore, sessionStore, permissions, mailer, s.minio, s.esClient)
+	orgHandler.RegisterRoutes(subrouter)
+
+	binHandler := bin.NewHandler(binStore, userStore, sessionStore, apiKeyStore, documentStore, templateStore, permissions, s.minio, s.esClient)
 	binHandler.RegisterRoutes(subrouter)
 
-	documentHandler := document.NewHandler(documentStore, userStore, binStore, s.minio, s.rmqChan, s.rmq, s.esClient)
+	shareHandler := share.NewHandler(shareStore, binStore, userStore, sessionStore, permissions)
+	shareHandler.RegisterRoutes(subrouter)
+
+	documentHandler := document.NewHandler(documentStore, quotaStore, userStore, sessionStore, apiKeyStore, permissions, s.minio, s.rmqChan, s.rmq, s.esClient)
 	documentHandler.RegisterRoutes(subrouter)
+	go document.BackfillSizes(context.Background(), documentStore, binStore, permissions, s.minio)
+	go document.BackfillSearchFields(context.Background(), documentStore, binStore, s.esClient)
+
+	purger := account.NewPurger(deletionStore, s.minio, s.esClient)
+	go purger.Run(context.Background(), time.Minute)
+
+	trashRetention := time.Duration(config.Envs.TrashRetentionInSeconds) * time.Second
+	trashPurger := trash.NewPurger(trashStore, binStore, documentStore, permissions, s.minio, s.esClient, trashRetention)
+	go trashPurger.Run(context.Background(), time.Hour)
+
+	trashHandler := trash.NewHandler(trashStore, documentStore, userStore, sessionStore, apiKeyStore, permissions, trashPurger, s.minio, s.esClient, trashRetention)
+	trashHandler.RegisterRoutes(subrouter)
+
+	bulkImporter := importer.NewImporter(importStore, quotaStore, binStore, documentStore, permissions, s.minio, s.rmqChan, s.rmq)
+	go bulkImporter.Run(context.Background(), 5*time.Second)
+
+	importHandler := importer.NewHandler(importStore, quotaStore, documentStore, binStore, userStore, sessionStore, apiKeyStore, permissions, s.minio)
+	importHandler.RegisterRoutes(subrouter)
+
+	quotaHandler := quota.NewHandler(quotaStore, documentStore, userStore, sessionStore, apiKeyStore, permissions)
+	quotaHandler.RegisterRoutes(subrouter)
+
+	templateHandler := template.NewHandler(templateStore, userStore, sessionStore, apiKeyStore)
+	templateHandler.RegisterRoutes(subrouter)
 
-	err := http.ListenAndServe(s.addr, router)
-	return err
+	return http.ListenAndServe(s.addr, router)
 }
@@ -19,6 +19,8 @@ func FatalIfErr(err error) {
 }
 
 func main() {
+	FatalIfErr(config.Envs.Validate())
+
 	// database
 	database := db.NewSQLStorage(db.DBConfig{
 		User:     config.Envs.DBUser,
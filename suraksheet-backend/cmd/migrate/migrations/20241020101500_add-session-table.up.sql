@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS sessions (
+    id SERIAL PRIMARY KEY,
+    userId INT NOT NULL,
+    refreshToken VARCHAR(64) NOT NULL UNIQUE,
+    expiresAt TIMESTAMP NOT NULL,
+    revokedAt TIMESTAMP,
+    createdAt TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+    FOREIGN KEY (userId) REFERENCES users(id) ON DELETE CASCADE
+);
\ No newline at end of file
@@ -0,0 +1,4 @@
+ALTER TABLE sessions
+DROP COLUMN userAgent,
+DROP COLUMN ipAddress,
+DROP COLUMN lastSeenAt;
\ No newline at end of file
@@ -0,0 +1,4 @@
+ALTER TABLE sessions
+ADD COLUMN userAgent VARCHAR(255) NOT NULL DEFAULT '',
+ADD COLUMN ipAddress VARCHAR(45) NOT NULL DEFAULT '',
+ADD COLUMN lastSeenAt TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP;
\ No newline at end of file
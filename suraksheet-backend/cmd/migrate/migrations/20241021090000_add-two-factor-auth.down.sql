@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS recovery_codes;
+
+ALTER TABLE users
+DROP COLUMN totpSecret,
+DROP COLUMN totpEnabled;
\ No newline at end of file
@@ -0,0 +1,12 @@
+ALTER TABLE users
+ADD COLUMN totpSecret VARCHAR(64) NOT NULL DEFAULT '',
+ADD COLUMN totpEnabled BOOLEAN NOT NULL DEFAULT FALSE;
+
+CREATE TABLE IF NOT EXISTS recovery_codes (
+    id SERIAL PRIMARY KEY,
+    userId INT NOT NULL,
+    code VARCHAR(64) NOT NULL,
+    usedAt TIMESTAMP,
+
+    FOREIGN KEY (userId) REFERENCES users(id) ON DELETE CASCADE
+);
\ No newline at end of file
@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS user_tokens;
+
+ALTER TABLE users
+DROP COLUMN emailVerified;
\ No newline at end of file
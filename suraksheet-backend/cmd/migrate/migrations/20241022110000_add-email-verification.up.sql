@@ -0,0 +1,17 @@
+ALTER TABLE users
+ADD COLUMN emailVerified BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- accounts created before verification existed are trusted as they are
+UPDATE users SET emailVerified = TRUE;
+
+CREATE TABLE IF NOT EXISTS user_tokens (
+    id SERIAL PRIMARY KEY,
+    userId INT NOT NULL,
+    purpose VARCHAR(32) NOT NULL,
+    token VARCHAR(64) NOT NULL UNIQUE,
+    expiresAt TIMESTAMP NOT NULL,
+    usedAt TIMESTAMP,
+    createdAt TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+    FOREIGN KEY (userId) REFERENCES users(id) ON DELETE CASCADE
+);
\ No newline at end of file
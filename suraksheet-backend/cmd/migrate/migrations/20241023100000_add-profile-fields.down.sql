@@ -0,0 +1,3 @@
+ALTER TABLE users
+DROP COLUMN storageKey,
+DROP COLUMN pendingEmail;
\ No newline at end of file
@@ -0,0 +1,7 @@
+ALTER TABLE users
+ADD COLUMN storageKey VARCHAR(64) NOT NULL DEFAULT '',
+ADD COLUMN pendingEmail VARCHAR(255) NOT NULL DEFAULT '';
+
+-- objects in minio were stored under the hash of the email address, keep
+-- them where they are now that the email address can change
+UPDATE users SET storageKey = encode(sha256(convert_to(email, 'UTF8')), 'hex');
\ No newline at end of file
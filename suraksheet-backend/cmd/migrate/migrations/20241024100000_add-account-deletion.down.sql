@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS account_deletions;
+
+ALTER TABLE bins
+DROP CONSTRAINT bins_owner_fkey,
+ADD CONSTRAINT bins_owner_fkey FOREIGN KEY (owner) REFERENCES users(id);
\ No newline at end of file
@@ -0,0 +1,19 @@
+ALTER TABLE bins
+DROP CONSTRAINT bins_owner_fkey,
+ADD CONSTRAINT bins_owner_fkey FOREIGN KEY (owner) REFERENCES users(id) ON DELETE CASCADE;
+
+CREATE TABLE IF NOT EXISTS account_deletions (
+    id SERIAL PRIMARY KEY,
+    userId INT NOT NULL,
+    storageKey VARCHAR(64) NOT NULL,
+    status VARCHAR(16) NOT NULL DEFAULT 'scheduled',
+    step VARCHAR(16) NOT NULL DEFAULT '',
+    error TEXT NOT NULL DEFAULT '',
+    attempts INT NOT NULL DEFAULT 0,
+    purgeAt TIMESTAMP NOT NULL,
+    createdAt TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    completedAt TIMESTAMP
+);
+
+CREATE UNIQUE INDEX uq_pending_account_deletion ON account_deletions (userId)
+WHERE status IN ('scheduled', 'running', 'failed');
\ No newline at end of file
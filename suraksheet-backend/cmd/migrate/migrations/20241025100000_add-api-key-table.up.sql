@@ -0,0 +1,14 @@
+CREATE TABLE IF NOT EXISTS api_keys (
+    id SERIAL PRIMARY KEY,
+    userId INT NOT NULL,
+    name VARCHAR(100) NOT NULL,
+    prefix VARCHAR(16) NOT NULL,
+    key VARCHAR(64) NOT NULL UNIQUE,
+    scope VARCHAR(16) NOT NULL,
+    expiresAt TIMESTAMP,
+    lastUsedAt TIMESTAMP,
+    revokedAt TIMESTAMP,
+    createdAt TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+    FOREIGN KEY (userId) REFERENCES users(id) ON DELETE CASCADE
+);
\ No newline at end of file
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS user_identities;
+DROP TABLE IF EXISTS oidc_login_states;
\ No newline at end of file
@@ -0,0 +1,18 @@
+CREATE TABLE IF NOT EXISTS oidc_login_states (
+    state VARCHAR(64) PRIMARY KEY,
+    codeVerifier VARCHAR(128) NOT NULL,
+    nonce VARCHAR(64) NOT NULL,
+    expiresAt TIMESTAMP NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS user_identities (
+    id SERIAL PRIMARY KEY,
+    userId INT NOT NULL,
+    issuer VARCHAR(255) NOT NULL,
+    subject VARCHAR(255) NOT NULL,
+    email VARCHAR(255) NOT NULL DEFAULT '',
+    createdAt TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+    FOREIGN KEY (userId) REFERENCES users(id) ON DELETE CASCADE,
+    UNIQUE(issuer, subject)
+);
\ No newline at end of file
@@ -0,0 +1,19 @@
+CREATE TABLE IF NOT EXISTS login_attempts (
+    key VARCHAR(320) PRIMARY KEY,
+    failures INT NOT NULL DEFAULT 0,
+    lastFailureAt TIMESTAMP NOT NULL,
+    blockedUntil TIMESTAMP NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS audit_log (
+    id SERIAL PRIMARY KEY,
+    userId INT,
+    event VARCHAR(64) NOT NULL,
+    detail TEXT NOT NULL DEFAULT '',
+    ipAddress VARCHAR(45) NOT NULL DEFAULT '',
+    createdAt TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+    FOREIGN KEY (userId) REFERENCES users(id) ON DELETE SET NULL
+);
+
+CREATE INDEX IF NOT EXISTS audit_log_user_idx ON audit_log (userId);
\ No newline at end of file
@@ -0,0 +1 @@
+DROP TABLE IF EXISTS jwt_keys;
\ No newline at end of file
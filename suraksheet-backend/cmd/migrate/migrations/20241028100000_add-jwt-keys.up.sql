@@ -0,0 +1,6 @@
+CREATE TABLE IF NOT EXISTS jwt_keys (
+    id VARCHAR(32) PRIMARY KEY,
+    algorithm VARCHAR(16) NOT NULL,
+    privateKey BYTEA NOT NULL,
+    createdAt TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
\ No newline at end of file
@@ -0,0 +1,8 @@
+DROP INDEX IF EXISTS bins_parent_idx;
+DROP INDEX IF EXISTS uq_bin_name;
+
+ALTER TABLE bins DROP COLUMN parent;
+
+ALTER TABLE bins
+ADD CONSTRAINT uq_bin_name
+UNIQUE (name, owner);
\ No newline at end of file
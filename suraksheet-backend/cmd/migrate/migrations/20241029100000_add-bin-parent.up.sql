@@ -0,0 +1,8 @@
+ALTER TABLE bins
+ADD COLUMN parent INT REFERENCES bins(id) ON DELETE CASCADE;
+
+ALTER TABLE bins DROP CONSTRAINT uq_bin_name;
+
+-- names only have to be unique among siblings; top level bins have no parent
+CREATE UNIQUE INDEX uq_bin_name ON bins (owner, COALESCE(parent, 0), name);
+CREATE INDEX IF NOT EXISTS bins_parent_idx ON bins (parent);
\ No newline at end of file
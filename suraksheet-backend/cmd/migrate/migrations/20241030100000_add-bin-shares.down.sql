@@ -0,0 +1 @@
+DROP TABLE IF EXISTS bin_shares;
\ No newline at end of file
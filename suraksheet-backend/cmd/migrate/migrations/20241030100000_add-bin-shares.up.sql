@@ -0,0 +1,17 @@
+CREATE TABLE IF NOT EXISTS bin_shares (
+    id SERIAL PRIMARY KEY,
+    bin INT NOT NULL,
+    userId INT NOT NULL,
+    role VARCHAR(16) NOT NULL,
+    status VARCHAR(16) NOT NULL DEFAULT 'pending',
+    invitedBy INT,
+    createdAt TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    respondedAt TIMESTAMP,
+
+    FOREIGN KEY (bin) REFERENCES bins(id) ON DELETE CASCADE,
+    FOREIGN KEY (userId) REFERENCES users(id) ON DELETE CASCADE,
+    FOREIGN KEY (invitedBy) REFERENCES users(id) ON DELETE SET NULL,
+    UNIQUE(bin, userId)
+);
+
+CREATE INDEX IF NOT EXISTS bin_shares_user_idx ON bin_shares (userId);
\ No newline at end of file
@@ -0,0 +1,16 @@
+ALTER TABLE documents DROP COLUMN profile;
+
+DELETE FROM bins WHERE organization IS NOT NULL;
+DROP INDEX IF EXISTS bins_organization_idx;
+DROP INDEX IF EXISTS uq_bin_name;
+CREATE UNIQUE INDEX uq_bin_name ON bins (owner, COALESCE(parent, 0), name);
+
+ALTER TABLE bins
+DROP CONSTRAINT bins_owner_check,
+DROP COLUMN organization,
+ALTER COLUMN owner SET NOT NULL;
+
+DROP TABLE IF EXISTS managed_profiles;
+DROP TABLE IF EXISTS organization_invitations;
+DROP TABLE IF EXISTS organization_members;
+DROP TABLE IF EXISTS organizations;
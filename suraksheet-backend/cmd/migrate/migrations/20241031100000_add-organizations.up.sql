@@ -0,0 +1,56 @@
+CREATE TABLE IF NOT EXISTS organizations (
+    id SERIAL PRIMARY KEY,
+    name VARCHAR(255) NOT NULL,
+    storageKey VARCHAR(64) NOT NULL UNIQUE,
+    createdAt TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS organization_members (
+    organization INT NOT NULL,
+    userId INT NOT NULL,
+    role VARCHAR(16) NOT NULL,
+    createdAt TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+    PRIMARY KEY (organization, userId),
+    FOREIGN KEY (organization) REFERENCES organizations(id) ON DELETE CASCADE,
+    FOREIGN KEY (userId) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS organization_invitations (
+    id SERIAL PRIMARY KEY,
+    organization INT NOT NULL,
+    email VARCHAR(255) NOT NULL,
+    role VARCHAR(16) NOT NULL,
+    token VARCHAR(64) NOT NULL UNIQUE,
+    invitedBy INT,
+    expiresAt TIMESTAMP NOT NULL,
+    acceptedAt TIMESTAMP,
+    createdAt TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+    FOREIGN KEY (organization) REFERENCES organizations(id) ON DELETE CASCADE,
+    FOREIGN KEY (invitedBy) REFERENCES users(id) ON DELETE SET NULL
+);
+
+-- people in a household who don't log in themselves
+CREATE TABLE IF NOT EXISTS managed_profiles (
+    id SERIAL PRIMARY KEY,
+    organization INT NOT NULL,
+    name VARCHAR(255) NOT NULL,
+    relationship VARCHAR(64) NOT NULL DEFAULT '',
+    createdAt TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+    FOREIGN KEY (organization) REFERENCES organizations(id) ON DELETE CASCADE
+);
+
+-- a bin belongs either to a user or to an organization
+ALTER TABLE bins
+ALTER COLUMN owner DROP NOT NULL,
+ADD COLUMN organization INT REFERENCES organizations(id) ON DELETE CASCADE,
+ADD CONSTRAINT bins_owner_check CHECK ((owner IS NULL) <> (organization IS NULL));
+
+DROP INDEX IF EXISTS uq_bin_name;
+CREATE UNIQUE INDEX uq_bin_name ON bins (COALESCE(owner, 0), COALESCE(organization, 0), COALESCE(parent, 0), name);
+CREATE INDEX IF NOT EXISTS bins_organization_idx ON bins (organization);
+
+ALTER TABLE documents
+ADD COLUMN profile INT REFERENCES managed_profiles(id) ON DELETE SET NULL;
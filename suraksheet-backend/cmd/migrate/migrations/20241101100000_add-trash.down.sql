@@ -0,0 +1,12 @@
+DROP TABLE IF EXISTS trash;
+
+DELETE FROM documents WHERE deletedAt IS NOT NULL;
+DELETE FROM bins WHERE deletedAt IS NOT NULL;
+
+DROP INDEX IF EXISTS uq_document_name;
+ALTER TABLE documents ADD CONSTRAINT documents_referencename_bin_key UNIQUE (referenceName, bin);
+DROP INDEX IF EXISTS uq_bin_name;
+CREATE UNIQUE INDEX uq_bin_name ON bins (COALESCE(owner, 0), COALESCE(organization, 0), COALESCE(parent, 0), name);
+
+ALTER TABLE documents DROP COLUMN deletedAt;
+ALTER TABLE bins DROP COLUMN deletedAt;
@@ -0,0 +1,25 @@
+ALTER TABLE bins ADD COLUMN deletedAt TIMESTAMP;
+ALTER TABLE documents ADD COLUMN deletedAt TIMESTAMP;
+
+-- names in the trash can be reused
+DROP INDEX IF EXISTS uq_bin_name;
+CREATE UNIQUE INDEX uq_bin_name ON bins (COALESCE(owner, 0), COALESCE(organization, 0), COALESCE(parent, 0), name) WHERE deletedAt IS NULL;
+ALTER TABLE documents DROP CONSTRAINT IF EXISTS documents_referencename_bin_key;
+CREATE UNIQUE INDEX uq_document_name ON documents (bin, referenceName) WHERE deletedAt IS NULL;
+
+-- one entry for every document or bin that was deleted on its own; what was
+-- inside a deleted bin shares its deletedAt and is restored along with it
+CREATE TABLE IF NOT EXISTS trash (
+    id SERIAL PRIMARY KEY,
+    document INT,
+    bin INT,
+    deletedBy INT,
+    deletedAt TIMESTAMP NOT NULL,
+
+    FOREIGN KEY (document) REFERENCES documents(id) ON DELETE CASCADE,
+    FOREIGN KEY (bin) REFERENCES bins(id) ON DELETE CASCADE,
+    FOREIGN KEY (deletedBy) REFERENCES users(id) ON DELETE SET NULL,
+    CHECK ((document IS NULL) <> (bin IS NULL))
+);
+
+CREATE INDEX IF NOT EXISTS trash_deleted_at_idx ON trash (deletedAt);
@@ -0,0 +1,32 @@
+-- an import unpacks an uploaded archive into bins; the archive is kept in
+-- object storage until every file in it has been imported
+CREATE TABLE IF NOT EXISTS imports (
+    id SERIAL PRIMARY KEY,
+    userId INT NOT NULL,
+    bin INT NOT NULL,
+    name VARCHAR(255) NOT NULL,
+    archiveKey TEXT NOT NULL,
+    language VARCHAR(3) NOT NULL,
+    status VARCHAR(16) NOT NULL DEFAULT 'pending',
+    createdAt TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    completedAt TIMESTAMP,
+
+    FOREIGN KEY (userId) REFERENCES users(id) ON DELETE CASCADE,
+    FOREIGN KEY (bin) REFERENCES bins(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS imports_user_idx ON imports (userId);
+CREATE INDEX IF NOT EXISTS imports_status_idx ON imports (status);
+
+CREATE TABLE IF NOT EXISTS import_files (
+    id SERIAL PRIMARY KEY,
+    import INT NOT NULL,
+    path TEXT NOT NULL,
+    status VARCHAR(16) NOT NULL DEFAULT 'pending',
+    error TEXT NOT NULL DEFAULT '',
+    document INT,
+
+    FOREIGN KEY (import) REFERENCES imports(id) ON DELETE CASCADE,
+    FOREIGN KEY (document) REFERENCES documents(id) ON DELETE SET NULL,
+    UNIQUE(import, path)
+);
@@ -0,0 +1 @@
+ALTER TABLE bins DROP COLUMN IF EXISTS query;
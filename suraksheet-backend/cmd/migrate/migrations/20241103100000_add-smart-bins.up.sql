@@ -0,0 +1,2 @@
+-- smart bins hold the documents matching their query instead of their own
+ALTER TABLE bins ADD COLUMN query JSONB;
@@ -0,0 +1,3 @@
+ALTER TABLE documents DROP COLUMN IF EXISTS extractionStatus;
+ALTER TABLE documents DROP COLUMN IF EXISTS contentType;
+ALTER TABLE documents DROP COLUMN IF EXISTS size;
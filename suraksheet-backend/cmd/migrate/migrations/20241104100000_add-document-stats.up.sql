@@ -0,0 +1,8 @@
+-- the size and type of each document's object, cached so usage can be added
+-- up without asking object storage; NULL until known
+ALTER TABLE documents ADD COLUMN size BIGINT;
+ALTER TABLE documents ADD COLUMN contentType VARCHAR(255) NOT NULL DEFAULT '';
+
+-- set by the extractor: pending, completed, empty (no text found) or failed
+ALTER TABLE documents ADD COLUMN extractionStatus VARCHAR(16) NOT NULL DEFAULT 'pending';
+UPDATE documents SET extractionStatus = 'completed' WHERE extract <> '';
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS quotas;
+DROP TABLE IF EXISTS plans;
@@ -0,0 +1,28 @@
+-- limits on what a user or organization may store; NULL means unlimited
+CREATE TABLE IF NOT EXISTS plans (
+    name VARCHAR(32) PRIMARY KEY,
+    maxBytes BIGINT,
+    maxDocuments INT
+);
+
+INSERT INTO plans (name, maxBytes, maxDocuments) VALUES
+    ('free', 1073741824, 1000),
+    ('plus', 21474836480, 20000),
+    ('unlimited', NULL, NULL)
+ON CONFLICT DO NOTHING;
+
+-- the plan of a user or organization, with limits that override the plan's;
+-- those without a row are on the default plan
+CREATE TABLE IF NOT EXISTS quotas (
+    id SERIAL PRIMARY KEY,
+    userId INT UNIQUE,
+    organization INT UNIQUE,
+    plan VARCHAR(32) NOT NULL,
+    maxBytes BIGINT,
+    maxDocuments INT,
+
+    FOREIGN KEY (userId) REFERENCES users(id) ON DELETE CASCADE,
+    FOREIGN KEY (organization) REFERENCES organizations(id) ON DELETE CASCADE,
+    FOREIGN KEY (plan) REFERENCES plans(name) ON UPDATE CASCADE,
+    CHECK ((userId IS NULL) <> (organization IS NULL))
+);
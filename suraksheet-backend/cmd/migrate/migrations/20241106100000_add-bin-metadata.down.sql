@@ -0,0 +1,8 @@
+ALTER TABLE bins DROP COLUMN IF EXISTS archived;
+ALTER TABLE bins DROP COLUMN IF EXISTS position;
+ALTER TABLE bins DROP COLUMN IF EXISTS pinned;
+ALTER TABLE bins DROP COLUMN IF EXISTS icon;
+ALTER TABLE bins DROP COLUMN IF EXISTS color;
+ALTER TABLE bins DROP COLUMN IF EXISTS description;
+DROP INDEX IF EXISTS uq_default_bin;
+ALTER TABLE bins DROP COLUMN IF EXISTS isDefault;
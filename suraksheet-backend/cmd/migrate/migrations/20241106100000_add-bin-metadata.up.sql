@@ -0,0 +1,13 @@
+-- the bin every user starts with used to be told apart by its name
+ALTER TABLE bins ADD COLUMN isDefault BOOLEAN NOT NULL DEFAULT FALSE;
+UPDATE bins SET isDefault = TRUE
+WHERE name = 'No Bin' AND parent IS NULL AND organization IS NULL AND deletedAt IS NULL;
+CREATE UNIQUE INDEX IF NOT EXISTS uq_default_bin ON bins (owner) WHERE isDefault;
+
+ALTER TABLE bins ADD COLUMN description TEXT NOT NULL DEFAULT '';
+ALTER TABLE bins ADD COLUMN color VARCHAR(16) NOT NULL DEFAULT '';
+ALTER TABLE bins ADD COLUMN icon VARCHAR(64) NOT NULL DEFAULT '';
+-- bins are listed pinned first, then by position, then by name
+ALTER TABLE bins ADD COLUMN pinned BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE bins ADD COLUMN position INT NOT NULL DEFAULT 0;
+ALTER TABLE bins ADD COLUMN archived BOOLEAN NOT NULL DEFAULT FALSE;
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS bin_slots;
+DROP TABLE IF EXISTS bin_templates;
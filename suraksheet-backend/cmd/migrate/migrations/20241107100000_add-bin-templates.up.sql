@@ -0,0 +1,30 @@
+-- the documents a recurring process needs, such as a visa application, kept
+-- to create bins from
+CREATE TABLE IF NOT EXISTS bin_templates (
+    id SERIAL PRIMARY KEY,
+    owner INT NOT NULL,
+    name VARCHAR(100) NOT NULL,
+    description TEXT NOT NULL DEFAULT '',
+    slots JSONB NOT NULL,
+    createdAt TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+    FOREIGN KEY (owner) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS bin_templates_owner_idx ON bin_templates (owner);
+
+-- a document a bin created from a template is expected to hold, and the
+-- document filling it once there is one
+CREATE TABLE IF NOT EXISTS bin_slots (
+    id SERIAL PRIMARY KEY,
+    bin INT NOT NULL,
+    name VARCHAR(100) NOT NULL,
+    description TEXT NOT NULL DEFAULT '',
+    required BOOLEAN NOT NULL DEFAULT TRUE,
+    position INT NOT NULL DEFAULT 0,
+    document INT,
+
+    FOREIGN KEY (bin) REFERENCES bins(id) ON DELETE CASCADE,
+    FOREIGN KEY (document) REFERENCES documents(id) ON DELETE SET NULL,
+    UNIQUE(bin, name)
+);
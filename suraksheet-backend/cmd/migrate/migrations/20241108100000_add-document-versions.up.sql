@@ -0,0 +1,26 @@
+ALTER TABLE documents ADD COLUMN version INT NOT NULL DEFAULT 1;
+
+-- every version of a document. The current one lives in the document's own
+-- object and row; older ones keep their object under objectKey and the text
+-- that was extracted from it
+CREATE TABLE IF NOT EXISTS document_versions (
+    id SERIAL PRIMARY KEY,
+    document INT NOT NULL,
+    version INT NOT NULL,
+    name VARCHAR(255) NOT NULL,
+    size BIGINT,
+    contentType VARCHAR(255) NOT NULL DEFAULT '',
+    language VARCHAR(3) NOT NULL,
+    extract TEXT NOT NULL DEFAULT '',
+    objectKey TEXT NOT NULL DEFAULT '',
+    uploadedBy INT,
+    createdAt TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+    FOREIGN KEY (document) REFERENCES documents(id) ON DELETE CASCADE,
+    FOREIGN KEY (uploadedBy) REFERENCES users(id) ON DELETE SET NULL,
+    UNIQUE(document, version)
+);
+
+INSERT INTO document_versions (document, version, name, size, contentType, language, createdAt)
+SELECT id, 1, name, size, contentType, language, createdAt FROM documents
+ON CONFLICT DO NOTHING;
@@ -0,0 +1,20 @@
+-- the pages of a document made of several files, in order. Documents of a
+-- single file have no pages; once pages are added the document's own file
+-- becomes the page with an empty objectKey, and the document's text is that
+-- of its pages joined together
+CREATE TABLE IF NOT EXISTS document_pages (
+    id SERIAL PRIMARY KEY,
+    document INT NOT NULL,
+    position INT NOT NULL,
+    name VARCHAR(255) NOT NULL,
+    size BIGINT,
+    contentType VARCHAR(255) NOT NULL DEFAULT '',
+    objectKey TEXT NOT NULL DEFAULT '',
+    extract TEXT NOT NULL DEFAULT '',
+    extractionStatus VARCHAR(16) NOT NULL DEFAULT 'pending',
+    createdAt TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+    FOREIGN KEY (document) REFERENCES documents(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS document_pages_document_idx ON document_pages (document, position);
@@ -0,0 +1,7 @@
+DROP INDEX IF EXISTS documents_type_idx;
+ALTER TABLE documents DROP COLUMN IF EXISTS holderName;
+ALTER TABLE documents DROP COLUMN IF EXISTS expiryDate;
+ALTER TABLE documents DROP COLUMN IF EXISTS issueDate;
+ALTER TABLE documents DROP COLUMN IF EXISTS documentNumber;
+ALTER TABLE documents DROP COLUMN IF EXISTS issuer;
+ALTER TABLE documents DROP COLUMN IF EXISTS documentType;
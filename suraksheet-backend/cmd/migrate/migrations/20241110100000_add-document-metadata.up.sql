@@ -0,0 +1,10 @@
+-- what the document is and who it belongs to, filled in by its owner.
+-- documentType is one of the configured document types, or empty
+ALTER TABLE documents ADD COLUMN documentType VARCHAR(64) NOT NULL DEFAULT '';
+ALTER TABLE documents ADD COLUMN issuer VARCHAR(255) NOT NULL DEFAULT '';
+ALTER TABLE documents ADD COLUMN documentNumber VARCHAR(100) NOT NULL DEFAULT '';
+ALTER TABLE documents ADD COLUMN issueDate DATE;
+ALTER TABLE documents ADD COLUMN expiryDate DATE;
+ALTER TABLE documents ADD COLUMN holderName VARCHAR(255) NOT NULL DEFAULT '';
+
+CREATE INDEX IF NOT EXISTS documents_type_idx ON documents (bin, documentType);
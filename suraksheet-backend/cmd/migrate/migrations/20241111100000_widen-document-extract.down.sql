@@ -0,0 +1 @@
+ALTER TABLE documents ALTER COLUMN extract TYPE VARCHAR(1000) USING left(extract, 1000);
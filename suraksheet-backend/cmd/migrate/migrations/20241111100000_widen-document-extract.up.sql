@@ -0,0 +1,3 @@
+-- the text of a document made of several pages is that of all its pages, far
+-- more than the original limit allows
+ALTER TABLE documents ALTER COLUMN extract TYPE TEXT;
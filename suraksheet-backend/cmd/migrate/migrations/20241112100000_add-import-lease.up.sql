@@ -0,0 +1,6 @@
+-- a running import holds a lease it renews as it goes, so one left running by
+-- a process that died is picked up again once the lease runs out
+ALTER TABLE imports ADD COLUMN IF NOT EXISTS claimedAt TIMESTAMP;
+
+-- imports already running were claimed before leases existed
+UPDATE imports SET claimedAt = createdAt WHERE status = 'running';
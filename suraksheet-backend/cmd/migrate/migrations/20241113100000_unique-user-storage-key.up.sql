@@ -0,0 +1,8 @@
+-- storage keys were the hash of the email address, so an account registered
+-- with an address another account had moved away from got that account's
+-- prefix; give every account but the first its own
+UPDATE users u
+SET storageKey = md5(random()::text || u.id::text) || md5(random()::text || u.email)
+WHERE EXISTS (SELECT 1 FROM users o WHERE o.storageKey = u.storageKey AND o.id < u.id);
+
+ALTER TABLE users ADD CONSTRAINT users_storagekey_key UNIQUE (storageKey);
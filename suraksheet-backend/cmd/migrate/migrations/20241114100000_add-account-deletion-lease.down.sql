@@ -0,0 +1 @@
+ALTER TABLE account_deletions DROP COLUMN IF EXISTS claimedAt;
@@ -0,0 +1,6 @@
+-- a running deletion holds a lease the purger renews with every step, so one
+-- left running by a process that died is picked up again once it runs out
+ALTER TABLE account_deletions ADD COLUMN IF NOT EXISTS claimedAt TIMESTAMP;
+
+-- deletions already running were claimed before leases existed
+UPDATE account_deletions SET claimedAt = purgeAt WHERE status = 'running';
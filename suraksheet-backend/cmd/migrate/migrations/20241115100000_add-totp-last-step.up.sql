@@ -0,0 +1,3 @@
+-- the time step of the last TOTP code accepted, so a code can only be used
+-- once even though it stays valid for a while
+ALTER TABLE users ADD COLUMN IF NOT EXISTS totpLastStep BIGINT NOT NULL DEFAULT 0;
@@ -1,14 +1,24 @@
 package config
 
 import (
+	"fmt"
 	"os"
 	"strconv"
 )
 
+// minJWTSecretLength is the shortest SERVER_JWT_SECRET the API starts with.
+const minJWTSecretLength = 32
+
 type Config struct {
 	PublicHost string
 	Port       string
-	JWTSecret  string
+
+	JWTSecret                       string
+	JWTAlgorithm                    string
+	JWTKeyRotationInSeconds         int64
+	JWTKeyOverlapInSeconds          int64
+	JWTExpirationInSeconds          int64
+	RefreshTokenExpirationInSeconds int64
 
 	DBUser     string
 	DBPassword string
@@ -23,36 +33,148 @@ type Config struct {
 
 	RabbitMQUrl      string
 	ElasticsearchUrl string
+
+	AccountDeletionGracePeriodInSeconds int64
+	TrashRetentionInSeconds             int64
+
+	MaxUploadSizeInBytes int64
+	// MaxImportSizeInBytes is how large an archive to import may be
+	MaxImportSizeInBytes int64
+	// MaxDocumentVersions is how many versions of a document are kept,
+	// the current one included; 0 keeps them all
+	MaxDocumentVersions int64
+	// DocumentTypes lists, comma separated, the types a document can be
+	// given
+	DocumentTypes string
+	DefaultPlan   string
+	// AdminEmails lists, comma separated, the users who manage plans and quotas
+	AdminEmails string
+	// TrustedProxies lists, comma separated, the addresses or CIDR ranges of
+	// the reverse proxies whose X-Forwarded-For header is believed
+	TrustedProxies string
+
+	LoginLimiter                  string
+	LoginBackoffBaseInSeconds     int64
+	LoginBackoffMaxInSeconds      int64
+	LoginFailureWindowInSeconds   int64
+	LoginAccountLockoutThreshold  int64
+	LoginIPLockoutThreshold       int64
+	LoginLockoutDurationInSeconds int64
+
+	OIDCIssuer       string
+	OIDCClientID     string
+	OIDCClientSecret string
+	OIDCRedirectURL  string
+	OIDCFrontendURL  string
+
+	MailDriver   string
+	MailFrom     string
+	MailLogDir   string
+	SMTPHost     string
+	SMTPPort     string
+	SMTPUsername string
+	SMTPPassword string
 }
 
 var Envs = initConfig()
 
+// defaultDocumentTypes are the types a document can be given unless
+// DOCUMENT_TYPES says otherwise
+const defaultDocumentTypes = "passport,citizenship,national_id,driving_license,birth_certificate," +
+	"marriage_certificate,academic_certificate,bank_statement,tax_document,insurance,property_deed,other"
+
 func initConfig() Config {
 	port, err := strconv.Atoi(getEnv("POSTGRES_PORT", "5432"))
 	if err != nil {
 		panic(err)
 	}
+	publicHost := getEnv("SERVER_PUBLIC_HOST", "http://localhost")
 	return Config{
-		PublicHost:       getEnv("SERVER_PUBLIC_HOST", "http://localhost"),
-		Port:             getEnv("SERVER_PORT", ":8080"),
-		JWTSecret:        getEnv("SERVER_JWT_SECRET", ""),
-		DBUser:           getEnv("POSTGRES_USER", "root"),
-		DBPassword:       getEnv("POSTGRES_PASSWORD", "mypassword"),
-		DBHost:           getEnv("POSTGRES_HOST", "127.0.0.1"),
-		DBPort:           port,
-		DBName:           getEnv("POSTGRES_DATABASE", "suraksheet"),
-		MinioURL:         getEnv("MINIO_ENDPOINT", "127.0.0.1:9000"),
-		MinioAccessKey:   getEnv("MINIO_ACCESS_KEY", ""),
-		MinioSecretKey:   getEnv("MINIO_SECRET_KEY", ""),
-		MinioBucketName:  getEnv("MINIO_BUCKET_NAME", "suraksheet"),
-		RabbitMQUrl:      getEnv("RABBITMQ_URL", "localhost"),
-		ElasticsearchUrl: getEnv("ELASTICSEARCH_URL", "localhost"),
+		PublicHost:                          publicHost,
+		Port:                                getEnv("SERVER_PORT", ":8080"),
+		JWTSecret:                           getEnv("SERVER_JWT_SECRET", ""),
+		JWTAlgorithm:                        getEnv("SERVER_JWT_ALGORITHM", "EdDSA"),
+		JWTKeyRotationInSeconds:             getEnvAsInt("SERVER_JWT_KEY_ROTATION", 3600*24*30),
+		JWTKeyOverlapInSeconds:              getEnvAsInt("SERVER_JWT_KEY_OVERLAP", 3600*24*2),
+		JWTExpirationInSeconds:              getEnvAsInt("SERVER_JWT_EXPIRATION", 60*15),
+		RefreshTokenExpirationInSeconds:     getEnvAsInt("SERVER_REFRESH_TOKEN_EXPIRATION", 3600*24*30),
+		DBUser:                              getEnv("POSTGRES_USER", "root"),
+		DBPassword:                          getEnv("POSTGRES_PASSWORD", "mypassword"),
+		DBHost:                              getEnv("POSTGRES_HOST", "127.0.0.1"),
+		DBPort:                              port,
+		DBName:                              getEnv("POSTGRES_DATABASE", "suraksheet"),
+		MinioURL:                            getEnv("MINIO_ENDPOINT", "127.0.0.1:9000"),
+		MinioAccessKey:                      getEnv("MINIO_ACCESS_KEY", ""),
+		MinioSecretKey:                      getEnv("MINIO_SECRET_KEY", ""),
+		MinioBucketName:                     getEnv("MINIO_BUCKET_NAME", "suraksheet"),
+		RabbitMQUrl:                         getEnv("RABBITMQ_URL", "localhost"),
+		ElasticsearchUrl:                    getEnv("ELASTICSEARCH_URL", "localhost"),
+		AccountDeletionGracePeriodInSeconds: getEnvAsInt("ACCOUNT_DELETION_GRACE_PERIOD", 3600*24*7),
+		TrashRetentionInSeconds:             getEnvAsInt("TRASH_RETENTION", 3600*24*30),
+		MaxUploadSizeInBytes:                getEnvAsInt("MAX_UPLOAD_SIZE", 10<<20),
+		MaxImportSizeInBytes:                getEnvAsInt("MAX_IMPORT_SIZE", 100<<20),
+		MaxDocumentVersions:                 getEnvAsInt("MAX_DOCUMENT_VERSIONS", 10),
+		DocumentTypes:                       getEnv("DOCUMENT_TYPES", defaultDocumentTypes),
+		DefaultPlan:                         getEnv("DEFAULT_PLAN", "free"),
+		AdminEmails:                         getEnv("ADMIN_EMAILS", ""),
+		TrustedProxies:                      getEnv("TRUSTED_PROXIES", ""),
+		LoginLimiter:                        getEnv("LOGIN_LIMITER", "postgres"),
+		LoginBackoffBaseInSeconds:           getEnvAsInt("LOGIN_BACKOFF_BASE", 1),
+		LoginBackoffMaxInSeconds:            getEnvAsInt("LOGIN_BACKOFF_MAX", 60),
+		LoginFailureWindowInSeconds:         getEnvAsInt("LOGIN_FAILURE_WINDOW", 3600),
+		LoginAccountLockoutThreshold:        getEnvAsInt("LOGIN_ACCOUNT_LOCKOUT_THRESHOLD", 10),
+		LoginIPLockoutThreshold:             getEnvAsInt("LOGIN_IP_LOCKOUT_THRESHOLD", 50),
+		LoginLockoutDurationInSeconds:       getEnvAsInt("LOGIN_LOCKOUT_DURATION", 900),
+		OIDCIssuer:                          getEnv("OIDC_ISSUER", ""),
+		OIDCClientID:                        getEnv("OIDC_CLIENT_ID", ""),
+		OIDCClientSecret:                    getEnv("OIDC_CLIENT_SECRET", ""),
+		OIDCRedirectURL:                     getEnv("OIDC_REDIRECT_URL", publicHost+"/api/v1/oidc/callback"),
+		OIDCFrontendURL:                     getEnv("OIDC_FRONTEND_URL", publicHost+"/login"),
+		MailDriver:                          getEnv("MAIL_DRIVER", "log"),
+		MailFrom:                            getEnv("MAIL_FROM", "Suraksheet <no-reply@localhost>"),
+		MailLogDir:                          getEnv("MAIL_LOG_DIR", ""),
+		SMTPHost:                            getEnv("SMTP_HOST", "localhost"),
+		SMTPPort:                            getEnv("SMTP_PORT", "587"),
+		SMTPUsername:                        getEnv("SMTP_USERNAME", ""),
+		SMTPPassword:                        getEnv("SMTP_PASSWORD", ""),
 	}
 }
 
+// Validate reports settings the API must not run with.
+func (c Config) Validate() error {
+	if len(c.JWTSecret) < minJWTSecretLength {
+		return fmt.Errorf("SERVER_JWT_SECRET must be set to at least %d random characters", minJWTSecretLength)
+	}
+	switch c.JWTAlgorithm {
+	case "HS256", "RS256", "EdDSA":
+	default:
+		return fmt.Errorf("SERVER_JWT_ALGORITHM must be one of HS256, RS256 or EdDSA")
+	}
+	if c.JWTKeyRotationInSeconds <= 0 {
+		return fmt.Errorf("SERVER_JWT_KEY_ROTATION must be positive")
+	}
+	// tokens signed by a retired key must expire before the key is dropped;
+	// email links live for a day
+	if c.JWTKeyOverlapInSeconds < max(c.JWTExpirationInSeconds, 3600*24) {
+		return fmt.Errorf("SERVER_JWT_KEY_OVERLAP must cover SERVER_JWT_EXPIRATION and at least a day")
+	}
+	return nil
+}
+
 func getEnv(key, fallback string) string {
 	if value, ok := os.LookupEnv(key); ok {
 		return value
 	}
 	return fallback
 }
+
+func getEnvAsInt(key string, fallback int64) int64 {
+	if value, ok := os.LookupEnv(key); ok {
+		i, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return fallback
+		}
+		return i
+	}
+	return fallback
+}
@@ -3,6 +3,7 @@ module github.com/LikheKeto/Suraksheet
 go 1.22.5
 
 require (
+	github.com/DATA-DOG/go-sqlmock v1.5.2
 	github.com/elastic/go-elasticsearch/v8 v8.17.0
 	github.com/go-chi/chi/v5 v5.1.0
 	github.com/go-chi/cors v1.2.1
@@ -0,0 +1,99 @@
+package mail
+
+import (
+	"fmt"
+	"log"
+	netmail "net/mail"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/LikheKeto/Suraksheet/config"
+	"github.com/LikheKeto/Suraksheet/types"
+)
+
+// NewMailer returns the mailer selected by MAIL_DRIVER.
+func NewMailer() types.Mailer {
+	switch config.Envs.MailDriver {
+	case "smtp":
+		log.Println("Sending mail through SMTP")
+		return &SMTPMailer{
+			Host:     config.Envs.SMTPHost,
+			Port:     config.Envs.SMTPPort,
+			Username: config.Envs.SMTPUsername,
+			Password: config.Envs.SMTPPassword,
+			From:     config.Envs.MailFrom,
+		}
+	default:
+		log.Println("Mail will be logged instead of sent")
+		return &LogMailer{Dir: config.Envs.MailLogDir, From: config.Envs.MailFrom}
+	}
+}
+
+type SMTPMailer struct {
+	Host     string
+	Port     string
+	Username string
+	Password string
+	From     string
+}
+
+func (m *SMTPMailer) Send(to, subject, body string) error {
+	var auth smtp.Auth
+	if m.Username != "" {
+		auth = smtp.PlainAuth("", m.Username, m.Password, m.Host)
+	}
+	from, err := netmail.ParseAddress(m.From)
+	if err != nil {
+		return fmt.Errorf("invalid sender address: %v", err)
+	}
+	return smtp.SendMail(m.Host+":"+m.Port, auth, from.Address, []string{to}, message(m.From, to, subject, body))
+}
+
+// LogMailer is meant for local development. It writes every message to the
+// log, and also to a file in Dir when one is set.
+type LogMailer struct {
+	Dir  string
+	From string
+}
+
+func (m *LogMailer) Send(to, subject, body string) error {
+	msg := message(m.From, to, subject, body)
+	if m.Dir == "" {
+		log.Printf("mail to %s:\n%s", to, msg)
+		return nil
+	}
+	if err := os.MkdirAll(m.Dir, 0o755); err != nil {
+		return err
+	}
+	name := filepath.Join(m.Dir, fmt.Sprintf("%d-%s.eml", time.Now().UnixNano(), sanitize(to)))
+	if err := os.WriteFile(name, msg, 0o644); err != nil {
+		return err
+	}
+	log.Printf("mail to %s written to %s", to, name)
+	return nil
+}
+
+func message(from, to, subject, body string) []byte {
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\n", from)
+	fmt.Fprintf(&b, "To: %s\r\n", to)
+	fmt.Fprintf(&b, "Subject: %s\r\n", subject)
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=\"utf-8\"\r\n")
+	b.WriteString("\r\n")
+	b.WriteString(strings.ReplaceAll(body, "\n", "\r\n"))
+	return []byte(b.String())
+}
+
+func sanitize(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '/' || r == '\\' || r == os.PathSeparator {
+			return '_'
+		}
+		return r
+	}, s)
+}
@@ -0,0 +1,105 @@
+package account
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/LikheKeto/Suraksheet/types"
+	"github.com/LikheKeto/Suraksheet/utils"
+	"github.com/elastic/go-elasticsearch/v8"
+	"github.com/minio/minio-go/v7"
+)
+
+const (
+	StepObjects  = "objects"
+	StepSearch   = "search"
+	StepDatabase = "database"
+)
+
+// Purger deletes accounts whose grace period has passed. Every step can be
+// repeated safely, so a failed deletion is simply run again on the next tick,
+// as is one left running by a process that died once its lease runs out.
+type Purger struct {
+	store    types.AccountDeletionStore
+	minio    *minio.Client
+	esClient *elasticsearch.Client
+}
+
+func NewPurger(store types.AccountDeletionStore, minio *minio.Client, esClient *elasticsearch.Client) *Purger {
+	return &Purger{store: store, minio: minio, esClient: esClient}
+}
+
+func (p *Purger) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		p.purgeDue(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (p *Purger) purgeDue(ctx context.Context) {
+	deletions, err := p.store.GetDueDeletions()
+	if err != nil {
+		log.Printf("unable to fetch due account deletions: %v", err)
+		return
+	}
+	for _, deletion := range deletions {
+		if err := p.store.ClaimDeletion(deletion.ID); err != nil {
+			continue
+		}
+		if err := p.purge(ctx, deletion); err != nil {
+			log.Printf("unable to delete account of user %d: %v", deletion.UserID, err)
+		} else {
+			log.Printf("deleted account of user %d", deletion.UserID)
+		}
+	}
+}
+
+// purgeStep is one part of deleting an account, named for the progress it
+// records.
+type purgeStep struct {
+	name string
+	run  func() error
+}
+
+// purge deletes the user row before anything else, since DeleteUser may
+// still refuse; the objects and search entries are only cleaned up once the
+// account is gone.
+func (p *Purger) purge(ctx context.Context, deletion types.AccountDeletion) error {
+	return p.runSteps(deletion, []purgeStep{
+		{StepDatabase, func() error {
+			return p.store.DeleteUser(deletion.UserID)
+		}},
+		{StepObjects, func() error {
+			return utils.DeleteDir(ctx, p.minio, deletion.StorageKey+"/")
+		}},
+		{StepSearch, func() error {
+			return utils.DeleteFromIndex(ctx, p.esClient, map[string]interface{}{
+				"term": map[string]interface{}{"user_id": deletion.UserID},
+			})
+		}},
+	})
+}
+
+// runSteps runs the steps in order, recording the progress of the deletion
+// and stopping at the first that fails.
+func (p *Purger) runSteps(deletion types.AccountDeletion, steps []purgeStep) error {
+	for _, step := range steps {
+		if err := p.store.UpdateDeletionProgress(deletion.ID, StatusRunning, step.name, ""); err != nil {
+			return err
+		}
+		if err := step.run(); err != nil {
+			if uErr := p.store.UpdateDeletionProgress(deletion.ID, StatusFailed, step.name, err.Error()); uErr != nil {
+				log.Printf("unable to record failed account deletion: %v", uErr)
+			}
+			return err
+		}
+	}
+	return p.store.UpdateDeletionProgress(deletion.ID, StatusCompleted, "", "")
+}
@@ -0,0 +1,82 @@
+package account
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/LikheKeto/Suraksheet/types"
+)
+
+type progress struct {
+	status, step, errMsg string
+}
+
+type mockDeletionStore struct {
+	types.AccountDeletionStore
+	deleteErr error
+	progress  []progress
+}
+
+func (m *mockDeletionStore) UpdateDeletionProgress(id int, status, step, errMsg string) error {
+	m.progress = append(m.progress, progress{status, step, errMsg})
+	return nil
+}
+
+func (m *mockDeletionStore) DeleteUser(userID int) error {
+	return m.deleteErr
+}
+
+// the steps that reach object storage and the search index are stood in for
+func TestRunSteps(t *testing.T) {
+	deletion := types.AccountDeletion{ID: 1, UserID: 2}
+	tests := []struct {
+		name      string
+		deleteErr error
+		want      []progress
+	}{
+		{"should record every step and the completion", nil, []progress{
+			{StatusRunning, StepDatabase, ""},
+			{StatusRunning, StepObjects, ""},
+			{StatusCompleted, "", ""},
+		}},
+		{"should stop at a failed step and record why", errors.New("user is the only owner of Thapa Family"), []progress{
+			{StatusRunning, StepDatabase, ""},
+			{StatusFailed, StepDatabase, "user is the only owner of Thapa Family"},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := &mockDeletionStore{deleteErr: tt.deleteErr}
+			p := &Purger{store: store}
+			err := p.runSteps(deletion, []purgeStep{
+				{StepDatabase, func() error { return store.DeleteUser(deletion.UserID) }},
+				{StepObjects, func() error { return nil }},
+			})
+			if (err != nil) != (tt.deleteErr != nil) {
+				t.Fatalf("expected error %v, got %v", tt.deleteErr, err)
+			}
+			if !slices.Equal(store.progress, tt.want) {
+				t.Errorf("expected progress %v, got %v", tt.want, store.progress)
+			}
+		})
+	}
+}
+
+// a purge the database refuses must leave the objects and search entries be;
+// the purger has no clients to reach them with
+func TestPurgeKeepsDataOfRefusedDeletion(t *testing.T) {
+	store := &mockDeletionStore{deleteErr: errors.New("user is the only owner of Thapa Family")}
+	p := &Purger{store: store}
+	if err := p.purge(context.Background(), types.AccountDeletion{ID: 1, UserID: 2, StorageKey: "key"}); err == nil {
+		t.Fatal("expected an error")
+	}
+	want := []progress{
+		{StatusRunning, StepDatabase, ""},
+		{StatusFailed, StepDatabase, "user is the only owner of Thapa Family"},
+	}
+	if !slices.Equal(store.progress, want) {
+		t.Errorf("expected progress %v, got %v", want, store.progress)
+	}
+}
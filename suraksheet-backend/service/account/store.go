@@ -0,0 +1,229 @@
+package account
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/LikheKeto/Suraksheet/types"
+)
+
+const (
+	StatusScheduled = "scheduled"
+	StatusRunning   = "running"
+	StatusFailed    = "failed"
+	StatusCompleted = "completed"
+	StatusCancelled = "cancelled"
+
+	// deletions that failed this many times are left for an operator to look at
+	maxAttempts = 5
+
+	// claimLease is how long a running deletion stays claimed without
+	// progress. The purger renews it with every step, so a deletion only
+	// outlives it if the process running it is gone.
+	claimLease = 30 * time.Minute
+)
+
+type Store struct {
+	db *sql.DB
+}
+
+func NewStore(db *sql.DB) *Store {
+	return &Store{
+		db: db,
+	}
+}
+
+func (s *Store) ScheduleDeletion(deletion types.AccountDeletion) (*types.AccountDeletion, error) {
+	row := s.db.QueryRow(`
+		INSERT INTO account_deletions (userId, storageKey, purgeAt)
+		VALUES ($1, $2, $3)
+		RETURNING *;
+	`, deletion.UserID, deletion.StorageKey, deletion.PurgeAt)
+	return scanRowIntoDeletion(row)
+}
+
+// GetDeletionByUser returns the most recent deletion request of the user.
+func (s *Store) GetDeletionByUser(userID int) (*types.AccountDeletion, error) {
+	row := s.db.QueryRow(`
+		SELECT * FROM account_deletions WHERE userId = $1
+		ORDER BY createdAt DESC LIMIT 1;
+	`, userID)
+	return scanRowIntoDeletion(row)
+}
+
+func (s *Store) CancelDeletion(userID int) error {
+	res, err := s.db.Exec(`
+		UPDATE account_deletions SET status = $1
+		WHERE userId = $2 AND status = $3;
+	`, StatusCancelled, userID, StatusScheduled)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return fmt.Errorf("no deletion is scheduled")
+	}
+	return nil
+}
+
+// GetDueDeletions returns deletions whose grace period is over, including
+// failed ones and running ones whose lease ran out, which should be retried.
+func (s *Store) GetDueDeletions() ([]types.AccountDeletion, error) {
+	rows, err := s.db.Query(`
+		SELECT * FROM account_deletions
+		WHERE (status IN ($1, $2) OR (status = $3 AND claimedAt < $4))
+			AND attempts < $5 AND purgeAt <= $6;
+	`, StatusScheduled, StatusFailed, StatusRunning, staleBefore(), maxAttempts, time.Now().UTC())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	deletions := make([]types.AccountDeletion, 0)
+	for rows.Next() {
+		deletion, err := scanRowIntoDeletion(rows)
+		if err != nil {
+			return nil, err
+		}
+		deletions = append(deletions, *deletion)
+	}
+	return deletions, nil
+}
+
+// ClaimDeletion marks a due deletion, or a running one whose lease ran out,
+// as running. It fails if another API replica got to it first or the user
+// cancelled in the meantime.
+func (s *Store) ClaimDeletion(id int) error {
+	res, err := s.db.Exec(`
+		UPDATE account_deletions
+		SET status = $1, attempts = attempts + 1, error = '', claimedAt = CURRENT_TIMESTAMP
+		WHERE id = $2 AND (status IN ($3, $4) OR (status = $1 AND claimedAt < $5));
+	`, StatusRunning, id, StatusScheduled, StatusFailed, staleBefore())
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return fmt.Errorf("deletion is no longer pending")
+	}
+	return nil
+}
+
+func (s *Store) UpdateDeletionProgress(id int, status, step, errMsg string) error {
+	_, err := s.db.Exec(`
+		UPDATE account_deletions
+		SET status = $1, step = $2, error = $3,
+			completedAt = CASE WHEN $1 = 'completed' THEN CURRENT_TIMESTAMP ELSE NULL END,
+			claimedAt = CASE WHEN $1 = 'running' THEN CURRENT_TIMESTAMP ELSE claimedAt END
+		WHERE id = $4;
+	`, status, step, errMsg, id)
+	return err
+}
+
+// DeleteUser removes the user row. Bins, documents, sessions and tokens go
+// with it through their foreign keys. It refuses while the user is the only
+// owner of an organization, which would be left without one; the user may
+// have become that after the deletion was scheduled.
+func (s *Store) DeleteUser(userID int) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// the same row locks changes to an organization's members take, so no
+	// other owner can step down in the meantime
+	_, err = tx.Exec(`
+		SELECT id FROM organizations
+		WHERE id IN (SELECT organization FROM organization_members WHERE userId = $1)
+		ORDER BY id FOR UPDATE;
+	`, userID)
+	if err != nil {
+		return err
+	}
+	orgs, err := soleOwnedOrganizations(tx, userID)
+	if err != nil {
+		return err
+	}
+	if len(orgs) > 0 {
+		return fmt.Errorf("user is the only owner of %s", strings.Join(orgs, ", "))
+	}
+	if _, err := tx.Exec("DELETE FROM users WHERE id = $1;", userID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// SoleOwnedOrganizations returns the names of the organizations the user is
+// the only owner of.
+func (s *Store) SoleOwnedOrganizations(userID int) ([]string, error) {
+	return soleOwnedOrganizations(s.db, userID)
+}
+
+type querier interface {
+	Query(query string, args ...any) (*sql.Rows, error)
+}
+
+func soleOwnedOrganizations(q querier, userID int) ([]string, error) {
+	rows, err := q.Query(`
+		SELECT o.name FROM organizations o
+		JOIN organization_members m ON m.organization = o.id
+		WHERE m.userId = $1 AND m.role = $2 AND NOT EXISTS (
+			SELECT 1 FROM organization_members other
+			WHERE other.organization = o.id AND other.role = $2 AND other.userId <> $1
+		)
+		ORDER BY o.name;
+	`, userID, types.OrgRoleOwner)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	names := make([]string, 0)
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		names = append(names, name)
+	}
+	return names, nil
+}
+
+func staleBefore() time.Time {
+	return time.Now().UTC().Add(-claimLease)
+}
+
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+func scanRowIntoDeletion(row scanner) (*types.AccountDeletion, error) {
+	deletion := new(types.AccountDeletion)
+	err := row.Scan(&deletion.ID,
+		&deletion.UserID,
+		&deletion.StorageKey,
+		&deletion.Status,
+		&deletion.Step,
+		&deletion.Error,
+		&deletion.Attempts,
+		&deletion.PurgeAt,
+		&deletion.CreatedAt,
+		&deletion.CompletedAt,
+		&deletion.ClaimedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("no deletion has been requested")
+		}
+		return nil, err
+	}
+	return deletion, nil
+}
@@ -0,0 +1,116 @@
+package account
+
+import (
+	"database/sql/driver"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/LikheKeto/Suraksheet/types"
+)
+
+func newMockStore(t *testing.T) (*Store, sqlmock.Sqlmock) {
+	t.Helper()
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		db.Close()
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+	})
+	return NewStore(db), mock
+}
+
+func TestDeleteUser(t *testing.T) {
+	lockOrganizations := "SELECT id FROM organizations .* FOR UPDATE"
+	soleOwned := "SELECT o.name FROM organizations o"
+
+	t.Run("should delete a user who leaves no organization without an owner", func(t *testing.T) {
+		store, mock := newMockStore(t)
+		mock.ExpectBegin()
+		mock.ExpectExec(lockOrganizations).WithArgs(1).WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectQuery(soleOwned).WithArgs(1, types.OrgRoleOwner).WillReturnRows(sqlmock.NewRows([]string{"name"}))
+		mock.ExpectExec("DELETE FROM users").WithArgs(1).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+
+		if err := store.DeleteUser(1); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("should keep the only owner of an organization", func(t *testing.T) {
+		store, mock := newMockStore(t)
+		mock.ExpectBegin()
+		mock.ExpectExec(lockOrganizations).WithArgs(1).WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectQuery(soleOwned).WithArgs(1, types.OrgRoleOwner).
+			WillReturnRows(sqlmock.NewRows([]string{"name"}).AddRow("Thapa Family"))
+		mock.ExpectRollback()
+
+		if err := store.DeleteUser(1); err == nil {
+			t.Error("expected an error")
+		}
+	})
+}
+
+// leaseExpiry matches the time before which a running deletion's lease has
+// run out.
+type leaseExpiry struct{}
+
+func (leaseExpiry) Match(v driver.Value) bool {
+	at, ok := v.(time.Time)
+	return ok && time.Since(at) >= claimLease && time.Since(at) < claimLease+time.Minute
+}
+
+func TestClaimDeletion(t *testing.T) {
+	claim := `SET status = \$1, attempts = attempts \+ 1, error = '', claimedAt = CURRENT_TIMESTAMP\s+` +
+		`WHERE id = \$2 AND \(status IN \(\$3, \$4\) OR \(status = \$1 AND claimedAt < \$5\)\)`
+
+	t.Run("should claim a due or stalled deletion", func(t *testing.T) {
+		store, mock := newMockStore(t)
+		mock.ExpectExec(claim).WithArgs(StatusRunning, 1, StatusScheduled, StatusFailed, leaseExpiry{}).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+
+		if err := store.ClaimDeletion(1); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("should fail for a deletion that was cancelled or claimed", func(t *testing.T) {
+		store, mock := newMockStore(t)
+		mock.ExpectExec(claim).WithArgs(StatusRunning, 1, StatusScheduled, StatusFailed, leaseExpiry{}).
+			WillReturnResult(sqlmock.NewResult(0, 0))
+
+		if err := store.ClaimDeletion(1); err == nil {
+			t.Error("expected an error")
+		}
+	})
+}
+
+func TestGetDueDeletions(t *testing.T) {
+	store, mock := newMockStore(t)
+	mock.ExpectQuery(`WHERE \(status IN \(\$1, \$2\) OR \(status = \$3 AND claimedAt < \$4\)\)\s+AND attempts < \$5 AND purgeAt <= \$6`).
+		WithArgs(StatusScheduled, StatusFailed, StatusRunning, leaseExpiry{}, maxAttempts, sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "userId", "storageKey", "status", "step", "error", "attempts", "purgeAt", "createdAt", "completedAt", "claimedAt"}).
+			AddRow(1, 2, "key", StatusRunning, StepObjects, "", 1, time.Now().Add(-time.Hour), time.Now().Add(-time.Hour), nil, time.Now().Add(-time.Hour)))
+
+	deletions, err := store.GetDueDeletions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(deletions) != 1 || deletions[0].Status != StatusRunning || deletions[0].ClaimedAt == nil {
+		t.Errorf("expected the stalled deletion, got %+v", deletions)
+	}
+}
+
+func TestCancelDeletion(t *testing.T) {
+	store, mock := newMockStore(t)
+	mock.ExpectExec("UPDATE account_deletions SET status").WithArgs(StatusCancelled, 1, StatusScheduled).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	if err := store.CancelDeletion(1); err == nil {
+		t.Error("expected an error when no deletion is scheduled")
+	}
+}
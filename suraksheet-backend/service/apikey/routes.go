@@ -0,0 +1,120 @@
+package apikey
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/LikheKeto/Suraksheet/service/auth"
+	"github.com/LikheKeto/Suraksheet/types"
+	"github.com/LikheKeto/Suraksheet/utils"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-playground/validator/v10"
+)
+
+type Handler struct {
+	store        types.APIKeyStore
+	userStore    types.UserStore
+	sessionStore types.SessionStore
+}
+
+func NewHandler(store types.APIKeyStore, userStore types.UserStore, sessionStore types.SessionStore) *Handler {
+	return &Handler{store: store, userStore: userStore, sessionStore: sessionStore}
+}
+
+// RegisterRoutes only accepts JWTs, so an API key can't be used to mint more keys.
+func (h *Handler) RegisterRoutes(router chi.Router) {
+	router.MethodFunc(http.MethodGet, "/api-keys", auth.WithJWTAuth(h.handleGetAPIKeys, h.userStore, h.sessionStore))
+	router.MethodFunc(http.MethodPost, "/api-keys", auth.WithJWTAuth(h.handleCreateAPIKey, h.userStore, h.sessionStore))
+	router.MethodFunc(http.MethodDelete, "/api-keys/{keyID}", auth.WithJWTAuth(h.handleRevokeAPIKey, h.userStore, h.sessionStore))
+}
+
+func (h *Handler) handleGetAPIKeys(w http.ResponseWriter, r *http.Request) {
+	user, err := auth.ExtractUserFromContext(r)
+	if err != nil {
+		utils.WriteError(w, http.StatusForbidden, err)
+		return
+	}
+	keys, err := h.store.GetAPIKeysByUser(user.ID)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, keys)
+}
+
+func (h *Handler) handleCreateAPIKey(w http.ResponseWriter, r *http.Request) {
+	user, err := auth.ExtractUserFromContext(r)
+	if err != nil {
+		utils.WriteError(w, http.StatusForbidden, err)
+		return
+	}
+	var payload types.CreateAPIKeyPayload
+	if err := utils.ParseJSON(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	if err := utils.Validate.Struct(payload); err != nil {
+		errors := err.(validator.ValidationErrors)
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid payload %v", errors))
+		return
+	}
+	if payload.ExpiresAt != nil {
+		if !payload.ExpiresAt.After(time.Now()) {
+			utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("expiry must be in the future"))
+			return
+		}
+		expiresAt := payload.ExpiresAt.UTC()
+		payload.ExpiresAt = &expiresAt
+	}
+
+	secret, prefix, err := auth.CreateAPIKey()
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	key, err := h.store.CreateAPIKey(types.APIKey{
+		UserID:    user.ID,
+		Name:      payload.Name,
+		Prefix:    prefix,
+		Key:       utils.HashString(secret),
+		Scope:     payload.Scope,
+		ExpiresAt: payload.ExpiresAt,
+	})
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	// the key itself is only ever shown in this response
+	utils.WriteJSON(w, http.StatusCreated, map[string]any{"apiKey": key, "key": secret})
+}
+
+func (h *Handler) handleRevokeAPIKey(w http.ResponseWriter, r *http.Request) {
+	user, err := auth.ExtractUserFromContext(r)
+	if err != nil {
+		utils.WriteError(w, http.StatusForbidden, err)
+		return
+	}
+	keyIDStr := chi.URLParam(r, "keyID")
+	keyID, err := strconv.Atoi(keyIDStr)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid api key %s", keyIDStr))
+		return
+	}
+	key, err := h.store.GetAPIKeyByID(keyID)
+	if err != nil {
+		utils.WriteError(w, http.StatusNotFound, err)
+		return
+	}
+	if key.UserID != user.ID {
+		utils.WriteError(w, http.StatusForbidden, fmt.Errorf("api key doesn't belong to user"))
+		return
+	}
+	if err := h.store.RevokeAPIKey(key.ID); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	utils.WriteJSON(w, http.StatusNoContent, nil)
+}
@@ -0,0 +1,99 @@
+package apikey
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/LikheKeto/Suraksheet/types"
+)
+
+type Store struct {
+	db *sql.DB
+}
+
+func NewStore(db *sql.DB) *Store {
+	return &Store{
+		db: db,
+	}
+}
+
+func (s *Store) CreateAPIKey(key types.APIKey) (*types.APIKey, error) {
+	row := s.db.QueryRow(`
+		INSERT INTO api_keys (userId, name, prefix, key, scope, expiresAt)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING *;
+	`, key.UserID, key.Name, key.Prefix, key.Key, key.Scope, key.ExpiresAt)
+	return scanRowIntoAPIKey(row)
+}
+
+func (s *Store) GetAPIKeysByUser(userID int) ([]types.APIKey, error) {
+	rows, err := s.db.Query(`
+		SELECT * FROM api_keys
+		WHERE userId = $1 AND revokedAt IS NULL
+		ORDER BY createdAt DESC;
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := make([]types.APIKey, 0)
+	for rows.Next() {
+		key, err := scanRowIntoAPIKey(rows)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, *key)
+	}
+	return keys, nil
+}
+
+func (s *Store) GetAPIKeyByID(id int) (*types.APIKey, error) {
+	row := s.db.QueryRow("SELECT * FROM api_keys WHERE id = $1;", id)
+	return scanRowIntoAPIKey(row)
+}
+
+func (s *Store) GetAPIKeyByKey(key string) (*types.APIKey, error) {
+	row := s.db.QueryRow("SELECT * FROM api_keys WHERE key = $1;", key)
+	return scanRowIntoAPIKey(row)
+}
+
+// TouchAPIKey records that the key was used. Like sessions, the write is
+// skipped if it happened within the last minute.
+func (s *Store) TouchAPIKey(id int) error {
+	_, err := s.db.Exec(`
+		UPDATE api_keys SET lastUsedAt = CURRENT_TIMESTAMP
+		WHERE id = $1 AND (lastUsedAt IS NULL OR lastUsedAt < CURRENT_TIMESTAMP - INTERVAL '1 minute');
+	`, id)
+	return err
+}
+
+func (s *Store) RevokeAPIKey(id int) error {
+	_, err := s.db.Exec("UPDATE api_keys SET revokedAt = CURRENT_TIMESTAMP WHERE id = $1 AND revokedAt IS NULL;", id)
+	return err
+}
+
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+func scanRowIntoAPIKey(row scanner) (*types.APIKey, error) {
+	key := new(types.APIKey)
+	err := row.Scan(&key.ID,
+		&key.UserID,
+		&key.Name,
+		&key.Prefix,
+		&key.Key,
+		&key.Scope,
+		&key.ExpiresAt,
+		&key.LastUsedAt,
+		&key.RevokedAt,
+		&key.CreatedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("api key not found")
+		}
+		return nil, err
+	}
+	return key, nil
+}
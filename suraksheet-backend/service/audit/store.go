@@ -0,0 +1,30 @@
+package audit
+
+import (
+	"database/sql"
+
+	"github.com/LikheKeto/Suraksheet/types"
+)
+
+const (
+	EventAccountLocked = "login.account_locked"
+	EventIPLocked      = "login.ip_locked"
+)
+
+type Store struct {
+	db *sql.DB
+}
+
+func NewStore(db *sql.DB) *Store {
+	return &Store{
+		db: db,
+	}
+}
+
+func (s *Store) CreateAuditEntry(entry types.AuditEntry) error {
+	_, err := s.db.Exec(`
+		INSERT INTO audit_log (userId, event, detail, ipAddress)
+		VALUES ($1, $2, $3, $4);
+	`, entry.UserID, entry.Event, entry.Detail, entry.IPAddress)
+	return err
+}
@@ -0,0 +1,64 @@
+package auth
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/LikheKeto/Suraksheet/types"
+	"github.com/LikheKeto/Suraksheet/utils"
+)
+
+// apiKeyPrefix tells API keys apart from JWTs in the Authorization header.
+const apiKeyPrefix = "srk_"
+
+// CreateAPIKey returns a new API key and the short prefix shown to the user
+// to recognise it later. Only the hash of the key is stored.
+func CreateAPIKey() (string, string, error) {
+	token, err := randomToken(24)
+	if err != nil {
+		return "", "", err
+	}
+	return apiKeyPrefix + token, token[:8], nil
+}
+
+// WithJWTOrAPIKeyAuth works like WithJWTAuth but also lets scripts
+// authenticate with a personal API key, as long as the key's scope covers the
+// scope the route needs.
+func WithJWTOrAPIKeyAuth(handlerFunc http.HandlerFunc, scope string, store types.UserStore, sessionStore types.SessionStore, apiKeyStore types.APIKeyStore) http.HandlerFunc {
+	withJWT := WithJWTAuth(handlerFunc, store, sessionStore)
+	return func(w http.ResponseWriter, r *http.Request) {
+		tokenString := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !strings.HasPrefix(tokenString, apiKeyPrefix) {
+			withJWT(w, r)
+			return
+		}
+
+		key, err := apiKeyStore.GetAPIKeyByKey(utils.HashString(tokenString))
+		if err != nil || !key.Active() {
+			permissionDenied(w)
+			return
+		}
+		if !key.Allows(scope) {
+			log.Printf("api key %d with scope %s used on route needing %s", key.ID, key.Scope, scope)
+			permissionDenied(w)
+			return
+		}
+		if err := apiKeyStore.TouchAPIKey(key.ID); err != nil {
+			log.Printf("failed to update api key usage: %v", err)
+		}
+
+		u, err := store.GetUserByID(key.UserID)
+		if err != nil {
+			permissionDenied(w)
+			return
+		}
+
+		ctx := r.Context()
+		ctx = context.WithValue(ctx, user, u)
+		r = r.WithContext(ctx)
+
+		handlerFunc(w, r)
+	}
+}
@@ -0,0 +1,33 @@
+package auth
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/LikheKeto/Suraksheet/types"
+)
+
+func TestCreateAPIKey(t *testing.T) {
+	key, prefix, err := CreateAPIKey()
+	if err != nil {
+		t.Fatalf("error creating api key: %v", err)
+	}
+	if !strings.HasPrefix(key, apiKeyPrefix+prefix) {
+		t.Errorf("expected key %s to start with its prefix %s", key, prefix)
+	}
+}
+
+func TestAPIKeyScopes(t *testing.T) {
+	read := types.APIKey{Scope: types.APIKeyScopeRead}
+	if !read.Allows(types.APIKeyScopeRead) || read.Allows(types.APIKeyScopeUpload) || read.Allows(types.APIKeyScopeFull) {
+		t.Error("expected read-only key to only allow reads")
+	}
+	upload := types.APIKey{Scope: types.APIKeyScopeUpload}
+	if upload.Allows(types.APIKeyScopeRead) || !upload.Allows(types.APIKeyScopeUpload) {
+		t.Error("expected upload-only key to only allow uploads")
+	}
+	full := types.APIKey{Scope: types.APIKeyScopeFull}
+	if !full.Allows(types.APIKeyScopeRead) || !full.Allows(types.APIKeyScopeUpload) || !full.Allows(types.APIKeyScopeFull) {
+		t.Error("expected full key to allow everything")
+	}
+}
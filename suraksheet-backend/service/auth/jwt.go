@@ -16,30 +16,50 @@ import (
 )
 
 var user = new(types.User)
+var session = new(types.Session)
 
-func CreateJWT(secret []byte, userID int) (string, error) {
-	expiration := time.Hour * 24 * 30
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+func CreateJWT(userID int, sessionID int) (string, error) {
+	expiration := time.Second * time.Duration(config.Envs.JWTExpirationInSeconds)
+	return Keys.Sign(jwt.MapClaims{
 		"userID":    strconv.Itoa(userID),
-		"expiredAt": time.Now().Add(expiration).Unix(),
+		"sessionID": strconv.Itoa(sessionID),
+		"exp":       time.Now().Add(expiration).Unix(),
 	})
-	tokenString, err := token.SignedString(secret)
+}
+
+// CreateChallengeJWT issues a short-lived token proving that the user passed
+// the password step of login. It carries no session, so WithJWTAuth rejects it.
+func CreateChallengeJWT(userID int) (string, error) {
+	return Keys.Sign(jwt.MapClaims{
+		"userID":  strconv.Itoa(userID),
+		"purpose": "2fa",
+		"exp":     time.Now().Add(time.Minute * 5).Unix(),
+	})
+}
+
+// ValidateChallengeJWT returns the ID of the user a challenge token was issued to.
+func ValidateChallengeJWT(tokenString string) (int, error) {
+	token, err := ValidateJWT(tokenString)
+	if err != nil || !token.Valid {
+		return 0, fmt.Errorf("invalid or expired challenge")
+	}
+	claims := token.Claims.(jwt.MapClaims)
+	if purpose, _ := claims["purpose"].(string); purpose != "2fa" {
+		return 0, fmt.Errorf("invalid or expired challenge")
+	}
+	str, _ := claims["userID"].(string)
+	userID, err := strconv.Atoi(str)
 	if err != nil {
-		return "", err
+		return 0, fmt.Errorf("invalid or expired challenge")
 	}
-	return tokenString, nil
+	return userID, nil
 }
 
 func ValidateJWT(token string) (*jwt.Token, error) {
-	return jwt.Parse(token, func(t *jwt.Token) (interface{}, error) {
-		if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("unexpected signing method: %v", t.Header["alg"])
-		}
-		return []byte(config.Envs.JWTSecret), nil
-	})
+	return Keys.Parse(token)
 }
 
-func WithJWTAuth(handlerFunc http.HandlerFunc, store types.UserStore) http.HandlerFunc {
+func WithJWTAuth(handlerFunc http.HandlerFunc, store types.UserStore, sessionStore types.SessionStore) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		// get the token from Authentication headers
 		split := strings.Split(r.Header.Get("Authorization"), "Bearer ")
@@ -73,6 +93,26 @@ func WithJWTAuth(handlerFunc http.HandlerFunc, store types.UserStore) http.Handl
 			return
 		}
 
+		// reject tokens whose session has been revoked or has expired
+		str, ok = claims["sessionID"].(string)
+		if !ok {
+			permissionDenied(w)
+			return
+		}
+		sessionID, err := strconv.Atoi(str)
+		if err != nil {
+			permissionDenied(w)
+			return
+		}
+		s, err := sessionStore.GetSessionByID(sessionID)
+		if err != nil || s.UserID != userID || !s.Active() {
+			permissionDenied(w)
+			return
+		}
+		if err := sessionStore.TouchSession(s.ID); err != nil {
+			log.Printf("failed to update session activity: %v", err)
+		}
+
 		u, err := store.GetUserByID(userID)
 		if err != nil {
 			permissionDenied(w)
@@ -82,12 +122,52 @@ func WithJWTAuth(handlerFunc http.HandlerFunc, store types.UserStore) http.Handl
 		// set context "userID" value
 		ctx := r.Context()
 		ctx = context.WithValue(ctx, user, u)
+		ctx = context.WithValue(ctx, session, s)
 		r = r.WithContext(ctx)
 
 		handlerFunc(w, r)
 	}
 }
 
+// RequireVerifiedEmail restricts a handler wrapped by WithJWTAuth to users
+// who have verified their email address.
+func RequireVerifiedEmail(handlerFunc http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		u, err := ExtractUserFromContext(r)
+		if err != nil {
+			permissionDenied(w)
+			return
+		}
+		if !u.EmailVerified {
+			utils.WriteError(w, http.StatusForbidden, fmt.Errorf("email address has not been verified"))
+			return
+		}
+		handlerFunc(w, r)
+	}
+}
+
+// RequireAdmin lets through only users whose verified email address is one
+// of the configured admin addresses.
+func RequireAdmin(handlerFunc http.HandlerFunc) http.HandlerFunc {
+	return RequireVerifiedEmail(func(w http.ResponseWriter, r *http.Request) {
+		u, err := ExtractUserFromContext(r)
+		if err != nil || !IsAdmin(u) {
+			permissionDenied(w)
+			return
+		}
+		handlerFunc(w, r)
+	})
+}
+
+func IsAdmin(u *types.User) bool {
+	for _, email := range strings.Split(config.Envs.AdminEmails, ",") {
+		if email = strings.TrimSpace(email); email != "" && strings.EqualFold(email, u.Email) {
+			return true
+		}
+	}
+	return false
+}
+
 func ExtractUserFromContext(r *http.Request) (*types.User, error) {
 	usr := r.Context().Value(user)
 	if usr == nil {
@@ -100,6 +180,14 @@ func ExtractUserFromContext(r *http.Request) (*types.User, error) {
 	}
 }
 
+func ExtractSessionFromContext(r *http.Request) (*types.Session, error) {
+	s, ok := r.Context().Value(session).(*types.Session)
+	if !ok {
+		return nil, fmt.Errorf("permission denied")
+	}
+	return s, nil
+}
+
 func permissionDenied(w http.ResponseWriter) {
 	utils.WriteError(w, http.StatusForbidden, fmt.Errorf("permission denied"))
 }
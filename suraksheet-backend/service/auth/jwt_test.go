@@ -1,11 +1,16 @@
 package auth
 
-import "testing"
+import (
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
 
 func TestCreateJWT(t *testing.T) {
-	secret := []byte("secret")
+	Keys.Set(NewHMACKey("test", []byte("secret")), []*SigningKey{NewHMACKey("test", []byte("secret"))})
 
-	token, err := CreateJWT(secret, 1)
+	token, err := CreateJWT(1, 1)
 	if err != nil {
 		t.Errorf("error creating JWT: %v", err)
 	}
@@ -13,3 +18,50 @@ func TestCreateJWT(t *testing.T) {
 		t.Error("expected token to be not empty")
 	}
 }
+
+func TestValidateJWT(t *testing.T) {
+	key := NewHMACKey("test", []byte("secret"))
+	Keys.Set(key, []*SigningKey{key})
+
+	t.Run("should accept a fresh token", func(t *testing.T) {
+		token, err := CreateJWT(1, 2)
+		if err != nil {
+			t.Fatalf("error creating JWT: %v", err)
+		}
+		parsed, err := ValidateJWT(token)
+		if err != nil {
+			t.Fatalf("expected token to be valid, got %v", err)
+		}
+		claims := parsed.Claims.(jwt.MapClaims)
+		if claims["sessionID"] != "2" {
+			t.Errorf("expected sessionID claim to be 2, got %v", claims["sessionID"])
+		}
+	})
+
+	t.Run("should reject an expired token", func(t *testing.T) {
+		token, err := Keys.Sign(jwt.MapClaims{
+			"userID":    "1",
+			"sessionID": "1",
+			"exp":       time.Now().Add(-time.Minute).Unix(),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := ValidateJWT(token); err == nil {
+			t.Error("expected expired token to be rejected")
+		}
+	})
+
+	t.Run("should reject a token without expiry", func(t *testing.T) {
+		token, err := Keys.Sign(jwt.MapClaims{
+			"userID":    "1",
+			"sessionID": "1",
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := ValidateJWT(token); err == nil {
+			t.Error("expected token without exp to be rejected")
+		}
+	})
+}
@@ -0,0 +1,227 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	AlgorithmHS256 = "HS256"
+	AlgorithmRS256 = "RS256"
+	AlgorithmEdDSA = "EdDSA"
+)
+
+// Keys holds the keys every token of the API is signed and verified with. It
+// is filled at startup, see jwtkey.Rotator.
+var Keys = NewKeySet()
+
+// SigningKey is a key identified by the kid header of the tokens it signs.
+type SigningKey struct {
+	ID        string
+	Algorithm string
+	Private   any
+	Public    any
+	// ValidUntil is when a superseded key stops being accepted. It is zero
+	// for the key currently used for signing.
+	ValidUntil time.Time
+}
+
+// GenerateSigningKey creates a random key for the given algorithm.
+func GenerateSigningKey(algorithm string) (*SigningKey, error) {
+	id, err := randomToken(8)
+	if err != nil {
+		return nil, err
+	}
+	switch algorithm {
+	case AlgorithmHS256:
+		secret := make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			return nil, err
+		}
+		return NewHMACKey(id, secret), nil
+	case AlgorithmRS256:
+		private, err := rsa.GenerateKey(rand.Reader, 2048)
+		if err != nil {
+			return nil, err
+		}
+		return &SigningKey{ID: id, Algorithm: algorithm, Private: private, Public: &private.PublicKey}, nil
+	case AlgorithmEdDSA:
+		public, private, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+		return &SigningKey{ID: id, Algorithm: algorithm, Private: private, Public: public}, nil
+	}
+	return nil, fmt.Errorf("unsupported signing algorithm %s", algorithm)
+}
+
+func NewHMACKey(id string, secret []byte) *SigningKey {
+	return &SigningKey{ID: id, Algorithm: AlgorithmHS256, Private: secret, Public: secret}
+}
+
+// MarshalPrivateKey encodes the private part of key for storage.
+func MarshalPrivateKey(key *SigningKey) ([]byte, error) {
+	if key.Algorithm == AlgorithmHS256 {
+		return key.Private.([]byte), nil
+	}
+	return x509.MarshalPKCS8PrivateKey(key.Private)
+}
+
+// ParseSigningKey is the inverse of MarshalPrivateKey.
+func ParseSigningKey(id, algorithm string, der []byte) (*SigningKey, error) {
+	if algorithm == AlgorithmHS256 {
+		return NewHMACKey(id, der), nil
+	}
+	private, err := x509.ParsePKCS8PrivateKey(der)
+	if err != nil {
+		return nil, err
+	}
+	key := &SigningKey{ID: id, Algorithm: algorithm, Private: private}
+	switch k := private.(type) {
+	case *rsa.PrivateKey:
+		if algorithm != AlgorithmRS256 {
+			return nil, fmt.Errorf("key %s isn't an %s key", id, algorithm)
+		}
+		key.Public = &k.PublicKey
+	case ed25519.PrivateKey:
+		if algorithm != AlgorithmEdDSA {
+			return nil, fmt.Errorf("key %s isn't an %s key", id, algorithm)
+		}
+		key.Public = k.Public()
+	default:
+		return nil, fmt.Errorf("unsupported private key type %T", private)
+	}
+	return key, nil
+}
+
+// KeySet signs tokens with its current key and verifies them with any key
+// that hasn't been retired yet.
+type KeySet struct {
+	mu      sync.RWMutex
+	current *SigningKey
+	keys    map[string]*SigningKey
+
+	// refresh is called when a token names an unknown key, which happens
+	// when another replica rotated first
+	refresh     func() error
+	lastRefresh time.Time
+}
+
+func NewKeySet() *KeySet {
+	return &KeySet{keys: make(map[string]*SigningKey)}
+}
+
+// Set replaces the keys of the set. current must be one of keys.
+func (ks *KeySet) Set(current *SigningKey, keys []*SigningKey) {
+	m := make(map[string]*SigningKey, len(keys))
+	for _, key := range keys {
+		m[key.ID] = key
+	}
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+	ks.current = current
+	ks.keys = m
+}
+
+func (ks *KeySet) SetRefresh(refresh func() error) {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+	ks.refresh = refresh
+}
+
+func (ks *KeySet) Sign(claims jwt.MapClaims) (string, error) {
+	ks.mu.RLock()
+	key := ks.current
+	ks.mu.RUnlock()
+	if key == nil {
+		return "", fmt.Errorf("no signing key available")
+	}
+	token := jwt.NewWithClaims(jwt.GetSigningMethod(key.Algorithm), claims)
+	token.Header["kid"] = key.ID
+	return token.SignedString(key.Private)
+}
+
+// Parse validates a token signed by one of the keys of the set.
+func (ks *KeySet) Parse(tokenString string) (*jwt.Token, error) {
+	return jwt.Parse(tokenString, ks.keyFunc,
+		jwt.WithValidMethods([]string{AlgorithmHS256, AlgorithmRS256, AlgorithmEdDSA}),
+		jwt.WithExpirationRequired())
+}
+
+func (ks *KeySet) keyFunc(t *jwt.Token) (interface{}, error) {
+	kid, _ := t.Header["kid"].(string)
+	key := ks.lookup(kid)
+	if key == nil && ks.tryRefresh() {
+		key = ks.lookup(kid)
+	}
+	if key == nil {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+	if t.Method.Alg() != key.Algorithm {
+		return nil, fmt.Errorf("unexpected signing method: %v", t.Header["alg"])
+	}
+	if !key.ValidUntil.IsZero() && time.Now().After(key.ValidUntil) {
+		return nil, fmt.Errorf("signing key %q has been retired", kid)
+	}
+	return key.Public, nil
+}
+
+func (ks *KeySet) lookup(kid string) *SigningKey {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+	return ks.keys[kid]
+}
+
+// tryRefresh reloads the keys at most every few seconds, so tokens with made
+// up key IDs can't be used to hammer the store.
+func (ks *KeySet) tryRefresh() bool {
+	ks.mu.Lock()
+	refresh := ks.refresh
+	if refresh == nil || time.Since(ks.lastRefresh) < 10*time.Second {
+		ks.mu.Unlock()
+		return false
+	}
+	ks.lastRefresh = time.Now()
+	ks.mu.Unlock()
+	return refresh() == nil
+}
+
+// JWKS returns the public keys of the set as a JSON Web Key Set. HMAC keys
+// are secret and left out.
+func (ks *KeySet) JWKS() map[string]any {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+	keys := make([]map[string]string, 0, len(ks.keys))
+	for _, key := range ks.keys {
+		switch public := key.Public.(type) {
+		case *rsa.PublicKey:
+			keys = append(keys, map[string]string{
+				"kty": "RSA",
+				"kid": key.ID,
+				"use": "sig",
+				"alg": key.Algorithm,
+				"n":   base64.RawURLEncoding.EncodeToString(public.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes()),
+			})
+		case ed25519.PublicKey:
+			keys = append(keys, map[string]string{
+				"kty": "OKP",
+				"kid": key.ID,
+				"use": "sig",
+				"alg": key.Algorithm,
+				"crv": "Ed25519",
+				"x":   base64.RawURLEncoding.EncodeToString(public),
+			})
+		}
+	}
+	return map[string]any{"keys": keys}
+}
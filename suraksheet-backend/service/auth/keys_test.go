@@ -0,0 +1,88 @@
+package auth
+
+import (
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestKeySet(t *testing.T) {
+	claims := func() jwt.MapClaims {
+		return jwt.MapClaims{"userID": "1", "exp": time.Now().Add(time.Minute).Unix()}
+	}
+
+	for _, algorithm := range []string{AlgorithmHS256, AlgorithmRS256, AlgorithmEdDSA} {
+		t.Run("should sign and verify with "+algorithm, func(t *testing.T) {
+			key, err := GenerateSigningKey(algorithm)
+			if err != nil {
+				t.Fatal(err)
+			}
+			der, err := MarshalPrivateKey(key)
+			if err != nil {
+				t.Fatal(err)
+			}
+			parsed, err := ParseSigningKey(key.ID, algorithm, der)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			ks := NewKeySet()
+			ks.Set(parsed, []*SigningKey{parsed})
+			token, err := ks.Sign(claims())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := ks.Parse(token); err != nil {
+				t.Errorf("expected token to be valid, got %v", err)
+			}
+
+			published := len(ks.JWKS()["keys"].([]map[string]string))
+			if algorithm == AlgorithmHS256 && published != 0 {
+				t.Error("expected hmac keys not to be published")
+			} else if algorithm != AlgorithmHS256 && published != 1 {
+				t.Errorf("expected 1 published key, got %d", published)
+			}
+		})
+	}
+
+	t.Run("should accept old keys until they retire", func(t *testing.T) {
+		old, _ := GenerateSigningKey(AlgorithmEdDSA)
+		ks := NewKeySet()
+		ks.Set(old, []*SigningKey{old})
+		token, err := ks.Sign(claims())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		current, _ := GenerateSigningKey(AlgorithmEdDSA)
+		old.ValidUntil = time.Now().Add(time.Hour)
+		ks.Set(current, []*SigningKey{current, old})
+		if _, err := ks.Parse(token); err != nil {
+			t.Errorf("expected token of overlapping key to be valid, got %v", err)
+		}
+
+		old.ValidUntil = time.Now().Add(-time.Second)
+		if _, err := ks.Parse(token); err == nil {
+			t.Error("expected token of retired key to be rejected")
+		}
+
+		ks.Set(current, []*SigningKey{current})
+		if _, err := ks.Parse(token); err == nil {
+			t.Error("expected token of unknown key to be rejected")
+		}
+	})
+
+	t.Run("should reject a token without key id", func(t *testing.T) {
+		key := NewHMACKey("test", []byte("secret"))
+		ks := NewKeySet()
+		ks.Set(key, []*SigningKey{key})
+		token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims()).SignedString([]byte("secret"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := ks.Parse(token); err == nil {
+			t.Error("expected token without kid to be rejected")
+		}
+	})
+}
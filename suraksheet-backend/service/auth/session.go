@@ -0,0 +1,91 @@
+package auth
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/LikheKeto/Suraksheet/config"
+	"github.com/LikheKeto/Suraksheet/types"
+	"github.com/LikheKeto/Suraksheet/utils"
+)
+
+// CreateRefreshToken returns a random opaque token. Only its hash is stored.
+func CreateRefreshToken() (string, error) {
+	return randomToken(32)
+}
+
+// CreateInvitationToken returns a random token for an invitation link. Only
+// its hash is stored.
+func CreateInvitationToken() (string, error) {
+	return randomToken(32)
+}
+
+func randomToken(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// StartSession creates a new session for the user logging in with r and
+// returns an access token and a refresh token for it.
+func StartSession(store types.SessionStore, userID int, r *http.Request) (string, string, error) {
+	refreshToken, err := CreateRefreshToken()
+	if err != nil {
+		return "", "", err
+	}
+	userAgent := r.UserAgent()
+	if len(userAgent) > 255 {
+		userAgent = userAgent[:255]
+	}
+	session, err := store.CreateSession(types.Session{
+		UserID:       userID,
+		RefreshToken: utils.HashString(refreshToken),
+		ExpiresAt:    refreshTokenExpiry(),
+		UserAgent:    userAgent,
+		IPAddress:    utils.ClientIP(r),
+	})
+	if err != nil {
+		return "", "", err
+	}
+	token, err := CreateJWT(userID, session.ID)
+	if err != nil {
+		return "", "", err
+	}
+	return token, refreshToken, nil
+}
+
+// RefreshSession exchanges a refresh token for a new access token. The refresh
+// token is rotated, so the one passed in cannot be used again.
+func RefreshSession(store types.SessionStore, refreshToken string) (string, string, error) {
+	hash := utils.HashString(refreshToken)
+	session, err := store.GetSessionByRefreshToken(hash)
+	if err != nil {
+		return "", "", fmt.Errorf("invalid refresh token")
+	}
+	if !session.Active() {
+		return "", "", fmt.Errorf("session has expired or was revoked")
+	}
+
+	newRefreshToken, err := CreateRefreshToken()
+	if err != nil {
+		return "", "", err
+	}
+	err = store.RotateRefreshToken(session.ID, hash, utils.HashString(newRefreshToken), refreshTokenExpiry())
+	if err != nil {
+		return "", "", err
+	}
+	token, err := CreateJWT(session.UserID, session.ID)
+	if err != nil {
+		return "", "", err
+	}
+	return token, newRefreshToken, nil
+}
+
+func refreshTokenExpiry() time.Time {
+	return time.Now().UTC().Add(time.Second * time.Duration(config.Envs.RefreshTokenExpirationInSeconds))
+}
@@ -0,0 +1,64 @@
+package auth
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/LikheKeto/Suraksheet/types"
+	"github.com/LikheKeto/Suraksheet/utils"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	PurposeVerifyEmail   = "verify-email"
+	PurposeResetPassword = "reset-password"
+	PurposeChangeEmail   = "change-email"
+)
+
+// CreateUserToken issues a signed token for a one-off action such as
+// verifying an email address. The token ID is recorded in the store so the
+// token can only be used once.
+func CreateUserToken(store types.UserStore, userID int, purpose string, ttl time.Duration) (string, error) {
+	id, err := randomToken(16)
+	if err != nil {
+		return "", err
+	}
+	expiresAt := time.Now().Add(ttl)
+	if err := store.CreateUserToken(userID, purpose, utils.HashString(id), expiresAt.UTC()); err != nil {
+		return "", err
+	}
+	return Keys.Sign(jwt.MapClaims{
+		"userID":  strconv.Itoa(userID),
+		"purpose": purpose,
+		"jti":     id,
+		"exp":     expiresAt.Unix(),
+	})
+}
+
+// ConsumeUserToken checks a token created by CreateUserToken for the given
+// purpose, marks it as used and returns the ID of the user it belongs to.
+func ConsumeUserToken(store types.UserStore, purpose string, tokenString string) (int, error) {
+	token, err := ValidateJWT(tokenString)
+	if err != nil || !token.Valid {
+		return 0, fmt.Errorf("invalid or expired token")
+	}
+	claims := token.Claims.(jwt.MapClaims)
+	if p, _ := claims["purpose"].(string); p != purpose {
+		return 0, fmt.Errorf("invalid or expired token")
+	}
+	id, _ := claims["jti"].(string)
+	str, _ := claims["userID"].(string)
+	userID, err := strconv.Atoi(str)
+	if err != nil || id == "" {
+		return 0, fmt.Errorf("invalid or expired token")
+	}
+	owner, err := store.UseUserToken(purpose, utils.HashString(id))
+	if err != nil {
+		return 0, err
+	}
+	if owner != userID {
+		return 0, fmt.Errorf("invalid or expired token")
+	}
+	return userID, nil
+}
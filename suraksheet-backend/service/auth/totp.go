@@ -0,0 +1,116 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/LikheKeto/Suraksheet/utils"
+)
+
+const (
+	totpIssuer = "Suraksheet"
+	totpDigits = 6
+	totpPeriod = 30
+	// number of periods before and after the current one that are accepted,
+	// to allow for clock drift on the user's device
+	totpSkew = 1
+)
+
+var totpEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// GenerateTOTPSecret returns a new base32 encoded secret for an authenticator app.
+func GenerateTOTPSecret() (string, error) {
+	b := make([]byte, 20)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return totpEncoding.EncodeToString(b), nil
+}
+
+// TOTPURI returns the otpauth URI that authenticator apps scan as a QR code.
+func TOTPURI(secret, email string) string {
+	v := url.Values{}
+	v.Set("secret", secret)
+	v.Set("issuer", totpIssuer)
+	v.Set("algorithm", "SHA1")
+	v.Set("digits", fmt.Sprint(totpDigits))
+	v.Set("period", fmt.Sprint(totpPeriod))
+	return fmt.Sprintf("otpauth://totp/%s:%s?%s", totpIssuer, url.PathEscape(email), v.Encode())
+}
+
+// TOTPCode computes the code for the given secret at time t as described in RFC 6238.
+func TOTPCode(secret string, t time.Time) (string, error) {
+	key, err := totpEncoding.DecodeString(strings.ToUpper(secret))
+	if err != nil {
+		return "", fmt.Errorf("invalid totp secret: %v", err)
+	}
+	return hotp(key, uint64(t.Unix()/totpPeriod)), nil
+}
+
+// ValidateTOTP reports whether code is valid for secret around time t, along
+// with the time step it belongs to. Callers record the step, so the code
+// can't be used again while it is still valid.
+func ValidateTOTP(secret, code string, t time.Time) (int64, bool) {
+	if secret == "" || len(code) != totpDigits {
+		return 0, false
+	}
+	key, err := totpEncoding.DecodeString(strings.ToUpper(secret))
+	if err != nil {
+		return 0, false
+	}
+	counter := t.Unix() / totpPeriod
+	for i := -totpSkew; i <= totpSkew; i++ {
+		expected := hotp(key, uint64(counter+int64(i)))
+		if subtle.ConstantTimeCompare([]byte(expected), []byte(code)) == 1 {
+			return counter + int64(i), true
+		}
+	}
+	return 0, false
+}
+
+func hotp(key []byte, counter uint64) string {
+	msg := make([]byte, 8)
+	binary.BigEndian.PutUint64(msg, counter)
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg)
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	mod := uint32(1)
+	for i := 0; i < totpDigits; i++ {
+		mod *= 10
+	}
+	return fmt.Sprintf("%0*d", totpDigits, value%mod)
+}
+
+// GenerateRecoveryCodes returns n single-use codes that can be used in place of
+// a TOTP code if the user loses their authenticator.
+func GenerateRecoveryCodes(n int) ([]string, error) {
+	codes := make([]string, n)
+	for i := range codes {
+		b := make([]byte, 5)
+		if _, err := rand.Read(b); err != nil {
+			return nil, err
+		}
+		code := hex.EncodeToString(b)
+		codes[i] = code[:5] + "-" + code[5:]
+	}
+	return codes, nil
+}
+
+// HashRecoveryCode normalises a recovery code as typed by the user and hashes
+// it for storage and lookup.
+func HashRecoveryCode(code string) string {
+	code = strings.ToLower(strings.ReplaceAll(strings.TrimSpace(code), "-", ""))
+	return utils.HashString(code)
+}
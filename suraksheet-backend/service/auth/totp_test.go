@@ -0,0 +1,64 @@
+package auth
+
+import (
+	"testing"
+	"time"
+)
+
+// secret "12345678901234567890" from the RFC 6238 test vectors, base32 encoded
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestTOTPCode(t *testing.T) {
+	tests := []struct {
+		unix int64
+		code string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+	}
+	for _, tt := range tests {
+		code, err := TOTPCode(rfcSecret, time.Unix(tt.unix, 0))
+		if err != nil {
+			t.Fatalf("error generating code: %v", err)
+		}
+		if code != tt.code {
+			t.Errorf("at %d expected code %s, got %s", tt.unix, tt.code, code)
+		}
+	}
+}
+
+func TestValidateTOTP(t *testing.T) {
+	now := time.Unix(1234567890, 0)
+	step, ok := ValidateTOTP(rfcSecret, "005924", now)
+	if !ok {
+		t.Error("expected current code to be valid")
+	}
+	if step != now.Unix()/totpPeriod {
+		t.Errorf("expected step %d, got %d", now.Unix()/totpPeriod, step)
+	}
+	// a code from the previous period belongs to that period's step
+	if late, ok := ValidateTOTP(rfcSecret, "005924", now.Add(totpPeriod*time.Second)); !ok || late != step {
+		t.Errorf("expected code from previous period to be accepted for step %d, got %d", step, late)
+	}
+	if _, ok := ValidateTOTP(rfcSecret, "005924", now.Add(3*totpPeriod*time.Second)); ok {
+		t.Error("expected stale code to be rejected")
+	}
+	if _, ok := ValidateTOTP("", "005924", now); ok {
+		t.Error("expected code to be rejected without a secret")
+	}
+}
+
+func TestRecoveryCodes(t *testing.T) {
+	codes, err := GenerateRecoveryCodes(10)
+	if err != nil {
+		t.Fatalf("error generating recovery codes: %v", err)
+	}
+	if len(codes) != 10 {
+		t.Fatalf("expected 10 codes, got %d", len(codes))
+	}
+	if HashRecoveryCode(codes[0]) != HashRecoveryCode(" "+codes[0][:5]+codes[0][6:]+" ") {
+		t.Error("expected hash to ignore dashes and surrounding spaces")
+	}
+}
@@ -0,0 +1,58 @@
+package bin
+
+import (
+	"testing"
+
+	"github.com/LikheKeto/Suraksheet/types"
+	"github.com/LikheKeto/Suraksheet/utils"
+)
+
+func TestEditBinPayloadValidation(t *testing.T) {
+	short, empty, color, badColor := "ab", "", "#1e90ff", "blue"
+	pinned := true
+	tests := []struct {
+		name    string
+		payload types.EditBinPayload
+		valid   bool
+	}{
+		{"nothing to change", types.EditBinPayload{Id: 1}, true},
+		{"pin only", types.EditBinPayload{Id: 1, Pinned: &pinned}, true},
+		{"short name", types.EditBinPayload{Id: 1, Name: &short}, false},
+		{"hex color", types.EditBinPayload{Id: 1, Color: &color}, true},
+		{"cleared color", types.EditBinPayload{Id: 1, Color: &empty}, true},
+		{"named color", types.EditBinPayload{Id: 1, Color: &badColor}, false},
+	}
+	for _, tt := range tests {
+		err := utils.Validate.Struct(tt.payload)
+		if (err == nil) != tt.valid {
+			t.Errorf("%s: expected valid %v, got %v", tt.name, tt.valid, err)
+		}
+	}
+}
+
+func TestWithoutArchived(t *testing.T) {
+	parent := func(id int) *int { return &id }
+	bins := []types.Bin{
+		{ID: 1, IsDefault: true},
+		{ID: 2, Archived: true},
+		{ID: 3, ParentID: parent(2)},
+		{ID: 4, ParentID: parent(3)},
+		{ID: 5},
+		{ID: 6, ParentID: parent(5)},
+		// the parent of a shared bin may not be listed
+		{ID: 7, ParentID: parent(99)},
+	}
+	got := make([]int, 0)
+	for _, bin := range withoutArchived(bins) {
+		got = append(got, bin.ID)
+	}
+	want := []int{1, 5, 6, 7}
+	if len(got) != len(want) {
+		t.Fatalf("expected bins %v, got %v", want, got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("expected bins %v, got %v", want, got)
+		}
+	}
+}
@@ -0,0 +1,134 @@
+package bin
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/LikheKeto/Suraksheet/service/auth"
+	"github.com/LikheKeto/Suraksheet/types"
+	"github.com/LikheKeto/Suraksheet/utils"
+	"github.com/go-chi/chi/v5"
+)
+
+type exportManifest struct {
+	Bin        types.Bin          `json:"bin"`
+	ExportedAt time.Time          `json:"exportedAt"`
+	Documents  []exportedDocument `json:"documents"`
+}
+
+type exportedDocument struct {
+	types.Document
+	// File is the name of the document's file in the archive
+	File string `json:"file"`
+}
+
+func (h *Handler) handleExportBin(w http.ResponseWriter, r *http.Request) {
+	user, err := auth.ExtractUserFromContext(r)
+	if err != nil {
+		utils.WriteError(w, http.StatusForbidden, err)
+		return
+	}
+	binIDStr := chi.URLParam(r, "binID")
+	binID, err := strconv.Atoi(binIDStr)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid bin %s", binIDStr))
+		return
+	}
+	bin, ok := h.permissions.Bin(w, user.ID, binID, types.RoleViewer)
+	if !ok {
+		return
+	}
+	storageKey, err := h.permissions.StorageKey(bin)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	documents, err := h.binDocuments(r.Context(), user.ID, bin, types.DocumentFilter{})
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	manifest := exportManifest{Bin: *bin, ExportedAt: time.Now(), Documents: make([]exportedDocument, 0, len(documents))}
+	taken := map[string]bool{"manifest.json": true}
+	for _, doc := range documents {
+		file := exportFileName(doc, taken)
+		taken[file] = true
+		manifest.Documents = append(manifest.Documents, exportedDocument{Document: doc, File: file})
+	}
+
+	// the archive is written straight to the response, one object at a time,
+	// so the status is sent before the objects are read; a failure after this
+	// point can only cut the download short
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", archiveName(bin.Name)))
+	w.WriteHeader(http.StatusOK)
+
+	archive := zip.NewWriter(w)
+	if err := writeManifest(archive, manifest); err != nil {
+		log.Printf("unable to export bin %d: %v", bin.ID, err)
+		return
+	}
+	for _, doc := range manifest.Documents {
+		objectName := path.Join(storageKey, strconv.Itoa(doc.BinID), utils.HashString(doc.ReferenceName))
+		if err := h.writeObject(r, archive, objectName, doc); err != nil {
+			log.Printf("unable to export document %d of bin %d: %v", doc.ID, bin.ID, err)
+			return
+		}
+	}
+	if err := archive.Close(); err != nil {
+		log.Printf("unable to export bin %d: %v", bin.ID, err)
+	}
+}
+
+func writeManifest(archive *zip.Writer, manifest exportManifest) error {
+	f, err := archive.CreateHeader(&zip.FileHeader{Name: "manifest.json", Method: zip.Deflate, Modified: manifest.ExportedAt})
+	if err != nil {
+		return err
+	}
+	encoder := json.NewEncoder(f)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(manifest)
+}
+
+func (h *Handler) writeObject(r *http.Request, archive *zip.Writer, objectName string, doc exportedDocument) error {
+	obj, err := utils.GetObject(r.Context(), h.minio, objectName)
+	if err != nil {
+		return err
+	}
+	defer obj.Close()
+	f, err := archive.CreateHeader(&zip.FileHeader{Name: doc.File, Method: zip.Deflate, Modified: doc.CreatedAt})
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(f, obj)
+	return err
+}
+
+// exportFileName names the document's file in the archive after its reference
+// name, keeping the extension of the uploaded file.
+func exportFileName(doc types.Document, taken map[string]bool) string {
+	name := strings.NewReplacer("/", "_", "\\", "_").Replace(doc.ReferenceName)
+	if name == "" || name == "." || name == ".." {
+		name = strconv.Itoa(doc.ID)
+	}
+	ext := path.Ext(doc.Name)
+	file := name + ext
+	for i := 2; taken[file]; i++ {
+		file = fmt.Sprintf("%s (%d)%s", name, i, ext)
+	}
+	return file
+}
+
+// archiveName is the file name offered for the bin's archive.
+func archiveName(binName string) string {
+	return utils.SafeFileName(binName) + ".zip"
+}
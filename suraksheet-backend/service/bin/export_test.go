@@ -0,0 +1,28 @@
+package bin
+
+import (
+	"testing"
+
+	"github.com/LikheKeto/Suraksheet/types"
+)
+
+func TestExportFileName(t *testing.T) {
+	taken := map[string]bool{"manifest.json": true}
+	tests := []struct {
+		doc  types.Document
+		want string
+	}{
+		{types.Document{ID: 1, ReferenceName: "Passport", Name: "scan.pdf"}, "Passport.pdf"},
+		{types.Document{ID: 2, ReferenceName: "Passport", Name: "other.pdf"}, "Passport (2).pdf"},
+		{types.Document{ID: 3, ReferenceName: "Bank/Statement", Name: "statement.png"}, "Bank_Statement.png"},
+		{types.Document{ID: 4, ReferenceName: "manifest", Name: "notes.json"}, "manifest (2).json"},
+		{types.Document{ID: 5, ReferenceName: "..", Name: "photo.jpg"}, "5.jpg"},
+	}
+	for _, tt := range tests {
+		got := exportFileName(tt.doc, taken)
+		if got != tt.want {
+			t.Errorf("document %d: expected %q, got %q", tt.doc.ID, tt.want, got)
+		}
+		taken[got] = true
+	}
+}
@@ -2,13 +2,16 @@ package bin
 
 import (
 	"fmt"
+	"log"
 	"net/http"
-	"path"
 	"strconv"
 
 	"github.com/LikheKeto/Suraksheet/service/auth"
+	"github.com/LikheKeto/Suraksheet/service/permission"
+	"github.com/LikheKeto/Suraksheet/service/template"
 	"github.com/LikheKeto/Suraksheet/types"
 	"github.com/LikheKeto/Suraksheet/utils"
+	"github.com/elastic/go-elasticsearch/v8"
 	"github.com/go-chi/chi/v5"
 	"github.com/go-playground/validator/v10"
 	"github.com/minio/minio-go/v7"
@@ -17,20 +20,38 @@ import (
 type Handler struct {
 	store         types.BinStore
 	userStore     types.UserStore
+	sessionStore  types.SessionStore
+	apiKeyStore   types.APIKeyStore
 	documentStore types.DocumentStore
+	templateStore types.TemplateStore
+	permissions   *permission.Checker
 	minio         *minio.Client
+	esClient      *elasticsearch.Client
 }
 
-func NewHandler(store types.BinStore, userStore types.UserStore, documentStore types.DocumentStore, minio *minio.Client) *Handler {
-	return &Handler{store: store, userStore: userStore, documentStore: documentStore, minio: minio}
+func NewHandler(store types.BinStore, userStore types.UserStore, sessionStore types.SessionStore, apiKeyStore types.APIKeyStore, documentStore types.DocumentStore, templateStore types.TemplateStore, permissions *permission.Checker, minio *minio.Client, esClient *elasticsearch.Client) *Handler {
+	return &Handler{store: store, userStore: userStore, sessionStore: sessionStore, apiKeyStore: apiKeyStore, documentStore: documentStore, templateStore: templateStore, permissions: permissions, minio: minio, esClient: esClient}
 }
 
 func (h *Handler) RegisterRoutes(router chi.Router) {
-	router.MethodFunc(http.MethodGet, "/bins/{binID}", auth.WithJWTAuth(h.handleGetDocumentsInBin, h.userStore))
-	router.MethodFunc(http.MethodGet, "/bins", auth.WithJWTAuth(h.handleGetBins, h.userStore))
-	router.MethodFunc(http.MethodPost, "/bins", auth.WithJWTAuth(h.handleCreateBin, h.userStore))
-	router.MethodFunc(http.MethodPatch, "/bins", auth.WithJWTAuth(h.handleEditBin, h.userStore))
-	router.MethodFunc(http.MethodDelete, "/bins", auth.WithJWTAuth(h.handleDeleteBin, h.userStore))
+	router.MethodFunc(http.MethodGet, "/bins/tree", h.withAuth(h.handleGetBinTree, types.APIKeyScopeRead))
+	router.MethodFunc(http.MethodGet, "/bins/{binID}/stats", h.withAuth(h.handleGetBinStats, types.APIKeyScopeRead))
+	router.MethodFunc(http.MethodGet, "/bins/{binID}/export", h.withAuth(h.handleExportBin, types.APIKeyScopeRead))
+	router.MethodFunc(http.MethodGet, "/bins/{binID}/path", h.withAuth(h.handleGetBinPath, types.APIKeyScopeRead))
+	router.MethodFunc(http.MethodGet, "/bins/{binID}", h.withAuth(h.handleGetDocumentsInBin, types.APIKeyScopeRead))
+	router.MethodFunc(http.MethodGet, "/bins", h.withAuth(h.handleGetBins, types.APIKeyScopeRead))
+	router.MethodFunc(http.MethodPost, "/bins", h.withAuth(h.handleCreateBin, types.APIKeyScopeFull))
+	router.MethodFunc(http.MethodGet, "/usage", h.withAuth(h.handleGetUsage, types.APIKeyScopeRead))
+	router.MethodFunc(http.MethodPut, "/bins/{binID}/query", h.withAuth(h.handleUpdateBinQuery, types.APIKeyScopeFull))
+	router.MethodFunc(http.MethodGet, "/bins/{binID}/slots", h.withAuth(h.handleGetSlots, types.APIKeyScopeRead))
+	router.MethodFunc(http.MethodPut, "/bins/{binID}/slots/{slotID}", h.withAuth(h.handleFillSlot, types.APIKeyScopeFull))
+	router.MethodFunc(http.MethodPost, "/bins/move", h.withAuth(h.handleMoveBin, types.APIKeyScopeFull))
+	router.MethodFunc(http.MethodPatch, "/bins", h.withAuth(h.handleEditBin, types.APIKeyScopeFull))
+	router.MethodFunc(http.MethodDelete, "/bins", h.withAuth(h.handleDeleteBin, types.APIKeyScopeFull))
+}
+
+func (h *Handler) withAuth(handlerFunc http.HandlerFunc, scope string) http.HandlerFunc {
+	return auth.WithJWTOrAPIKeyAuth(auth.RequireVerifiedEmail(handlerFunc), scope, h.userStore, h.sessionStore, h.apiKeyStore)
 }
 
 func (h *Handler) handleGetDocumentsInBin(w http.ResponseWriter, r *http.Request) {
@@ -45,16 +66,16 @@ func (h *Handler) handleGetDocumentsInBin(w http.ResponseWriter, r *http.Request
 		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid bin %s", binIDStr))
 		return
 	}
-	bin, err := h.store.GetBinById(BinID)
+	filter, err := utils.ParseDocumentFilter(r.URL.Query())
 	if err != nil {
 		utils.WriteError(w, http.StatusBadRequest, err)
 		return
 	}
-	if bin.OwnerID != user.ID {
-		utils.WriteError(w, http.StatusForbidden, fmt.Errorf("bin doesn't belong to user"))
+	bin, ok := h.permissions.Bin(w, user.ID, BinID, types.RoleViewer)
+	if !ok {
 		return
 	}
-	documents, err := h.documentStore.GetDocumentsInBin(BinID)
+	documents, err := h.binDocuments(r.Context(), user.ID, bin, filter)
 	if err != nil {
 		utils.WriteError(w, http.StatusInternalServerError, err)
 		return
@@ -68,11 +89,157 @@ func (h *Handler) handleGetBins(w http.ResponseWriter, r *http.Request) {
 		utils.WriteError(w, http.StatusForbidden, err)
 		return
 	}
-	bins, err := h.store.GetBinsByUser(user.ID)
+	bins, ok := h.listVisibleBins(w, r, user.ID)
+	if !ok {
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, bins)
+}
+
+// listVisibleBins returns what listBins does, leaving out archived bins and
+// the bins inside them unless the archived query parameter is true.
+func (h *Handler) listVisibleBins(w http.ResponseWriter, r *http.Request, userID int) ([]types.Bin, bool) {
+	includeArchived := false
+	if archivedStr := r.URL.Query().Get("archived"); archivedStr != "" {
+		var err error
+		if includeArchived, err = strconv.ParseBool(archivedStr); err != nil {
+			utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid archived %s", archivedStr))
+			return nil, false
+		}
+	}
+	bins, ok := h.listBins(w, r, userID)
+	if !ok || includeArchived {
+		return bins, ok
+	}
+	return withoutArchived(bins), true
+}
+
+// listBins returns the user's own bins, or the bins of the organization given
+// by the organization query parameter.
+func (h *Handler) listBins(w http.ResponseWriter, r *http.Request, userID int) ([]types.Bin, bool) {
+	var bins []types.Bin
+	var err error
+	if orgIDStr := r.URL.Query().Get("organization"); orgIDStr != "" {
+		orgID, convErr := strconv.Atoi(orgIDStr)
+		if convErr != nil {
+			utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid organization %s", orgIDStr))
+			return nil, false
+		}
+		if _, ok := h.permissions.Organization(w, userID, orgID, types.OrgRoleMember); !ok {
+			return nil, false
+		}
+		bins, err = h.store.GetBinsByOrganization(orgID)
+	} else {
+		bins, err = h.store.GetBinsByUser(userID)
+	}
 	if err != nil {
 		utils.WriteError(w, http.StatusInternalServerError, err)
+		return nil, false
+	}
+	return bins, true
+}
+
+// withoutArchived leaves out the archived bins and the bins inside them,
+// keeping the order of the rest.
+func withoutArchived(bins []types.Bin) []types.Bin {
+	byID := make(map[int]*types.Bin, len(bins))
+	for i := range bins {
+		byID[bins[i].ID] = &bins[i]
+	}
+	hidden := make(map[int]bool, len(bins))
+	var isHidden func(bin *types.Bin) bool
+	isHidden = func(bin *types.Bin) bool {
+		if hide, ok := hidden[bin.ID]; ok {
+			return hide
+		}
+		hide := bin.Archived
+		if !hide && bin.ParentID != nil {
+			if parent, ok := byID[*bin.ParentID]; ok {
+				hide = isHidden(parent)
+			}
+		}
+		hidden[bin.ID] = hide
+		return hide
+	}
+	visible := make([]types.Bin, 0, len(bins))
+	for i := range bins {
+		if !isHidden(&bins[i]) {
+			visible = append(visible, bins[i])
+		}
+	}
+	return visible
+}
+
+type binNode struct {
+	types.Bin
+	Children []*binNode `json:"children"`
+}
+
+// buildTree nests bins under their parents, keeping the order they came in.
+func buildTree(bins []types.Bin) []*binNode {
+	nodes := make(map[int]*binNode, len(bins))
+	for _, bin := range bins {
+		nodes[bin.ID] = &binNode{Bin: bin, Children: make([]*binNode, 0)}
+	}
+	roots := make([]*binNode, 0)
+	for _, bin := range bins {
+		node := nodes[bin.ID]
+		if bin.ParentID != nil {
+			if parent, ok := nodes[*bin.ParentID]; ok {
+				parent.Children = append(parent.Children, node)
+				continue
+			}
+		}
+		roots = append(roots, node)
+	}
+	return roots
+}
+
+func (h *Handler) handleGetBinTree(w http.ResponseWriter, r *http.Request) {
+	user, err := auth.ExtractUserFromContext(r)
+	if err != nil {
+		utils.WriteError(w, http.StatusForbidden, err)
+		return
+	}
+	bins, ok := h.listVisibleBins(w, r, user.ID)
+	if !ok {
 		return
 	}
+	utils.WriteJSON(w, http.StatusOK, buildTree(bins))
+}
+
+func (h *Handler) handleGetBinPath(w http.ResponseWriter, r *http.Request) {
+	user, err := auth.ExtractUserFromContext(r)
+	if err != nil {
+		utils.WriteError(w, http.StatusForbidden, err)
+		return
+	}
+	binIDStr := chi.URLParam(r, "binID")
+	binID, err := strconv.Atoi(binIDStr)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid bin %s", binIDStr))
+		return
+	}
+	if _, ok := h.permissions.Bin(w, user.ID, binID, types.RoleViewer); !ok {
+		return
+	}
+	bins, err := h.store.GetBinPath(binID)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	// people the bin is shared with only see the path from the shared bin down
+	for i := range bins {
+		role, err := h.permissions.Role(user.ID, &bins[i])
+		if err != nil {
+			utils.WriteError(w, http.StatusInternalServerError, err)
+			return
+		}
+		if role != "" {
+			bins = bins[i:]
+			break
+		}
+	}
 	utils.WriteJSON(w, http.StatusOK, bins)
 }
 
@@ -92,7 +259,40 @@ func (h *Handler) handleCreateBin(w http.ResponseWriter, r *http.Request) {
 		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid payload %v", errors))
 		return
 	}
-	bin, err := h.store.CreateBin(payload.Name, user.ID)
+	// bins created inside a shared or organization bin belong to the same
+	// owner as the rest of the tree
+	newBin := types.Bin{Name: payload.Name, OwnerID: user.ID, ParentID: payload.Parent, Query: payload.Query}
+	if payload.Parent != nil {
+		// a smart bin searches all documents of the owner, so only owners
+		// may add one
+		required := types.RoleEditor
+		if payload.Query != nil {
+			required = types.RoleOwner
+		}
+		parent, ok := h.permissions.Container(w, user.ID, *payload.Parent, required)
+		if !ok {
+			return
+		}
+		newBin.OwnerID = parent.OwnerID
+		newBin.OrganizationID = parent.OrganizationID
+	} else if payload.Organization != nil {
+		if _, ok := h.permissions.Organization(w, user.ID, *payload.Organization, types.OrgRoleMember); !ok {
+			return
+		}
+		newBin.OrganizationID = payload.Organization
+	}
+	var bin *types.Bin
+	if payload.Template != nil {
+		var tmpl *types.BinTemplate
+		tmpl, err = template.Owned(h.templateStore, user.ID, *payload.Template)
+		if err != nil {
+			utils.WriteError(w, http.StatusNotFound, err)
+			return
+		}
+		bin, err = h.store.CreateBinWithSlots(newBin, tmpl.Slots)
+	} else {
+		bin, err = h.store.CreateBin(newBin)
+	}
 	if err != nil {
 		utils.WriteError(w, http.StatusBadRequest, err)
 		return
@@ -116,9 +316,40 @@ func (h *Handler) handleEditBin(w http.ResponseWriter, r *http.Request) {
 		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid payload %v", errors))
 		return
 	}
-	err = h.store.UpdateBinName(payload.Id, user.ID, payload.Name)
+	bin, ok := h.permissions.Bin(w, user.ID, payload.Id, types.RoleEditor)
+	if !ok {
+		return
+	}
+	err = h.store.UpdateBin(bin.ID, payload)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("unable to update bin: %v", err))
+		return
+	}
+	utils.WriteJSON(w, http.StatusNoContent, nil)
+}
+
+func (h *Handler) handleMoveBin(w http.ResponseWriter, r *http.Request) {
+	user, err := auth.ExtractUserFromContext(r)
+	if err != nil {
+		utils.WriteError(w, http.StatusForbidden, err)
+		return
+	}
+	var payload types.MoveBinPayload
+	if err := utils.ParseJSON(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	if err := utils.Validate.Struct(payload); err != nil {
+		errors := err.(validator.ValidationErrors)
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid payload %v", errors))
+		return
+	}
+	if _, ok := h.permissions.Bin(w, user.ID, payload.Id, types.RoleOwner); !ok {
+		return
+	}
+	err = h.store.MoveBin(payload.Id, payload.Parent)
 	if err != nil {
-		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("unable to update name: %v", err))
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("unable to move bin: %v", err))
 		return
 	}
 	utils.WriteJSON(w, http.StatusNoContent, nil)
@@ -141,15 +372,30 @@ func (h *Handler) handleDeleteBin(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = utils.DeleteDir(r.Context(), h.minio, path.Join(utils.HashString(user.Email), strconv.Itoa(payload.Id)))
-	if err != nil {
-		utils.WriteError(w, http.StatusInternalServerError, fmt.Errorf("unable to delete bin: %v", err))
+	bin, ok := h.permissions.Bin(w, user.ID, payload.Id, types.RoleOwner)
+	if !ok {
+		return
 	}
 
-	err = h.store.DeleteBin(payload.Id, user.ID)
+	// the bin and everything in it go to the trash; the purge job deletes
+	// the objects once the retention period has passed
+	_, err = h.store.TrashBin(bin.ID, user.ID)
 	if err != nil {
 		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("unable to delete bin: %v", err))
 		return
 	}
+	binIDs, err := h.store.GetBinDescendantIDs(bin.ID)
+	if err == nil {
+		var docIDs []int
+		docIDs, err = h.documentStore.GetDocumentIDsInBins(binIDs)
+		if err == nil && len(docIDs) > 0 {
+			err = utils.DeleteFromIndex(r.Context(), h.esClient, map[string]interface{}{
+				"terms": map[string]interface{}{"document_id": docIDs},
+			})
+		}
+	}
+	if err != nil {
+		log.Printf("unable to remove documents of bin %d from search: %v", bin.ID, err)
+	}
 	utils.WriteJSON(w, http.StatusNoContent, nil)
 }
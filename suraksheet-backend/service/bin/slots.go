@@ -0,0 +1,85 @@
+package bin
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/LikheKeto/Suraksheet/service/auth"
+	"github.com/LikheKeto/Suraksheet/types"
+	"github.com/LikheKeto/Suraksheet/utils"
+	"github.com/go-chi/chi/v5"
+)
+
+// handleGetSlots lists the slots of a bin created from a template, and the
+// required ones no document has been put in yet.
+func (h *Handler) handleGetSlots(w http.ResponseWriter, r *http.Request) {
+	user, err := auth.ExtractUserFromContext(r)
+	if err != nil {
+		utils.WriteError(w, http.StatusForbidden, err)
+		return
+	}
+	binIDStr := chi.URLParam(r, "binID")
+	binID, err := strconv.Atoi(binIDStr)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid bin %s", binIDStr))
+		return
+	}
+	bin, ok := h.permissions.Bin(w, user.ID, binID, types.RoleViewer)
+	if !ok {
+		return
+	}
+	slots, err := h.store.GetBinSlots(bin.ID)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, types.BinSlots{Slots: slots, Missing: types.MissingSlots(slots)})
+}
+
+// handleFillSlot puts a document of the bin in one of its slots, or empties
+// the slot when no document is given.
+func (h *Handler) handleFillSlot(w http.ResponseWriter, r *http.Request) {
+	user, err := auth.ExtractUserFromContext(r)
+	if err != nil {
+		utils.WriteError(w, http.StatusForbidden, err)
+		return
+	}
+	binIDStr := chi.URLParam(r, "binID")
+	binID, err := strconv.Atoi(binIDStr)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid bin %s", binIDStr))
+		return
+	}
+	slotIDStr := chi.URLParam(r, "slotID")
+	slotID, err := strconv.Atoi(slotIDStr)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid slot %s", slotIDStr))
+		return
+	}
+	var payload types.FillSlotPayload
+	if err := utils.ParseJSON(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	bin, ok := h.permissions.Bin(w, user.ID, binID, types.RoleUploader)
+	if !ok {
+		return
+	}
+	if payload.Document != nil {
+		doc, _, ok := h.permissions.Document(w, user.ID, *payload.Document, types.RoleViewer)
+		if !ok {
+			return
+		}
+		if doc.BinID != bin.ID {
+			utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("document %d is not in this bin", doc.ID))
+			return
+		}
+	}
+	slot, err := h.store.FillBinSlot(bin.ID, slotID, payload.Document)
+	if err != nil {
+		utils.WriteError(w, http.StatusNotFound, err)
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, slot)
+}
@@ -0,0 +1,139 @@
+package bin
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/LikheKeto/Suraksheet/service/auth"
+	"github.com/LikheKeto/Suraksheet/service/permission"
+	"github.com/LikheKeto/Suraksheet/types"
+	"github.com/LikheKeto/Suraksheet/utils"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-playground/validator/v10"
+)
+
+// smartBinHits is how many of the best matches a smart bin shows.
+const smartBinHits = 500
+
+// binDocuments returns the documents in the bin, or those matching its query
+// for smart bins, that pass filter.
+func (h *Handler) binDocuments(ctx context.Context, userID int, bin *types.Bin, filter types.DocumentFilter) ([]types.Document, error) {
+	if !bin.IsSmart() {
+		return h.documentStore.GetDocumentsInBin(bin.ID, filter)
+	}
+	docIDs, err := utils.SearchDocuments(ctx, h.esClient, bin.Query.Text, smartBinFilter(bin, filter), smartBinHits)
+	if err != nil {
+		return nil, err
+	}
+	documents := make([]types.Document, 0)
+	if len(docIDs) == 0 {
+		return documents, nil
+	}
+	found, err := h.documentStore.FetchDocumentsFromDB(docIDs)
+	if err != nil {
+		return nil, err
+	}
+	byID := make(map[int]*types.Document, len(found))
+	for _, doc := range found {
+		byID[doc.ID] = doc
+	}
+	// the query searches all documents of the bin's owner; whoever the bin is
+	// shared with only sees those in bins shared with them too
+	readable := func(int) (bool, error) { return true, nil }
+	if bin.OrganizationID == nil && bin.OwnerID != userID {
+		readable = h.readableBins(userID)
+	}
+	for _, id := range docIDs {
+		doc, ok := byID[id]
+		if !ok {
+			continue
+		}
+		if ok, err := readable(doc.BinID); err != nil {
+			return nil, err
+		} else if ok {
+			documents = append(documents, *doc)
+		}
+	}
+	return documents, nil
+}
+
+// readableBins returns a function that reports whether the user can see the
+// documents in a bin, looking each bin up once.
+func (h *Handler) readableBins(userID int) func(binID int) (bool, error) {
+	seen := make(map[int]bool)
+	return func(binID int) (bool, error) {
+		if ok, found := seen[binID]; found {
+			return ok, nil
+		}
+		bin, err := h.store.GetBinById(binID)
+		if err != nil {
+			return false, err
+		}
+		role, err := h.permissions.Role(userID, bin)
+		if err != nil {
+			return false, err
+		}
+		seen[binID] = permission.Allows(role, types.RoleViewer)
+		return seen[binID], nil
+	}
+}
+
+// smartBinFilter restricts a smart bin's search to the documents of its
+// owner, narrowed down by the query's language and upload date and by the
+// metadata filter of the listing.
+func smartBinFilter(bin *types.Bin, metadata types.DocumentFilter) map[string]interface{} {
+	filters := append([]map[string]interface{}{utils.OwnerFilter(bin)}, utils.MetadataFilters(metadata)...)
+	query := bin.Query
+	if query.Language != "" {
+		filters = append(filters, map[string]interface{}{"term": map[string]interface{}{"language": query.Language}})
+	}
+	if query.CreatedAfter != nil || query.CreatedBefore != nil {
+		created := map[string]interface{}{}
+		if query.CreatedAfter != nil {
+			created["gte"] = query.CreatedAfter.Format(time.RFC3339)
+		}
+		if query.CreatedBefore != nil {
+			created["lt"] = query.CreatedBefore.Format(time.RFC3339)
+		}
+		filters = append(filters, map[string]interface{}{"range": map[string]interface{}{"created_at": created}})
+	}
+	return map[string]interface{}{"bool": map[string]interface{}{"filter": filters}}
+}
+
+func (h *Handler) handleUpdateBinQuery(w http.ResponseWriter, r *http.Request) {
+	user, err := auth.ExtractUserFromContext(r)
+	if err != nil {
+		utils.WriteError(w, http.StatusForbidden, err)
+		return
+	}
+	binIDStr := chi.URLParam(r, "binID")
+	binID, err := strconv.Atoi(binIDStr)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid bin %s", binIDStr))
+		return
+	}
+	var payload types.SmartBinQuery
+	if err := utils.ParseJSON(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	if err := utils.Validate.Struct(payload); err != nil {
+		errors := err.(validator.ValidationErrors)
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid payload %v", errors))
+		return
+	}
+	// the query decides which of the owner's documents the bin shows, so
+	// only owners may change it
+	bin, ok := h.permissions.Bin(w, user.ID, binID, types.RoleOwner)
+	if !ok {
+		return
+	}
+	if err := h.store.UpdateBinQuery(bin.ID, payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("unable to update query: %v", err))
+		return
+	}
+	utils.WriteJSON(w, http.StatusNoContent, nil)
+}
@@ -0,0 +1,77 @@
+package bin
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/LikheKeto/Suraksheet/service/permission"
+	"github.com/LikheKeto/Suraksheet/types"
+)
+
+func TestSmartBinFilter(t *testing.T) {
+	newYear := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	bin := &types.Bin{OwnerID: 7, Query: &types.SmartBinQuery{Text: "insurance", Language: "nep", CreatedAfter: &newYear}}
+	b, err := json.Marshal(smartBinFilter(bin, types.DocumentFilter{DocumentType: "insurance_policy"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	filter := string(b)
+	for _, want := range []string{
+		`{"term":{"user_id":7}}`,
+		`{"term":{"language":"nep"}}`,
+		`{"range":{"created_at":{"gte":"2024-01-01T00:00:00Z"}}}`,
+		`{"term":{"document_type.keyword":"insurance_policy"}}`,
+	} {
+		if !strings.Contains(filter, want) {
+			t.Errorf("expected %s in %s", want, filter)
+		}
+	}
+
+	b, _ = json.Marshal(smartBinFilter(&types.Bin{OwnerID: 7, Query: &types.SmartBinQuery{Text: "insurance"}}, types.DocumentFilter{}))
+	if strings.Contains(string(b), "language") || strings.Contains(string(b), "created_at") {
+		t.Errorf("expected only the owner filter, got %s", b)
+	}
+}
+
+type mockBinStore struct {
+	types.BinStore
+	bins map[int]*types.Bin
+}
+
+func (m *mockBinStore) GetBinById(id int) (*types.Bin, error) {
+	return m.bins[id], nil
+}
+
+type mockShareStore struct {
+	types.ShareStore
+	shared map[int]string
+}
+
+func (m *mockShareStore) GetBinRoles(binID int, userID int) ([]string, error) {
+	if role, ok := m.shared[binID]; ok {
+		return []string{role}, nil
+	}
+	return nil, nil
+}
+
+func TestReadableBins(t *testing.T) {
+	store := &mockBinStore{bins: map[int]*types.Bin{
+		1: {ID: 1, OwnerID: 1},
+		2: {ID: 2, OwnerID: 1},
+	}}
+	shares := &mockShareStore{shared: map[int]string{1: types.RoleViewer}}
+	h := &Handler{store: store, permissions: permission.NewChecker(store, nil, shares, nil, nil)}
+
+	readable := h.readableBins(2)
+	for binID, want := range map[int]bool{1: true, 2: false} {
+		got, err := readable(binID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Errorf("bin %d: expected readable %v, got %v", binID, want, got)
+		}
+	}
+}
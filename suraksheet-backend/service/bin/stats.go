@@ -0,0 +1,80 @@
+package bin
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/LikheKeto/Suraksheet/service/auth"
+	"github.com/LikheKeto/Suraksheet/types"
+	"github.com/LikheKeto/Suraksheet/utils"
+	"github.com/go-chi/chi/v5"
+)
+
+// handleGetBinStats adds up the documents in the bin and the bins nested in
+// it, or those matching a smart bin's query.
+func (h *Handler) handleGetBinStats(w http.ResponseWriter, r *http.Request) {
+	user, err := auth.ExtractUserFromContext(r)
+	if err != nil {
+		utils.WriteError(w, http.StatusForbidden, err)
+		return
+	}
+	binIDStr := chi.URLParam(r, "binID")
+	binID, err := strconv.Atoi(binIDStr)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid bin %s", binIDStr))
+		return
+	}
+	bin, ok := h.permissions.Bin(w, user.ID, binID, types.RoleViewer)
+	if !ok {
+		return
+	}
+	var stats *types.DocumentStats
+	if bin.IsSmart() {
+		var documents []types.Document
+		documents, err = h.binDocuments(r.Context(), user.ID, bin, types.DocumentFilter{})
+		stats = types.NewDocumentStats()
+		for _, doc := range documents {
+			var size int64
+			if doc.Size != nil {
+				size = *doc.Size
+			}
+			stats.Add(doc.ContentType, doc.Language, doc.ExtractionStatus, 1, size)
+		}
+	} else {
+		var binIDs []int
+		binIDs, err = h.store.GetBinDescendantIDs(bin.ID)
+		if err == nil {
+			stats, err = h.documentStore.GetDocumentStats(binIDs)
+		}
+	}
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, stats)
+}
+
+// handleGetUsage adds up the documents in the user's bins, or in the bins of
+// the organization given by the organization query parameter.
+func (h *Handler) handleGetUsage(w http.ResponseWriter, r *http.Request) {
+	user, err := auth.ExtractUserFromContext(r)
+	if err != nil {
+		utils.WriteError(w, http.StatusForbidden, err)
+		return
+	}
+	bins, ok := h.listBins(w, r, user.ID)
+	if !ok {
+		return
+	}
+	binIDs := make([]int, 0, len(bins))
+	for _, bin := range bins {
+		binIDs = append(binIDs, bin.ID)
+	}
+	stats, err := h.documentStore.GetDocumentStats(binIDs)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, stats)
+}
@@ -2,7 +2,10 @@ package bin
 
 import (
 	"database/sql"
+	"encoding/json"
 	"fmt"
+	"slices"
+	"strings"
 
 	"github.com/LikheKeto/Suraksheet/types"
 )
@@ -17,17 +20,17 @@ func NewStore(db *sql.DB) *Store {
 	}
 }
 
-func (s *Store) DeleteBin(binID int, userID int) error {
-	rows := s.db.QueryRow("SELECT name FROM bins WHERE id = $1 AND owner = $2;", binID, userID)
-	if err := rows.Err(); err != nil {
+// DeleteBin deletes the bin along with every bin nested in it.
+func (s *Store) DeleteBin(binID int) error {
+	var isDefault bool
+	err := s.db.QueryRow("SELECT isDefault FROM bins WHERE id = $1;", binID).Scan(&isDefault)
+	if err != nil && err != sql.ErrNoRows {
 		return err
 	}
-	var name string
-	rows.Scan(&name)
-	if name == "No Bin" {
+	if isDefault {
 		return fmt.Errorf("the default bin cannot be deleted")
 	}
-	_, err := s.db.Exec("DELETE FROM bins WHERE id = $1 AND owner = $2;", binID, userID)
+	_, err = s.db.Exec("DELETE FROM bins WHERE id = $1;", binID)
 	if err != nil {
 		return err
 	}
@@ -35,9 +38,9 @@ func (s *Store) DeleteBin(binID int, userID int) error {
 }
 
 func (s *Store) GetBinById(binID int) (*types.Bin, error) {
-	row := s.db.QueryRow("SELECT * FROM bins WHERE id = $1;", binID)
-	bin := new(types.Bin)
-	if err := row.Scan(&bin.ID, &bin.Name, &bin.OwnerID, &bin.CreatedAt); err != nil {
+	row := s.db.QueryRow("SELECT * FROM bins WHERE id = $1 AND deletedAt IS NULL;", binID)
+	bin, err := scanRowIntoBin(row)
+	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, fmt.Errorf("bin with id doesn't exist")
 		}
@@ -46,62 +49,423 @@ func (s *Store) GetBinById(binID int) (*types.Bin, error) {
 	return bin, nil
 }
 
-func (s *Store) UpdateBinName(binID int, userID int, newName string) error {
-	rows := s.db.QueryRow("SELECT name FROM bins WHERE id = $1 AND owner = $2;", binID, userID)
-	if err := rows.Err(); err != nil {
+func (s *Store) UpdateBin(binID int, changes types.EditBinPayload) error {
+	var isDefault bool
+	err := s.db.QueryRow("SELECT isDefault FROM bins WHERE id = $1;", binID).Scan(&isDefault)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return fmt.Errorf("bin with id doesn't exist")
+		}
 		return err
 	}
-	var name string
-	rows.Scan(&name)
-	if name == "No Bin" {
-		return fmt.Errorf("the default bin cannot be edited")
+	if isDefault && changes.Name != nil {
+		return fmt.Errorf("the default bin cannot be renamed")
+	}
+	if changes.Name != nil && isDefaultName(*changes.Name) {
+		return errDefaultName
 	}
-	_, err := s.db.Exec("UPDATE bins SET name = $1 WHERE id = $2 AND owner = $3;", newName, binID, userID)
+	if isDefault && changes.Archived != nil && *changes.Archived {
+		return fmt.Errorf("the default bin cannot be archived")
+	}
+	_, err = s.db.Exec(`
+		UPDATE bins SET
+			name = COALESCE($1, name),
+			description = COALESCE($2, description),
+			color = COALESCE($3, color),
+			icon = COALESCE($4, icon),
+			pinned = COALESCE($5, pinned),
+			position = COALESCE($6, position),
+			archived = COALESCE($7, archived)
+		WHERE id = $8;
+	`, changes.Name, changes.Description, changes.Color, changes.Icon, changes.Pinned, changes.Position, changes.Archived, binID)
+	return err
+}
+
+func (s *Store) GetBinsByUser(id int) ([]types.Bin, error) {
+	rows, err := s.db.Query("SELECT * FROM bins WHERE owner = $1 AND deletedAt IS NULL ORDER BY pinned DESC, position, name;", id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	return scanRowsIntoBins(rows)
+}
+
+func (s *Store) GetBinsByOrganization(orgID int) ([]types.Bin, error) {
+	rows, err := s.db.Query("SELECT * FROM bins WHERE organization = $1 AND deletedAt IS NULL ORDER BY pinned DESC, position, name;", orgID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	return scanRowsIntoBins(rows)
+}
+
+func (s *Store) GetChildBins(parentID int) ([]types.Bin, error) {
+	rows, err := s.db.Query("SELECT * FROM bins WHERE parent = $1 AND deletedAt IS NULL ORDER BY pinned DESC, position, name;", parentID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	return scanRowsIntoBins(rows)
+}
+
+func (s *Store) CreateBin(bin types.Bin) (*types.Bin, error) {
+	if isDefaultName(bin.Name) {
+		return nil, errDefaultName
+	}
+	var ownerID *int
+	if bin.OrganizationID == nil {
+		ownerID = &bin.OwnerID
+	}
+	query, err := marshalQuery(bin.Query)
+	if err != nil {
+		return nil, err
+	}
+	row := s.db.QueryRow(`
+		INSERT INTO bins (name, owner, parent, organization, query)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING *;
+	`, bin.Name, ownerID, bin.ParentID, bin.OrganizationID, query)
+	return scanRowIntoBin(row)
+}
+
+func (s *Store) UpdateBinQuery(binID int, query types.SmartBinQuery) error {
+	b, err := marshalQuery(&query)
+	if err != nil {
+		return err
+	}
+	res, err := s.db.Exec("UPDATE bins SET query = $1 WHERE id = $2 AND query IS NOT NULL;", b, binID)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
 	if err != nil {
 		return err
 	}
+	if n == 0 {
+		return fmt.Errorf("only smart bins have a query")
+	}
 	return nil
 }
 
-func (s *Store) GetBinsByUser(id int) ([]types.Bin, error) {
-	rows, err := s.db.Query("SELECT * FROM bins WHERE owner = $1;", id)
+func (s *Store) CreateBinWithSlots(bin types.Bin, slots []types.TemplateSlot) (*types.Bin, error) {
+	if isDefaultName(bin.Name) {
+		return nil, errDefaultName
+	}
+	var ownerID *int
+	if bin.OrganizationID == nil {
+		ownerID = &bin.OwnerID
+	}
+	tx, err := s.db.Begin()
 	if err != nil {
 		return nil, err
 	}
+	defer tx.Rollback()
 
-	bins := make([]types.Bin, 0)
+	created, err := scanRowIntoBin(tx.QueryRow(`
+		INSERT INTO bins (name, owner, parent, organization)
+		VALUES ($1, $2, $3, $4)
+		RETURNING *;
+	`, bin.Name, ownerID, bin.ParentID, bin.OrganizationID))
+	if err != nil {
+		return nil, err
+	}
+	for i, slot := range slots {
+		_, err := tx.Exec(`
+			INSERT INTO bin_slots (bin, name, description, required, position)
+			VALUES ($1, $2, $3, $4, $5);
+		`, created.ID, slot.Name, slot.Description, slot.Required, i)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return created, nil
+}
+
+// selectSlot reads a slot from bin_slots s, leaving the document out once it
+// has been moved out of the bin or to the trash.
+const selectSlot = `
+	SELECT s.id, s.bin, s.name, s.description, s.required, s.position, d.id
+	FROM bin_slots s
+	LEFT JOIN documents d ON d.id = s.document AND d.bin = s.bin AND d.deletedAt IS NULL
+`
+
+func (s *Store) GetBinSlots(binID int) ([]types.BinSlot, error) {
+	rows, err := s.db.Query(selectSlot+"WHERE s.bin = $1 ORDER BY s.position;", binID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	slots := make([]types.BinSlot, 0)
 	for rows.Next() {
-		bin, err := scanRowsIntoBin(rows)
+		slot, err := scanRowIntoSlot(rows)
 		if err != nil {
 			return nil, err
 		}
-		bins = append(bins, *bin)
+		slots = append(slots, *slot)
 	}
-	return bins, nil
+	return slots, rows.Err()
+}
+
+func (s *Store) FillBinSlot(binID, slotID int, documentID *int) (*types.BinSlot, error) {
+	res, err := s.db.Exec("UPDATE bin_slots SET document = $1 WHERE id = $2 AND bin = $3;", documentID, slotID, binID)
+	if err != nil {
+		return nil, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return nil, err
+	}
+	if n == 0 {
+		return nil, fmt.Errorf("slot not found")
+	}
+	return scanRowIntoSlot(s.db.QueryRow(selectSlot+"WHERE s.id = $1;", slotID))
+}
+
+// MoveBin puts the bin under parentID, or at the top level if parentID is
+// nil. The parent must belong to the same user or organization, and moves
+// that would put a bin inside itself are refused.
+func (s *Store) MoveBin(binID int, parentID *int) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	bin, err := scanRowIntoBin(tx.QueryRow("SELECT * FROM bins WHERE id = $1 AND deletedAt IS NULL;", binID))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return fmt.Errorf("bin with id doesn't exist")
+		}
+		return err
+	}
+	if bin.IsDefault {
+		return fmt.Errorf("the default bin cannot be moved")
+	}
+
+	// two concurrent moves could each pass the cycle check and still form a
+	// cycle together, so moves within one user's or organization's bins take
+	// turns; organizations get negative keys so the two never collide
+	lockKey := int64(bin.OwnerID)
+	if bin.OrganizationID != nil {
+		lockKey = -int64(*bin.OrganizationID)
+	}
+	if _, err := tx.Exec("SELECT pg_advisory_xact_lock($1);", lockKey); err != nil {
+		return err
+	}
+
+	if parentID != nil {
+		ancestors, err := getAncestorIDs(tx, *parentID, bin)
+		if err != nil {
+			return err
+		}
+		if len(ancestors) == 0 {
+			return fmt.Errorf("parent bin doesn't exist")
+		}
+		if slices.Contains(ancestors, binID) {
+			return fmt.Errorf("a bin cannot be moved into itself")
+		}
+		var smart bool
+		if err := tx.QueryRow("SELECT query IS NOT NULL FROM bins WHERE id = $1;", *parentID).Scan(&smart); err != nil {
+			return err
+		}
+		if smart {
+			return fmt.Errorf("smart bins cannot hold other bins")
+		}
+	}
+
+	if _, err := tx.Exec("UPDATE bins SET parent = $1 WHERE id = $2;", parentID, binID); err != nil {
+		return err
+	}
+	return tx.Commit()
 }
 
-func (s *Store) CreateBin(name string, ownerID int) (*types.Bin, error) {
-	var newBin types.Bin
+// getAncestorIDs returns the ID of the bin and all bins above it, as long as
+// the bin has the same owner as sibling.
+func getAncestorIDs(tx *sql.Tx, binID int, sibling *types.Bin) ([]int, error) {
+	rows, err := tx.Query(`
+		WITH RECURSIVE ancestors AS (
+			SELECT id, parent FROM bins
+			WHERE id = $1 AND owner IS NOT DISTINCT FROM $2 AND organization IS NOT DISTINCT FROM $3
+			AND deletedAt IS NULL
+			UNION
+			SELECT b.id, b.parent FROM bins b JOIN ancestors a ON b.id = a.parent
+		)
+		SELECT id FROM ancestors;
+	`, binID, nullableOwner(sibling), sibling.OrganizationID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	return scanIDs(rows)
+}
 
-	err := s.db.QueryRow(`
-		INSERT INTO bins (name, owner)
-		VALUES ($1, $2)
-		RETURNING id, name, owner, createdAt;
-	`, name, ownerID).Scan(
-		&newBin.ID, &newBin.Name, &newBin.OwnerID, &newBin.CreatedAt,
-	)
+// GetBinPath returns the bins from the top level down to the given bin.
+func (s *Store) GetBinPath(binID int) ([]types.Bin, error) {
+	rows, err := s.db.Query(`
+		WITH RECURSIVE path AS (
+			SELECT b.*, 0 AS depth FROM bins b WHERE id = $1
+			UNION
+			SELECT b.*, p.depth + 1 FROM bins b JOIN path p ON b.id = p.parent
+		)
+		SELECT id, name, owner, createdAt, parent, organization, deletedAt, query,
+			isDefault, description, color, icon, pinned, position, archived
+		FROM path ORDER BY depth DESC;
+	`, binID)
 	if err != nil {
 		return nil, err
 	}
+	defer rows.Close()
+	return scanRowsIntoBins(rows)
+}
 
-	return &newBin, nil
+// GetBinDescendantIDs returns the ID of the bin and of all bins nested in it.
+func (s *Store) GetBinDescendantIDs(binID int) ([]int, error) {
+	rows, err := s.db.Query(`
+		WITH RECURSIVE tree AS (
+			SELECT id FROM bins WHERE id = $1
+			UNION
+			SELECT b.id FROM bins b JOIN tree t ON b.parent = t.id
+		)
+		SELECT id FROM tree;
+	`, binID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	return scanIDs(rows)
 }
 
-func scanRowsIntoBin(rows *sql.Rows) (*types.Bin, error) {
+func (s *Store) TrashBin(binID int, userID int) (*types.TrashEntry, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	bin, err := scanRowIntoBin(tx.QueryRow("SELECT * FROM bins WHERE id = $1 AND deletedAt IS NULL FOR UPDATE;", binID))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("bin with id doesn't exist")
+		}
+		return nil, err
+	}
+	if bin.IsDefault {
+		return nil, fmt.Errorf("the default bin cannot be deleted")
+	}
+
+	// everything still in the tree gets the same deletedAt as the entry, which
+	// is how RestoreBin knows what to bring back; CURRENT_TIMESTAMP is the
+	// same for the whole transaction
+	_, err = tx.Exec(`
+		WITH RECURSIVE tree AS (
+			SELECT id FROM bins WHERE id = $1
+			UNION
+			SELECT b.id FROM bins b JOIN tree t ON b.parent = t.id WHERE b.deletedAt IS NULL
+		), trashed AS (
+			UPDATE bins SET deletedAt = CURRENT_TIMESTAMP WHERE id IN (SELECT id FROM tree)
+			RETURNING id
+		)
+		UPDATE documents SET deletedAt = CURRENT_TIMESTAMP
+		WHERE deletedAt IS NULL AND bin IN (SELECT id FROM trashed);
+	`, binID)
+	if err != nil {
+		return nil, err
+	}
+	entry := &types.TrashEntry{Bin: *bin, Name: bin.Name, DeletedBy: &userID}
+	err = tx.QueryRow(`
+		INSERT INTO trash (bin, deletedBy, deletedAt)
+		VALUES ($1, $2, CURRENT_TIMESTAMP)
+		RETURNING id, deletedAt;
+	`, binID, userID).Scan(&entry.ID, &entry.DeletedAt)
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	entry.Bin.DeletedAt = &entry.DeletedAt
+	return entry, nil
+}
+
+func scanIDs(rows *sql.Rows) ([]int, error) {
+	ids := make([]int, 0)
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+var errDefaultName = fmt.Errorf("%s is the name of the default bin", types.DefaultBinName)
+
+// isDefaultName reports whether name would pass for the default bin's.
+func isDefaultName(name string) bool {
+	return strings.EqualFold(strings.TrimSpace(name), types.DefaultBinName)
+}
+
+func nullableOwner(bin *types.Bin) *int {
+	if bin.OrganizationID != nil {
+		return nil
+	}
+	return &bin.OwnerID
+}
+
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+func scanRowsIntoBins(rows *sql.Rows) ([]types.Bin, error) {
+	bins := make([]types.Bin, 0)
+	for rows.Next() {
+		bin, err := scanRowIntoBin(rows)
+		if err != nil {
+			return nil, err
+		}
+		bins = append(bins, *bin)
+	}
+	return bins, nil
+}
+
+func scanRowIntoBin(row scanner) (*types.Bin, error) {
 	bin := new(types.Bin)
-	err := rows.Scan(&bin.ID, &bin.Name, &bin.OwnerID, &bin.CreatedAt)
+	var ownerID sql.NullInt64
+	var query []byte
+	err := row.Scan(&bin.ID, &bin.Name, &ownerID, &bin.CreatedAt, &bin.ParentID, &bin.OrganizationID, &bin.DeletedAt, &query,
+		&bin.IsDefault, &bin.Description, &bin.Color, &bin.Icon, &bin.Pinned, &bin.Position, &bin.Archived)
 	if err != nil {
 		return nil, err
 	}
+	bin.OwnerID = int(ownerID.Int64)
+	if query != nil {
+		bin.Query = new(types.SmartBinQuery)
+		if err := json.Unmarshal(query, bin.Query); err != nil {
+			return nil, err
+		}
+	}
 	return bin, nil
 }
+
+func scanRowIntoSlot(row scanner) (*types.BinSlot, error) {
+	slot := new(types.BinSlot)
+	err := row.Scan(&slot.ID, &slot.BinID, &slot.Name, &slot.Description, &slot.Required, &slot.Position, &slot.DocumentID)
+	if err != nil {
+		return nil, err
+	}
+	return slot, nil
+}
+
+// marshalQuery returns the query as stored in the query column, nil for
+// regular bins.
+func marshalQuery(query *types.SmartBinQuery) ([]byte, error) {
+	if query == nil {
+		return nil, nil
+	}
+	return json.Marshal(query)
+}
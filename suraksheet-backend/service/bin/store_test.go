@@ -0,0 +1,135 @@
+package bin
+
+import (
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/LikheKeto/Suraksheet/types"
+)
+
+func newMockStore(t *testing.T) (*Store, sqlmock.Sqlmock) {
+	t.Helper()
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		db.Close()
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+	})
+	return NewStore(db), mock
+}
+
+var binColumns = []string{"id", "name", "owner", "createdAt", "parent", "organization", "deletedAt", "query",
+	"isDefault", "description", "color", "icon", "pinned", "position", "archived"}
+
+func binRow(id int, isDefault bool) *sqlmock.Rows {
+	return sqlmock.NewRows(binColumns).
+		AddRow(id, "bin", 1, time.Now(), nil, nil, nil, nil, isDefault, "", "", "", false, 0, false)
+}
+
+func idRows(ids ...int) *sqlmock.Rows {
+	rows := sqlmock.NewRows([]string{"id"})
+	for _, id := range ids {
+		rows.AddRow(id)
+	}
+	return rows
+}
+
+func TestMoveBin(t *testing.T) {
+	selectBin := `SELECT \* FROM bins WHERE id = \$1`
+	ancestors := "WITH RECURSIVE ancestors"
+	parent := func(id int) *int { return &id }
+
+	tests := []struct {
+		name      string
+		binID     int
+		parentID  *int
+		ancestors []int
+		wantErr   bool
+	}{
+		{"into another bin", 2, parent(5), []int{5, 4}, false},
+		{"into itself", 2, parent(2), []int{2, 1}, true},
+		{"into its own descendant", 2, parent(4), []int{4, 3, 2, 1}, true},
+		{"into a bin of someone else", 2, parent(9), []int{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store, mock := newMockStore(t)
+			mock.ExpectBegin()
+			mock.ExpectQuery(selectBin).WithArgs(tt.binID).WillReturnRows(binRow(tt.binID, false))
+			mock.ExpectExec("SELECT pg_advisory_xact_lock").WithArgs(int64(1)).WillReturnResult(sqlmock.NewResult(0, 0))
+			mock.ExpectQuery(ancestors).WithArgs(*tt.parentID, 1, nil).WillReturnRows(idRows(tt.ancestors...))
+			if tt.wantErr {
+				mock.ExpectRollback()
+			} else {
+				mock.ExpectQuery("SELECT query IS NOT NULL").WithArgs(*tt.parentID).
+					WillReturnRows(sqlmock.NewRows([]string{"smart"}).AddRow(false))
+				mock.ExpectExec("UPDATE bins SET parent").WithArgs(*tt.parentID, tt.binID).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+			}
+
+			err := store.MoveBin(tt.binID, tt.parentID)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("expected error %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+
+	t.Run("should not move the default bin", func(t *testing.T) {
+		store, mock := newMockStore(t)
+		mock.ExpectBegin()
+		mock.ExpectQuery(selectBin).WithArgs(1).WillReturnRows(binRow(1, true))
+		mock.ExpectRollback()
+
+		if err := store.MoveBin(1, parent(5)); err == nil {
+			t.Error("expected an error")
+		}
+	})
+}
+
+func TestCreateBinDefaultName(t *testing.T) {
+	store, mock := newMockStore(t)
+	for _, name := range []string{types.DefaultBinName, " no bin "} {
+		if _, err := store.CreateBin(types.Bin{Name: name, OwnerID: 1}); err == nil {
+			t.Errorf("expected an error for %q", name)
+		}
+	}
+
+	mock.ExpectQuery("SELECT isDefault FROM bins").WithArgs(2).
+		WillReturnRows(sqlmock.NewRows([]string{"isDefault"}).AddRow(false))
+	name := types.DefaultBinName
+	if err := store.UpdateBin(2, types.EditBinPayload{Id: 2, Name: &name}); err == nil {
+		t.Error("expected an error for renaming a bin to the default name")
+	}
+}
+
+func TestBuildTree(t *testing.T) {
+	parent := func(id int) *int { return &id }
+	roots := buildTree([]types.Bin{
+		{ID: 1},
+		{ID: 2, ParentID: parent(1)},
+		{ID: 3, ParentID: parent(2)},
+		{ID: 4, ParentID: parent(1)},
+		// a bin whose parent isn't listed, like one shared on its own
+		{ID: 5, ParentID: parent(99)},
+	})
+
+	if len(roots) != 2 || roots[0].ID != 1 || roots[1].ID != 5 {
+		t.Fatalf("expected bins 1 and 5 at the top, got %d roots", len(roots))
+	}
+	children := roots[0].Children
+	if len(children) != 2 || children[0].ID != 2 || children[1].ID != 4 {
+		t.Fatalf("expected bins 2 and 4 in bin 1 in order, got %d children", len(children))
+	}
+	if len(children[0].Children) != 1 || children[0].Children[0].ID != 3 {
+		t.Errorf("expected bin 3 in bin 2")
+	}
+	if len(roots[1].Children) != 0 {
+		t.Errorf("expected bin 5 to hold nothing")
+	}
+}
@@ -0,0 +1,109 @@
+package document
+
+import (
+	"context"
+	"log"
+	"path"
+	"strconv"
+
+	"github.com/LikheKeto/Suraksheet/service/permission"
+	"github.com/LikheKeto/Suraksheet/types"
+	"github.com/LikheKeto/Suraksheet/utils"
+	"github.com/elastic/go-elasticsearch/v8"
+	"github.com/minio/minio-go/v7"
+)
+
+// backfillBatch is how many documents BackfillSizes looks up at a time.
+const backfillBatch = 100
+
+// BackfillSizes records the size and content type of documents uploaded
+// before they were recorded at upload time, reading them from the objects.
+// Documents whose object can't be read are logged and left for the next
+// start.
+func BackfillSizes(ctx context.Context, store types.DocumentStore, binStore types.BinStore, permissions *permission.Checker, minio *minio.Client) {
+	failed := map[int]bool{}
+	for {
+		docs, err := store.GetDocumentsWithoutSize(backfillBatch + len(failed))
+		if err != nil {
+			log.Printf("unable to fetch documents without size: %v", err)
+			return
+		}
+		done := true
+		for _, doc := range docs {
+			if failed[doc.ID] {
+				continue
+			}
+			done = false
+			if err := backfillSize(ctx, store, binStore, permissions, minio, doc); err != nil {
+				log.Printf("unable to record size of document %d: %v", doc.ID, err)
+				failed[doc.ID] = true
+			}
+		}
+		if done {
+			return
+		}
+	}
+}
+
+func backfillSize(ctx context.Context, store types.DocumentStore, binStore types.BinStore, permissions *permission.Checker, minio *minio.Client, doc types.Document) error {
+	bin, err := binStore.GetBinById(doc.BinID)
+	if err != nil {
+		return err
+	}
+	storageKey, err := permissions.StorageKey(bin)
+	if err != nil {
+		return err
+	}
+	info, err := utils.StatObject(ctx, minio, path.Join(storageKey, strconv.Itoa(doc.BinID), utils.HashString(doc.ReferenceName)))
+	if err != nil {
+		return err
+	}
+	return store.SetDocumentSize(doc.ID, info.Size, info.ContentType)
+}
+
+// BackfillSearchFields indexes again the documents whose search entry was
+// written before the language and upload date were indexed, which smart bins
+// filter on. Documents that can't be indexed are logged and left for the next
+// start.
+func BackfillSearchFields(ctx context.Context, store types.DocumentStore, binStore types.BinStore, esClient *elasticsearch.Client) {
+	failed := map[int]bool{}
+	for {
+		docIDs, err := utils.IndexedWithout(ctx, esClient, "created_at", backfillBatch+len(failed))
+		if err != nil {
+			log.Printf("unable to fetch documents to index again: %v", err)
+			return
+		}
+		pending := make([]int, 0, len(docIDs))
+		for _, id := range docIDs {
+			if !failed[id] {
+				pending = append(pending, id)
+			}
+		}
+		if len(pending) == 0 {
+			return
+		}
+		docs, err := store.FetchDocumentsFromDB(pending)
+		if err != nil {
+			log.Printf("unable to fetch documents to index again: %v", err)
+			return
+		}
+		indexed := map[int]bool{}
+		for _, doc := range docs {
+			bin, err := binStore.GetBinById(doc.BinID)
+			if err == nil {
+				err = utils.IndexExtractedDocument(ctx, esClient, doc, bin)
+			}
+			if err != nil {
+				log.Printf("unable to index document %d again: %v", doc.ID, err)
+				continue
+			}
+			indexed[doc.ID] = true
+		}
+		// entries of documents that are gone or in the trash are skipped too
+		for _, id := range pending {
+			if !indexed[id] {
+				failed[id] = true
+			}
+		}
+	}
+}
@@ -0,0 +1,38 @@
+package document
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/LikheKeto/Suraksheet/types"
+)
+
+type mockSizeStore struct {
+	types.DocumentStore
+	docs   []types.Document
+	limits []int
+}
+
+func (m *mockSizeStore) GetDocumentsWithoutSize(limit int) ([]types.Document, error) {
+	m.limits = append(m.limits, limit)
+	return m.docs[:min(limit, len(m.docs))], nil
+}
+
+type mockBinStore struct {
+	types.BinStore
+}
+
+func (m *mockBinStore) GetBinById(id int) (*types.Bin, error) {
+	return nil, errors.New("connection reset")
+}
+
+func TestBackfillSizes(t *testing.T) {
+	store := &mockSizeStore{docs: []types.Document{{ID: 1, BinID: 2}, {ID: 2, BinID: 2}}}
+	// every document fails, so the second batch has nothing new and ends the loop
+	BackfillSizes(context.Background(), store, &mockBinStore{}, nil, nil)
+	if want := []int{backfillBatch, backfillBatch + 2}; !slices.Equal(store.limits, want) {
+		t.Errorf("expected batches of %v, got %v", want, store.limits)
+	}
+}
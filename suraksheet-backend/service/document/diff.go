@@ -0,0 +1,108 @@
+package document
+
+import "strings"
+
+const (
+	diffEqual  = "equal"
+	diffInsert = "insert"
+	diffDelete = "delete"
+)
+
+// maxDiffCells bounds the table diffWords fills in; texts that differ in more
+// words than that are shown as replaced outright.
+const maxDiffCells = 4 << 20
+
+type diffPart struct {
+	Op   string `json:"op"`
+	Text string `json:"text"`
+}
+
+type versionDiff struct {
+	From  int        `json:"from"`
+	To    int        `json:"to"`
+	Parts []diffPart `json:"parts"`
+}
+
+// diffWords compares two texts word by word, since extracted text keeps no
+// line breaks. It keeps the longest run of words they have in common and
+// marks the rest as deleted from a or inserted in b, joining neighbouring
+// words with the same mark into one part.
+func diffWords(a, b string) []diffPart {
+	x, y := strings.Fields(a), strings.Fields(b)
+	var parts []diffPart
+	add := func(op, word string) {
+		if n := len(parts); n > 0 && parts[n-1].Op == op {
+			parts[n-1].Text += " " + word
+			return
+		}
+		parts = append(parts, diffPart{Op: op, Text: word})
+	}
+
+	// the words both texts start and end with need no table
+	prefix := 0
+	for prefix < len(x) && prefix < len(y) && x[prefix] == y[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(x)-prefix && suffix < len(y)-prefix && x[len(x)-1-suffix] == y[len(y)-1-suffix] {
+		suffix++
+	}
+	for _, word := range x[:prefix] {
+		add(diffEqual, word)
+	}
+	tail := x[len(x)-suffix:]
+	x, y = x[prefix:len(x)-suffix], y[prefix:len(y)-suffix]
+
+	if (len(x)+1)*(len(y)+1) > maxDiffCells {
+		for _, word := range x {
+			add(diffDelete, word)
+		}
+		for _, word := range y {
+			add(diffInsert, word)
+		}
+	} else {
+		// lcs[i][j] is how many words x[i:] and y[j:] have in common
+		lcs := make([][]int, len(x)+1)
+		for i := range lcs {
+			lcs[i] = make([]int, len(y)+1)
+		}
+		for i := len(x) - 1; i >= 0; i-- {
+			for j := len(y) - 1; j >= 0; j-- {
+				if x[i] == y[j] {
+					lcs[i][j] = lcs[i+1][j+1] + 1
+				} else {
+					lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+				}
+			}
+		}
+		i, j := 0, 0
+		for i < len(x) && j < len(y) {
+			switch {
+			case x[i] == y[j]:
+				add(diffEqual, x[i])
+				i++
+				j++
+			case lcs[i+1][j] >= lcs[i][j+1]:
+				add(diffDelete, x[i])
+				i++
+			default:
+				add(diffInsert, y[j])
+				j++
+			}
+		}
+		for ; i < len(x); i++ {
+			add(diffDelete, x[i])
+		}
+		for ; j < len(y); j++ {
+			add(diffInsert, y[j])
+		}
+	}
+
+	for _, word := range tail {
+		add(diffEqual, word)
+	}
+	if parts == nil {
+		parts = make([]diffPart, 0)
+	}
+	return parts
+}
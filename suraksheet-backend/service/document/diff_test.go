@@ -0,0 +1,47 @@
+package document
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDiffWords(t *testing.T) {
+	// extracted text comes as one line
+	old := "Name Ram Bahadur Passport No 0123456 Expiry 20250101"
+	new := "Name Ram Bahadur Passport No 0123456 Expiry 20350101 Place of issue Kathmandu"
+	want := []diffPart{
+		{Op: diffEqual, Text: "Name Ram Bahadur Passport No 0123456 Expiry"},
+		{Op: diffDelete, Text: "20250101"},
+		{Op: diffInsert, Text: "20350101 Place of issue Kathmandu"},
+	}
+	if got := diffWords(old, new); !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+
+	want = []diffPart{
+		{Op: diffEqual, Text: "Name"},
+		{Op: diffDelete, Text: "Ram"},
+		{Op: diffInsert, Text: "Hari"},
+		{Op: diffEqual, Text: "Bahadur"},
+	}
+	if got := diffWords("Name Ram Bahadur", "Name Hari Bahadur"); !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+
+	if got := diffWords("", ""); len(got) != 0 {
+		t.Errorf("expected no parts for empty texts, got %v", got)
+	}
+}
+
+func TestDiffWordsLongTexts(t *testing.T) {
+	a := strings.Repeat("alpha ", 3000)
+	b := strings.Repeat("beta ", 3000)
+	want := []diffPart{
+		{Op: diffDelete, Text: strings.TrimSpace(a)},
+		{Op: diffInsert, Text: strings.TrimSpace(b)},
+	}
+	if got := diffWords(a, b); !reflect.DeepEqual(got, want) {
+		t.Error("expected texts too long to compare to be replaced outright")
+	}
+}
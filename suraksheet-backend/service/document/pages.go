@@ -0,0 +1,335 @@
+package document
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"mime/multipart"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/LikheKeto/Suraksheet/config"
+	"github.com/LikheKeto/Suraksheet/service/auth"
+	"github.com/LikheKeto/Suraksheet/service/quota"
+	"github.com/LikheKeto/Suraksheet/types"
+	"github.com/LikheKeto/Suraksheet/utils"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-playground/validator/v10"
+)
+
+// maxPagesPerUpload is how many pages can be added in one request.
+const maxPagesPerUpload = 20
+
+func (h *Handler) handleGetPages(w http.ResponseWriter, r *http.Request) {
+	user, err := auth.ExtractUserFromContext(r)
+	if err != nil {
+		utils.WriteError(w, http.StatusForbidden, err)
+		return
+	}
+	docID, ok := documentIDParam(w, r)
+	if !ok {
+		return
+	}
+	doc, _, ok := h.permissions.Document(w, user.ID, docID, types.RoleViewer)
+	if !ok {
+		return
+	}
+	pages, err := h.documentPages(doc)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, pages)
+}
+
+// handleAddPages appends the images uploaded as files to the document and
+// queues each of them for extraction.
+func (h *Handler) handleAddPages(w http.ResponseWriter, r *http.Request) {
+	user, err := auth.ExtractUserFromContext(r)
+	if err != nil {
+		utils.WriteError(w, http.StatusForbidden, err)
+		return
+	}
+	docID, ok := documentIDParam(w, r)
+	if !ok {
+		return
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, maxPagesPerUpload*config.Envs.MaxUploadSizeInBytes+1<<20)
+	if err := r.ParseMultipartForm(10 << 20); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			utils.WriteError(w, http.StatusRequestEntityTooLarge, fmt.Errorf("pages are larger than %d bytes together", tooLarge.Limit))
+			return
+		}
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	files := r.MultipartForm.File["files"]
+	if len(files) == 0 || len(files) > maxPagesPerUpload {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("between 1 and %d files are needed", maxPagesPerUpload))
+		return
+	}
+	for _, fileHeader := range files {
+		if fileHeader.Size > config.Envs.MaxUploadSizeInBytes {
+			utils.WriteError(w, http.StatusRequestEntityTooLarge, fmt.Errorf("%s is larger than %d bytes", fileHeader.Filename, config.Envs.MaxUploadSizeInBytes))
+			return
+		}
+		if !strings.HasPrefix(fileHeader.Header.Get("Content-Type"), "image/") {
+			utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("%s is not an image", fileHeader.Filename))
+			return
+		}
+	}
+	doc, bin, ok := h.permissions.Document(w, user.ID, docID, types.RoleEditor)
+	if !ok {
+		return
+	}
+	storageKey, err := h.permissions.StorageKey(bin)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	binQuota, err := quota.ForBin(h.quotaStore, bin)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	var size int64
+	for _, fileHeader := range files {
+		size += fileHeader.Size
+	}
+	err = quota.CheckRoom(binQuota, h.store, bin, 0, size)
+	if errors.Is(err, types.ErrQuotaExceeded) {
+		utils.WriteError(w, http.StatusInsufficientStorage, err)
+		return
+	}
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	// cleaning up has to finish even if the client has gone away
+	ctx := context.Background()
+	added := make([]types.DocumentPage, 0, len(files))
+	uploaded := make([]string, 0, len(files))
+	for _, fileHeader := range files {
+		key, err := newPageObjectKey(storageKey, doc.ID)
+		if err == nil {
+			err = h.uploadPage(r.Context(), fileHeader, key)
+		}
+		if err != nil {
+			h.removeObjects(ctx, uploaded)
+			utils.WriteError(w, http.StatusInternalServerError, fmt.Errorf("unable to store %s: %v", fileHeader.Filename, err))
+			return
+		}
+		uploaded = append(uploaded, key)
+		size := fileHeader.Size
+		added = append(added, types.DocumentPage{
+			Name:        fileHeader.Filename,
+			Size:        &size,
+			ContentType: fileHeader.Header.Get("Content-Type"),
+			ObjectKey:   key,
+		})
+	}
+	pages, err := h.store.AddDocumentPages(*doc, added, binQuota)
+	if err != nil {
+		h.removeObjects(ctx, uploaded)
+		utils.WriteError(w, transferErrorStatus(err), fmt.Errorf("unable to add pages: %v", err))
+		return
+	}
+
+	for _, page := range pages {
+		if page.ObjectKey == "" || page.ExtractionStatus != types.ExtractionPending {
+			continue
+		}
+		err := utils.QueueForExtraction(h.rmqChan, h.rmq, utils.ExtractionArgs{
+			DocID:          doc.ID,
+			UserID:         bin.OwnerID,
+			OrganizationID: bin.OrganizationID,
+			FileKey:        page.ObjectKey,
+			Extension:      fileExtension(page.Name),
+			Language:       doc.Language,
+			PageID:         &page.ID,
+		})
+		if err != nil {
+			log.Printf("unable to queue page %d of document %d for extraction: %v", page.ID, doc.ID, err)
+		}
+	}
+	utils.WriteJSON(w, http.StatusCreated, pages)
+}
+
+func (h *Handler) handleReorderPages(w http.ResponseWriter, r *http.Request) {
+	user, err := auth.ExtractUserFromContext(r)
+	if err != nil {
+		utils.WriteError(w, http.StatusForbidden, err)
+		return
+	}
+	docID, ok := documentIDParam(w, r)
+	if !ok {
+		return
+	}
+	var payload types.ReorderPagesPayload
+	if err := utils.ParseJSON(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	if err := utils.Validate.Struct(payload); err != nil {
+		errors := err.(validator.ValidationErrors)
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid payload %v", errors))
+		return
+	}
+	doc, bin, ok := h.permissions.Document(w, user.ID, docID, types.RoleEditor)
+	if !ok {
+		return
+	}
+	pages, err := h.store.ReorderDocumentPages(doc.ID, payload.Pages)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("unable to reorder pages: %v", err))
+		return
+	}
+	h.reindex(r.Context(), doc.ID, bin)
+	utils.WriteJSON(w, http.StatusOK, pages)
+}
+
+// handleRemovePage takes a page out of the document. The document's own file
+// stays; it is replaced by uploading a new version instead.
+func (h *Handler) handleRemovePage(w http.ResponseWriter, r *http.Request) {
+	user, err := auth.ExtractUserFromContext(r)
+	if err != nil {
+		utils.WriteError(w, http.StatusForbidden, err)
+		return
+	}
+	docID, ok := documentIDParam(w, r)
+	if !ok {
+		return
+	}
+	doc, bin, ok := h.permissions.Document(w, user.ID, docID, types.RoleEditor)
+	if !ok {
+		return
+	}
+	page, ok := h.pageParam(w, r, doc)
+	if !ok {
+		return
+	}
+	if page.ObjectKey == "" {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("the document's own file can't be removed, upload a new version instead"))
+		return
+	}
+	if err := h.store.RemoveDocumentPage(doc.ID, page.ID); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("unable to remove page: %v", err))
+		return
+	}
+	if err := utils.DeleteObject(r.Context(), h.minio, page.ObjectKey); err != nil {
+		log.Printf("unable to delete file in minio: %v\n", err)
+	}
+	h.reindex(r.Context(), doc.ID, bin)
+	utils.WriteJSON(w, http.StatusNoContent, nil)
+}
+
+func (h *Handler) handleGetPageAsset(w http.ResponseWriter, r *http.Request) {
+	user, err := auth.ExtractUserFromContext(r)
+	if err != nil {
+		utils.WriteError(w, http.StatusForbidden, err)
+		return
+	}
+	docID, ok := documentIDParam(w, r)
+	if !ok {
+		return
+	}
+	doc, bin, ok := h.permissions.Document(w, user.ID, docID, types.RoleViewer)
+	if !ok {
+		return
+	}
+	page, ok := h.pageParam(w, r, doc)
+	if !ok {
+		return
+	}
+	objectName := page.ObjectKey
+	if objectName == "" {
+		storageKey, err := h.permissions.StorageKey(bin)
+		if err != nil {
+			utils.WriteError(w, http.StatusInternalServerError, err)
+			return
+		}
+		objectName = path.Join(storageKey, strconv.Itoa(doc.BinID), utils.HashString(doc.ReferenceName))
+	}
+	h.serveObject(w, r, objectName)
+}
+
+// documentPages returns the pages of the document, or its own file as the
+// only page for documents of a single file.
+func (h *Handler) documentPages(doc *types.Document) ([]types.DocumentPage, error) {
+	pages, err := h.store.GetDocumentPages(doc.ID)
+	if err != nil || len(pages) > 0 {
+		return pages, err
+	}
+	return []types.DocumentPage{{
+		DocumentID:       doc.ID,
+		Page:             1,
+		Name:             doc.Name,
+		Size:             doc.Size,
+		ContentType:      doc.ContentType,
+		Extract:          doc.Extract,
+		ExtractionStatus: doc.ExtractionStatus,
+		CreatedAt:        doc.CreatedAt,
+	}}, nil
+}
+
+// pageParam returns the page of the document numbered in the URL.
+func (h *Handler) pageParam(w http.ResponseWriter, r *http.Request, doc *types.Document) (*types.DocumentPage, bool) {
+	pageStr := chi.URLParam(r, "page")
+	n, err := strconv.Atoi(pageStr)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid page %s", pageStr))
+		return nil, false
+	}
+	pages, err := h.documentPages(doc)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return nil, false
+	}
+	if n < 1 || n > len(pages) {
+		utils.WriteError(w, http.StatusNotFound, fmt.Errorf("page %d not found", n))
+		return nil, false
+	}
+	return &pages[n-1], true
+}
+
+// reindex puts the document's text, joined from its pages, back into search.
+func (h *Handler) reindex(ctx context.Context, docID int, bin *types.Bin) {
+	doc, err := h.store.GetDocumentByID(docID)
+	if err != nil {
+		log.Printf("unable to fetch document %d: %v", docID, err)
+		return
+	}
+	if doc.Extract == "" {
+		err = utils.DeleteFromIndex(ctx, h.esClient, map[string]interface{}{
+			"term": map[string]interface{}{"document_id": doc.ID},
+		})
+	} else {
+		err = utils.IndexExtractedDocument(ctx, h.esClient, doc, bin)
+	}
+	if err != nil {
+		log.Printf("unable to update search entry of document %d: %v", doc.ID, err)
+	}
+}
+
+func newPageObjectKey(storageKey string, docID int) (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return utils.PageObjectKey(storageKey, docID, hex.EncodeToString(b)), nil
+}
+
+func (h *Handler) uploadPage(ctx context.Context, fileHeader *multipart.FileHeader, key string) error {
+	file, err := fileHeader.Open()
+	if err != nil {
+		return err
+	}
+	return utils.UploadToMinio(ctx, h.minio, file, fileHeader, key)
+}
@@ -0,0 +1,122 @@
+package document
+
+import (
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/LikheKeto/Suraksheet/types"
+)
+
+var pageColumns = []string{"id", "document", "position", "name", "size", "contentType", "objectKey", "extract", "extractionStatus", "createdAt"}
+
+// pageRows returns the rows of the document's pages, one per object key in
+// order; the empty key is the document's own file.
+func pageRows(docID int, firstID int, keys ...string) *sqlmock.Rows {
+	rows := sqlmock.NewRows(pageColumns)
+	for i, key := range keys {
+		rows.AddRow(firstID+i, docID, i+1, "page.png", 100, "image/png", key, "text", types.ExtractionCompleted, time.Now())
+	}
+	return rows
+}
+
+var (
+	selectPages = regexp.QuoteMeta("SELECT * FROM document_pages WHERE document = $1 ORDER BY position;")
+	rejoinPages = regexp.QuoteMeta("UPDATE documents d SET extract = p.text, extractionStatus = p.status")
+)
+
+func TestReorderDocumentPages(t *testing.T) {
+	t.Run("should join the text again in the new order", func(t *testing.T) {
+		store, mock := newMockStore(t)
+		mock.ExpectBegin()
+		mock.ExpectQuery(selectPages).WithArgs(1).WillReturnRows(pageRows(1, 10, "", "a", "b"))
+		for position, id := range []int{12, 10, 11} {
+			mock.ExpectExec("UPDATE document_pages SET position").WithArgs(position+1, id).
+				WillReturnResult(sqlmock.NewResult(0, 1))
+		}
+		mock.ExpectExec(rejoinPages).WithArgs(1).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectQuery(selectPages).WithArgs(1).WillReturnRows(pageRows(1, 10, "b", "", "a"))
+		mock.ExpectCommit()
+
+		pages, err := store.ReorderDocumentPages(1, []int{12, 10, 11})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(pages) != 3 {
+			t.Errorf("expected 3 pages, got %d", len(pages))
+		}
+	})
+
+	t.Run("should fail for an order missing pages or naming others", func(t *testing.T) {
+		for _, order := range [][]int{{10, 11}, {10, 11, 99}} {
+			store, mock := newMockStore(t)
+			mock.ExpectBegin()
+			mock.ExpectQuery(selectPages).WithArgs(1).WillReturnRows(pageRows(1, 10, "", "a", "b"))
+			mock.ExpectRollback()
+			if _, err := store.ReorderDocumentPages(1, order); err == nil {
+				t.Errorf("expected an error for order %v", order)
+			}
+		}
+	})
+}
+
+func TestRemoveDocumentPage(t *testing.T) {
+	t.Run("should join the text again after removing the last page", func(t *testing.T) {
+		store, mock := newMockStore(t)
+		mock.ExpectBegin()
+		mock.ExpectQuery("DELETE FROM document_pages").WithArgs(12, 1).
+			WillReturnRows(sqlmock.NewRows([]string{"position"}).AddRow(3))
+		mock.ExpectExec("UPDATE document_pages SET position = position - 1").WithArgs(1, 3).
+			WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec(rejoinPages).WithArgs(1).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+
+		if err := store.RemoveDocumentPage(1, 12); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("should fail for a page of another document", func(t *testing.T) {
+		store, mock := newMockStore(t)
+		mock.ExpectBegin()
+		mock.ExpectQuery("DELETE FROM document_pages").WithArgs(99, 1).
+			WillReturnRows(sqlmock.NewRows([]string{"position"}))
+		mock.ExpectRollback()
+
+		if err := store.RemoveDocumentPage(1, 99); err == nil {
+			t.Error("expected an error")
+		}
+	})
+}
+
+func TestCopyPages(t *testing.T) {
+	store, mock := newMockStore(t)
+	mock.ExpectBegin()
+	mock.ExpectQuery(selectPages).WithArgs(1).WillReturnRows(pageRows(1, 10, "", "pages/1/a"))
+	mock.ExpectExec("INSERT INTO document_pages").
+		WithArgs(2, 1, "page.png", 100, "image/png", "", "text", types.ExtractionCompleted, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("INSERT INTO document_pages").
+		WithArgs(2, 2, "page.png", 100, "image/png", "pages/2/copy", "text", types.ExtractionCompleted, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectRollback()
+
+	tx, err := store.db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+	copied := make(map[string]int)
+	err = copyPages(tx, 1, 2, func(docID int, objectKey string) (string, error) {
+		copied[objectKey] = docID
+		return "pages/2/copy", nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the document's own file is copied along with the document
+	if len(copied) != 1 || copied["pages/1/a"] != 2 {
+		t.Errorf("expected only the added page's object to be copied for the copy, got %v", copied)
+	}
+}
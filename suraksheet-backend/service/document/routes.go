@@ -1,9 +1,9 @@
 package document
 
 import (
-	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
@@ -12,7 +12,10 @@ import (
 	"strconv"
 	"strings"
 
+	"github.com/LikheKeto/Suraksheet/config"
 	"github.com/LikheKeto/Suraksheet/service/auth"
+	"github.com/LikheKeto/Suraksheet/service/permission"
+	"github.com/LikheKeto/Suraksheet/service/quota"
 	"github.com/LikheKeto/Suraksheet/types"
 	"github.com/LikheKeto/Suraksheet/utils"
 	"github.com/elastic/go-elasticsearch/v8"
@@ -23,36 +26,61 @@ import (
 )
 
 type Handler struct {
-	store     types.DocumentStore
-	userStore types.UserStore
-	binStore  types.BinStore
-	minio     *minio.Client
-	rmqChan   *amqp.Channel
-	rmq       amqp.Queue
-	esClient  *elasticsearch.Client
+	store        types.DocumentStore
+	quotaStore   types.QuotaStore
+	userStore    types.UserStore
+	sessionStore types.SessionStore
+	apiKeyStore  types.APIKeyStore
+	permissions  *permission.Checker
+	minio        *minio.Client
+	rmqChan      *amqp.Channel
+	rmq          amqp.Queue
+	esClient     *elasticsearch.Client
 }
 
-func NewHandler(documentStore types.DocumentStore,
-	userStore types.UserStore, binStore types.BinStore,
-	minio *minio.Client, rmqChan *amqp.Channel, rmq amqp.Queue, esClient *elasticsearch.Client) *Handler {
+func NewHandler(documentStore types.DocumentStore, quotaStore types.QuotaStore,
+	userStore types.UserStore, sessionStore types.SessionStore, apiKeyStore types.APIKeyStore,
+	permissions *permission.Checker, minio *minio.Client, rmqChan *amqp.Channel, rmq amqp.Queue, esClient *elasticsearch.Client) *Handler {
 	return &Handler{
-		store:     documentStore,
-		userStore: userStore,
-		binStore:  binStore,
-		minio:     minio,
-		rmqChan:   rmqChan,
-		rmq:       rmq,
-		esClient:  esClient,
+		store:        documentStore,
+		quotaStore:   quotaStore,
+		userStore:    userStore,
+		sessionStore: sessionStore,
+		apiKeyStore:  apiKeyStore,
+		permissions:  permissions,
+		minio:        minio,
+		rmqChan:      rmqChan,
+		rmq:          rmq,
+		esClient:     esClient,
 	}
 }
 
 func (h *Handler) RegisterRoutes(router chi.Router) {
-	router.MethodFunc(http.MethodGet, "/document/{documentID}/asset", auth.WithJWTAuth(h.handleGetImage, h.userStore))
-	router.MethodFunc(http.MethodGet, "/document/{documentID}", auth.WithJWTAuth(h.handleGetDocument, h.userStore))
-	router.MethodFunc(http.MethodPost, "/document", auth.WithJWTAuth(h.handleInsertDocument, h.userStore))
-	router.MethodFunc(http.MethodPatch, "/document", auth.WithJWTAuth(h.handleEditDocument, h.userStore))
-	router.MethodFunc(http.MethodDelete, "/document", auth.WithJWTAuth(h.handleDeleteDocument, h.userStore))
-	router.MethodFunc(http.MethodGet, "/document/search", auth.WithJWTAuth(h.handleSearchDocuments, h.userStore))
+	router.MethodFunc(http.MethodGet, "/document/{documentID}/asset", h.withAuth(h.handleGetImage, types.APIKeyScopeRead))
+	router.MethodFunc(http.MethodGet, "/document/{documentID}", h.withAuth(h.handleGetDocument, types.APIKeyScopeRead))
+	router.MethodFunc(http.MethodGet, "/document/{documentID}/versions", h.withAuth(h.handleGetVersions, types.APIKeyScopeRead))
+	router.MethodFunc(http.MethodPost, "/document/{documentID}/versions", h.withAuth(h.handleAddVersion, types.APIKeyScopeFull))
+	router.MethodFunc(http.MethodGet, "/document/{documentID}/versions/diff", h.withAuth(h.handleDiffVersions, types.APIKeyScopeRead))
+	router.MethodFunc(http.MethodPost, "/document/{documentID}/versions/{version}/restore", h.withAuth(h.handleRestoreVersion, types.APIKeyScopeFull))
+	router.MethodFunc(http.MethodGet, "/document/{documentID}/pages", h.withAuth(h.handleGetPages, types.APIKeyScopeRead))
+	router.MethodFunc(http.MethodPost, "/document/{documentID}/pages", h.withAuth(h.handleAddPages, types.APIKeyScopeFull))
+	router.MethodFunc(http.MethodPut, "/document/{documentID}/pages/order", h.withAuth(h.handleReorderPages, types.APIKeyScopeFull))
+	router.MethodFunc(http.MethodDelete, "/document/{documentID}/pages/{page}", h.withAuth(h.handleRemovePage, types.APIKeyScopeFull))
+	router.MethodFunc(http.MethodGet, "/document/{documentID}/pages/{page}/asset", h.withAuth(h.handleGetPageAsset, types.APIKeyScopeRead))
+	router.MethodFunc(http.MethodPost, "/document", h.withAuth(h.handleInsertDocument, types.APIKeyScopeUpload))
+	router.MethodFunc(http.MethodPatch, "/document", h.withAuth(h.handleEditDocument, types.APIKeyScopeFull))
+	router.MethodFunc(http.MethodPost, "/document/profile", h.withAuth(h.handleSetDocumentProfile, types.APIKeyScopeFull))
+	router.MethodFunc(http.MethodPost, "/document/move", h.withAuth(h.handleMoveDocuments, types.APIKeyScopeFull))
+	router.MethodFunc(http.MethodPost, "/document/copy", h.withAuth(h.handleCopyDocuments, types.APIKeyScopeFull))
+	router.MethodFunc(http.MethodPost, "/document/{documentID}/move", h.withAuth(h.handleMoveDocument, types.APIKeyScopeFull))
+	router.MethodFunc(http.MethodPost, "/document/{documentID}/copy", h.withAuth(h.handleCopyDocument, types.APIKeyScopeFull))
+	router.MethodFunc(http.MethodDelete, "/document", h.withAuth(h.handleDeleteDocument, types.APIKeyScopeFull))
+	router.MethodFunc(http.MethodGet, "/document/search", h.withAuth(h.handleSearchDocuments, types.APIKeyScopeRead))
+	router.MethodFunc(http.MethodGet, "/document/types", h.withAuth(h.handleGetDocumentTypes, types.APIKeyScopeRead))
+}
+
+func (h *Handler) withAuth(handlerFunc http.HandlerFunc, scope string) http.HandlerFunc {
+	return auth.WithJWTOrAPIKeyAuth(auth.RequireVerifiedEmail(handlerFunc), scope, h.userStore, h.sessionStore, h.apiKeyStore)
 }
 
 func (h *Handler) handleGetImage(w http.ResponseWriter, r *http.Request) {
@@ -67,34 +95,36 @@ func (h *Handler) handleGetImage(w http.ResponseWriter, r *http.Request) {
 		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid document id"))
 		return
 	}
-	owner, _ := h.store.GetDocumentOwner(documentID)
-	if owner != user.ID {
-		utils.WriteError(w, http.StatusForbidden, fmt.Errorf("document does not belong to user"))
+	document, bin, ok := h.permissions.Document(w, user.ID, documentID, types.RoleViewer)
+	if !ok {
 		return
 	}
-	document, err := h.store.GetDocumentByID(documentID)
+	storageKey, err := h.permissions.StorageKey(bin)
 	if err != nil {
 		utils.WriteError(w, http.StatusInternalServerError, err)
 		return
 	}
-	objectName := path.Join(utils.HashString(user.Email), strconv.Itoa(document.BinID), utils.HashString(document.ReferenceName))
+	objectName := path.Join(storageKey, strconv.Itoa(document.BinID), utils.HashString(document.ReferenceName))
+	h.serveObject(w, r, objectName)
+}
+
+func (h *Handler) serveObject(w http.ResponseWriter, r *http.Request, objectName string) {
 	obj, err := utils.GetObject(r.Context(), h.minio, objectName)
 	if err != nil {
 		utils.WriteError(w, http.StatusNotFound, err)
 		return
 	}
+	defer obj.Close()
 	stat, err := obj.Stat()
 	if err != nil {
-		utils.WriteJSON(w, http.StatusInternalServerError, fmt.Errorf("unable to get object stats: %w", err))
+		utils.WriteError(w, http.StatusInternalServerError, fmt.Errorf("unable to get object stats: %w", err))
 		return
 	}
-	defer obj.Close()
+	w.Header().Set("Content-Type", stat.ContentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%s", path.Base(stat.Key)))
 	if _, err := io.Copy(w, obj); err != nil {
-		utils.WriteError(w, http.StatusInternalServerError, fmt.Errorf("failed to write object to response: %w", err))
-		return
+		log.Printf("failed to write object to response: %v", err)
 	}
-	w.Header().Set("Content-Type", stat.ContentType)
-	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%s", stat.Key))
 }
 
 func (h *Handler) handleGetDocument(w http.ResponseWriter, r *http.Request) {
@@ -109,14 +139,8 @@ func (h *Handler) handleGetDocument(w http.ResponseWriter, r *http.Request) {
 		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid document id"))
 		return
 	}
-	owner, _ := h.store.GetDocumentOwner(documentID)
-	if owner != user.ID {
-		utils.WriteError(w, http.StatusForbidden, fmt.Errorf("document does not belong to user"))
-		return
-	}
-	document, err := h.store.GetDocumentByID(documentID)
-	if err != nil {
-		utils.WriteError(w, http.StatusInternalServerError, err)
+	document, _, ok := h.permissions.Document(w, user.ID, documentID, types.RoleViewer)
+	if !ok {
 		return
 	}
 	utils.WriteJSON(w, http.StatusOK, document)
@@ -128,10 +152,21 @@ func (h *Handler) handleInsertDocument(w http.ResponseWriter, r *http.Request) {
 		utils.WriteError(w, http.StatusForbidden, err)
 		return
 	}
-	r.ParseMultipartForm(10 << 20)
+	// room for the form fields next to the file
+	r.Body = http.MaxBytesReader(w, r.Body, config.Envs.MaxUploadSizeInBytes+1<<20)
+	if err := r.ParseMultipartForm(10 << 20); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			utils.WriteError(w, http.StatusRequestEntityTooLarge, fmt.Errorf("file is larger than %d bytes", config.Envs.MaxUploadSizeInBytes))
+			return
+		}
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
 	referenceName := r.Form.Get("referenceName")
 	binIDStr := r.Form.Get("binID")
 	language := r.Form.Get("language")
+	profileIDStr := r.Form.Get("profileID")
 
 	if !(language == "eng" || language == "nep") {
 		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("language not supported"))
@@ -143,6 +178,27 @@ func (h *Handler) handleInsertDocument(w http.ResponseWriter, r *http.Request) {
 		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid bin"))
 		return
 	}
+	bin, ok := h.permissions.Container(w, user.ID, binID, types.RoleUploader)
+	if !ok {
+		return
+	}
+	var profileID *int
+	if profileIDStr != "" {
+		id, err := strconv.Atoi(profileIDStr)
+		if err != nil {
+			utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid profile"))
+			return
+		}
+		if _, ok := h.permissions.Profile(w, bin, id); !ok {
+			return
+		}
+		profileID = &id
+	}
+	storageKey, err := h.permissions.StorageKey(bin)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
 
 	if err := h.store.ReferenceNameExistsInBin(referenceName, binID); err != nil {
 		utils.WriteError(w, http.StatusBadRequest, err)
@@ -154,9 +210,29 @@ func (h *Handler) handleInsertDocument(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, fmt.Sprintf("failed to get file from request: %v", err), http.StatusInternalServerError)
 		return
 	}
+	if fileHeader.Size > config.Envs.MaxUploadSizeInBytes {
+		utils.WriteError(w, http.StatusRequestEntityTooLarge, fmt.Errorf("file is larger than %d bytes", config.Envs.MaxUploadSizeInBytes))
+		return
+	}
+	binQuota, err := quota.ForBin(h.quotaStore, bin)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	// turn the file away before it is stored if it can't fit; inserting the
+	// document checks again, as other uploads may take the room meanwhile
+	err = quota.CheckRoom(binQuota, h.store, bin, 1, fileHeader.Size)
+	if errors.Is(err, types.ErrQuotaExceeded) {
+		utils.WriteError(w, http.StatusInsufficientStorage, err)
+		return
+	}
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
 
 	// Upload file to MinIO
-	fileKey := path.Join(utils.HashString(user.Email), strconv.Itoa(binID), utils.HashString(referenceName))
+	fileKey := path.Join(storageKey, strconv.Itoa(binID), utils.HashString(referenceName))
 	err = utils.UploadToMinio(r.Context(), h.minio, file, fileHeader, fileKey)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -169,24 +245,30 @@ func (h *Handler) handleInsertDocument(w http.ResponseWriter, r *http.Request) {
 		Name:          fileHeader.Filename,
 		ReferenceName: referenceName,
 		Language:      language,
-	})
+		ProfileID:     profileID,
+		Size:          &fileHeader.Size,
+		ContentType:   fileHeader.Header.Get("Content-Type"),
+	}, user.ID, binQuota)
+	if errors.Is(err, types.ErrQuotaExceeded) {
+		utils.DeleteObject(r.Context(), h.minio, fileKey)
+		utils.WriteError(w, http.StatusInsufficientStorage, err)
+		return
+	}
 	if err != nil {
 		utils.WriteError(w, http.StatusInternalServerError, fmt.Errorf("unable to insert document: %v", err))
 		return
 	}
 	// queue for extraction
-	parts := strings.Split(fileHeader.Filename, ".")
-	var extension string
-	if len(parts) > 1 {
-		extension = parts[len(parts)-1]
-	}
-
+	// indexed under the owner, who can search everything in their bins, or
+	// under the organization, whose members can
 	err = utils.QueueForExtraction(h.rmqChan, h.rmq, utils.ExtractionArgs{
-		DocID:     document.ID,
-		UserID:    user.ID,
-		FileKey:   fileKey,
-		Extension: extension,
-		Language:  language,
+		DocID:          document.ID,
+		UserID:         bin.OwnerID,
+		OrganizationID: bin.OrganizationID,
+		FileKey:        fileKey,
+		Extension:      fileExtension(fileHeader.Filename),
+		Language:       language,
+		Version:        document.Version,
 	})
 	if err != nil {
 		utils.WriteJSON(w, http.StatusCreated, fmt.Errorf("unable to queue for extraction: %v", err))
@@ -194,6 +276,15 @@ func (h *Handler) handleInsertDocument(w http.ResponseWriter, r *http.Request) {
 	utils.WriteJSON(w, http.StatusCreated, document)
 }
 
+// fileExtension returns the part of the file name after the last dot.
+func fileExtension(filename string) string {
+	parts := strings.Split(filename, ".")
+	if len(parts) > 1 {
+		return parts[len(parts)-1]
+	}
+	return ""
+}
+
 func (h *Handler) handleEditDocument(w http.ResponseWriter, r *http.Request) {
 	user, err := auth.ExtractUserFromContext(r)
 	if err != nil {
@@ -211,59 +302,96 @@ func (h *Handler) handleEditDocument(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	doc, err := h.store.GetDocumentByID(payload.Id)
-	if err != nil {
-		utils.WriteError(w, http.StatusBadRequest, err)
+	doc, bin, ok := h.permissions.Document(w, user.ID, payload.Id, types.RoleEditor)
+	if !ok {
 		return
 	}
+	var meta types.DocumentMetadata
+	if payload.EditsMetadata() {
+		meta = payload.ApplyTo(doc.DocumentMetadata)
+		if err := meta.Validate(utils.DocumentTypes()); err != nil {
+			utils.WriteError(w, http.StatusBadRequest, err)
+			return
+		}
+	}
 
-	if doc.ReferenceName == payload.ReferenceName {
-		utils.WriteJSON(w, http.StatusNoContent, nil)
-		return
+	// the metadata goes first: it can be put back if the rename fails, while
+	// a moved object can't be once the metadata fails to save
+	if payload.EditsMetadata() {
+		if err := h.setMetadata(r.Context(), doc.ID, meta); err != nil {
+			utils.WriteError(w, http.StatusInternalServerError, err)
+			return
+		}
+	}
+
+	if payload.ReferenceName != nil && *payload.ReferenceName != doc.ReferenceName {
+		if !h.renameDocument(w, r, doc, bin, *payload.ReferenceName) {
+			if payload.EditsMetadata() {
+				if err := h.setMetadata(context.Background(), doc.ID, doc.DocumentMetadata); err != nil {
+					log.Printf("unable to put back metadata of document %d: %v\n", doc.ID, err)
+				}
+			}
+			return
+		}
 	}
+	utils.WriteJSON(w, http.StatusNoContent, nil)
+}
 
-	bin, err := h.binStore.GetBinById(doc.BinID)
+// setMetadata saves the document's metadata and copies it to its search entry.
+func (h *Handler) setMetadata(ctx context.Context, docID int, meta types.DocumentMetadata) error {
+	updated, err := h.store.UpdateDocumentMetadata(docID, meta)
 	if err != nil {
-		utils.WriteError(w, http.StatusBadRequest, err)
-		return
+		return err
+	}
+	err = utils.UpdateIndexedDocument(ctx, h.esClient, docID, utils.MetadataFields(updated))
+	if err != nil {
+		log.Printf("unable to update search index of document %d: %v\n", docID, err)
 	}
+	return nil
+}
 
-	if bin.OwnerID != user.ID {
-		utils.WriteError(w, http.StatusForbidden, fmt.Errorf("document doesn't belong to user"))
-		return
+// renameDocument gives the document a new reference name and moves its object
+// to match.
+func (h *Handler) renameDocument(w http.ResponseWriter, r *http.Request, doc *types.Document, bin *types.Bin, name string) bool {
+	storageKey, err := h.permissions.StorageKey(bin)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return false
 	}
 
-	err = h.store.UpdateDocumentName(payload.Id, payload.ReferenceName)
+	err = h.store.UpdateDocumentName(doc.ID, name)
 	if err != nil {
 		utils.WriteError(w, http.StatusInternalServerError, err)
-		return
+		return false
 	}
 
-	old := path.Join(utils.HashString(user.Email), strconv.Itoa(bin.ID), utils.HashString(doc.ReferenceName))
-	new := path.Join(utils.HashString(user.Email), strconv.Itoa(bin.ID), utils.HashString(payload.ReferenceName))
+	old := path.Join(storageKey, strconv.Itoa(bin.ID), utils.HashString(doc.ReferenceName))
+	new := path.Join(storageKey, strconv.Itoa(bin.ID), utils.HashString(name))
 	err = utils.RenameObject(r.Context(), h.minio, old, new)
 	if err != nil {
 		utils.WriteError(w, http.StatusInternalServerError, fmt.Errorf("unable to rename document: %v", err))
-		err = h.store.UpdateDocumentName(payload.Id, doc.ReferenceName)
+		err = h.store.UpdateDocumentName(doc.ID, doc.ReferenceName)
 		if err != nil {
 			log.Printf("unable to revert file name in db: %v\n", err)
 		}
-		return
+		return false
 	}
 	err = utils.DeleteObject(r.Context(), h.minio, old)
 	if err != nil {
 		log.Printf("unable to delete file in minio: %v\n", err)
 	}
-	utils.WriteJSON(w, http.StatusNoContent, nil)
+	return true
 }
 
-func (h *Handler) handleDeleteDocument(w http.ResponseWriter, r *http.Request) {
+// handleSetDocumentProfile files a document in an organization bin under one
+// of the organization's managed profiles, or takes it off with a null profile.
+func (h *Handler) handleSetDocumentProfile(w http.ResponseWriter, r *http.Request) {
 	user, err := auth.ExtractUserFromContext(r)
 	if err != nil {
 		utils.WriteError(w, http.StatusForbidden, err)
 		return
 	}
-	var payload types.DeleteBinDocPayload
+	var payload types.SetDocumentProfilePayload
 	if err := utils.ParseJSON(r, &payload); err != nil {
 		utils.WriteError(w, http.StatusBadRequest, err)
 		return
@@ -273,31 +401,72 @@ func (h *Handler) handleDeleteDocument(w http.ResponseWriter, r *http.Request) {
 		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid payload %v", errors))
 		return
 	}
-	doc, err := h.store.GetDocumentByID(payload.Id)
-	if err != nil {
-		utils.WriteError(w, http.StatusBadRequest, err)
+	doc, bin, ok := h.permissions.Document(w, user.ID, payload.Id, types.RoleEditor)
+	if !ok {
+		return
+	}
+	if payload.Profile != nil {
+		if _, ok := h.permissions.Profile(w, bin, *payload.Profile); !ok {
+			return
+		}
+	}
+	if err := h.store.SetDocumentProfile(doc.ID, payload.Profile); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
 		return
 	}
-	bin, err := h.binStore.GetBinById(doc.BinID)
+	utils.WriteJSON(w, http.StatusNoContent, nil)
+}
+
+func (h *Handler) handleDeleteDocument(w http.ResponseWriter, r *http.Request) {
+	user, err := auth.ExtractUserFromContext(r)
 	if err != nil {
+		utils.WriteError(w, http.StatusForbidden, err)
+		return
+	}
+	var payload types.DeleteBinDocPayload
+	if err := utils.ParseJSON(r, &payload); err != nil {
 		utils.WriteError(w, http.StatusBadRequest, err)
 		return
 	}
-	if bin.OwnerID != user.ID {
-		utils.WriteError(w, http.StatusForbidden, fmt.Errorf("document doesn't belong to user"))
+	if err := utils.Validate.Struct(payload); err != nil {
+		errors := err.(validator.ValidationErrors)
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid payload %v", errors))
+		return
+	}
+	doc, bin, ok := h.permissions.Document(w, user.ID, payload.Id, types.RoleEditor)
+	if !ok {
 		return
 	}
-	err = utils.DeleteObject(r.Context(), h.minio, path.Join(utils.HashString(user.Email),
-		strconv.Itoa(doc.BinID), utils.HashString(doc.ReferenceName)))
+	storageKey, err := h.permissions.StorageKey(bin)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	// the object is parked in the trash so a new document can take the name
+	object := path.Join(storageKey, strconv.Itoa(doc.BinID), utils.HashString(doc.ReferenceName))
+	trashed := utils.TrashedObjectKey(storageKey, doc.BinID, doc.ID)
+	err = utils.CopyObject(r.Context(), h.minio, object, trashed)
 	if err != nil {
 		utils.WriteError(w, http.StatusInternalServerError, fmt.Errorf("unable to delete object: %v", err))
 		return
 	}
-	err = h.store.DeleteDocumentByID(payload.Id)
+	_, err = h.store.TrashDocument(doc.ID, user.ID)
 	if err != nil {
+		if err := utils.DeleteObject(r.Context(), h.minio, trashed); err != nil {
+			log.Printf("unable to delete file in minio: %v\n", err)
+		}
 		utils.WriteError(w, http.StatusInternalServerError, err)
 		return
 	}
+	if err := utils.DeleteObject(r.Context(), h.minio, object); err != nil {
+		log.Printf("unable to delete file in minio: %v\n", err)
+	}
+	err = utils.DeleteFromIndex(r.Context(), h.esClient, map[string]interface{}{
+		"term": map[string]interface{}{"document_id": doc.ID},
+	})
+	if err != nil {
+		log.Printf("unable to remove document %d from search: %v", doc.ID, err)
+	}
 	utils.WriteJSON(w, http.StatusNoContent, nil)
 }
 
@@ -314,65 +483,34 @@ func (h *Handler) handleSearchDocuments(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	searchQuery := map[string]interface{}{
-		"query": map[string]interface{}{
-			"bool": map[string]interface{}{
-				"must": []map[string]interface{}{
-					{"match": map[string]interface{}{"text": query}},
-				},
-				"filter": []map[string]interface{}{
-					{"term": map[string]interface{}{"user_id": user.ID}},
-				},
-			},
-		},
-	}
-
-	var buf bytes.Buffer
-	if err := json.NewEncoder(&buf).Encode(searchQuery); err != nil {
-		utils.WriteError(w, http.StatusInternalServerError, fmt.Errorf("failed to encode search query: %v", err))
+	metadataFilter, err := utils.ParseDocumentFilter(r.URL.Query())
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
 		return
 	}
 
-	res, err := h.esClient.Search(
-		h.esClient.Search.WithContext(context.Background()),
-		h.esClient.Search.WithIndex("documents"),
-		h.esClient.Search.WithBody(&buf),
-		h.esClient.Search.WithPretty(),
-	)
+	orgIDs, err := h.permissions.OrganizationIDs(user.ID)
 	if err != nil {
-		utils.WriteError(w, http.StatusInternalServerError, fmt.Errorf("search query failed: %v", err))
+		utils.WriteError(w, http.StatusInternalServerError, err)
 		return
 	}
-	defer res.Body.Close()
-
-	if res.StatusCode != http.StatusOK {
-		utils.WriteError(w, res.StatusCode, fmt.Errorf("error from elasticsearch"))
-		return
+	// the user's own documents and those of their organizations
+	filter := map[string]interface{}{
+		"bool": map[string]interface{}{
+			"should": []map[string]interface{}{
+				{"term": map[string]interface{}{"user_id": user.ID}},
+				{"terms": map[string]interface{}{"organization_id": orgIDs}},
+			},
+			"minimum_should_match": 1,
+			"filter":               utils.MetadataFilters(metadataFilter),
+		},
 	}
-
-	var esRes map[string]interface{}
-	if err := json.NewDecoder(res.Body).Decode(&esRes); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	docIDs, err := utils.SearchDocuments(r.Context(), h.esClient, query, filter, 4)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
 		return
 	}
 
-	// Extract document IDs from Elasticsearch response
-	var docIDs []int
-	if hits, ok := esRes["hits"].(map[string]interface{})["hits"].([]interface{}); ok {
-		for i, hit := range hits {
-			if i > 3 {
-				break
-			}
-			if hitMap, ok := hit.(map[string]interface{}); ok {
-				if source, ok := hitMap["_source"].(map[string]interface{}); ok {
-					if docID, ok := source["document_id"].(float64); ok {
-						docIDs = append(docIDs, int(docID))
-					}
-				}
-			}
-		}
-	}
-
 	if len(docIDs) == 0 {
 		json.NewEncoder(w).Encode([]interface{}{})
 		return
@@ -386,3 +524,7 @@ func (h *Handler) handleSearchDocuments(w http.ResponseWriter, r *http.Request)
 
 	json.NewEncoder(w).Encode(documents)
 }
+
+func (h *Handler) handleGetDocumentTypes(w http.ResponseWriter, r *http.Request) {
+	utils.WriteJSON(w, http.StatusOK, utils.DocumentTypes())
+}
@@ -3,6 +3,8 @@ package document
 import (
 	"database/sql"
 	"fmt"
+	"strconv"
+	"strings"
 
 	"github.com/LikheKeto/Suraksheet/types"
 	"github.com/lib/pq"
@@ -18,23 +20,17 @@ func NewStore(db *sql.DB) *Store {
 	}
 }
 
-func (s *Store) GetDocumentOwner(id int) (int, error) {
-	row := s.db.QueryRow("SELECT b.owner FROM documents d JOIN bins b ON d.bin = b.id WHERE d.id = $1;", id)
-	var ownerID int
-	if err := row.Scan(&ownerID); err != nil {
-		return 0, err
-	}
-	return ownerID, nil
-}
-
-func (s *Store) GetDocumentsInBin(binID int) ([]types.Document, error) {
-	rows, err := s.db.Query("SELECT * FROM documents WHERE bin = $1;", binID)
+func (s *Store) GetDocumentsInBin(binID int, filter types.DocumentFilter) ([]types.Document, error) {
+	conditions, args := filterConditions(filter, []any{binID})
+	rows, err := s.db.Query("SELECT * FROM documents WHERE bin = $1 AND deletedAt IS NULL"+conditions+";", args...)
 	if err != nil {
 		return nil, err
 	}
+	defer rows.Close()
+
 	docs := make([]types.Document, 0)
 	for rows.Next() {
-		doc, err := scanRowsIntoDocument(rows)
+		doc, err := scanRowIntoDocument(rows)
 		if err != nil {
 			return nil, err
 		}
@@ -43,13 +39,43 @@ func (s *Store) GetDocumentsInBin(binID int) ([]types.Document, error) {
 	return docs, nil
 }
 
+// filterConditions returns the SQL conditions, each starting with AND, that
+// the documents passing filter meet.
+// Their arguments are numbered after args and appended to them.
+func filterConditions(filter types.DocumentFilter, args []any) (string, []any) {
+	var conditions strings.Builder
+	add := func(condition string, arg any) {
+		args = append(args, arg)
+		conditions.WriteString(" AND " + strings.ReplaceAll(condition, "?", "$"+strconv.Itoa(len(args))))
+	}
+	if filter.DocumentType != "" {
+		add("documentType = ?", filter.DocumentType)
+	}
+	if filter.Issuer != "" {
+		add("strpos(lower(issuer), lower(?)) > 0", filter.Issuer)
+	}
+	if filter.HolderName != "" {
+		add("strpos(lower(holderName), lower(?)) > 0", filter.HolderName)
+	}
+	if filter.DocumentNumber != "" {
+		add("lower(documentNumber) = lower(?)", filter.DocumentNumber)
+	}
+	if filter.ExpiresAfter != nil {
+		add("expiryDate >= ?", *filter.ExpiresAfter)
+	}
+	if filter.ExpiresBefore != nil {
+		add("expiryDate < ?", *filter.ExpiresBefore)
+	}
+	return conditions.String(), args
+}
+
 func (s *Store) DeleteDocumentByID(id int) error {
 	_, err := s.db.Exec("DELETE FROM documents WHERE id = $1;", id)
 	return err
 }
 
 func (s *Store) ReferenceNameExistsInBin(name string, binID int) error {
-	row := s.db.QueryRow("SELECT id FROM documents WHERE bin = $1 AND referenceName = $2;", binID, name)
+	row := s.db.QueryRow("SELECT id FROM documents WHERE bin = $1 AND referenceName = $2 AND deletedAt IS NULL;", binID, name)
 	var id int
 	if err := row.Scan(&id); err != nil {
 		if err == sql.ErrNoRows {
@@ -61,46 +87,354 @@ func (s *Store) ReferenceNameExistsInBin(name string, binID int) error {
 }
 
 func (s *Store) GetDocumentByID(id int) (*types.Document, error) {
-	row := s.db.QueryRow("SELECT * FROM documents WHERE id = $1;", id)
-	doc := new(types.Document)
-	if err := row.Scan(&doc.ID, &doc.Name, &doc.ReferenceName,
-		&doc.BinID, &doc.Url, &doc.Extract, &doc.CreatedAt, &doc.Language); err != nil {
+	row := s.db.QueryRow("SELECT * FROM documents WHERE id = $1 AND deletedAt IS NULL;", id)
+	return scanRowIntoDocument(row)
+}
+
+func (s *Store) InsertDocument(doc types.Document, uploadedBy int, quota *types.Quota) (*types.Document, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
 		return nil, err
 	}
+	defer tx.Rollback()
+
+	var created *types.Document
+	err = withinQuota(tx, doc.BinID, quota, func() error {
+		query := `
+			INSERT INTO documents (name, referenceName, bin, url, language, profile, size, contentType)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+			RETURNING *;
+		`
+		row := tx.QueryRow(query, doc.Name, doc.ReferenceName, doc.BinID, doc.Url, doc.Language, doc.ProfileID, doc.Size, doc.ContentType)
+		var err error
+		created, err = scanRowIntoDocument(row)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec(`
+			INSERT INTO document_versions (document, version, name, size, contentType, language, uploadedBy)
+			VALUES ($1, $2, $3, $4, $5, $6, $7);
+		`, created.ID, created.Version, created.Name, created.Size, created.ContentType, created.Language, uploadedBy)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return created, nil
+}
+
+func (s *Store) UpdateDocumentName(id int, name string) error {
+	_, err := s.db.Exec("UPDATE documents SET referenceName = $1 WHERE id = $2;", name, id)
+	if err != nil {
+		return fmt.Errorf("unable to update document: %v", err)
+	}
+	return nil
+}
+
+func (s *Store) UpdateDocumentMetadata(id int, meta types.DocumentMetadata) (*types.Document, error) {
+	row := s.db.QueryRow(`
+		UPDATE documents SET documentType = $1, issuer = $2, documentNumber = $3,
+			issueDate = $4, expiryDate = $5, holderName = $6
+		WHERE id = $7
+		RETURNING *;
+	`, meta.DocumentType, meta.Issuer, meta.DocumentNumber, meta.IssueDate, meta.ExpiryDate, meta.HolderName, id)
+	doc, err := scanRowIntoDocument(row)
+	if err != nil {
+		return nil, fmt.Errorf("unable to update document: %v", err)
+	}
 	return doc, nil
 }
 
-func (s *Store) InsertDocument(doc types.Document) (*types.Document, error) {
-	var newDoc types.Document
+func (s *Store) SetDocumentProfile(id int, profileID *int) error {
+	_, err := s.db.Exec("UPDATE documents SET profile = $1 WHERE id = $2;", profileID, id)
+	return err
+}
+
+func (s *Store) GetDocumentsByProfile(profileID int, filter types.DocumentFilter) ([]types.Document, error) {
+	conditions, args := filterConditions(filter, []any{profileID})
+	rows, err := s.db.Query("SELECT * FROM documents WHERE profile = $1 AND deletedAt IS NULL"+conditions+" ORDER BY createdAt DESC;", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	docs := make([]types.Document, 0)
+	for rows.Next() {
+		doc, err := scanRowIntoDocument(rows)
+		if err != nil {
+			return nil, err
+		}
+		docs = append(docs, *doc)
+	}
+	return docs, nil
+}
+
+func (s *Store) GetReferenceNamesInBin(binID int) ([]string, error) {
+	rows, err := s.db.Query("SELECT referenceName FROM documents WHERE bin = $1 AND deletedAt IS NULL;", binID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	names := make([]string, 0)
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		names = append(names, name)
+	}
+	return names, nil
+}
 
-	query := `
-		INSERT INTO documents (name, referenceName, bin, url, language)
-		VALUES ($1, $2, $3, $4, $5)
-		RETURNING id, name, referenceName, bin, url, extract, createdAt, language;
-	`
-	err := s.db.QueryRow(query, doc.Name, doc.ReferenceName, doc.BinID, doc.Url, doc.Language).Scan(
-		&newDoc.ID, &newDoc.Name, &newDoc.ReferenceName,
-		&newDoc.BinID, &newDoc.Url, &newDoc.Extract, &newDoc.CreatedAt, &newDoc.Language,
-	)
+func (s *Store) MoveDocuments(docs []types.Document, quota *types.Quota, moveObject func(docID int, objectKey string) (string, error)) error {
+	if len(docs) == 0 {
+		return nil
+	}
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// the documents all go into the same bin
+	err = withinQuota(tx, docs[0].BinID, quota, func() error {
+		for _, doc := range docs {
+			_, err := tx.Exec(`
+				UPDATE documents SET bin = $1, referenceName = $2, profile = $3 WHERE id = $4;
+			`, doc.BinID, doc.ReferenceName, doc.ProfileID, doc.ID)
+			if err != nil {
+				return fmt.Errorf("unable to move document %d: %v", doc.ID, err)
+			}
+			if moveObject == nil {
+				continue
+			}
+			if err := moveObjects(tx, doc.ID, moveObject); err != nil {
+				return fmt.Errorf("unable to move the objects of document %d: %v", doc.ID, err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// moveObjects records where moveObject put the objects of the document's
+// pages and older versions.
+func moveObjects(tx *sql.Tx, docID int, moveObject func(docID int, objectKey string) (string, error)) error {
+	for _, table := range []string{"document_pages", "document_versions"} {
+		keys, err := documentObjectKeys(tx, table, docID)
+		if err != nil {
+			return err
+		}
+		for _, key := range keys {
+			moved, err := moveObject(docID, key)
+			if err != nil {
+				return err
+			}
+			if moved == key {
+				continue
+			}
+			_, err = tx.Exec("UPDATE "+table+" SET objectKey = $1 WHERE document = $2 AND objectKey = $3;", moved, docID, key)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func documentObjectKeys(q rowsQuerier, table string, docID int) ([]string, error) {
+	rows, err := q.Query("SELECT objectKey FROM "+table+" WHERE document = $1 AND objectKey <> '';", docID)
 	if err != nil {
 		return nil, err
 	}
+	defer rows.Close()
 
-	return &newDoc, nil
+	keys := make([]string, 0)
+	for rows.Next() {
+		var key string
+		if err := rows.Scan(&key); err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
 }
 
-func (s *Store) UpdateDocumentName(id int, name string) error {
-	_, err := s.db.Exec("UPDATE documents SET referenceName = $1 WHERE id = $2;", name, id)
+func (s *Store) CopyDocuments(docs []types.Document, quota *types.Quota, copyPage func(docID int, objectKey string) (string, error)) ([]types.Document, error) {
+	copies := make([]types.Document, 0, len(docs))
+	if len(docs) == 0 {
+		return copies, nil
+	}
+	tx, err := s.db.Begin()
 	if err != nil {
-		return fmt.Errorf("unable to update document: %v", err)
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// the copies all go into the same bin
+	err = withinQuota(tx, docs[0].BinID, quota, func() error {
+		return copyDocuments(tx, docs, &copies, copyPage)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return copies, nil
+}
+
+func copyDocuments(tx *sql.Tx, docs []types.Document, copies *[]types.Document, copyPage func(docID int, objectKey string) (string, error)) error {
+	for _, doc := range docs {
+		// copies without text are queued for extraction again
+		status := types.ExtractionCompleted
+		if doc.Extract == "" {
+			status = types.ExtractionPending
+		}
+		newDoc, err := scanRowIntoDocument(tx.QueryRow(`
+			INSERT INTO documents (name, referenceName, bin, url, extract, language, profile, size, contentType, extractionStatus,
+				documentType, issuer, documentNumber, issueDate, expiryDate, holderName)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16)
+			RETURNING *;
+		`, doc.Name, doc.ReferenceName, doc.BinID, doc.Url, doc.Extract, doc.Language, doc.ProfileID, doc.Size, doc.ContentType, status,
+			doc.DocumentType, doc.Issuer, doc.DocumentNumber, doc.IssueDate, doc.ExpiryDate, doc.HolderName))
+		if err != nil {
+			return fmt.Errorf("unable to copy document %d: %v", doc.ID, err)
+		}
+		// the copy starts its own history from the current version
+		_, err = tx.Exec(`
+			INSERT INTO document_versions (document, version, name, size, contentType, language, uploadedBy)
+			SELECT $1, $2, name, size, contentType, language, uploadedBy
+			FROM document_versions WHERE document = $3 AND version = $4;
+		`, newDoc.ID, newDoc.Version, doc.ID, doc.Version)
+		if err != nil {
+			return fmt.Errorf("unable to copy document %d: %v", doc.ID, err)
+		}
+		if err := copyPages(tx, doc.ID, newDoc.ID, copyPage); err != nil {
+			return fmt.Errorf("unable to copy the pages of document %d: %v", doc.ID, err)
+		}
+		*copies = append(*copies, *newDoc)
+	}
+	return nil
+}
+
+// copyPages gives the copy of a document the pages of the original, each with
+// its own copy of the page's object.
+func copyPages(tx *sql.Tx, docID, copyID int, copyPage func(docID int, objectKey string) (string, error)) error {
+	pages, err := documentPages(tx, docID)
+	if err != nil {
+		return err
+	}
+	for _, page := range pages {
+		key := page.ObjectKey
+		if key != "" {
+			if key, err = copyPage(copyID, key); err != nil {
+				return err
+			}
+		}
+		_, err := tx.Exec(`
+			INSERT INTO document_pages (document, position, name, size, contentType, objectKey, extract, extractionStatus, createdAt)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9);
+		`, copyID, page.Page, page.Name, page.Size, page.ContentType, key, page.Extract, page.ExtractionStatus, page.CreatedAt)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Store) GetStorageUsage(userID int, orgID *int) (*types.QuotaUsage, error) {
+	return storageUsage(s.db, userID, orgID)
+}
+
+// withinQuota runs change and fails with ErrQuotaExceeded if that takes the
+// owner of the bin over the quota. Changes to one owner's documents take
+// turns, so two uploads can't both squeeze into the last bit of room.
+func withinQuota(tx *sql.Tx, binID int, quota *types.Quota, change func() error) error {
+	if quota == nil {
+		return change()
+	}
+	var ownerID sql.NullInt64
+	var orgID *int
+	err := tx.QueryRow("SELECT owner, organization FROM bins WHERE id = $1;", binID).Scan(&ownerID, &orgID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return fmt.Errorf("bin with id doesn't exist")
+		}
+		return err
+	}
+	// the same keys bin moves lock on
+	lockKey := ownerID.Int64
+	if orgID != nil {
+		lockKey = -int64(*orgID)
+	}
+	if _, err := tx.Exec("SELECT pg_advisory_xact_lock($1);", lockKey); err != nil {
+		return err
+	}
+	before, err := storageUsage(tx, int(ownerID.Int64), orgID)
+	if err != nil {
+		return err
+	}
+	if err := change(); err != nil {
+		return err
+	}
+	after, err := storageUsage(tx, int(ownerID.Int64), orgID)
+	if err != nil {
+		return err
+	}
+	if quota.Exceeded(*before, *after) {
+		return types.ErrQuotaExceeded
 	}
 	return nil
 }
 
+type querier interface {
+	QueryRow(query string, args ...any) *sql.Row
+}
+
+// selectUsage counts documents and adds up their sizes along with those of
+// their older versions and extra pages.
+const selectUsage = `
+	SELECT COUNT(d.id), COALESCE(SUM(d.size), 0) + COALESCE(SUM(v.size), 0)
+	FROM documents d JOIN bins b ON b.id = d.bin
+	LEFT JOIN (
+		SELECT document, SUM(size) AS size FROM (
+			SELECT document, size FROM document_versions WHERE objectKey <> ''
+			UNION ALL
+			SELECT document, size FROM document_pages WHERE objectKey <> ''
+		) kept GROUP BY document
+	) v ON v.document = d.id
+`
+
+func storageUsage(q querier, userID int, orgID *int) (*types.QuotaUsage, error) {
+	var row *sql.Row
+	if orgID != nil {
+		row = q.QueryRow(selectUsage+`
+			WHERE b.organization = $1;
+		`, *orgID)
+	} else {
+		row = q.QueryRow(selectUsage+`
+			WHERE b.owner = $1 AND b.organization IS NULL;
+		`, userID)
+	}
+	usage := new(types.QuotaUsage)
+	if err := row.Scan(&usage.Documents, &usage.Bytes); err != nil {
+		return nil, err
+	}
+	return usage, nil
+}
+
 func (s *Store) FetchDocumentsFromDB(docIDs []int) ([]*types.Document, error) {
 	var documents []*types.Document
 
-	query := "SELECT * FROM documents WHERE id = ANY($1)"
+	query := "SELECT * FROM documents WHERE id = ANY($1) AND deletedAt IS NULL"
 	rows, err := s.db.Query(query, pq.Array(docIDs))
 	if err != nil {
 		return nil, err
@@ -108,7 +442,7 @@ func (s *Store) FetchDocumentsFromDB(docIDs []int) ([]*types.Document, error) {
 	defer rows.Close()
 
 	for rows.Next() {
-		doc, err := scanRowsIntoDocument(rows)
+		doc, err := scanRowIntoDocument(rows)
 		if err != nil {
 			return nil, err
 		}
@@ -118,12 +452,502 @@ func (s *Store) FetchDocumentsFromDB(docIDs []int) ([]*types.Document, error) {
 	return documents, nil
 }
 
-func scanRowsIntoDocument(rows *sql.Rows) (*types.Document, error) {
+func (s *Store) GetDocumentIDsInBins(binIDs []int) ([]int, error) {
+	rows, err := s.db.Query("SELECT id FROM documents WHERE bin = ANY($1);", pq.Array(binIDs))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := make([]int, 0)
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+func (s *Store) GetDocumentStats(binIDs []int) (*types.DocumentStats, error) {
+	rows, err := s.db.Query(`
+		SELECT contentType, language, extractionStatus, COUNT(*), COALESCE(SUM(size), 0)
+		FROM documents
+		WHERE bin = ANY($1) AND deletedAt IS NULL
+		GROUP BY contentType, language, extractionStatus;
+	`, pq.Array(binIDs))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	stats := types.NewDocumentStats()
+	for rows.Next() {
+		var contentType, language, extractionStatus string
+		var documents int
+		var bytes int64
+		if err := rows.Scan(&contentType, &language, &extractionStatus, &documents, &bytes); err != nil {
+			return nil, err
+		}
+		stats.Add(contentType, language, extractionStatus, documents, bytes)
+	}
+	return stats, nil
+}
+
+func (s *Store) GetDocumentsWithoutSize(limit int) ([]types.Document, error) {
+	rows, err := s.db.Query("SELECT * FROM documents WHERE size IS NULL AND deletedAt IS NULL ORDER BY id LIMIT $1;", limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	documents := make([]types.Document, 0)
+	for rows.Next() {
+		doc, err := scanRowIntoDocument(rows)
+		if err != nil {
+			return nil, err
+		}
+		documents = append(documents, *doc)
+	}
+	return documents, nil
+}
+
+func (s *Store) SetDocumentSize(id int, size int64, contentType string) error {
+	_, err := s.db.Exec("UPDATE documents SET size = $1, contentType = $2 WHERE id = $3;", size, contentType, id)
+	return err
+}
+
+// TrashDocument moves the document to the trash. The caller moves its object
+// out of the way first, so the reference name can be used again.
+func (s *Store) TrashDocument(id int, userID int) (*types.TrashEntry, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	doc, err := scanRowIntoDocument(tx.QueryRow(`
+		UPDATE documents SET deletedAt = CURRENT_TIMESTAMP
+		WHERE id = $1 AND deletedAt IS NULL
+		RETURNING *;
+	`, id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("document not found")
+		}
+		return nil, err
+	}
+	entry := &types.TrashEntry{DocumentID: &doc.ID, Name: doc.ReferenceName, DeletedBy: &userID}
+	err = tx.QueryRow(`
+		INSERT INTO trash (document, deletedBy, deletedAt)
+		VALUES ($1, $2, CURRENT_TIMESTAMP)
+		RETURNING id, deletedAt;
+	`, id, userID).Scan(&entry.ID, &entry.DeletedAt)
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return entry, nil
+}
+
+// ownExtract is the text of document d's own file, which is that of the
+// document unless it has pages.
+const ownExtract = `COALESCE((SELECT p.extract FROM document_pages p WHERE p.document = d.id AND p.objectKey = ''), d.extract)`
+
+// selectVersion reads a version from document_versions v joined with its
+// document d, whose row holds the text of the current version.
+const selectVersion = `
+	SELECT v.id, v.document, v.version, v.name, v.size, v.contentType, v.language,
+		CASE WHEN v.version = d.version THEN ` + ownExtract + ` ELSE v.extract END,
+		v.uploadedBy, v.createdAt, v.version = d.version, v.objectKey
+	FROM document_versions v JOIN documents d ON d.id = v.document
+`
+
+func (s *Store) GetDocumentVersions(docID int) ([]types.DocumentVersion, error) {
+	rows, err := s.db.Query(selectVersion+"WHERE v.document = $1 ORDER BY v.version DESC;", docID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	versions := make([]types.DocumentVersion, 0)
+	for rows.Next() {
+		version, err := scanRowIntoVersion(rows)
+		if err != nil {
+			return nil, err
+		}
+		versions = append(versions, *version)
+	}
+	return versions, rows.Err()
+}
+
+func (s *Store) GetDocumentVersion(docID, version int) (*types.DocumentVersion, error) {
+	v, err := scanRowIntoVersion(s.db.QueryRow(selectVersion+"WHERE v.document = $1 AND v.version = $2;", docID, version))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("version %d not found", version)
+		}
+		return nil, err
+	}
+	return v, nil
+}
+
+func (s *Store) AddDocumentVersion(doc types.Document, archivedKey string, next types.Document, uploadedBy int, quota *types.Quota, keep int, write func() error, undo func()) (*types.Document, []string, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, nil, err
+	}
+	defer tx.Rollback()
+
+	var updated *types.Document
+	written := false
+	err = withinQuota(tx, doc.BinID, quota, func() error {
+		// versions of the same document take turns, so one upload can't write
+		// over the objects of another
+		var version int
+		err := tx.QueryRow("SELECT version FROM documents WHERE id = $1 AND deletedAt IS NULL FOR UPDATE;", doc.ID).Scan(&version)
+		if err != nil {
+			if err == sql.ErrNoRows {
+				return fmt.Errorf("document not found")
+			}
+			return err
+		}
+		if version != doc.Version {
+			return errDocumentChanged
+		}
+		if err := write(); err != nil {
+			return err
+		}
+		written = true
+		updated, err = addVersion(tx, doc, archivedKey, next, uploadedBy)
+		return err
+	})
+	if err == nil {
+		var dropped []string
+		dropped, err = dropVersions(tx, doc.ID, updated.Version, keep)
+		if err == nil {
+			if err = tx.Commit(); err == nil {
+				return updated, dropped, nil
+			}
+		}
+	}
+	if written {
+		undo()
+	}
+	return nil, nil, err
+}
+
+// errDocumentChanged is returned when a document got a new version while
+// another one was being added.
+var errDocumentChanged = fmt.Errorf("the document was changed in the meantime, try again")
+
+func addVersion(tx *sql.Tx, doc types.Document, archivedKey string, next types.Document, uploadedBy int) (*types.Document, error) {
+	// the current version keeps its text next to its object
+	_, err := tx.Exec(`
+		INSERT INTO document_versions (document, version, name, size, contentType, language, extract, objectKey, createdAt)
+		SELECT id, version, name, size, contentType, language, `+ownExtract+`, $1, createdAt
+		FROM documents d WHERE id = $2 AND version = $3
+		ON CONFLICT (document, version) DO UPDATE
+		SET objectKey = EXCLUDED.objectKey, extract = EXCLUDED.extract;
+	`, archivedKey, doc.ID, doc.Version)
+	if err != nil {
+		return nil, err
+	}
+	updated, err := scanRowIntoDocument(tx.QueryRow(`
+		UPDATE documents
+		SET version = version + 1, name = $1, size = $2, contentType = $3, language = $4,
+			extract = $5, extractionStatus = $6
+		WHERE id = $7 AND version = $8 AND deletedAt IS NULL
+		RETURNING *;
+	`, next.Name, next.Size, next.ContentType, next.Language, next.Extract, next.ExtractionStatus, doc.ID, doc.Version))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, errDocumentChanged
+		}
+		return nil, err
+	}
+	_, err = tx.Exec(`
+		INSERT INTO document_versions (document, version, name, size, contentType, language, uploadedBy)
+		VALUES ($1, $2, $3, $4, $5, $6, $7);
+	`, updated.ID, updated.Version, updated.Name, updated.Size, updated.ContentType, updated.Language, uploadedBy)
+	if err != nil {
+		return nil, err
+	}
+	// a new version replaces the document's own file, which is one of its
+	// pages if it has any
+	_, err = tx.Exec(`
+		UPDATE document_pages SET name = $1, size = $2, contentType = $3, extract = $4, extractionStatus = $5
+		WHERE document = $6 AND objectKey = '';
+	`, next.Name, next.Size, next.ContentType, next.Extract, next.ExtractionStatus, doc.ID)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := tx.Exec(joinPages, doc.ID); err != nil {
+		return nil, err
+	}
+	return scanRowIntoDocument(tx.QueryRow("SELECT * FROM documents WHERE id = $1;", doc.ID))
+}
+
+// dropVersions deletes the versions of the document older than the newest
+// keep, and returns the keys of their objects. A keep of 0 keeps them all.
+func dropVersions(tx *sql.Tx, docID int, current int, keep int) ([]string, error) {
+	dropped := make([]string, 0)
+	if keep <= 0 {
+		return dropped, nil
+	}
+	rows, err := tx.Query(`
+		DELETE FROM document_versions WHERE document = $1 AND version <= $2
+		RETURNING objectKey;
+	`, docID, current-keep)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var key string
+		if err := rows.Scan(&key); err != nil {
+			return nil, err
+		}
+		dropped = append(dropped, key)
+	}
+	return dropped, rows.Err()
+}
+
+func (s *Store) GetVersionObjectKeys(docIDs []int) ([]string, error) {
+	keys := make([]string, 0)
+	if len(docIDs) == 0 {
+		return keys, nil
+	}
+	rows, err := s.db.Query("SELECT objectKey FROM document_versions WHERE document = ANY($1) AND objectKey <> '';", pq.Array(docIDs))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var key string
+		if err := rows.Scan(&key); err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
+
+// joinPages sets the document's text to that of its pages, in order, and its
+// extraction status to the one of the page furthest behind. Documents without
+// pages are left alone.
+const joinPages = `
+	UPDATE documents d SET extract = p.text, extractionStatus = p.status
+	FROM (
+		SELECT COALESCE(string_agg(extract, E'\n\n' ORDER BY position) FILTER (WHERE extract <> ''), '') AS text,
+			CASE
+				WHEN bool_or(extractionStatus = 'pending') THEN 'pending'
+				WHEN bool_or(extractionStatus = 'completed') THEN 'completed'
+				WHEN bool_or(extractionStatus = 'failed') THEN 'failed'
+				ELSE 'empty'
+			END AS status
+		FROM document_pages WHERE document = $1
+		HAVING COUNT(*) > 0
+	) p
+	WHERE d.id = $1;
+`
+
+func (s *Store) GetDocumentPages(docID int) ([]types.DocumentPage, error) {
+	return documentPages(s.db, docID)
+}
+
+type rowsQuerier interface {
+	Query(query string, args ...any) (*sql.Rows, error)
+}
+
+func documentPages(q rowsQuerier, docID int) ([]types.DocumentPage, error) {
+	rows, err := q.Query("SELECT * FROM document_pages WHERE document = $1 ORDER BY position;", docID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	pages := make([]types.DocumentPage, 0)
+	for rows.Next() {
+		page, err := scanRowIntoPage(rows)
+		if err != nil {
+			return nil, err
+		}
+		pages = append(pages, *page)
+	}
+	return pages, rows.Err()
+}
+
+func (s *Store) AddDocumentPages(doc types.Document, pages []types.DocumentPage, quota *types.Quota) ([]types.DocumentPage, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	err = withinQuota(tx, doc.BinID, quota, func() error {
+		var count int
+		if err := tx.QueryRow("SELECT COUNT(*) FROM document_pages WHERE document = $1;", doc.ID).Scan(&count); err != nil {
+			return err
+		}
+		if count == 0 {
+			_, err := tx.Exec(`
+				INSERT INTO document_pages (document, position, name, size, contentType, extract, extractionStatus, createdAt)
+				SELECT id, 1, name, size, contentType, extract, extractionStatus, createdAt
+				FROM documents WHERE id = $1;
+			`, doc.ID)
+			if err != nil {
+				return err
+			}
+			count = 1
+		}
+		for i, page := range pages {
+			_, err := tx.Exec(`
+				INSERT INTO document_pages (document, position, name, size, contentType, objectKey)
+				VALUES ($1, $2, $3, $4, $5, $6);
+			`, doc.ID, count+i+1, page.Name, page.Size, page.ContentType, page.ObjectKey)
+			if err != nil {
+				return err
+			}
+		}
+		_, err := tx.Exec(joinPages, doc.ID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	added, err := documentPages(tx, doc.ID)
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return added, nil
+}
+
+func (s *Store) ReorderDocumentPages(docID int, pageIDs []int) ([]types.DocumentPage, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	pages, err := documentPages(tx, docID)
+	if err != nil {
+		return nil, err
+	}
+	existing := make(map[int]bool, len(pages))
+	for _, page := range pages {
+		existing[page.ID] = true
+	}
+	if len(pageIDs) != len(pages) {
+		return nil, fmt.Errorf("the new order has to list all %d pages", len(pages))
+	}
+	for i, id := range pageIDs {
+		if !existing[id] {
+			return nil, fmt.Errorf("page %d is not a page of this document", id)
+		}
+		if _, err := tx.Exec("UPDATE document_pages SET position = $1 WHERE id = $2;", i+1, id); err != nil {
+			return nil, err
+		}
+	}
+	if _, err := tx.Exec(joinPages, docID); err != nil {
+		return nil, err
+	}
+	pages, err = documentPages(tx, docID)
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return pages, nil
+}
+
+func (s *Store) RemoveDocumentPage(docID, pageID int) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var position int
+	err = tx.QueryRow(`
+		DELETE FROM document_pages WHERE id = $1 AND document = $2
+		RETURNING position;
+	`, pageID, docID).Scan(&position)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return fmt.Errorf("page not found")
+		}
+		return err
+	}
+	_, err = tx.Exec("UPDATE document_pages SET position = position - 1 WHERE document = $1 AND position > $2;", docID, position)
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec(joinPages, docID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *Store) GetPageObjectKeys(docIDs []int) ([]string, error) {
+	keys := make([]string, 0)
+	if len(docIDs) == 0 {
+		return keys, nil
+	}
+	rows, err := s.db.Query("SELECT objectKey FROM document_pages WHERE document = ANY($1) AND objectKey <> '';", pq.Array(docIDs))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var key string
+		if err := rows.Scan(&key); err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
+
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+func scanRowIntoDocument(row scanner) (*types.Document, error) {
 	doc := new(types.Document)
-	err := rows.Scan(&doc.ID, &doc.Name, &doc.ReferenceName,
-		&doc.BinID, &doc.Url, &doc.Extract, &doc.CreatedAt, &doc.Language)
+	err := row.Scan(&doc.ID, &doc.Name, &doc.ReferenceName,
+		&doc.BinID, &doc.Url, &doc.Extract, &doc.CreatedAt, &doc.Language, &doc.ProfileID, &doc.DeletedAt,
+		&doc.Size, &doc.ContentType, &doc.ExtractionStatus, &doc.Version,
+		&doc.DocumentType, &doc.Issuer, &doc.DocumentNumber, &doc.IssueDate, &doc.ExpiryDate, &doc.HolderName)
 	if err != nil {
 		return nil, err
 	}
 	return doc, nil
 }
+
+func scanRowIntoVersion(row scanner) (*types.DocumentVersion, error) {
+	v := new(types.DocumentVersion)
+	err := row.Scan(&v.ID, &v.DocumentID, &v.Version, &v.Name, &v.Size, &v.ContentType, &v.Language,
+		&v.Extract, &v.UploadedBy, &v.CreatedAt, &v.Current, &v.ObjectKey)
+	if err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+func scanRowIntoPage(row scanner) (*types.DocumentPage, error) {
+	page := new(types.DocumentPage)
+	err := row.Scan(&page.ID, &page.DocumentID, &page.Page, &page.Name, &page.Size, &page.ContentType,
+		&page.ObjectKey, &page.Extract, &page.ExtractionStatus, &page.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return page, nil
+}
@@ -0,0 +1,224 @@
+package document
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/LikheKeto/Suraksheet/types"
+	"github.com/LikheKeto/Suraksheet/utils"
+)
+
+func newMockStore(t *testing.T) (*Store, sqlmock.Sqlmock) {
+	t.Helper()
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		db.Close()
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+	})
+	return NewStore(db), mock
+}
+
+var documentColumns = []string{"id", "name", "referenceName", "bin", "url", "extract", "createdAt", "language", "profile", "deletedAt",
+	"size", "contentType", "extractionStatus", "version",
+	"documentType", "issuer", "documentNumber", "issueDate", "expiryDate", "holderName"}
+
+func documentRow(id int, referenceName string) *sqlmock.Rows {
+	return sqlmock.NewRows(documentColumns).AddRow(id, "scan.pdf", referenceName, 2, "", "", time.Now(), "eng", nil, time.Now(),
+		100, "application/pdf", types.ExtractionCompleted, 1, "", "", "", nil, nil, "")
+}
+
+func TestAddDocumentVersion(t *testing.T) {
+	doc := types.Document{ID: 1, BinID: 2, Version: 2}
+	next := types.Document{Name: "scan.pdf"}
+
+	t.Run("should not write over a newer version", func(t *testing.T) {
+		store, mock := newMockStore(t)
+		mock.ExpectBegin()
+		mock.ExpectQuery("SELECT version FROM documents .* FOR UPDATE").WithArgs(1).
+			WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(3))
+		mock.ExpectRollback()
+
+		written, undone := false, false
+		_, _, err := store.AddDocumentVersion(doc, "archived", next, 1, nil, 10,
+			func() error { written = true; return nil }, func() { undone = true })
+		if !errors.Is(err, errDocumentChanged) {
+			t.Errorf("expected the document to have changed, got %v", err)
+		}
+		if written || undone {
+			t.Errorf("expected no objects to be touched, written %v, undone %v", written, undone)
+		}
+	})
+
+	t.Run("should put the objects back if the version can't be recorded", func(t *testing.T) {
+		store, mock := newMockStore(t)
+		mock.ExpectBegin()
+		mock.ExpectQuery("SELECT version FROM documents .* FOR UPDATE").WithArgs(1).
+			WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(2))
+		mock.ExpectExec("INSERT INTO document_versions").WillReturnError(errors.New("connection reset"))
+		mock.ExpectRollback()
+
+		written, undone := false, false
+		_, _, err := store.AddDocumentVersion(doc, "archived", next, 1, nil, 10,
+			func() error { written = true; return nil }, func() { undone = true })
+		if err == nil {
+			t.Fatal("expected an error")
+		}
+		if !written || !undone {
+			t.Errorf("expected the objects to be written and put back, written %v, undone %v", written, undone)
+		}
+	})
+}
+
+func TestFilterConditions(t *testing.T) {
+	expiry := time.Date(2030, 6, 1, 0, 0, 0, 0, time.UTC)
+	conditions, args := filterConditions(types.DocumentFilter{
+		DocumentType:   "passport",
+		HolderName:     "SITA",
+		DocumentNumber: "27-01-74-0512",
+		ExpiresBefore:  &expiry,
+	}, []any{7})
+	want := " AND documentType = $2 AND strpos(lower(holderName), lower($3)) > 0" +
+		" AND lower(documentNumber) = lower($4) AND expiryDate < $5"
+	if conditions != want {
+		t.Errorf("expected %q, got %q", want, conditions)
+	}
+	if wantArgs := []any{7, "passport", "SITA", "27-01-74-0512", expiry}; !reflect.DeepEqual(args, wantArgs) {
+		t.Errorf("expected arguments %v, got %v", wantArgs, args)
+	}
+
+	if conditions, args := filterConditions(types.DocumentFilter{}, []any{7}); conditions != "" || len(args) != 1 {
+		t.Errorf("expected no conditions, got %q with %v", conditions, args)
+	}
+}
+
+func TestGetDocumentsInBin(t *testing.T) {
+	store, mock := newMockStore(t)
+	mock.ExpectQuery(`SELECT \* FROM documents WHERE bin = \$1 AND deletedAt IS NULL AND documentType = \$2;`).
+		WithArgs(3, "passport").
+		WillReturnRows(sqlmock.NewRows(nil))
+
+	docs, err := store.GetDocumentsInBin(3, types.DocumentFilter{DocumentType: "passport"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(docs) != 0 {
+		t.Errorf("expected no documents, got %d", len(docs))
+	}
+}
+
+func TestTrashDocument(t *testing.T) {
+	t.Run("should move the document to the trash", func(t *testing.T) {
+		store, mock := newMockStore(t)
+		mock.ExpectBegin()
+		mock.ExpectQuery("UPDATE documents SET deletedAt = CURRENT_TIMESTAMP").WithArgs(1).
+			WillReturnRows(documentRow(1, "passport"))
+		mock.ExpectQuery("INSERT INTO trash").WithArgs(1, 2).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "deletedAt"}).AddRow(7, time.Now()))
+		mock.ExpectCommit()
+
+		entry, err := store.TrashDocument(1, 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if entry.ID != 7 || entry.Name != "passport" || *entry.DocumentID != 1 {
+			t.Errorf("unexpected entry %+v", entry)
+		}
+	})
+
+	t.Run("should fail for a document already in the trash", func(t *testing.T) {
+		store, mock := newMockStore(t)
+		mock.ExpectBegin()
+		mock.ExpectQuery("UPDATE documents SET deletedAt = CURRENT_TIMESTAMP").WithArgs(1).
+			WillReturnRows(sqlmock.NewRows(nil))
+		mock.ExpectRollback()
+
+		if _, err := store.TrashDocument(1, 2); err == nil {
+			t.Error("expected an error")
+		}
+	})
+}
+
+func TestGetDocumentStats(t *testing.T) {
+	store, mock := newMockStore(t)
+	mock.ExpectQuery("SELECT contentType, language, extractionStatus, COUNT\\(\\*\\), COALESCE\\(SUM\\(size\\), 0\\)").
+		WithArgs("{2,3}").
+		WillReturnRows(sqlmock.NewRows([]string{"contentType", "language", "extractionStatus", "count", "sum"}).
+			AddRow("application/pdf", "eng", types.ExtractionCompleted, 2, 300).
+			AddRow("application/pdf", "nep", types.ExtractionFailed, 1, 0).
+			AddRow("image/png", "eng", types.ExtractionCompleted, 1, 50))
+
+	stats, err := store.GetDocumentStats([]int{2, 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Documents != 4 || stats.Bytes != 350 {
+		t.Errorf("expected 4 documents of 350 bytes, got %d of %d", stats.Documents, stats.Bytes)
+	}
+	if pdf := stats.ContentTypes["application/pdf"]; pdf == nil || pdf.Documents != 3 || pdf.Bytes != 300 {
+		t.Errorf("unexpected pdf usage %+v", pdf)
+	}
+	if stats.Languages["eng"] != 3 || stats.ExtractionStatuses[types.ExtractionFailed] != 1 {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+}
+
+func TestGetDocumentsWithoutSize(t *testing.T) {
+	store, mock := newMockStore(t)
+	mock.ExpectQuery(`SELECT \* FROM documents WHERE size IS NULL AND deletedAt IS NULL ORDER BY id LIMIT \$1;`).
+		WithArgs(100).
+		WillReturnRows(documentRow(1, "passport"))
+	mock.ExpectExec("UPDATE documents SET size = \\$1, contentType = \\$2 WHERE id = \\$3;").
+		WithArgs(int64(2048), "application/pdf", 1).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	docs, err := store.GetDocumentsWithoutSize(100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(docs) != 1 || docs[0].ID != 1 {
+		t.Fatalf("expected document 1, got %+v", docs)
+	}
+	if err := store.SetDocumentSize(docs[0].ID, 2048, "application/pdf"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMoveDocuments(t *testing.T) {
+	store, mock := newMockStore(t)
+	mock.ExpectBegin()
+	mock.ExpectExec("UPDATE documents SET bin = \\$1, referenceName = \\$2, profile = \\$3 WHERE id = \\$4;").
+		WithArgs(3, "passport", nil, 1).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery("SELECT objectKey FROM document_pages WHERE document = \\$1").WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"objectKey"}).AddRow("old/pages/1/a1"))
+	mock.ExpectExec("UPDATE document_pages SET objectKey = \\$1 WHERE document = \\$2 AND objectKey = \\$3;").
+		WithArgs("new/pages/1/a1", 1, "old/pages/1/a1").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery("SELECT objectKey FROM document_versions WHERE document = \\$1").WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"objectKey"}).AddRow("new/versions/1/1"))
+	mock.ExpectCommit()
+
+	moved := map[string]string{}
+	err := store.MoveDocuments([]types.Document{{ID: 1, BinID: 3, ReferenceName: "passport"}}, nil, func(docID int, objectKey string) (string, error) {
+		key := utils.MovedObjectKey(objectKey, "new")
+		if key != objectKey {
+			moved[objectKey] = key
+		}
+		return key, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the version already under the new key is left alone
+	if len(moved) != 1 || moved["old/pages/1/a1"] != "new/pages/1/a1" {
+		t.Errorf("expected only the page to move, got %v", moved)
+	}
+}
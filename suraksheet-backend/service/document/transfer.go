@@ -0,0 +1,389 @@
+package document
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"path"
+	"strconv"
+
+	"github.com/LikheKeto/Suraksheet/service/auth"
+	"github.com/LikheKeto/Suraksheet/service/quota"
+	"github.com/LikheKeto/Suraksheet/types"
+	"github.com/LikheKeto/Suraksheet/utils"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-playground/validator/v10"
+)
+
+// transferItem is one document being moved or copied.
+type transferItem struct {
+	doc    *types.Document
+	bin    *types.Bin
+	result types.Document
+	src    string
+	dst    string
+	// skip is set for documents that are moved into the bin they are already in
+	skip bool
+}
+
+func (h *Handler) handleMoveDocument(w http.ResponseWriter, r *http.Request) {
+	h.handleTransferDocument(w, r, false)
+}
+
+func (h *Handler) handleCopyDocument(w http.ResponseWriter, r *http.Request) {
+	h.handleTransferDocument(w, r, true)
+}
+
+func (h *Handler) handleMoveDocuments(w http.ResponseWriter, r *http.Request) {
+	h.handleTransferDocuments(w, r, false)
+}
+
+func (h *Handler) handleCopyDocuments(w http.ResponseWriter, r *http.Request) {
+	h.handleTransferDocuments(w, r, true)
+}
+
+func (h *Handler) handleTransferDocument(w http.ResponseWriter, r *http.Request, copying bool) {
+	user, err := auth.ExtractUserFromContext(r)
+	if err != nil {
+		utils.WriteError(w, http.StatusForbidden, err)
+		return
+	}
+	docIDStr := chi.URLParam(r, "documentID")
+	docID, err := strconv.Atoi(docIDStr)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid document %s", docIDStr))
+		return
+	}
+	var payload types.TransferDocumentPayload
+	if err := utils.ParseJSON(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	if err := utils.Validate.Struct(payload); err != nil {
+		errors := err.(validator.ValidationErrors)
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid payload %v", errors))
+		return
+	}
+	docs, ok := h.transfer(w, r, user.ID, []int{docID}, payload.Bin, payload.OnConflict, copying)
+	if !ok {
+		return
+	}
+	utils.WriteJSON(w, transferStatus(copying), docs[0])
+}
+
+func (h *Handler) handleTransferDocuments(w http.ResponseWriter, r *http.Request, copying bool) {
+	user, err := auth.ExtractUserFromContext(r)
+	if err != nil {
+		utils.WriteError(w, http.StatusForbidden, err)
+		return
+	}
+	var payload types.TransferDocumentsPayload
+	if err := utils.ParseJSON(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	if err := utils.Validate.Struct(payload); err != nil {
+		errors := err.(validator.ValidationErrors)
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid payload %v", errors))
+		return
+	}
+	docs, ok := h.transfer(w, r, user.ID, payload.Ids, payload.Bin, payload.OnConflict, copying)
+	if !ok {
+		return
+	}
+	utils.WriteJSON(w, transferStatus(copying), docs)
+}
+
+func transferStatus(copying bool) int {
+	if copying {
+		return http.StatusCreated
+	}
+	return http.StatusOK
+}
+
+// transfer moves or copies the documents into the bin, all or nothing. Objects
+// are copied first and the rows changed in one transaction; if anything fails
+// the copies, rows and search entries are put back the way they were. Pages
+// and older versions of documents moved to another owner go along with them.
+// The old objects of moved documents are only deleted once everything else is
+// done.
+func (h *Handler) transfer(w http.ResponseWriter, r *http.Request, userID int, ids []int, binID int, onConflict string, copying bool) ([]types.Document, bool) {
+	required := types.RoleEditor
+	if copying {
+		required = types.RoleViewer
+	}
+	target, ok := h.permissions.Container(w, userID, binID, types.RoleUploader)
+	if !ok {
+		return nil, false
+	}
+	targetKey, err := h.permissions.StorageKey(target)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return nil, false
+	}
+	targetQuota, err := quota.ForBin(h.quotaStore, target)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return nil, false
+	}
+	names, err := h.store.GetReferenceNamesInBin(target.ID)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return nil, false
+	}
+	taken := make(map[string]bool, len(names))
+	for _, name := range names {
+		taken[name] = true
+	}
+
+	items := make([]*transferItem, 0, len(ids))
+	seen := make(map[int]bool, len(ids))
+	storageKeys := map[int]string{target.ID: targetKey}
+	for _, id := range ids {
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		doc, bin, ok := h.permissions.Document(w, userID, id, required)
+		if !ok {
+			return nil, false
+		}
+		item := &transferItem{doc: doc, bin: bin, result: *doc}
+		items = append(items, item)
+		if !copying && doc.BinID == target.ID {
+			item.skip = true
+			continue
+		}
+
+		srcKey, ok := storageKeys[bin.ID]
+		if !ok {
+			srcKey, err = h.permissions.StorageKey(bin)
+			if err != nil {
+				utils.WriteError(w, http.StatusInternalServerError, err)
+				return nil, false
+			}
+			storageKeys[bin.ID] = srcKey
+		}
+
+		name := doc.ReferenceName
+		if taken[name] {
+			if onConflict != types.ConflictRename {
+				utils.WriteError(w, http.StatusConflict, fmt.Errorf("document with reference name %q already exists in the target bin", name))
+				return nil, false
+			}
+			name = utils.FreeName(name, taken)
+		}
+		taken[name] = true
+
+		item.result.BinID = target.ID
+		item.result.ReferenceName = name
+		// profiles belong to an organization and don't follow documents out of it
+		if !sameOwner(bin, target) {
+			item.result.ProfileID = nil
+		}
+		item.src = path.Join(srcKey, strconv.Itoa(bin.ID), utils.HashString(doc.ReferenceName))
+		item.dst = path.Join(targetKey, strconv.Itoa(target.ID), utils.HashString(name))
+	}
+
+	// rolling back has to finish even if the client has gone away
+	ctx := context.Background()
+
+	copied := make([]string, 0, len(items))
+	// the old keys of the pages and versions that moved, by their new key
+	moved := make(map[string]string)
+	for _, item := range items {
+		if item.skip {
+			continue
+		}
+		if err := utils.CopyObject(r.Context(), h.minio, item.src, item.dst); err != nil {
+			h.removeObjects(ctx, copied)
+			utils.WriteError(w, http.StatusInternalServerError, fmt.Errorf("unable to copy document %d: %v", item.doc.ID, err))
+			return nil, false
+		}
+		copied = append(copied, item.dst)
+	}
+
+	changed := make([]types.Document, 0, len(items))
+	for _, item := range items {
+		if !item.skip {
+			changed = append(changed, item.result)
+		}
+	}
+	if copying {
+		copies, err := h.store.CopyDocuments(changed, targetQuota, func(docID int, objectKey string) (string, error) {
+			key, err := newPageObjectKey(targetKey, docID)
+			if err != nil {
+				return "", err
+			}
+			if err := utils.CopyObject(r.Context(), h.minio, objectKey, key); err != nil {
+				return "", err
+			}
+			copied = append(copied, key)
+			return key, nil
+		})
+		if err != nil {
+			h.removeObjects(ctx, copied)
+			utils.WriteError(w, transferErrorStatus(err), fmt.Errorf("unable to copy documents: %v", err))
+			return nil, false
+		}
+		for i, item := range items {
+			// nothing is skipped when copying, so the copies line up with items
+			item.result = copies[i]
+		}
+	} else if err := h.store.MoveDocuments(changed, targetQuota, func(docID int, objectKey string) (string, error) {
+		key := utils.MovedObjectKey(objectKey, targetKey)
+		if key == objectKey {
+			return key, nil
+		}
+		if err := utils.CopyObject(r.Context(), h.minio, objectKey, key); err != nil {
+			return "", err
+		}
+		copied = append(copied, key)
+		moved[key] = objectKey
+		return key, nil
+	}); err != nil {
+		h.removeObjects(ctx, copied)
+		utils.WriteError(w, transferErrorStatus(err), fmt.Errorf("unable to move documents: %v", err))
+		return nil, false
+	}
+
+	if err := h.updateIndex(r.Context(), items, target, copying); err != nil {
+		h.revertTransfer(ctx, items, copying, moved)
+		h.removeObjects(ctx, copied)
+		utils.WriteError(w, http.StatusInternalServerError, fmt.Errorf("unable to update search index: %v", err))
+		return nil, false
+	}
+
+	docs := make([]types.Document, 0, len(items))
+	for _, item := range items {
+		docs = append(docs, item.result)
+		if item.skip {
+			continue
+		}
+		if !copying {
+			if err := utils.DeleteObject(ctx, h.minio, item.src); err != nil {
+				log.Printf("unable to delete file in minio: %v\n", err)
+			}
+		}
+		// documents that weren't extracted yet are extracted again from their
+		// new object, which also covers a pending extraction of the old one
+		if item.doc.Extract == "" {
+			err := utils.QueueForExtraction(h.rmqChan, h.rmq, utils.ExtractionArgs{
+				DocID:          item.result.ID,
+				UserID:         target.OwnerID,
+				OrganizationID: target.OrganizationID,
+				FileKey:        item.dst,
+				Extension:      fileExtension(item.doc.Name),
+				Language:       item.doc.Language,
+				Version:        item.result.Version,
+			})
+			if err != nil {
+				log.Printf("unable to queue document %d for extraction: %v", item.result.ID, err)
+			}
+		}
+	}
+	for _, key := range moved {
+		if err := utils.DeleteObject(ctx, h.minio, key); err != nil {
+			log.Printf("unable to delete file in minio: %v\n", err)
+		}
+	}
+	return docs, true
+}
+
+func transferErrorStatus(err error) int {
+	if errors.Is(err, types.ErrQuotaExceeded) {
+		return http.StatusInsufficientStorage
+	}
+	return http.StatusBadRequest
+}
+
+// updateIndex makes the search entries of the documents match their new bin.
+// Copies get entries of their own; moved documents are re-filed under the new
+// owner when the bin belongs to someone else.
+func (h *Handler) updateIndex(ctx context.Context, items []*transferItem, target *types.Bin, copying bool) error {
+	for i, item := range items {
+		if item.skip || item.doc.Extract == "" {
+			continue
+		}
+		var err error
+		if copying {
+			err = utils.IndexExtractedDocument(ctx, h.esClient, &item.result, target)
+		} else if !sameOwner(item.bin, target) {
+			err = utils.UpdateIndexedDocument(ctx, h.esClient, item.doc.ID, utils.SearchOwner(target))
+		}
+		if err != nil {
+			h.revertIndex(context.Background(), items[:i], target, copying)
+			return err
+		}
+	}
+	return nil
+}
+
+func (h *Handler) revertIndex(ctx context.Context, items []*transferItem, target *types.Bin, copying bool) {
+	for _, item := range items {
+		if item.skip || item.doc.Extract == "" {
+			continue
+		}
+		var err error
+		if copying {
+			err = utils.DeleteFromIndex(ctx, h.esClient, map[string]interface{}{
+				"term": map[string]interface{}{"document_id": item.result.ID},
+			})
+		} else if !sameOwner(item.bin, target) {
+			err = utils.UpdateIndexedDocument(ctx, h.esClient, item.doc.ID, utils.SearchOwner(item.bin))
+		}
+		if err != nil {
+			log.Printf("unable to revert search entry of document %d: %v", item.doc.ID, err)
+		}
+	}
+}
+
+// revertTransfer puts the rows back the way they were before the transfer.
+func (h *Handler) revertTransfer(ctx context.Context, items []*transferItem, copying bool, moved map[string]string) {
+	if copying {
+		for _, item := range items {
+			if item.skip {
+				continue
+			}
+			if err := h.store.DeleteDocumentByID(item.result.ID); err != nil {
+				log.Printf("unable to remove copy %d of document %d: %v", item.result.ID, item.doc.ID, err)
+			}
+		}
+		return
+	}
+	originals := make([]types.Document, 0, len(items))
+	for _, item := range items {
+		if !item.skip {
+			originals = append(originals, *item.doc)
+		}
+	}
+	// the old objects are still there, only the rows point at the new ones
+	err := h.store.MoveDocuments(originals, nil, func(docID int, objectKey string) (string, error) {
+		if old, ok := moved[objectKey]; ok {
+			return old, nil
+		}
+		return objectKey, nil
+	})
+	if err != nil {
+		log.Printf("unable to move documents back: %v", err)
+	}
+}
+
+func (h *Handler) removeObjects(ctx context.Context, keys []string) {
+	for _, key := range keys {
+		if err := utils.DeleteObject(ctx, h.minio, key); err != nil {
+			log.Printf("unable to delete file in minio: %v\n", err)
+		}
+	}
+}
+
+// sameOwner reports whether the two bins belong to the same user or
+// organization.
+func sameOwner(a, b *types.Bin) bool {
+	if a.OrganizationID != nil || b.OrganizationID != nil {
+		return a.OrganizationID != nil && b.OrganizationID != nil && *a.OrganizationID == *b.OrganizationID
+	}
+	return a.OwnerID == b.OwnerID
+}
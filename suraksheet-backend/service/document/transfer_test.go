@@ -0,0 +1,27 @@
+package document
+
+import (
+	"testing"
+
+	"github.com/LikheKeto/Suraksheet/types"
+)
+
+func TestSameOwner(t *testing.T) {
+	org1, org2 := 1, 2
+	tests := []struct {
+		name string
+		a, b types.Bin
+		want bool
+	}{
+		{"same user", types.Bin{OwnerID: 1}, types.Bin{OwnerID: 1}, true},
+		{"different users", types.Bin{OwnerID: 1}, types.Bin{OwnerID: 2}, false},
+		{"same organization", types.Bin{OrganizationID: &org1}, types.Bin{OrganizationID: &org1}, true},
+		{"different organizations", types.Bin{OrganizationID: &org1}, types.Bin{OrganizationID: &org2}, false},
+		{"user and organization", types.Bin{OwnerID: 1}, types.Bin{OrganizationID: &org1}, false},
+	}
+	for _, tt := range tests {
+		if got := sameOwner(&tt.a, &tt.b); got != tt.want {
+			t.Errorf("%s: expected %v, got %v", tt.name, tt.want, got)
+		}
+	}
+}
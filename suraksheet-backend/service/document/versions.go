@@ -0,0 +1,309 @@
+package document
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"path"
+	"strconv"
+
+	"github.com/LikheKeto/Suraksheet/config"
+	"github.com/LikheKeto/Suraksheet/service/auth"
+	"github.com/LikheKeto/Suraksheet/service/quota"
+	"github.com/LikheKeto/Suraksheet/types"
+	"github.com/LikheKeto/Suraksheet/utils"
+	"github.com/go-chi/chi/v5"
+)
+
+func (h *Handler) handleGetVersions(w http.ResponseWriter, r *http.Request) {
+	user, err := auth.ExtractUserFromContext(r)
+	if err != nil {
+		utils.WriteError(w, http.StatusForbidden, err)
+		return
+	}
+	docID, ok := documentIDParam(w, r)
+	if !ok {
+		return
+	}
+	doc, _, ok := h.permissions.Document(w, user.ID, docID, types.RoleViewer)
+	if !ok {
+		return
+	}
+	versions, err := h.store.GetDocumentVersions(doc.ID)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, versions)
+}
+
+// handleAddVersion replaces the document's file with a new upload, keeping
+// the old one as the previous version. The new file is extracted again.
+func (h *Handler) handleAddVersion(w http.ResponseWriter, r *http.Request) {
+	user, err := auth.ExtractUserFromContext(r)
+	if err != nil {
+		utils.WriteError(w, http.StatusForbidden, err)
+		return
+	}
+	docID, ok := documentIDParam(w, r)
+	if !ok {
+		return
+	}
+	// room for the form fields next to the file
+	r.Body = http.MaxBytesReader(w, r.Body, config.Envs.MaxUploadSizeInBytes+1<<20)
+	if err := r.ParseMultipartForm(10 << 20); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			utils.WriteError(w, http.StatusRequestEntityTooLarge, fmt.Errorf("file is larger than %d bytes", config.Envs.MaxUploadSizeInBytes))
+			return
+		}
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	doc, bin, ok := h.permissions.Document(w, user.ID, docID, types.RoleEditor)
+	if !ok {
+		return
+	}
+	language := r.Form.Get("language")
+	if language == "" {
+		language = doc.Language
+	}
+	if !(language == "eng" || language == "nep") {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("language not supported"))
+		return
+	}
+	file, fileHeader, err := r.FormFile("file")
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("failed to get file from request: %v", err))
+		return
+	}
+	if fileHeader.Size > config.Envs.MaxUploadSizeInBytes {
+		utils.WriteError(w, http.StatusRequestEntityTooLarge, fmt.Errorf("file is larger than %d bytes", config.Envs.MaxUploadSizeInBytes))
+		return
+	}
+
+	next := types.Document{
+		Name:             fileHeader.Filename,
+		Size:             &fileHeader.Size,
+		ContentType:      fileHeader.Header.Get("Content-Type"),
+		Language:         language,
+		ExtractionStatus: types.ExtractionPending,
+	}
+	updated, objectKey, ok := h.replaceVersion(w, r, user.ID, doc, bin, next, func(key string) error {
+		return utils.UploadToMinio(r.Context(), h.minio, file, fileHeader, key)
+	})
+	if !ok {
+		return
+	}
+	h.reextract(r.Context(), updated, bin, objectKey)
+	utils.WriteJSON(w, http.StatusCreated, updated)
+}
+
+// handleRestoreVersion makes an older version current again by adding it as
+// a new version, so the versions in between are kept.
+func (h *Handler) handleRestoreVersion(w http.ResponseWriter, r *http.Request) {
+	user, err := auth.ExtractUserFromContext(r)
+	if err != nil {
+		utils.WriteError(w, http.StatusForbidden, err)
+		return
+	}
+	docID, ok := documentIDParam(w, r)
+	if !ok {
+		return
+	}
+	versionStr := chi.URLParam(r, "version")
+	versionNo, err := strconv.Atoi(versionStr)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid version %s", versionStr))
+		return
+	}
+	doc, bin, ok := h.permissions.Document(w, user.ID, docID, types.RoleEditor)
+	if !ok {
+		return
+	}
+	version, err := h.store.GetDocumentVersion(doc.ID, versionNo)
+	if err != nil {
+		utils.WriteError(w, http.StatusNotFound, err)
+		return
+	}
+	if version.Current {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("version %d is already the current version", versionNo))
+		return
+	}
+	if version.ObjectKey == "" {
+		utils.WriteError(w, http.StatusNotFound, fmt.Errorf("the file of version %d is gone", versionNo))
+		return
+	}
+
+	// the text of the version comes back with it
+	next := types.Document{
+		Name:             version.Name,
+		Size:             version.Size,
+		ContentType:      version.ContentType,
+		Language:         version.Language,
+		Extract:          version.Extract,
+		ExtractionStatus: types.ExtractionCompleted,
+	}
+	if version.Extract == "" {
+		next.ExtractionStatus = types.ExtractionPending
+	}
+	updated, objectKey, ok := h.replaceVersion(w, r, user.ID, doc, bin, next, func(key string) error {
+		return utils.CopyObject(r.Context(), h.minio, version.ObjectKey, key)
+	})
+	if !ok {
+		return
+	}
+	if updated.Extract == "" {
+		h.reextract(r.Context(), updated, bin, objectKey)
+	} else if err := utils.IndexExtractedDocument(r.Context(), h.esClient, updated, bin); err != nil {
+		log.Printf("unable to index document %d: %v", updated.ID, err)
+	}
+	utils.WriteJSON(w, http.StatusOK, updated)
+}
+
+// handleDiffVersions compares the text extracted from two versions, by
+// default the current one and the one before it.
+func (h *Handler) handleDiffVersions(w http.ResponseWriter, r *http.Request) {
+	user, err := auth.ExtractUserFromContext(r)
+	if err != nil {
+		utils.WriteError(w, http.StatusForbidden, err)
+		return
+	}
+	docID, ok := documentIDParam(w, r)
+	if !ok {
+		return
+	}
+	doc, _, ok := h.permissions.Document(w, user.ID, docID, types.RoleViewer)
+	if !ok {
+		return
+	}
+	to, ok := versionQuery(w, r, "to", doc.Version)
+	if !ok {
+		return
+	}
+	from, ok := versionQuery(w, r, "from", to-1)
+	if !ok {
+		return
+	}
+	fromVersion, err := h.store.GetDocumentVersion(doc.ID, from)
+	if err != nil {
+		utils.WriteError(w, http.StatusNotFound, err)
+		return
+	}
+	toVersion, err := h.store.GetDocumentVersion(doc.ID, to)
+	if err != nil {
+		utils.WriteError(w, http.StatusNotFound, err)
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, versionDiff{
+		From:  from,
+		To:    to,
+		Parts: diffWords(fromVersion.Extract, toVersion.Extract),
+	})
+}
+
+// replaceVersion keeps the document's current object as its current version,
+// has put write the next version's object in its place, and records next as
+// the new current version. If recording fails the old object is put back.
+func (h *Handler) replaceVersion(w http.ResponseWriter, r *http.Request, userID int, doc *types.Document, bin *types.Bin, next types.Document, put func(key string) error) (*types.Document, string, bool) {
+	storageKey, err := h.permissions.StorageKey(bin)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return nil, "", false
+	}
+	binQuota, err := quota.ForBin(h.quotaStore, bin)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return nil, "", false
+	}
+	current := path.Join(storageKey, strconv.Itoa(bin.ID), utils.HashString(doc.ReferenceName))
+	archived := utils.VersionObjectKey(storageKey, doc.ID, doc.Version)
+
+	// putting things back has to finish even if the client has gone away
+	ctx := context.Background()
+	var writeErr error
+	write := func() error {
+		if err := utils.CopyObject(r.Context(), h.minio, current, archived); err != nil {
+			writeErr = fmt.Errorf("unable to keep the current version: %v", err)
+			return writeErr
+		}
+		if err := put(current); err != nil {
+			h.removeObjects(ctx, []string{archived})
+			writeErr = fmt.Errorf("unable to store the new version: %v", err)
+			return writeErr
+		}
+		return nil
+	}
+	undo := func() {
+		if err := utils.CopyObject(ctx, h.minio, archived, current); err != nil {
+			log.Printf("unable to put back the current version of document %d: %v", doc.ID, err)
+		} else {
+			h.removeObjects(ctx, []string{archived})
+		}
+	}
+	updated, dropped, err := h.store.AddDocumentVersion(*doc, archived, next, userID, binQuota, int(config.Envs.MaxDocumentVersions), write, undo)
+	if writeErr != nil {
+		utils.WriteError(w, http.StatusInternalServerError, writeErr)
+		return nil, "", false
+	}
+	if err != nil {
+		utils.WriteError(w, transferErrorStatus(err), fmt.Errorf("unable to add version: %v", err))
+		return nil, "", false
+	}
+	for _, key := range dropped {
+		if key != "" {
+			h.removeObjects(ctx, []string{key})
+		}
+	}
+	return updated, current, true
+}
+
+// reextract takes the document's old text out of search and queues the new
+// version for extraction.
+func (h *Handler) reextract(ctx context.Context, doc *types.Document, bin *types.Bin, objectKey string) {
+	err := utils.DeleteFromIndex(ctx, h.esClient, map[string]interface{}{
+		"term": map[string]interface{}{"document_id": doc.ID},
+	})
+	if err != nil {
+		log.Printf("unable to remove document %d from search: %v", doc.ID, err)
+	}
+	err = utils.QueueForExtraction(h.rmqChan, h.rmq, utils.ExtractionArgs{
+		DocID:          doc.ID,
+		UserID:         bin.OwnerID,
+		OrganizationID: bin.OrganizationID,
+		FileKey:        objectKey,
+		Extension:      fileExtension(doc.Name),
+		Language:       doc.Language,
+		Version:        doc.Version,
+	})
+	if err != nil {
+		log.Printf("unable to queue document %d for extraction: %v", doc.ID, err)
+	}
+}
+
+func documentIDParam(w http.ResponseWriter, r *http.Request) (int, bool) {
+	docIDStr := chi.URLParam(r, "documentID")
+	docID, err := strconv.Atoi(docIDStr)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid document %s", docIDStr))
+		return 0, false
+	}
+	return docID, true
+}
+
+// versionQuery reads a version number from the query string, or returns
+// fallback if it isn't there.
+func versionQuery(w http.ResponseWriter, r *http.Request, name string, fallback int) (int, bool) {
+	value := r.URL.Query().Get(name)
+	if value == "" {
+		return fallback, true
+	}
+	version, err := strconv.Atoi(value)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid version %s", value))
+		return 0, false
+	}
+	return version, true
+}
@@ -0,0 +1,280 @@
+package importer
+
+import (
+	"archive/zip"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/LikheKeto/Suraksheet/config"
+	"github.com/LikheKeto/Suraksheet/service/permission"
+	"github.com/LikheKeto/Suraksheet/service/quota"
+	"github.com/LikheKeto/Suraksheet/types"
+	"github.com/LikheKeto/Suraksheet/utils"
+	"github.com/minio/minio-go/v7"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// maxImportFiles is the most files one archive may hold.
+const maxImportFiles = 1000
+
+// Importer unpacks pending imports. Files that were imported are never
+// imported again, so a failed import can be queued again with RetryImport and
+// picks up where it stopped.
+type Importer struct {
+	store         types.ImportStore
+	quotaStore    types.QuotaStore
+	binStore      types.BinStore
+	documentStore types.DocumentStore
+	permissions   *permission.Checker
+	minio         *minio.Client
+	rmqChan       *amqp.Channel
+	rmq           amqp.Queue
+}
+
+func NewImporter(store types.ImportStore, quotaStore types.QuotaStore, binStore types.BinStore, documentStore types.DocumentStore, permissions *permission.Checker, minio *minio.Client, rmqChan *amqp.Channel, rmq amqp.Queue) *Importer {
+	return &Importer{store: store, quotaStore: quotaStore, binStore: binStore, documentStore: documentStore, permissions: permissions, minio: minio, rmqChan: rmqChan, rmq: rmq}
+}
+
+func (i *Importer) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		i.importPending(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (i *Importer) importPending(ctx context.Context) {
+	jobs, err := i.store.GetPendingImports()
+	if err != nil {
+		log.Printf("unable to fetch pending imports: %v", err)
+		return
+	}
+	for _, job := range jobs {
+		if err := i.store.ClaimImport(job.ID); err != nil {
+			continue
+		}
+		status := StatusCompleted
+		if err := i.run(ctx, job); err != nil {
+			log.Printf("import %d failed: %v", job.ID, err)
+			status = StatusFailed
+		}
+		if err := i.store.CompleteImport(job.ID, status); err != nil {
+			log.Printf("unable to complete import %d: %v", job.ID, err)
+		}
+	}
+}
+
+// run imports every file of the job that hasn't been imported yet. The
+// archive is removed once all of them have been.
+func (i *Importer) run(ctx context.Context, job types.ImportJob) error {
+	root, err := i.binStore.GetBinById(job.BinID)
+	if err != nil {
+		return err
+	}
+	storageKey, err := i.permissions.StorageKey(root)
+	if err != nil {
+		return err
+	}
+	// the bins created for the archive belong to the same owner as the root
+	binQuota, err := quota.ForBin(i.quotaStore, root)
+	if err != nil {
+		return err
+	}
+	obj, err := utils.GetObject(ctx, i.minio, job.ArchiveKey)
+	if err != nil {
+		return err
+	}
+	defer obj.Close()
+	stat, err := obj.Stat()
+	if err != nil {
+		return err
+	}
+	archive, err := zip.NewReader(obj, stat.Size)
+	if err != nil {
+		return err
+	}
+	entries := make(map[string]*zip.File, len(archive.File))
+	for _, f := range archive.File {
+		entries[f.Name] = f
+	}
+	files, err := i.store.GetImportFiles(job.ID)
+	if err != nil {
+		return err
+	}
+
+	run := &importRun{job: job, storageKey: storageKey, quota: binQuota, bins: map[string]*types.Bin{"": root}, names: map[int]map[string]bool{}}
+	failed := 0
+	for _, file := range files {
+		if file.Status == FileStatusImported {
+			continue
+		}
+		doc, err := i.importFile(ctx, run, entries[file.Path], file.Path)
+		if err != nil {
+			failed++
+			err = i.store.UpdateImportFile(file.ID, FileStatusFailed, err.Error(), nil)
+		} else {
+			err = i.store.UpdateImportFile(file.ID, FileStatusImported, "", &doc.ID)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d files could not be imported", failed, len(files))
+	}
+	if err := utils.DeleteObject(ctx, i.minio, job.ArchiveKey); err != nil {
+		log.Printf("unable to remove archive of import %d: %v", job.ID, err)
+	}
+	return nil
+}
+
+// importRun remembers the bins found or created for the archive's
+// directories, and the reference names taken in them, while a job runs.
+type importRun struct {
+	job        types.ImportJob
+	storageKey string
+	quota      *types.Quota
+	bins       map[string]*types.Bin
+	names      map[int]map[string]bool
+}
+
+func (i *Importer) importFile(ctx context.Context, run *importRun, entry *zip.File, filePath string) (*types.Document, error) {
+	if entry == nil {
+		return nil, fmt.Errorf("file is missing from the archive")
+	}
+	contentType := utils.ContentTypeByExtension(filePath)
+	if contentType == "" {
+		return nil, fmt.Errorf("file type not allowed: %s", path.Ext(filePath))
+	}
+	if int64(entry.UncompressedSize64) > config.Envs.MaxUploadSizeInBytes {
+		return nil, fmt.Errorf("file is larger than %d bytes", config.Envs.MaxUploadSizeInBytes)
+	}
+	dir, fileName := path.Split(filePath)
+	bin, err := i.binFor(run, strings.TrimSuffix(dir, "/"))
+	if err != nil {
+		return nil, fmt.Errorf("unable to create bin: %v", err)
+	}
+	taken, ok := run.names[bin.ID]
+	if !ok {
+		names, err := i.documentStore.GetReferenceNamesInBin(bin.ID)
+		if err != nil {
+			return nil, err
+		}
+		taken = make(map[string]bool, len(names))
+		for _, name := range names {
+			taken[name] = true
+		}
+		run.names[bin.ID] = taken
+	}
+	referenceName := strings.TrimSuffix(fileName, path.Ext(fileName))
+	if taken[referenceName] {
+		referenceName = utils.FreeName(referenceName, taken)
+	}
+
+	fileKey := path.Join(run.storageKey, strconv.Itoa(bin.ID), utils.HashString(referenceName))
+	content, err := entry.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer content.Close()
+	size := int64(entry.UncompressedSize64)
+	if err := utils.PutObject(ctx, i.minio, content, size, contentType, fileKey); err != nil {
+		return nil, fmt.Errorf("unable to upload file: %v", err)
+	}
+	doc, err := i.documentStore.InsertDocument(types.Document{
+		BinID:         bin.ID,
+		Name:          fileName,
+		ReferenceName: referenceName,
+		Language:      run.job.Language,
+		Size:          &size,
+		ContentType:   contentType,
+	}, run.job.UserID, run.quota)
+	if err != nil {
+		utils.DeleteObject(ctx, i.minio, fileKey)
+		if errors.Is(err, types.ErrQuotaExceeded) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("unable to insert document: %v", err)
+	}
+	taken[referenceName] = true
+
+	err = utils.QueueForExtraction(i.rmqChan, i.rmq, utils.ExtractionArgs{
+		DocID:          doc.ID,
+		UserID:         bin.OwnerID,
+		OrganizationID: bin.OrganizationID,
+		FileKey:        fileKey,
+		Extension:      strings.TrimPrefix(path.Ext(fileName), "."),
+		Language:       run.job.Language,
+		Version:        doc.Version,
+	})
+	if err != nil {
+		log.Printf("unable to queue document %d for extraction: %v", doc.ID, err)
+	}
+	return doc, nil
+}
+
+// binFor returns the bin for the directory, finding or creating the bins on
+// the way down from the job's bin.
+func (i *Importer) binFor(run *importRun, dir string) (*types.Bin, error) {
+	if bin, ok := run.bins[dir]; ok {
+		return bin, nil
+	}
+	parentDir, name := path.Split(dir)
+	parent, err := i.binFor(run, strings.TrimSuffix(parentDir, "/"))
+	if err != nil {
+		return nil, err
+	}
+	children, err := i.binStore.GetChildBins(parent.ID)
+	if err != nil {
+		return nil, err
+	}
+	for _, child := range children {
+		if child.Name == name {
+			run.bins[dir] = &child
+			return &child, nil
+		}
+	}
+	bin, err := i.binStore.CreateBin(types.Bin{Name: name, OwnerID: parent.OwnerID, OrganizationID: parent.OrganizationID, ParentID: &parent.ID})
+	if err != nil {
+		return nil, err
+	}
+	run.bins[dir] = bin
+	return bin, nil
+}
+
+// ArchiveFiles lists the files in the archive to import, leaving out
+// directories, hidden files and what archivers add on their own.
+func ArchiveFiles(archive *zip.Reader) ([]string, error) {
+	paths := make([]string, 0)
+	for _, f := range archive.File {
+		if f.FileInfo().IsDir() {
+			continue
+		}
+		name := f.Name
+		if path.IsAbs(name) || path.Clean(name) != name || strings.HasPrefix(name, "../") {
+			return nil, fmt.Errorf("invalid path in archive: %s", name)
+		}
+		if strings.HasPrefix(name, "__MACOSX/") || strings.HasPrefix(path.Base(name), ".") {
+			continue
+		}
+		paths = append(paths, name)
+	}
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("archive has no files")
+	}
+	if len(paths) > maxImportFiles {
+		return nil, fmt.Errorf("archive has more than %d files", maxImportFiles)
+	}
+	return paths, nil
+}
@@ -0,0 +1,55 @@
+package importer
+
+import (
+	"archive/zip"
+	"bytes"
+	"slices"
+	"testing"
+)
+
+func newArchive(t *testing.T, names ...string) *zip.Reader {
+	t.Helper()
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	for _, name := range names {
+		if _, err := w.Create(name); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	r, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+func TestArchiveFiles(t *testing.T) {
+	archive := newArchive(t,
+		"Passport.pdf",
+		"Visa/",
+		"Visa/Letter.docx",
+		"Visa/.DS_Store",
+		"__MACOSX/Visa/._Letter.docx",
+	)
+	paths, err := ArchiveFiles(archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"Passport.pdf", "Visa/Letter.docx"}; !slices.Equal(paths, want) {
+		t.Errorf("expected %v, got %v", want, paths)
+	}
+}
+
+func TestArchiveFilesRejectsInvalidPaths(t *testing.T) {
+	for _, name := range []string{"../Passport.pdf", "/etc/Passport.pdf", "Visa/../../Passport.pdf"} {
+		if _, err := ArchiveFiles(newArchive(t, name)); err == nil {
+			t.Errorf("expected %q to be rejected", name)
+		}
+	}
+	if _, err := ArchiveFiles(newArchive(t, "Visa/")); err == nil {
+		t.Error("expected an archive without files to be rejected")
+	}
+}
@@ -0,0 +1,273 @@
+package importer
+
+import (
+	"archive/zip"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/LikheKeto/Suraksheet/config"
+	"github.com/LikheKeto/Suraksheet/service/auth"
+	"github.com/LikheKeto/Suraksheet/service/permission"
+	"github.com/LikheKeto/Suraksheet/service/quota"
+	"github.com/LikheKeto/Suraksheet/types"
+	"github.com/LikheKeto/Suraksheet/utils"
+	"github.com/go-chi/chi/v5"
+	"github.com/minio/minio-go/v7"
+)
+
+type Handler struct {
+	store         types.ImportStore
+	quotaStore    types.QuotaStore
+	documentStore types.DocumentStore
+	binStore      types.BinStore
+	userStore     types.UserStore
+	sessionStore  types.SessionStore
+	apiKeyStore   types.APIKeyStore
+	permissions   *permission.Checker
+	minio         *minio.Client
+}
+
+func NewHandler(store types.ImportStore, quotaStore types.QuotaStore, documentStore types.DocumentStore, binStore types.BinStore, userStore types.UserStore, sessionStore types.SessionStore, apiKeyStore types.APIKeyStore, permissions *permission.Checker, minio *minio.Client) *Handler {
+	return &Handler{store: store, quotaStore: quotaStore, documentStore: documentStore, binStore: binStore, userStore: userStore, sessionStore: sessionStore, apiKeyStore: apiKeyStore, permissions: permissions, minio: minio}
+}
+
+func (h *Handler) RegisterRoutes(router chi.Router) {
+	router.MethodFunc(http.MethodGet, "/imports", h.withAuth(h.handleGetImports, types.APIKeyScopeRead))
+	router.MethodFunc(http.MethodPost, "/imports", h.withAuth(h.handleCreateImport, types.APIKeyScopeFull))
+	router.MethodFunc(http.MethodGet, "/imports/{importID}", h.withAuth(h.handleGetImport, types.APIKeyScopeRead))
+	router.MethodFunc(http.MethodPost, "/imports/{importID}/retry", h.withAuth(h.handleRetryImport, types.APIKeyScopeFull))
+}
+
+func (h *Handler) withAuth(handlerFunc http.HandlerFunc, scope string) http.HandlerFunc {
+	return auth.WithJWTOrAPIKeyAuth(auth.RequireVerifiedEmail(handlerFunc), scope, h.userStore, h.sessionStore, h.apiKeyStore)
+}
+
+func (h *Handler) handleGetImports(w http.ResponseWriter, r *http.Request) {
+	user, err := auth.ExtractUserFromContext(r)
+	if err != nil {
+		utils.WriteError(w, http.StatusForbidden, err)
+		return
+	}
+	jobs, err := h.store.GetImportsByUser(user.ID)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, jobs)
+}
+
+func (h *Handler) handleGetImport(w http.ResponseWriter, r *http.Request) {
+	user, err := auth.ExtractUserFromContext(r)
+	if err != nil {
+		utils.WriteError(w, http.StatusForbidden, err)
+		return
+	}
+	job, ok := h.userImport(w, r, user.ID)
+	if !ok {
+		return
+	}
+	job.Files, err = h.store.GetImportFiles(job.ID)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, job)
+}
+
+// handleCreateImport takes a ZIP archive and imports it into the bin given by
+// binID, or into a new bin named after the archive. Its directories become
+// bins and its files documents. The import runs in the background; its
+// status tells how far it got.
+func (h *Handler) handleCreateImport(w http.ResponseWriter, r *http.Request) {
+	user, err := auth.ExtractUserFromContext(r)
+	if err != nil {
+		utils.WriteError(w, http.StatusForbidden, err)
+		return
+	}
+	// room for the form fields next to the archive
+	r.Body = http.MaxBytesReader(w, r.Body, config.Envs.MaxImportSizeInBytes+1<<20)
+	if err := r.ParseMultipartForm(32 << 20); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			utils.WriteError(w, http.StatusRequestEntityTooLarge, fmt.Errorf("archive is larger than %d bytes", config.Envs.MaxImportSizeInBytes))
+			return
+		}
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	binIDStr := r.Form.Get("binID")
+	language := r.Form.Get("language")
+	if !(language == "eng" || language == "nep") {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("language not supported"))
+		return
+	}
+
+	file, fileHeader, err := r.FormFile("file")
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("failed to get file from request: %v", err))
+		return
+	}
+	defer file.Close()
+	if fileHeader.Size > config.Envs.MaxImportSizeInBytes {
+		utils.WriteError(w, http.StatusRequestEntityTooLarge, fmt.Errorf("archive is larger than %d bytes", config.Envs.MaxImportSizeInBytes))
+		return
+	}
+	archive, err := zip.NewReader(file, fileHeader.Size)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("file is not a ZIP archive"))
+		return
+	}
+	paths, err := ArchiveFiles(archive)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	// importing creates bins, so it takes what creating them does
+	var bin *types.Bin
+	if binIDStr != "" {
+		binID, err := strconv.Atoi(binIDStr)
+		if err != nil {
+			utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid bin"))
+			return
+		}
+		var ok bool
+		bin, ok = h.permissions.Container(w, user.ID, binID, types.RoleEditor)
+		if !ok {
+			return
+		}
+	}
+	// a bin created for the archive belongs to the user
+	owner := bin
+	if owner == nil {
+		owner = &types.Bin{OwnerID: user.ID}
+	}
+	if !h.checkRoom(w, owner, archive, paths) {
+		return
+	}
+
+	created := false
+	if bin == nil {
+		name := strings.TrimSuffix(fileHeader.Filename, path.Ext(fileHeader.Filename))
+		bin, err = h.binStore.CreateBin(types.Bin{Name: name, OwnerID: user.ID})
+		if err != nil {
+			utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("unable to create bin: %v", err))
+			return
+		}
+		created = true
+	}
+	job, err := h.createImport(r, user.ID, bin, fileHeader.Filename, language, file, fileHeader.Size, paths)
+	if err != nil {
+		if created {
+			if err := h.binStore.DeleteBin(bin.ID); err != nil {
+				log.Printf("unable to remove bin %d of failed import: %v", bin.ID, err)
+			}
+		}
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	utils.WriteJSON(w, http.StatusAccepted, job)
+}
+
+// checkRoom writes a 507 and returns false if the files to import from the
+// archive would take the owner of the bin over their quota. Files too large
+// to import on their own aren't counted, since they will be skipped.
+func (h *Handler) checkRoom(w http.ResponseWriter, bin *types.Bin, archive *zip.Reader, paths []string) bool {
+	binQuota, err := quota.ForBin(h.quotaStore, bin)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return false
+	}
+	sizes := make(map[string]int64, len(archive.File))
+	for _, f := range archive.File {
+		sizes[f.Name] = int64(f.UncompressedSize64)
+	}
+	var bytes int64
+	for _, p := range paths {
+		if size := sizes[p]; size <= config.Envs.MaxUploadSizeInBytes {
+			bytes += size
+		}
+	}
+	err = quota.CheckRoom(binQuota, h.documentStore, bin, len(paths), bytes)
+	if errors.Is(err, types.ErrQuotaExceeded) {
+		utils.WriteError(w, http.StatusInsufficientStorage, err)
+		return false
+	}
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return false
+	}
+	return true
+}
+
+// createImport stores the archive next to the bin's documents and records the
+// import for the importer to pick up.
+func (h *Handler) createImport(r *http.Request, userID int, bin *types.Bin, name, language string, archive io.ReaderAt, size int64, paths []string) (*types.ImportJob, error) {
+	storageKey, err := h.permissions.StorageKey(bin)
+	if err != nil {
+		return nil, err
+	}
+	archiveKey := path.Join(storageKey, "imports", utils.HashString(fmt.Sprintf("%d-%d-%s", userID, time.Now().UnixNano(), name)))
+	err = utils.PutObject(r.Context(), h.minio, io.NewSectionReader(archive, 0, size), size, "application/zip", archiveKey)
+	if err != nil {
+		return nil, fmt.Errorf("unable to store archive: %v", err)
+	}
+	job, err := h.store.CreateImport(types.ImportJob{
+		UserID:     userID,
+		BinID:      bin.ID,
+		Name:       name,
+		ArchiveKey: archiveKey,
+		Language:   language,
+	}, paths)
+	if err != nil {
+		utils.DeleteObject(r.Context(), h.minio, archiveKey)
+		return nil, fmt.Errorf("unable to create import: %v", err)
+	}
+	return job, nil
+}
+
+func (h *Handler) handleRetryImport(w http.ResponseWriter, r *http.Request) {
+	user, err := auth.ExtractUserFromContext(r)
+	if err != nil {
+		utils.WriteError(w, http.StatusForbidden, err)
+		return
+	}
+	job, ok := h.userImport(w, r, user.ID)
+	if !ok {
+		return
+	}
+	if _, ok := h.permissions.Bin(w, user.ID, job.BinID, types.RoleEditor); !ok {
+		return
+	}
+	if err := h.store.RetryImport(job.ID); err != nil {
+		utils.WriteError(w, http.StatusConflict, err)
+		return
+	}
+	job.Status = StatusPending
+	job.CompletedAt = nil
+	utils.WriteJSON(w, http.StatusAccepted, job)
+}
+
+// userImport loads the import in the URL, which only the user who started it
+// can see.
+func (h *Handler) userImport(w http.ResponseWriter, r *http.Request, userID int) (*types.ImportJob, bool) {
+	importIDStr := chi.URLParam(r, "importID")
+	importID, err := strconv.Atoi(importIDStr)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid import %s", importIDStr))
+		return nil, false
+	}
+	job, err := h.store.GetImportByID(importID)
+	if err != nil || job.UserID != userID {
+		utils.WriteError(w, http.StatusNotFound, fmt.Errorf("import not found"))
+		return nil, false
+	}
+	return job, true
+}
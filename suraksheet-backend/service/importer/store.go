@@ -0,0 +1,230 @@
+package importer
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/LikheKeto/Suraksheet/types"
+)
+
+const (
+	StatusPending   = "pending"
+	StatusRunning   = "running"
+	StatusCompleted = "completed"
+	StatusFailed    = "failed"
+
+	FileStatusPending  = "pending"
+	FileStatusImported = "imported"
+	FileStatusFailed   = "failed"
+)
+
+// claimLease is how long a running import stays claimed without progress.
+// The importer renews it with every file, so a job only outlives it if the
+// process running it is gone.
+const claimLease = 10 * time.Minute
+
+type Store struct {
+	db *sql.DB
+}
+
+func NewStore(db *sql.DB) *Store {
+	return &Store{
+		db: db,
+	}
+}
+
+func (s *Store) CreateImport(job types.ImportJob, paths []string) (*types.ImportJob, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	created, err := scanRowIntoImport(tx.QueryRow(`
+		INSERT INTO imports (userId, bin, name, archiveKey, language)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING *;
+	`, job.UserID, job.BinID, job.Name, job.ArchiveKey, job.Language))
+	if err != nil {
+		return nil, err
+	}
+	for _, path := range paths {
+		_, err := tx.Exec("INSERT INTO import_files (import, path) VALUES ($1, $2);", created.ID, path)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return created, nil
+}
+
+func (s *Store) GetImportByID(id int) (*types.ImportJob, error) {
+	job, err := scanRowIntoImport(s.db.QueryRow("SELECT * FROM imports WHERE id = $1;", id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("import not found")
+		}
+		return nil, err
+	}
+	return job, nil
+}
+
+func (s *Store) GetImportsByUser(userID int) ([]types.ImportJob, error) {
+	rows, err := s.db.Query("SELECT * FROM imports WHERE userId = $1 ORDER BY createdAt DESC;", userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	return scanRowsIntoImports(rows)
+}
+
+func (s *Store) GetImportFiles(importID int) ([]types.ImportFile, error) {
+	rows, err := s.db.Query("SELECT * FROM import_files WHERE import = $1 ORDER BY path;", importID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	files := make([]types.ImportFile, 0)
+	for rows.Next() {
+		file := types.ImportFile{}
+		err := rows.Scan(&file.ID, &file.ImportID, &file.Path, &file.Status, &file.Error, &file.DocumentID)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, file)
+	}
+	return files, nil
+}
+
+// GetPendingImports returns the imports waiting to run, along with running
+// imports whose lease ran out.
+func (s *Store) GetPendingImports() ([]types.ImportJob, error) {
+	rows, err := s.db.Query(`
+		SELECT * FROM imports
+		WHERE status = $1 OR (status = $2 AND claimedAt < $3)
+		ORDER BY createdAt;
+	`, StatusPending, StatusRunning, staleBefore())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	return scanRowsIntoImports(rows)
+}
+
+// ClaimImport marks a pending import, or a running one whose lease ran out,
+// as running. It fails if another API replica got to it first.
+func (s *Store) ClaimImport(id int) error {
+	res, err := s.db.Exec(`
+		UPDATE imports SET status = $1, claimedAt = CURRENT_TIMESTAMP
+		WHERE id = $2 AND (status = $3 OR (status = $1 AND claimedAt < $4));
+	`, StatusRunning, id, StatusPending, staleBefore())
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return fmt.Errorf("import is no longer pending")
+	}
+	return nil
+}
+
+// UpdateImportFile records how importing the file went, and renews the lease
+// of its import.
+func (s *Store) UpdateImportFile(id int, status, errMsg string, documentID *int) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`
+		UPDATE import_files SET status = $1, error = $2, document = $3
+		WHERE id = $4;
+	`, status, errMsg, documentID, id)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(`
+		UPDATE imports SET claimedAt = CURRENT_TIMESTAMP
+		WHERE id = (SELECT import FROM import_files WHERE id = $1);
+	`, id)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *Store) CompleteImport(id int, status string) error {
+	_, err := s.db.Exec(`
+		UPDATE imports SET status = $1, completedAt = CURRENT_TIMESTAMP
+		WHERE id = $2;
+	`, status, id)
+	return err
+}
+
+func (s *Store) RetryImport(id int) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec(`
+		UPDATE imports SET status = $1, completedAt = NULL, claimedAt = NULL
+		WHERE id = $2 AND (status = $3 OR (status = $4 AND claimedAt < $5));
+	`, StatusPending, id, StatusFailed, StatusRunning, staleBefore())
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return fmt.Errorf("only failed or stalled imports can be retried")
+	}
+	_, err = tx.Exec(`
+		UPDATE import_files SET status = $1, error = ''
+		WHERE import = $2 AND status = $3;
+	`, FileStatusPending, id, FileStatusFailed)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func staleBefore() time.Time {
+	return time.Now().UTC().Add(-claimLease)
+}
+
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+func scanRowsIntoImports(rows *sql.Rows) ([]types.ImportJob, error) {
+	jobs := make([]types.ImportJob, 0)
+	for rows.Next() {
+		job, err := scanRowIntoImport(rows)
+		if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, *job)
+	}
+	return jobs, nil
+}
+
+func scanRowIntoImport(row scanner) (*types.ImportJob, error) {
+	job := new(types.ImportJob)
+	err := row.Scan(&job.ID, &job.UserID, &job.BinID, &job.Name, &job.ArchiveKey, &job.Language, &job.Status, &job.CreatedAt, &job.CompletedAt, &job.ClaimedAt)
+	if err != nil {
+		return nil, err
+	}
+	return job, nil
+}
@@ -0,0 +1,118 @@
+package importer
+
+import (
+	"database/sql/driver"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func newMockStore(t *testing.T) (*Store, sqlmock.Sqlmock) {
+	t.Helper()
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		db.Close()
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+	})
+	return NewStore(db), mock
+}
+
+// leaseExpiry matches the time before which a running import's lease has
+// run out.
+type leaseExpiry struct{}
+
+func (leaseExpiry) Match(v driver.Value) bool {
+	at, ok := v.(time.Time)
+	return ok && time.Since(at) >= claimLease && time.Since(at) < claimLease+time.Minute
+}
+
+func TestClaimImport(t *testing.T) {
+	claim := `UPDATE imports SET status = \$1, claimedAt = CURRENT_TIMESTAMP\s+WHERE id = \$2 AND \(status = \$3 OR \(status = \$1 AND claimedAt < \$4\)\)`
+
+	t.Run("should claim a pending or stalled import", func(t *testing.T) {
+		store, mock := newMockStore(t)
+		mock.ExpectExec(claim).WithArgs(StatusRunning, 1, StatusPending, leaseExpiry{}).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+
+		if err := store.ClaimImport(1); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("should fail for an import claimed by someone else", func(t *testing.T) {
+		store, mock := newMockStore(t)
+		mock.ExpectExec(claim).WithArgs(StatusRunning, 1, StatusPending, leaseExpiry{}).
+			WillReturnResult(sqlmock.NewResult(0, 0))
+
+		if err := store.ClaimImport(1); err == nil {
+			t.Error("expected an error")
+		}
+	})
+}
+
+func TestGetPendingImports(t *testing.T) {
+	store, mock := newMockStore(t)
+	mock.ExpectQuery(`WHERE status = \$1 OR \(status = \$2 AND claimedAt < \$3\)`).
+		WithArgs(StatusPending, StatusRunning, leaseExpiry{}).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "userId", "bin", "name", "archiveKey", "language", "status", "createdAt", "completedAt", "claimedAt"}).
+			AddRow(1, 1, 1, "scans.zip", "imports/a", "eng", StatusRunning, time.Now(), nil, time.Now().Add(-time.Hour)))
+
+	jobs, err := store.GetPendingImports()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(jobs) != 1 || jobs[0].ClaimedAt == nil {
+		t.Errorf("expected the stalled import, got %+v", jobs)
+	}
+}
+
+func TestUpdateImportFile(t *testing.T) {
+	store, mock := newMockStore(t)
+	mock.ExpectBegin()
+	mock.ExpectExec("UPDATE import_files SET status").WithArgs(FileStatusImported, "", 4, 3).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("UPDATE imports SET claimedAt = CURRENT_TIMESTAMP").WithArgs(3).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	docID := 4
+	if err := store.UpdateImportFile(3, FileStatusImported, "", &docID); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRetryImport(t *testing.T) {
+	retry := `UPDATE imports SET status = \$1, completedAt = NULL, claimedAt = NULL\s+WHERE id = \$2 AND \(status = \$3 OR \(status = \$4 AND claimedAt < \$5\)\)`
+
+	t.Run("should queue the files that weren't imported again", func(t *testing.T) {
+		store, mock := newMockStore(t)
+		mock.ExpectBegin()
+		mock.ExpectExec(retry).WithArgs(StatusPending, 1, StatusFailed, StatusRunning, leaseExpiry{}).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec("UPDATE import_files SET status").WithArgs(FileStatusPending, 1, FileStatusFailed).
+			WillReturnResult(sqlmock.NewResult(0, 2))
+		mock.ExpectCommit()
+
+		if err := store.RetryImport(1); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("should fail for an import that is still running or done", func(t *testing.T) {
+		store, mock := newMockStore(t)
+		mock.ExpectBegin()
+		mock.ExpectExec(retry).WithArgs(StatusPending, 1, StatusFailed, StatusRunning, leaseExpiry{}).
+			WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectRollback()
+
+		if err := store.RetryImport(1); err == nil {
+			t.Error("expected an error")
+		}
+	})
+}
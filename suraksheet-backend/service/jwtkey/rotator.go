@@ -0,0 +1,157 @@
+package jwtkey
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/LikheKeto/Suraksheet/service/auth"
+	"github.com/LikheKeto/Suraksheet/types"
+)
+
+// Rotator keeps auth.Keys in sync with the keys in the store. It starts
+// signing with a fresh key every rotation period and keeps accepting the
+// previous ones for the overlap window, so tokens issued just before a
+// rotation stay valid until they expire.
+//
+// Private keys are stored encrypted with a key derived from the server secret.
+type Rotator struct {
+	store     types.JWTKeyStore
+	keys      *auth.KeySet
+	algorithm string
+	rotation  time.Duration
+	overlap   time.Duration
+	aead      cipher.AEAD
+
+	mu sync.Mutex
+}
+
+func NewRotator(store types.JWTKeyStore, keys *auth.KeySet, secret, algorithm string, rotation, overlap time.Duration) (*Rotator, error) {
+	sum := sha256.Sum256([]byte(secret))
+	block, err := aes.NewCipher(sum[:])
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &Rotator{
+		store:     store,
+		keys:      keys,
+		algorithm: algorithm,
+		rotation:  rotation,
+		overlap:   overlap,
+		aead:      aead,
+	}, nil
+}
+
+func (r *Rotator) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if err := r.Refresh(); err != nil {
+			log.Printf("unable to refresh jwt keys: %v", err)
+		}
+	}
+}
+
+// Refresh loads the keys from the store, creating a new signing key if the
+// current one is due for rotation and dropping keys past their overlap window.
+func (r *Rotator) Refresh() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stored, err := r.store.GetJWTKeys()
+	if err != nil {
+		return err
+	}
+	now := time.Now().UTC()
+
+	if len(stored) == 0 || stored[0].Algorithm != r.algorithm || now.Sub(stored[0].CreatedAt) >= r.rotation || !r.canOpen(stored[0]) {
+		key, err := r.createKey(now)
+		if err != nil {
+			return err
+		}
+		stored = append([]types.JWTKey{*key}, stored...)
+	}
+
+	keys := make([]*auth.SigningKey, 0, len(stored))
+	for i, k := range stored {
+		key, err := r.open(k)
+		if i > 0 {
+			validUntil := stored[i-1].CreatedAt.Add(r.overlap)
+			if now.After(validUntil) {
+				if err := r.store.DeleteJWTKeysCreatedBefore(k.CreatedAt); err != nil {
+					log.Printf("unable to delete retired jwt keys: %v", err)
+				}
+				break
+			}
+			if err != nil {
+				log.Printf("skipping jwt key %s: %v", k.ID, err)
+				continue
+			}
+			key.ValidUntil = validUntil
+		} else if err != nil {
+			return err
+		}
+		keys = append(keys, key)
+	}
+	r.keys.Set(keys[0], keys)
+	return nil
+}
+
+func (r *Rotator) createKey(now time.Time) (*types.JWTKey, error) {
+	key, err := auth.GenerateSigningKey(r.algorithm)
+	if err != nil {
+		return nil, err
+	}
+	der, err := auth.MarshalPrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, r.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	stored := types.JWTKey{
+		ID:         key.ID,
+		Algorithm:  key.Algorithm,
+		PrivateKey: r.aead.Seal(nonce, nonce, der, []byte(key.ID)),
+		CreatedAt:  now,
+	}
+	if err := r.store.CreateJWTKey(stored); err != nil {
+		return nil, err
+	}
+	log.Printf("created jwt signing key %s", key.ID)
+	return &stored, nil
+}
+
+func (r *Rotator) open(k types.JWTKey) (*auth.SigningKey, error) {
+	size := r.aead.NonceSize()
+	if len(k.PrivateKey) < size {
+		return nil, fmt.Errorf("malformed key")
+	}
+	der, err := r.aead.Open(nil, k.PrivateKey[:size], k.PrivateKey[size:], []byte(k.ID))
+	if err != nil {
+		// most likely SERVER_JWT_SECRET changed since the key was stored
+		return nil, fmt.Errorf("unable to decrypt key: %v", err)
+	}
+	return auth.ParseSigningKey(k.ID, k.Algorithm, der)
+}
+
+func (r *Rotator) canOpen(k types.JWTKey) bool {
+	_, err := r.open(k)
+	return err == nil
+}
@@ -0,0 +1,28 @@
+package jwtkey
+
+import (
+	"net/http"
+
+	"github.com/LikheKeto/Suraksheet/service/auth"
+	"github.com/LikheKeto/Suraksheet/utils"
+	"github.com/go-chi/chi/v5"
+)
+
+type Handler struct {
+	keys *auth.KeySet
+}
+
+func NewHandler(keys *auth.KeySet) *Handler {
+	return &Handler{keys: keys}
+}
+
+// RegisterRoutes expects the root router, since /.well-known lives outside
+// the versioned API.
+func (h *Handler) RegisterRoutes(router chi.Router) {
+	router.MethodFunc(http.MethodGet, "/.well-known/jwks.json", h.handleJWKS)
+}
+
+func (h *Handler) handleJWKS(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	utils.WriteJSON(w, http.StatusOK, h.keys.JWKS())
+}
@@ -0,0 +1,55 @@
+package jwtkey
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/LikheKeto/Suraksheet/types"
+)
+
+type Store struct {
+	db *sql.DB
+}
+
+func NewStore(db *sql.DB) *Store {
+	return &Store{
+		db: db,
+	}
+}
+
+// GetJWTKeys returns all stored keys, newest first.
+func (s *Store) GetJWTKeys() ([]types.JWTKey, error) {
+	rows, err := s.db.Query("SELECT * FROM jwt_keys ORDER BY createdAt DESC;")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := make([]types.JWTKey, 0)
+	for rows.Next() {
+		key := types.JWTKey{}
+		err := rows.Scan(&key.ID,
+			&key.Algorithm,
+			&key.PrivateKey,
+			&key.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+func (s *Store) CreateJWTKey(key types.JWTKey) error {
+	_, err := s.db.Exec(`
+		INSERT INTO jwt_keys (id, algorithm, privateKey, createdAt)
+		VALUES ($1, $2, $3, $4);
+	`, key.ID, key.Algorithm, key.PrivateKey, key.CreatedAt)
+	return err
+}
+
+// DeleteJWTKeysCreatedBefore removes keys created at or before t.
+func (s *Store) DeleteJWTKeysCreatedBefore(t time.Time) error {
+	_, err := s.db.Exec("DELETE FROM jwt_keys WHERE createdAt <= $1;", t)
+	return err
+}
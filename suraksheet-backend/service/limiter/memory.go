@@ -0,0 +1,69 @@
+package limiter
+
+import (
+	"sync"
+	"time"
+)
+
+// Memory keeps failed attempts in process memory. It's only suitable for a
+// single API replica; use Store when running several.
+type Memory struct {
+	policy Policy
+	now    func() time.Time
+
+	mu        sync.Mutex
+	attempts  map[string]*attempt
+	lastSweep time.Time
+}
+
+func NewMemory(policy Policy) *Memory {
+	return &Memory{
+		policy:   policy,
+		now:      time.Now,
+		attempts: make(map[string]*attempt),
+	}
+}
+
+func (m *Memory) RetryAfter(key string) (time.Duration, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	a, ok := m.attempts[key]
+	if !ok {
+		return 0, nil
+	}
+	return max(a.blockedUntil.Sub(m.now()), 0), nil
+}
+
+func (m *Memory) RecordFailure(key string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := m.now()
+	m.sweep(now)
+
+	a, ok := m.attempts[key]
+	if !ok {
+		a = new(attempt)
+		m.attempts[key] = a
+	}
+	return m.policy.fail(a, now), nil
+}
+
+func (m *Memory) Reset(key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.attempts, key)
+	return nil
+}
+
+// sweep drops stale attempts so keys from one-off guesses don't pile up.
+func (m *Memory) sweep(now time.Time) {
+	if now.Sub(m.lastSweep) < m.policy.Window {
+		return
+	}
+	for key, a := range m.attempts {
+		if m.policy.stale(a, now) {
+			delete(m.attempts, key)
+		}
+	}
+	m.lastSweep = now
+}
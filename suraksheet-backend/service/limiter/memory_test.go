@@ -0,0 +1,68 @@
+package limiter
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMemory(t *testing.T) {
+	policy := Policy{
+		BaseDelay:        time.Second,
+		MaxDelay:         4 * time.Second,
+		Window:           time.Hour,
+		LockoutThreshold: 5,
+		LockoutDuration:  15 * time.Minute,
+	}
+	now := time.Date(2024, 10, 27, 10, 0, 0, 0, time.UTC)
+	newMemory := func() *Memory {
+		m := NewMemory(policy)
+		m.now = func() time.Time { return now }
+		return m
+	}
+
+	t.Run("should double the delay after every failure", func(t *testing.T) {
+		m := newMemory()
+		for _, want := range []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 4 * time.Second} {
+			if locked, _ := m.RecordFailure("key"); locked {
+				t.Fatal("expected no lockout yet")
+			}
+			if wait, _ := m.RetryAfter("key"); wait != want {
+				t.Errorf("expected delay %v, got %v", want, wait)
+			}
+		}
+		if wait, _ := m.RetryAfter("other"); wait != 0 {
+			t.Errorf("expected other keys not to be delayed, got %v", wait)
+		}
+	})
+
+	t.Run("should lock out after too many failures", func(t *testing.T) {
+		m := newMemory()
+		var locked bool
+		for i := 0; i < policy.LockoutThreshold; i++ {
+			locked, _ = m.RecordFailure("key")
+		}
+		if !locked {
+			t.Fatal("expected lockout")
+		}
+		if wait, _ := m.RetryAfter("key"); wait != policy.LockoutDuration {
+			t.Errorf("expected lockout of %v, got %v", policy.LockoutDuration, wait)
+		}
+	})
+
+	t.Run("should forget failures after a reset or the window", func(t *testing.T) {
+		m := newMemory()
+		m.RecordFailure("key")
+		m.Reset("key")
+		if wait, _ := m.RetryAfter("key"); wait != 0 {
+			t.Errorf("expected no delay after reset, got %v", wait)
+		}
+
+		for i := 0; i < policy.LockoutThreshold-1; i++ {
+			m.RecordFailure("key")
+		}
+		now = now.Add(2 * policy.Window)
+		if locked, _ := m.RecordFailure("key"); locked {
+			t.Error("expected failures outside the window not to count")
+		}
+	})
+}
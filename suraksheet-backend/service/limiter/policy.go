@@ -0,0 +1,70 @@
+package limiter
+
+import (
+	"time"
+
+	"github.com/LikheKeto/Suraksheet/config"
+)
+
+// Policy decides how long further attempts are held off after a failure.
+// Every failure doubles the delay up to MaxDelay; once LockoutThreshold
+// failures pile up within Window the key is locked for LockoutDuration.
+type Policy struct {
+	BaseDelay        time.Duration
+	MaxDelay         time.Duration
+	Window           time.Duration
+	LockoutThreshold int
+	LockoutDuration  time.Duration
+}
+
+// AccountPolicy and IPPolicy build the policies from config.Envs. IPs get a
+// higher threshold since many users may share one behind a NAT.
+func AccountPolicy() Policy {
+	return policyFromConfig(int(config.Envs.LoginAccountLockoutThreshold))
+}
+
+func IPPolicy() Policy {
+	return policyFromConfig(int(config.Envs.LoginIPLockoutThreshold))
+}
+
+func policyFromConfig(threshold int) Policy {
+	return Policy{
+		BaseDelay:        time.Duration(config.Envs.LoginBackoffBaseInSeconds) * time.Second,
+		MaxDelay:         time.Duration(config.Envs.LoginBackoffMaxInSeconds) * time.Second,
+		Window:           time.Duration(config.Envs.LoginFailureWindowInSeconds) * time.Second,
+		LockoutThreshold: threshold,
+		LockoutDuration:  time.Duration(config.Envs.LoginLockoutDurationInSeconds) * time.Second,
+	}
+}
+
+type attempt struct {
+	failures      int
+	lastFailureAt time.Time
+	blockedUntil  time.Time
+}
+
+// fail records a failure at now and reports whether it locked the key out.
+// Once locked, every further failure within the window locks it again.
+func (p Policy) fail(a *attempt, now time.Time) bool {
+	if now.Sub(a.lastFailureAt) > p.Window {
+		a.failures = 0
+	}
+	a.failures++
+	a.lastFailureAt = now
+
+	if p.LockoutThreshold > 0 && a.failures >= p.LockoutThreshold {
+		a.blockedUntil = now.Add(p.LockoutDuration)
+		return true
+	}
+	delay := p.BaseDelay
+	for i := 1; i < a.failures && delay < p.MaxDelay; i++ {
+		delay *= 2
+	}
+	a.blockedUntil = now.Add(min(delay, p.MaxDelay))
+	return false
+}
+
+// stale reports whether the attempt no longer affects anything and can be dropped.
+func (p Policy) stale(a *attempt, now time.Time) bool {
+	return now.After(a.blockedUntil) && now.Sub(a.lastFailureAt) > p.Window
+}
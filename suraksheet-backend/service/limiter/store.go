@@ -0,0 +1,80 @@
+package limiter
+
+import (
+	"database/sql"
+	"time"
+)
+
+// Store keeps failed attempts in Postgres so all API replicas share them.
+type Store struct {
+	db     *sql.DB
+	policy Policy
+}
+
+func NewStore(db *sql.DB, policy Policy) *Store {
+	return &Store{
+		db:     db,
+		policy: policy,
+	}
+}
+
+func (s *Store) RetryAfter(key string) (time.Duration, error) {
+	var blockedUntil time.Time
+	err := s.db.QueryRow("SELECT blockedUntil FROM login_attempts WHERE key = $1;", key).Scan(&blockedUntil)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return 0, nil
+		}
+		return 0, err
+	}
+	return max(blockedUntil.Sub(time.Now().UTC()), 0), nil
+}
+
+func (s *Store) RecordFailure(key string) (bool, error) {
+	now := time.Now().UTC()
+	tx, err := s.db.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	// make sure the row exists so concurrent failures queue up on its lock
+	_, err = tx.Exec(`
+		INSERT INTO login_attempts (key, failures, lastFailureAt, blockedUntil)
+		VALUES ($1, 0, $2, $2)
+		ON CONFLICT (key) DO NOTHING;
+	`, key, time.Time{})
+	if err != nil {
+		return false, err
+	}
+	a := new(attempt)
+	err = tx.QueryRow(`
+		SELECT failures, lastFailureAt, blockedUntil FROM login_attempts
+		WHERE key = $1 FOR UPDATE;
+	`, key).Scan(&a.failures, &a.lastFailureAt, &a.blockedUntil)
+	if err != nil {
+		return false, err
+	}
+
+	locked := s.policy.fail(a, now)
+	_, err = tx.Exec(`
+		UPDATE login_attempts SET failures = $1, lastFailureAt = $2, blockedUntil = $3
+		WHERE key = $4;
+	`, a.failures, a.lastFailureAt, a.blockedUntil, key)
+	if err != nil {
+		return false, err
+	}
+	if err := tx.Commit(); err != nil {
+		return false, err
+	}
+
+	_, err = s.db.Exec(`
+		DELETE FROM login_attempts WHERE blockedUntil < $1 AND lastFailureAt < $2;
+	`, now, now.Add(-s.policy.Window))
+	return locked, err
+}
+
+func (s *Store) Reset(key string) error {
+	_, err := s.db.Exec("DELETE FROM login_attempts WHERE key = $1;", key)
+	return err
+}
@@ -0,0 +1,142 @@
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// mockIdP is a minimal identity provider that hands out an ID token for a
+// single authorization code.
+type mockIdP struct {
+	server   *httptest.Server
+	key      *rsa.PrivateKey
+	code     string
+	verifier string
+	nonce    string
+}
+
+func newMockIdP(t *testing.T) *mockIdP {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	idp := &mockIdP{key: key, code: "auth-code"}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 idp.server.URL,
+			"authorization_endpoint": idp.server.URL + "/authorize",
+			"token_endpoint":         idp.server.URL + "/token",
+			"jwks_uri":               idp.server.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]any{"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": "test",
+			"use": "sig",
+			"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		if r.Form.Get("code") != idp.code {
+			http.Error(w, "invalid code", http.StatusBadRequest)
+			return
+		}
+		sum := sha256.Sum256([]byte(r.Form.Get("code_verifier")))
+		if base64.RawURLEncoding.EncodeToString(sum[:]) != idp.verifier {
+			http.Error(w, "invalid code verifier", http.StatusBadRequest)
+			return
+		}
+		token := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+			"iss":            idp.server.URL,
+			"aud":            "suraksheet",
+			"sub":            "user-1",
+			"email":          "user@example.com",
+			"email_verified": true,
+			"given_name":     "Test",
+			"nonce":          idp.nonce,
+			"exp":            time.Now().Add(time.Minute).Unix(),
+		})
+		token.Header["kid"] = "test"
+		idToken, err := token.SignedString(key)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"id_token": idToken})
+	})
+	idp.server = httptest.NewServer(mux)
+	t.Cleanup(idp.server.Close)
+	return idp
+}
+
+// authorize plays the part of the browser signing in at the provider.
+func (idp *mockIdP) authorize(t *testing.T, authURL string) {
+	u, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(authURL, idp.server.URL+"/authorize?") {
+		t.Fatalf("unexpected auth url %s", authURL)
+	}
+	if u.Query().Get("code_challenge_method") != "S256" {
+		t.Fatalf("expected S256 code challenge")
+	}
+	idp.verifier = u.Query().Get("code_challenge")
+	idp.nonce = u.Query().Get("nonce")
+}
+
+func TestExchange(t *testing.T) {
+	idp := newMockIdP(t)
+	p := NewProvider(idp.server.URL, "suraksheet", "", "http://localhost/api/v1/oidc/callback")
+	ctx := context.Background()
+
+	verifier, challenge, err := NewPKCE()
+	if err != nil {
+		t.Fatal(err)
+	}
+	authURL, err := p.AuthURL(ctx, "state", "nonce", challenge)
+	if err != nil {
+		t.Fatal(err)
+	}
+	idp.authorize(t, authURL)
+
+	t.Run("should return the claims of a valid login", func(t *testing.T) {
+		claims, err := p.Exchange(ctx, idp.code, verifier, "nonce")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if claims.Subject != "user-1" || claims.Email != "user@example.com" || !claims.EmailVerified {
+			t.Errorf("unexpected claims %+v", claims)
+		}
+	})
+
+	t.Run("should fail if the nonce doesn't match", func(t *testing.T) {
+		if _, err := p.Exchange(ctx, idp.code, verifier, "other"); err == nil {
+			t.Error("expected error for mismatched nonce")
+		}
+	})
+
+	t.Run("should fail with the wrong code verifier", func(t *testing.T) {
+		if _, err := p.Exchange(ctx, idp.code, "wrong", "nonce"); err == nil {
+			t.Error("expected error for wrong code verifier")
+		}
+	})
+}
@@ -0,0 +1,222 @@
+package oidc
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/LikheKeto/Suraksheet/service/auth"
+	"github.com/LikheKeto/Suraksheet/types"
+	"github.com/LikheKeto/Suraksheet/utils"
+	"github.com/go-chi/chi/v5"
+)
+
+// loginExpiration is how long a user has to finish signing in at the provider.
+const loginExpiration = 10 * time.Minute
+
+// stateCookie ties a login to the browser that started it, so a callback
+// carrying someone else's state can't sign this browser into their account.
+const stateCookie = "oidc_state"
+
+type Handler struct {
+	store        types.OIDCStore
+	userStore    types.UserStore
+	sessionStore types.SessionStore
+	provider     *Provider
+	frontendURL  string
+}
+
+func NewHandler(store types.OIDCStore, userStore types.UserStore, sessionStore types.SessionStore, provider *Provider, frontendURL string) *Handler {
+	return &Handler{store: store, userStore: userStore, sessionStore: sessionStore, provider: provider, frontendURL: frontendURL}
+}
+
+func (h *Handler) RegisterRoutes(router chi.Router) {
+	router.MethodFunc(http.MethodGet, "/oidc/login", h.handleLogin)
+	router.MethodFunc(http.MethodGet, "/oidc/callback", h.handleCallback)
+}
+
+func (h *Handler) handleLogin(w http.ResponseWriter, r *http.Request) {
+	state, err := randomString(32)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	nonce, err := randomString(32)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	verifier, challenge, err := NewPKCE()
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	authURL, err := h.provider.AuthURL(r.Context(), state, nonce, challenge)
+	if err != nil {
+		log.Printf("oidc: %v", err)
+		utils.WriteError(w, http.StatusBadGateway, fmt.Errorf("identity provider is unavailable"))
+		return
+	}
+
+	err = h.store.CreateLoginState(types.OIDCLoginState{
+		State:        state,
+		CodeVerifier: verifier,
+		Nonce:        nonce,
+		ExpiresAt:    time.Now().UTC().Add(loginExpiration),
+	})
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	h.setStateCookie(w, state, int(loginExpiration/time.Second))
+	http.Redirect(w, r, authURL, http.StatusFound)
+}
+
+// handleCallback finishes the login and sends the browser back to the
+// frontend with the tokens in the URL fragment, so they never reach server logs.
+func (h *Handler) handleCallback(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	if e := query.Get("error"); e != "" {
+		h.redirect(w, r, url.Values{"error": {e}})
+		return
+	}
+	cookie, err := r.Cookie(stateCookie)
+	h.setStateCookie(w, "", -1)
+	if err != nil || subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(query.Get("state"))) != 1 {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("login was not started in this browser"))
+		return
+	}
+	login, err := h.store.ConsumeLoginState(query.Get("state"))
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	claims, err := h.provider.Exchange(r.Context(), query.Get("code"), login.CodeVerifier, login.Nonce)
+	if err != nil {
+		log.Printf("oidc: %v", err)
+		h.redirect(w, r, url.Values{"error": {"login_failed"}})
+		return
+	}
+
+	user, err := h.findOrCreateUser(claims)
+	if err != nil {
+		log.Printf("oidc: %v", err)
+		h.redirect(w, r, url.Values{"error": {err.Error()}})
+		return
+	}
+
+	if user.TOTPEnabled {
+		challenge, err := auth.CreateChallengeJWT(user.ID)
+		if err != nil {
+			utils.WriteError(w, http.StatusInternalServerError, err)
+			return
+		}
+		h.redirect(w, r, url.Values{"challenge": {challenge}})
+		return
+	}
+
+	token, refreshToken, err := auth.StartSession(h.sessionStore, user.ID, r)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	h.redirect(w, r, url.Values{"token": {token}, "refreshToken": {refreshToken}})
+}
+
+// findOrCreateUser resolves the user an identity belongs to. Unknown
+// identities are linked to the account with the same email, but only if the
+// provider vouches for that email; otherwise a new account is created.
+func (h *Handler) findOrCreateUser(claims *Claims) (*types.User, error) {
+	identity, err := h.store.GetIdentity(h.provider.Issuer, claims.Subject)
+	if err == nil {
+		return h.userStore.GetUserByID(identity.UserID)
+	}
+
+	if claims.Email == "" {
+		return nil, fmt.Errorf("identity provider didn't share an email")
+	}
+	email := claims.Email
+	user, err := h.userStore.GetUserByEmail(email)
+	if err == nil && !claims.EmailVerified {
+		return nil, fmt.Errorf("email_not_verified")
+	}
+	if err != nil {
+		user, err = h.createUser(email, claims)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = h.store.CreateIdentity(types.OIDCIdentity{
+		UserID:  user.ID,
+		Issuer:  h.provider.Issuer,
+		Subject: claims.Subject,
+		Email:   email,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+func (h *Handler) createUser(email string, claims *Claims) (*types.User, error) {
+	// the account gets an unguessable password; the user can set a real one
+	// through the password reset flow if they ever want one
+	password, err := randomString(32)
+	if err != nil {
+		return nil, err
+	}
+	hashedPassword, err := auth.HashPassword(password)
+	if err != nil {
+		return nil, err
+	}
+	firstName, lastName := claims.GivenName, claims.FamilyName
+	if firstName == "" {
+		firstName = strings.Split(email, "@")[0]
+	}
+
+	userID, err := h.userStore.CreateUser(types.User{
+		FirstName: firstName,
+		LastName:  lastName,
+		Email:     email,
+		Password:  hashedPassword,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if claims.EmailVerified {
+		if err := h.userStore.SetEmailVerified(userID); err != nil {
+			return nil, err
+		}
+	}
+	return h.userStore.GetUserByID(userID)
+}
+
+// setStateCookie remembers the state of a login for maxAge seconds; a
+// negative maxAge clears it. The cookie is only sent to the callback, and
+// SameSite=Lax still lets the provider's top-level redirect carry it.
+func (h *Handler) setStateCookie(w http.ResponseWriter, state string, maxAge int) {
+	cookie := &http.Cookie{
+		Name:     stateCookie,
+		Value:    state,
+		Path:     "/",
+		MaxAge:   maxAge,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	}
+	if callback, err := url.Parse(h.provider.RedirectURL); err == nil {
+		if callback.Path != "" {
+			cookie.Path = callback.Path
+		}
+		cookie.Secure = callback.Scheme == "https"
+	}
+	http.SetCookie(w, cookie)
+}
+
+func (h *Handler) redirect(w http.ResponseWriter, r *http.Request, fragment url.Values) {
+	http.Redirect(w, r, h.frontendURL+"#"+fragment.Encode(), http.StatusFound)
+}
@@ -0,0 +1,77 @@
+package oidc
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/LikheKeto/Suraksheet/types"
+)
+
+type mockOIDCStore struct {
+	types.OIDCStore
+	states   map[string]types.OIDCLoginState
+	consumed []string
+}
+
+func (m *mockOIDCStore) CreateLoginState(state types.OIDCLoginState) error {
+	m.states[state.State] = state
+	return nil
+}
+
+func (m *mockOIDCStore) ConsumeLoginState(state string) (*types.OIDCLoginState, error) {
+	m.consumed = append(m.consumed, state)
+	login, ok := m.states[state]
+	if !ok {
+		return nil, fmt.Errorf("invalid or expired login")
+	}
+	delete(m.states, state)
+	return &login, nil
+}
+
+func TestCallbackState(t *testing.T) {
+	idp := newMockIdP(t)
+	store := &mockOIDCStore{states: make(map[string]types.OIDCLoginState)}
+	provider := NewProvider(idp.server.URL, "suraksheet", "", "https://localhost/api/v1/oidc/callback")
+	h := NewHandler(store, nil, nil, provider, "http://localhost:5173/oidc")
+
+	rr := httptest.NewRecorder()
+	h.handleLogin(rr, httptest.NewRequest(http.MethodGet, "/api/v1/oidc/login", nil))
+	if rr.Code != http.StatusFound {
+		t.Fatalf("expected status code %d, got %d", http.StatusFound, rr.Code)
+	}
+	authURL, _ := url.Parse(rr.Header().Get("Location"))
+	state := authURL.Query().Get("state")
+	var cookie *http.Cookie
+	for _, c := range rr.Result().Cookies() {
+		if c.Name == stateCookie {
+			cookie = c
+		}
+	}
+	if cookie == nil || cookie.Value != state {
+		t.Fatalf("expected a cookie holding the state %q, got %+v", state, cookie)
+	}
+	if !cookie.HttpOnly || !cookie.Secure || cookie.SameSite != http.SameSiteLaxMode || cookie.Path != "/api/v1/oidc/callback" {
+		t.Errorf("unexpected cookie attributes %+v", cookie)
+	}
+
+	t.Run("should reject a callback from a browser that didn't start the login", func(t *testing.T) {
+		for _, c := range []*http.Cookie{nil, {Name: stateCookie, Value: "someone-elses"}} {
+			req := httptest.NewRequest(http.MethodGet, "/api/v1/oidc/callback?code=auth-code&state="+url.QueryEscape(state), nil)
+			if c != nil {
+				req.AddCookie(c)
+			}
+			rr := httptest.NewRecorder()
+			h.handleCallback(rr, req)
+
+			if rr.Code != http.StatusBadRequest {
+				t.Errorf("expected status code %d, got %d", http.StatusBadRequest, rr.Code)
+			}
+		}
+		if len(store.consumed) != 0 {
+			t.Errorf("expected the login to be left for its browser, consumed %v", store.consumed)
+		}
+	})
+}
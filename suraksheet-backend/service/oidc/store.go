@@ -0,0 +1,77 @@
+package oidc
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/LikheKeto/Suraksheet/types"
+)
+
+type Store struct {
+	db *sql.DB
+}
+
+func NewStore(db *sql.DB) *Store {
+	return &Store{
+		db: db,
+	}
+}
+
+func (s *Store) CreateLoginState(state types.OIDCLoginState) error {
+	// piggyback cleanup of abandoned logins on new ones
+	_, err := s.db.Exec("DELETE FROM oidc_login_states WHERE expiresAt <= $1;", time.Now().UTC())
+	if err != nil {
+		return err
+	}
+	_, err = s.db.Exec(`
+		INSERT INTO oidc_login_states (state, codeVerifier, nonce, expiresAt)
+		VALUES ($1, $2, $3, $4);
+	`, state.State, state.CodeVerifier, state.Nonce, state.ExpiresAt)
+	return err
+}
+
+// ConsumeLoginState deletes and returns a pending login, so each state can
+// only complete one callback.
+func (s *Store) ConsumeLoginState(state string) (*types.OIDCLoginState, error) {
+	login := new(types.OIDCLoginState)
+	err := s.db.QueryRow(`
+		DELETE FROM oidc_login_states
+		WHERE state = $1 AND expiresAt > $2
+		RETURNING state, codeVerifier, nonce, expiresAt;
+	`, state, time.Now().UTC()).Scan(&login.State, &login.CodeVerifier, &login.Nonce, &login.ExpiresAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("invalid or expired login")
+		}
+		return nil, err
+	}
+	return login, nil
+}
+
+func (s *Store) GetIdentity(issuer, subject string) (*types.OIDCIdentity, error) {
+	identity := new(types.OIDCIdentity)
+	err := s.db.QueryRow(`
+		SELECT * FROM user_identities WHERE issuer = $1 AND subject = $2;
+	`, issuer, subject).Scan(&identity.ID,
+		&identity.UserID,
+		&identity.Issuer,
+		&identity.Subject,
+		&identity.Email,
+		&identity.CreatedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("identity not found")
+		}
+		return nil, err
+	}
+	return identity, nil
+}
+
+func (s *Store) CreateIdentity(identity types.OIDCIdentity) error {
+	_, err := s.db.Exec(`
+		INSERT INTO user_identities (userId, issuer, subject, email)
+		VALUES ($1, $2, $3, $4);
+	`, identity.UserID, identity.Issuer, identity.Subject, identity.Email)
+	return err
+}
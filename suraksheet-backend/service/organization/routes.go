@@ -0,0 +1,583 @@
+package organization
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/LikheKeto/Suraksheet/config"
+	"github.com/LikheKeto/Suraksheet/service/auth"
+	"github.com/LikheKeto/Suraksheet/service/permission"
+	"github.com/LikheKeto/Suraksheet/types"
+	"github.com/LikheKeto/Suraksheet/utils"
+	"github.com/elastic/go-elasticsearch/v8"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-playground/validator/v10"
+	"github.com/minio/minio-go/v7"
+)
+
+const invitationExpiration = 7 * 24 * time.Hour
+
+type Handler struct {
+	store         types.OrganizationStore
+	documentStore types.DocumentStore
+	userStore     types.UserStore
+	sessionStore  types.SessionStore
+	permissions   *permission.Checker
+	mailer        types.Mailer
+	minio         *minio.Client
+	esClient      *elasticsearch.Client
+}
+
+func NewHandler(store types.OrganizationStore, documentStore types.DocumentStore, userStore types.UserStore, sessionStore types.SessionStore, permissions *permission.Checker, mailer types.Mailer, minio *minio.Client, esClient *elasticsearch.Client) *Handler {
+	return &Handler{store: store, documentStore: documentStore, userStore: userStore, sessionStore: sessionStore, permissions: permissions, mailer: mailer, minio: minio, esClient: esClient}
+}
+
+func (h *Handler) RegisterRoutes(router chi.Router) {
+	router.MethodFunc(http.MethodGet, "/organizations", h.withAuth(h.handleGetOrganizations))
+	router.MethodFunc(http.MethodPost, "/organizations", h.withAuth(h.handleCreateOrganization))
+	router.MethodFunc(http.MethodPost, "/organizations/invitations/accept", h.withAuth(h.handleAcceptInvitation))
+	router.MethodFunc(http.MethodGet, "/organizations/{orgID}", h.withAuth(h.handleGetOrganization))
+	router.MethodFunc(http.MethodPatch, "/organizations/{orgID}", h.withAuth(h.handleRenameOrganization))
+	router.MethodFunc(http.MethodDelete, "/organizations/{orgID}", h.withAuth(h.handleDeleteOrganization))
+	router.MethodFunc(http.MethodGet, "/organizations/{orgID}/members", h.withAuth(h.handleGetMembers))
+	router.MethodFunc(http.MethodPatch, "/organizations/{orgID}/members/{userID}", h.withAuth(h.handleUpdateMember))
+	router.MethodFunc(http.MethodDelete, "/organizations/{orgID}/members/{userID}", h.withAuth(h.handleRemoveMember))
+	router.MethodFunc(http.MethodGet, "/organizations/{orgID}/invitations", h.withAuth(h.handleGetInvitations))
+	router.MethodFunc(http.MethodPost, "/organizations/{orgID}/invitations", h.withAuth(h.handleInvite))
+	router.MethodFunc(http.MethodDelete, "/organizations/{orgID}/invitations/{invitationID}", h.withAuth(h.handleDeleteInvitation))
+	router.MethodFunc(http.MethodGet, "/organizations/{orgID}/profiles", h.withAuth(h.handleGetProfiles))
+	router.MethodFunc(http.MethodPost, "/organizations/{orgID}/profiles", h.withAuth(h.handleCreateProfile))
+	router.MethodFunc(http.MethodPatch, "/organizations/{orgID}/profiles/{profileID}", h.withAuth(h.handleUpdateProfile))
+	router.MethodFunc(http.MethodDelete, "/organizations/{orgID}/profiles/{profileID}", h.withAuth(h.handleDeleteProfile))
+	router.MethodFunc(http.MethodGet, "/organizations/{orgID}/profiles/{profileID}/documents", h.withAuth(h.handleGetProfileDocuments))
+}
+
+func (h *Handler) withAuth(handlerFunc http.HandlerFunc) http.HandlerFunc {
+	return auth.WithJWTAuth(auth.RequireVerifiedEmail(handlerFunc), h.userStore, h.sessionStore)
+}
+
+func urlParamInt(r *http.Request, name string) (int, error) {
+	str := chi.URLParam(r, name)
+	id, err := strconv.Atoi(str)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s %s", name, str)
+	}
+	return id, nil
+}
+
+// organization checks that the user has at least the required role in the
+// organization from the URL.
+func (h *Handler) organization(w http.ResponseWriter, r *http.Request, userID int, required string) (*types.Organization, bool) {
+	orgID, err := urlParamInt(r, "orgID")
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return nil, false
+	}
+	return h.permissions.Organization(w, userID, orgID, required)
+}
+
+func (h *Handler) handleGetOrganizations(w http.ResponseWriter, r *http.Request) {
+	user, err := auth.ExtractUserFromContext(r)
+	if err != nil {
+		utils.WriteError(w, http.StatusForbidden, err)
+		return
+	}
+	orgs, err := h.store.GetOrganizationsByUser(user.ID)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, orgs)
+}
+
+func (h *Handler) handleCreateOrganization(w http.ResponseWriter, r *http.Request) {
+	user, err := auth.ExtractUserFromContext(r)
+	if err != nil {
+		utils.WriteError(w, http.StatusForbidden, err)
+		return
+	}
+	var payload types.OrganizationPayload
+	if err := utils.ParseJSON(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	if err := utils.Validate.Struct(payload); err != nil {
+		errors := err.(validator.ValidationErrors)
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid payload %v", errors))
+		return
+	}
+	org, err := h.store.CreateOrganization(payload.Name, user.ID)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	utils.WriteJSON(w, http.StatusCreated, org)
+}
+
+func (h *Handler) handleGetOrganization(w http.ResponseWriter, r *http.Request) {
+	user, err := auth.ExtractUserFromContext(r)
+	if err != nil {
+		utils.WriteError(w, http.StatusForbidden, err)
+		return
+	}
+	org, ok := h.organization(w, r, user.ID, types.OrgRoleMember)
+	if !ok {
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, org)
+}
+
+func (h *Handler) handleRenameOrganization(w http.ResponseWriter, r *http.Request) {
+	user, err := auth.ExtractUserFromContext(r)
+	if err != nil {
+		utils.WriteError(w, http.StatusForbidden, err)
+		return
+	}
+	var payload types.OrganizationPayload
+	if err := utils.ParseJSON(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	if err := utils.Validate.Struct(payload); err != nil {
+		errors := err.(validator.ValidationErrors)
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid payload %v", errors))
+		return
+	}
+	org, ok := h.organization(w, r, user.ID, types.OrgRoleAdmin)
+	if !ok {
+		return
+	}
+	if err := h.store.UpdateOrganizationName(org.ID, payload.Name); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	utils.WriteJSON(w, http.StatusNoContent, nil)
+}
+
+// handleDeleteOrganization deletes the organization with all of its bins and
+// documents.
+func (h *Handler) handleDeleteOrganization(w http.ResponseWriter, r *http.Request) {
+	user, err := auth.ExtractUserFromContext(r)
+	if err != nil {
+		utils.WriteError(w, http.StatusForbidden, err)
+		return
+	}
+	org, ok := h.organization(w, r, user.ID, types.OrgRoleOwner)
+	if !ok {
+		return
+	}
+	err = utils.DeleteDir(r.Context(), h.minio, org.StorageKey+"/")
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, fmt.Errorf("unable to delete organization: %v", err))
+		return
+	}
+	err = utils.DeleteFromIndex(r.Context(), h.esClient, map[string]interface{}{
+		"term": map[string]interface{}{"organization_id": org.ID},
+	})
+	if err != nil {
+		log.Printf("unable to remove documents of organization %d from search: %v", org.ID, err)
+	}
+	if err := h.store.DeleteOrganization(org.ID); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	utils.WriteJSON(w, http.StatusNoContent, nil)
+}
+
+func (h *Handler) handleGetMembers(w http.ResponseWriter, r *http.Request) {
+	user, err := auth.ExtractUserFromContext(r)
+	if err != nil {
+		utils.WriteError(w, http.StatusForbidden, err)
+		return
+	}
+	org, ok := h.organization(w, r, user.ID, types.OrgRoleMember)
+	if !ok {
+		return
+	}
+	members, err := h.store.GetMembers(org.ID)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, members)
+}
+
+// handleUpdateMember changes the role of a member. Only owners hand out and
+// take away roles.
+func (h *Handler) handleUpdateMember(w http.ResponseWriter, r *http.Request) {
+	user, err := auth.ExtractUserFromContext(r)
+	if err != nil {
+		utils.WriteError(w, http.StatusForbidden, err)
+		return
+	}
+	memberID, err := urlParamInt(r, "userID")
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	var payload types.UpdateMemberPayload
+	if err := utils.ParseJSON(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	if err := utils.Validate.Struct(payload); err != nil {
+		errors := err.(validator.ValidationErrors)
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid payload %v", errors))
+		return
+	}
+	org, ok := h.organization(w, r, user.ID, types.OrgRoleOwner)
+	if !ok {
+		return
+	}
+	if _, err := h.store.GetMember(org.ID, memberID); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	if err := h.store.UpdateMemberRole(org.ID, memberID, payload.Role); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("unable to update member: %v", err))
+		return
+	}
+	utils.WriteJSON(w, http.StatusNoContent, nil)
+}
+
+// handleRemoveMember lets admins remove members, owners remove anyone, and
+// every member leave on their own.
+func (h *Handler) handleRemoveMember(w http.ResponseWriter, r *http.Request) {
+	user, err := auth.ExtractUserFromContext(r)
+	if err != nil {
+		utils.WriteError(w, http.StatusForbidden, err)
+		return
+	}
+	memberID, err := urlParamInt(r, "userID")
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	org, ok := h.organization(w, r, user.ID, types.OrgRoleMember)
+	if !ok {
+		return
+	}
+	member, err := h.store.GetMember(org.ID, memberID)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	if member.UserID != user.ID {
+		canRemove := org.Role == types.OrgRoleOwner ||
+			(org.Role == types.OrgRoleAdmin && member.Role == types.OrgRoleMember)
+		if !canRemove {
+			utils.WriteError(w, http.StatusForbidden, fmt.Errorf("%s access to the organization is not enough for this action", org.Role))
+			return
+		}
+	}
+	if err := h.store.RemoveMember(org.ID, member.UserID); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("unable to remove member: %v", err))
+		return
+	}
+	utils.WriteJSON(w, http.StatusNoContent, nil)
+}
+
+func (h *Handler) handleGetInvitations(w http.ResponseWriter, r *http.Request) {
+	user, err := auth.ExtractUserFromContext(r)
+	if err != nil {
+		utils.WriteError(w, http.StatusForbidden, err)
+		return
+	}
+	org, ok := h.organization(w, r, user.ID, types.OrgRoleAdmin)
+	if !ok {
+		return
+	}
+	invitations, err := h.store.GetInvitations(org.ID)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, invitations)
+}
+
+// handleInvite emails a link to join the organization. The person invited
+// doesn't need an account yet; they accept after signing up with that email.
+func (h *Handler) handleInvite(w http.ResponseWriter, r *http.Request) {
+	user, err := auth.ExtractUserFromContext(r)
+	if err != nil {
+		utils.WriteError(w, http.StatusForbidden, err)
+		return
+	}
+	var payload types.InviteMemberPayload
+	if err := utils.ParseJSON(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	if err := utils.Validate.Struct(payload); err != nil {
+		errors := err.(validator.ValidationErrors)
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid payload %v", errors))
+		return
+	}
+	required := types.OrgRoleAdmin
+	if payload.Role == types.OrgRoleAdmin {
+		required = types.OrgRoleOwner
+	}
+	org, ok := h.organization(w, r, user.ID, required)
+	if !ok {
+		return
+	}
+
+	token, err := auth.CreateInvitationToken()
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	invitation, err := h.store.CreateInvitation(types.OrganizationInvitation{
+		OrganizationID: org.ID,
+		Email:          strings.ToLower(payload.Email),
+		Role:           payload.Role,
+		Token:          token,
+		InvitedBy:      &user.ID,
+		ExpiresAt:      time.Now().Add(invitationExpiration).UTC(),
+	})
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	link := fmt.Sprintf("%s/organizations/join?token=%s", config.Envs.PublicHost, url.QueryEscape(token))
+	h.sendMail(invitation.Email, fmt.Sprintf("Join %s on Suraksheet", org.Name),
+		fmt.Sprintf("%s %s invited you to join %s on Suraksheet.\n\n"+
+			"Open the link below to accept. It expires in 7 days:\n%s", user.FirstName, user.LastName, org.Name, link))
+	utils.WriteJSON(w, http.StatusCreated, invitation)
+}
+
+// sendMail delivers the message in the background so slow mail servers don't
+// hold up the request.
+func (h *Handler) sendMail(to, subject, body string) {
+	go func() {
+		if err := h.mailer.Send(to, subject, body); err != nil {
+			log.Printf("unable to send mail to %s: %v", to, err)
+		}
+	}()
+}
+
+func (h *Handler) handleDeleteInvitation(w http.ResponseWriter, r *http.Request) {
+	user, err := auth.ExtractUserFromContext(r)
+	if err != nil {
+		utils.WriteError(w, http.StatusForbidden, err)
+		return
+	}
+	invitationID, err := urlParamInt(r, "invitationID")
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	org, ok := h.organization(w, r, user.ID, types.OrgRoleAdmin)
+	if !ok {
+		return
+	}
+	invitations, err := h.store.GetInvitations(org.ID)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	for _, invitation := range invitations {
+		if invitation.ID == invitationID {
+			if err := h.store.DeleteInvitation(invitation.ID); err != nil {
+				utils.WriteError(w, http.StatusInternalServerError, err)
+				return
+			}
+			utils.WriteJSON(w, http.StatusNoContent, nil)
+			return
+		}
+	}
+	utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invitation not found"))
+}
+
+// handleAcceptInvitation adds the signed in user to the organization, as long
+// as the invitation was sent to their email address.
+func (h *Handler) handleAcceptInvitation(w http.ResponseWriter, r *http.Request) {
+	user, err := auth.ExtractUserFromContext(r)
+	if err != nil {
+		utils.WriteError(w, http.StatusForbidden, err)
+		return
+	}
+	var payload types.AcceptInvitationPayload
+	if err := utils.ParseJSON(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	if err := utils.Validate.Struct(payload); err != nil {
+		errors := err.(validator.ValidationErrors)
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid payload %v", errors))
+		return
+	}
+	invitation, err := h.store.GetInvitationByToken(payload.Token)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid or expired invitation"))
+		return
+	}
+	if !strings.EqualFold(invitation.Email, user.Email) {
+		utils.WriteError(w, http.StatusForbidden, fmt.Errorf("the invitation was sent to a different email address"))
+		return
+	}
+	if err := h.store.AcceptInvitation(invitation.ID, user.ID); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	org, err := h.store.GetOrganizationByID(invitation.OrganizationID)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, org)
+}
+
+func (h *Handler) handleGetProfiles(w http.ResponseWriter, r *http.Request) {
+	user, err := auth.ExtractUserFromContext(r)
+	if err != nil {
+		utils.WriteError(w, http.StatusForbidden, err)
+		return
+	}
+	org, ok := h.organization(w, r, user.ID, types.OrgRoleMember)
+	if !ok {
+		return
+	}
+	profiles, err := h.store.GetProfiles(org.ID)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, profiles)
+}
+
+func (h *Handler) handleCreateProfile(w http.ResponseWriter, r *http.Request) {
+	user, err := auth.ExtractUserFromContext(r)
+	if err != nil {
+		utils.WriteError(w, http.StatusForbidden, err)
+		return
+	}
+	var payload types.ProfilePayload
+	if err := utils.ParseJSON(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	if err := utils.Validate.Struct(payload); err != nil {
+		errors := err.(validator.ValidationErrors)
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid payload %v", errors))
+		return
+	}
+	org, ok := h.organization(w, r, user.ID, types.OrgRoleAdmin)
+	if !ok {
+		return
+	}
+	profile, err := h.store.CreateProfile(types.ManagedProfile{
+		OrganizationID: org.ID,
+		Name:           payload.Name,
+		Relationship:   payload.Relationship,
+	})
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	utils.WriteJSON(w, http.StatusCreated, profile)
+}
+
+// profile loads the profile from the URL and checks it belongs to org.
+func (h *Handler) profile(w http.ResponseWriter, r *http.Request, org *types.Organization) (*types.ManagedProfile, bool) {
+	profileID, err := urlParamInt(r, "profileID")
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return nil, false
+	}
+	profile, err := h.store.GetProfileByID(profileID)
+	if err != nil || profile.OrganizationID != org.ID {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("profile not found"))
+		return nil, false
+	}
+	return profile, true
+}
+
+func (h *Handler) handleUpdateProfile(w http.ResponseWriter, r *http.Request) {
+	user, err := auth.ExtractUserFromContext(r)
+	if err != nil {
+		utils.WriteError(w, http.StatusForbidden, err)
+		return
+	}
+	var payload types.ProfilePayload
+	if err := utils.ParseJSON(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	if err := utils.Validate.Struct(payload); err != nil {
+		errors := err.(validator.ValidationErrors)
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid payload %v", errors))
+		return
+	}
+	org, ok := h.organization(w, r, user.ID, types.OrgRoleAdmin)
+	if !ok {
+		return
+	}
+	profile, ok := h.profile(w, r, org)
+	if !ok {
+		return
+	}
+	profile.Name = payload.Name
+	profile.Relationship = payload.Relationship
+	if err := h.store.UpdateProfile(*profile); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, profile)
+}
+
+// handleDeleteProfile removes the profile; documents filed under it stay in
+// their bins.
+func (h *Handler) handleDeleteProfile(w http.ResponseWriter, r *http.Request) {
+	user, err := auth.ExtractUserFromContext(r)
+	if err != nil {
+		utils.WriteError(w, http.StatusForbidden, err)
+		return
+	}
+	org, ok := h.organization(w, r, user.ID, types.OrgRoleAdmin)
+	if !ok {
+		return
+	}
+	profile, ok := h.profile(w, r, org)
+	if !ok {
+		return
+	}
+	if err := h.store.DeleteProfile(profile.ID); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	utils.WriteJSON(w, http.StatusNoContent, nil)
+}
+
+func (h *Handler) handleGetProfileDocuments(w http.ResponseWriter, r *http.Request) {
+	user, err := auth.ExtractUserFromContext(r)
+	if err != nil {
+		utils.WriteError(w, http.StatusForbidden, err)
+		return
+	}
+	org, ok := h.organization(w, r, user.ID, types.OrgRoleMember)
+	if !ok {
+		return
+	}
+	profile, ok := h.profile(w, r, org)
+	if !ok {
+		return
+	}
+	filter, err := utils.ParseDocumentFilter(r.URL.Query())
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	documents, err := h.documentStore.GetDocumentsByProfile(profile.ID, filter)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, documents)
+}
@@ -0,0 +1,406 @@
+package organization
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"github.com/LikheKeto/Suraksheet/types"
+	"github.com/LikheKeto/Suraksheet/utils"
+)
+
+type Store struct {
+	db *sql.DB
+}
+
+func NewStore(db *sql.DB) *Store {
+	return &Store{
+		db: db,
+	}
+}
+
+func (s *Store) CreateOrganization(name string, ownerID int) (*types.Organization, error) {
+	// organizations get their own prefix in MinIO, unrelated to any member
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	org, err := scanRowIntoOrganization(tx.QueryRow(`
+		INSERT INTO organizations (name, storageKey)
+		VALUES ($1, $2)
+		RETURNING *;
+	`, name, hex.EncodeToString(key)))
+	if err != nil {
+		return nil, err
+	}
+	_, err = tx.Exec(`
+		INSERT INTO organization_members (organization, userId, role)
+		VALUES ($1, $2, $3);
+	`, org.ID, ownerID, types.OrgRoleOwner)
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	org.Role = types.OrgRoleOwner
+	return org, nil
+}
+
+func (s *Store) GetOrganizationByID(id int) (*types.Organization, error) {
+	row := s.db.QueryRow("SELECT * FROM organizations WHERE id = $1;", id)
+	return scanRowIntoOrganization(row)
+}
+
+func (s *Store) GetOrganizationsByUser(userID int) ([]types.Organization, error) {
+	rows, err := s.db.Query(`
+		SELECT o.id, o.name, o.storageKey, o.createdAt, m.role
+		FROM organizations o JOIN organization_members m ON m.organization = o.id
+		WHERE m.userId = $1
+		ORDER BY o.name;
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	orgs := make([]types.Organization, 0)
+	for rows.Next() {
+		var org types.Organization
+		err := rows.Scan(&org.ID, &org.Name, &org.StorageKey, &org.CreatedAt, &org.Role)
+		if err != nil {
+			return nil, err
+		}
+		orgs = append(orgs, org)
+	}
+	return orgs, nil
+}
+
+func (s *Store) UpdateOrganizationName(id int, name string) error {
+	_, err := s.db.Exec("UPDATE organizations SET name = $1 WHERE id = $2;", name, id)
+	return err
+}
+
+func (s *Store) DeleteOrganization(id int) error {
+	_, err := s.db.Exec("DELETE FROM organizations WHERE id = $1;", id)
+	return err
+}
+
+func (s *Store) GetMember(orgID int, userID int) (*types.OrganizationMember, error) {
+	row := s.db.QueryRow(`
+		SELECT m.organization, m.userId, m.role, m.createdAt, u.firstName, u.lastName, u.email
+		FROM organization_members m JOIN users u ON u.id = m.userId
+		WHERE m.organization = $1 AND m.userId = $2;
+	`, orgID, userID)
+	return scanRowIntoMember(row)
+}
+
+// GetMemberRole returns the user's role in the organization, or "" if they
+// aren't a member.
+func (s *Store) GetMemberRole(orgID int, userID int) (string, error) {
+	var role string
+	err := s.db.QueryRow(`
+		SELECT role FROM organization_members WHERE organization = $1 AND userId = $2;
+	`, orgID, userID).Scan(&role)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	return role, err
+}
+
+func (s *Store) GetMembers(orgID int) ([]types.OrganizationMember, error) {
+	rows, err := s.db.Query(`
+		SELECT m.organization, m.userId, m.role, m.createdAt, u.firstName, u.lastName, u.email
+		FROM organization_members m JOIN users u ON u.id = m.userId
+		WHERE m.organization = $1
+		ORDER BY m.createdAt;
+	`, orgID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	members := make([]types.OrganizationMember, 0)
+	for rows.Next() {
+		member, err := scanRowIntoMember(rows)
+		if err != nil {
+			return nil, err
+		}
+		members = append(members, *member)
+	}
+	return members, nil
+}
+
+// UpdateMemberRole refuses to leave the organization without an owner.
+func (s *Store) UpdateMemberRole(orgID int, userID int, role string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := lockOrganization(tx, orgID); err != nil {
+		return err
+	}
+	_, err = tx.Exec(`
+		UPDATE organization_members SET role = $1
+		WHERE organization = $2 AND userId = $3;
+	`, role, orgID, userID)
+	if err != nil {
+		return err
+	}
+	if err := checkHasOwner(tx, orgID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// RemoveMember refuses to remove the last owner of the organization.
+func (s *Store) RemoveMember(orgID int, userID int) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := lockOrganization(tx, orgID); err != nil {
+		return err
+	}
+	_, err = tx.Exec(`
+		DELETE FROM organization_members WHERE organization = $1 AND userId = $2;
+	`, orgID, userID)
+	if err != nil {
+		return err
+	}
+	if err := checkHasOwner(tx, orgID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// lockOrganization makes changes to the members of one organization take
+// turns, so that two owners stepping down at once can't leave it without one.
+func lockOrganization(tx *sql.Tx, orgID int) error {
+	var id int
+	err := tx.QueryRow("SELECT id FROM organizations WHERE id = $1 FOR UPDATE;", orgID).Scan(&id)
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("organization not found")
+	}
+	return err
+}
+
+func checkHasOwner(tx *sql.Tx, orgID int) error {
+	var owners int
+	err := tx.QueryRow(`
+		SELECT COUNT(*) FROM organization_members WHERE organization = $1 AND role = $2;
+	`, orgID, types.OrgRoleOwner).Scan(&owners)
+	if err != nil {
+		return err
+	}
+	if owners == 0 {
+		return fmt.Errorf("an organization needs at least one owner")
+	}
+	return nil
+}
+
+// CreateInvitation stores the hash of invitation.Token, never the token itself.
+func (s *Store) CreateInvitation(invitation types.OrganizationInvitation) (*types.OrganizationInvitation, error) {
+	row := s.db.QueryRow(`
+		INSERT INTO organization_invitations (organization, email, role, token, invitedBy, expiresAt)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING *;
+	`, invitation.OrganizationID, invitation.Email, invitation.Role,
+		utils.HashString(invitation.Token), invitation.InvitedBy, invitation.ExpiresAt)
+	return scanRowIntoInvitation(row)
+}
+
+// GetInvitations returns the invitations that are still waiting for an answer.
+func (s *Store) GetInvitations(orgID int) ([]types.OrganizationInvitation, error) {
+	rows, err := s.db.Query(`
+		SELECT * FROM organization_invitations
+		WHERE organization = $1 AND acceptedAt IS NULL AND expiresAt > $2
+		ORDER BY createdAt DESC;
+	`, orgID, time.Now().UTC())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	invitations := make([]types.OrganizationInvitation, 0)
+	for rows.Next() {
+		invitation, err := scanRowIntoInvitation(rows)
+		if err != nil {
+			return nil, err
+		}
+		invitations = append(invitations, *invitation)
+	}
+	return invitations, nil
+}
+
+func (s *Store) GetInvitationByToken(token string) (*types.OrganizationInvitation, error) {
+	row := s.db.QueryRow(`
+		SELECT * FROM organization_invitations
+		WHERE token = $1 AND acceptedAt IS NULL AND expiresAt > $2;
+	`, utils.HashString(token), time.Now().UTC())
+	return scanRowIntoInvitation(row)
+}
+
+func (s *Store) AcceptInvitation(id int, userID int) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var orgID int
+	var role string
+	err = tx.QueryRow(`
+		UPDATE organization_invitations SET acceptedAt = $1
+		WHERE id = $2 AND acceptedAt IS NULL
+		RETURNING organization, role;
+	`, time.Now().UTC(), id).Scan(&orgID, &role)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return fmt.Errorf("invitation not found")
+		}
+		return err
+	}
+	// someone who is already a member keeps their current role
+	_, err = tx.Exec(`
+		INSERT INTO organization_members (organization, userId, role)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (organization, userId) DO NOTHING;
+	`, orgID, userID, role)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *Store) DeleteInvitation(id int) error {
+	_, err := s.db.Exec("DELETE FROM organization_invitations WHERE id = $1;", id)
+	return err
+}
+
+func (s *Store) CreateProfile(profile types.ManagedProfile) (*types.ManagedProfile, error) {
+	row := s.db.QueryRow(`
+		INSERT INTO managed_profiles (organization, name, relationship)
+		VALUES ($1, $2, $3)
+		RETURNING *;
+	`, profile.OrganizationID, profile.Name, profile.Relationship)
+	return scanRowIntoProfile(row)
+}
+
+func (s *Store) GetProfileByID(id int) (*types.ManagedProfile, error) {
+	row := s.db.QueryRow("SELECT * FROM managed_profiles WHERE id = $1;", id)
+	return scanRowIntoProfile(row)
+}
+
+func (s *Store) GetProfiles(orgID int) ([]types.ManagedProfile, error) {
+	rows, err := s.db.Query("SELECT * FROM managed_profiles WHERE organization = $1 ORDER BY name;", orgID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	profiles := make([]types.ManagedProfile, 0)
+	for rows.Next() {
+		profile, err := scanRowIntoProfile(rows)
+		if err != nil {
+			return nil, err
+		}
+		profiles = append(profiles, *profile)
+	}
+	return profiles, nil
+}
+
+func (s *Store) UpdateProfile(profile types.ManagedProfile) error {
+	_, err := s.db.Exec(`
+		UPDATE managed_profiles SET name = $1, relationship = $2 WHERE id = $3;
+	`, profile.Name, profile.Relationship, profile.ID)
+	return err
+}
+
+func (s *Store) DeleteProfile(id int) error {
+	_, err := s.db.Exec("DELETE FROM managed_profiles WHERE id = $1;", id)
+	return err
+}
+
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+func scanRowIntoOrganization(row scanner) (*types.Organization, error) {
+	org := new(types.Organization)
+	err := row.Scan(&org.ID, &org.Name, &org.StorageKey, &org.CreatedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("organization not found")
+		}
+		return nil, err
+	}
+	return org, nil
+}
+
+func scanRowIntoMember(row scanner) (*types.OrganizationMember, error) {
+	member := new(types.OrganizationMember)
+	err := row.Scan(&member.OrganizationID,
+		&member.UserID,
+		&member.Role,
+		&member.CreatedAt,
+		&member.FirstName,
+		&member.LastName,
+		&member.Email)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("member not found")
+		}
+		return nil, err
+	}
+	return member, nil
+}
+
+func scanRowIntoInvitation(row scanner) (*types.OrganizationInvitation, error) {
+	invitation := new(types.OrganizationInvitation)
+	err := row.Scan(&invitation.ID,
+		&invitation.OrganizationID,
+		&invitation.Email,
+		&invitation.Role,
+		&invitation.Token,
+		&invitation.InvitedBy,
+		&invitation.ExpiresAt,
+		&invitation.AcceptedAt,
+		&invitation.CreatedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("invitation not found")
+		}
+		return nil, err
+	}
+	return invitation, nil
+}
+
+func scanRowIntoProfile(row scanner) (*types.ManagedProfile, error) {
+	profile := new(types.ManagedProfile)
+	err := row.Scan(&profile.ID,
+		&profile.OrganizationID,
+		&profile.Name,
+		&profile.Relationship,
+		&profile.CreatedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("profile not found")
+		}
+		return nil, err
+	}
+	return profile, nil
+}
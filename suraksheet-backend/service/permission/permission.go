@@ -0,0 +1,199 @@
+package permission
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/LikheKeto/Suraksheet/types"
+	"github.com/LikheKeto/Suraksheet/utils"
+)
+
+// rank orders the roles; each role can do everything the ones below it can.
+var rank = map[string]int{
+	types.RoleViewer:   1,
+	types.RoleUploader: 2,
+	types.RoleEditor:   3,
+	types.RoleOwner:    4,
+}
+
+// Allows reports whether role is at least as strong as required.
+func Allows(role, required string) bool {
+	return role != "" && rank[role] >= rank[required]
+}
+
+// orgRank orders the roles within an organization.
+var orgRank = map[string]int{
+	types.OrgRoleMember: 1,
+	types.OrgRoleAdmin:  2,
+	types.OrgRoleOwner:  3,
+}
+
+// binRoleForOrgRole is the role members of an organization have on its bins.
+// Admins manage the bins like owners do; members can file and edit
+// documents.
+var binRoleForOrgRole = map[string]string{
+	types.OrgRoleOwner:  types.RoleOwner,
+	types.OrgRoleAdmin:  types.RoleOwner,
+	types.OrgRoleMember: types.RoleEditor,
+}
+
+// Checker is the one place that decides who may do what with a bin and the
+// documents in it. Handlers ask it instead of comparing owners themselves.
+type Checker struct {
+	binStore      types.BinStore
+	documentStore types.DocumentStore
+	shareStore    types.ShareStore
+	userStore     types.UserStore
+	orgStore      types.OrganizationStore
+}
+
+func NewChecker(binStore types.BinStore, documentStore types.DocumentStore, shareStore types.ShareStore, userStore types.UserStore, orgStore types.OrganizationStore) *Checker {
+	return &Checker{binStore: binStore, documentStore: documentStore, shareStore: shareStore, userStore: userStore, orgStore: orgStore}
+}
+
+// Role returns the strongest role the user has on the bin, or "" if none.
+func (c *Checker) Role(userID int, bin *types.Bin) (string, error) {
+	best := ""
+	if bin.OrganizationID != nil {
+		orgRole, err := c.orgStore.GetMemberRole(*bin.OrganizationID, userID)
+		if err != nil {
+			return "", err
+		}
+		best = binRoleForOrgRole[orgRole]
+	} else if bin.OwnerID == userID {
+		return types.RoleOwner, nil
+	}
+	if best == types.RoleOwner {
+		return best, nil
+	}
+	roles, err := c.shareStore.GetBinRoles(bin.ID, userID)
+	if err != nil {
+		return "", err
+	}
+	for _, role := range roles {
+		if rank[role] > rank[best] {
+			best = role
+		}
+	}
+	return best, nil
+}
+
+// Bin loads the bin and checks that the user has at least the required role
+// on it. On failure the error is written to w and ok is false.
+func (c *Checker) Bin(w http.ResponseWriter, userID int, binID int, required string) (bin *types.Bin, ok bool) {
+	bin, err := c.binStore.GetBinById(binID)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return nil, false
+	}
+	role, err := c.Role(userID, bin)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return nil, false
+	}
+	if !Allows(role, required) {
+		if role == "" {
+			utils.WriteError(w, http.StatusForbidden, fmt.Errorf("bin doesn't belong to user"))
+		} else {
+			utils.WriteError(w, http.StatusForbidden, fmt.Errorf("%s access is not enough for this action", role))
+		}
+		return nil, false
+	}
+	return bin, true
+}
+
+// Container is like Bin for bins that documents or other bins are put into,
+// which smart bins can't be.
+func (c *Checker) Container(w http.ResponseWriter, userID int, binID int, required string) (bin *types.Bin, ok bool) {
+	bin, ok = c.Bin(w, userID, binID, required)
+	if !ok {
+		return nil, false
+	}
+	if bin.IsSmart() {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("smart bins only hold the documents matching their query"))
+		return nil, false
+	}
+	return bin, true
+}
+
+// Document is like Bin for the bin the document is in.
+func (c *Checker) Document(w http.ResponseWriter, userID int, documentID int, required string) (*types.Document, *types.Bin, bool) {
+	doc, err := c.documentStore.GetDocumentByID(documentID)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("document not found"))
+		return nil, nil, false
+	}
+	bin, ok := c.Bin(w, userID, doc.BinID, required)
+	if !ok {
+		return nil, nil, false
+	}
+	return doc, bin, true
+}
+
+// Organization loads the organization and checks that the user is a member
+// with at least the required role in it. On failure the error is written to w
+// and ok is false. The returned organization carries the user's role.
+func (c *Checker) Organization(w http.ResponseWriter, userID int, orgID int, required string) (org *types.Organization, ok bool) {
+	role, err := c.orgStore.GetMemberRole(orgID, userID)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return nil, false
+	}
+	if role == "" {
+		utils.WriteError(w, http.StatusForbidden, fmt.Errorf("user is not a member of the organization"))
+		return nil, false
+	}
+	if orgRank[role] < orgRank[required] {
+		utils.WriteError(w, http.StatusForbidden, fmt.Errorf("%s access to the organization is not enough for this action", role))
+		return nil, false
+	}
+	org, err = c.orgStore.GetOrganizationByID(orgID)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return nil, false
+	}
+	org.Role = role
+	return org, true
+}
+
+// OrganizationIDs returns the IDs of the organizations the user is a member of.
+func (c *Checker) OrganizationIDs(userID int) ([]int, error) {
+	orgs, err := c.orgStore.GetOrganizationsByUser(userID)
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]int, 0, len(orgs))
+	for _, org := range orgs {
+		ids = append(ids, org.ID)
+	}
+	return ids, nil
+}
+
+// Profile checks that documents in the bin can be filed under the managed
+// profile, which must belong to the bin's organization. On failure the error
+// is written to w and ok is false.
+func (c *Checker) Profile(w http.ResponseWriter, bin *types.Bin, profileID int) (profile *types.ManagedProfile, ok bool) {
+	profile, err := c.orgStore.GetProfileByID(profileID)
+	if err != nil || bin.OrganizationID == nil || profile.OrganizationID != *bin.OrganizationID {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("profile doesn't belong to the bin's organization"))
+		return nil, false
+	}
+	return profile, true
+}
+
+// StorageKey returns the storage key of the bin's owner, or of its
+// organization. Objects always live under the owner, whoever uploaded them.
+func (c *Checker) StorageKey(bin *types.Bin) (string, error) {
+	if bin.OrganizationID != nil {
+		org, err := c.orgStore.GetOrganizationByID(*bin.OrganizationID)
+		if err != nil {
+			return "", err
+		}
+		return org.StorageKey, nil
+	}
+	owner, err := c.userStore.GetUserByID(bin.OwnerID)
+	if err != nil {
+		return "", err
+	}
+	return owner.StorageKey, nil
+}
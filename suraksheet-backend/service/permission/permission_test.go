@@ -0,0 +1,96 @@
+package permission
+
+import (
+	"testing"
+
+	"github.com/LikheKeto/Suraksheet/types"
+)
+
+func TestAllows(t *testing.T) {
+	tests := []struct {
+		role, required string
+		want           bool
+	}{
+		{types.RoleOwner, types.RoleOwner, true},
+		{types.RoleEditor, types.RoleOwner, false},
+		{types.RoleEditor, types.RoleUploader, true},
+		{types.RoleUploader, types.RoleEditor, false},
+		{types.RoleViewer, types.RoleViewer, true},
+		{types.RoleViewer, types.RoleUploader, false},
+		{"", types.RoleViewer, false},
+	}
+	for _, tt := range tests {
+		if got := Allows(tt.role, tt.required); got != tt.want {
+			t.Errorf("Allows(%q, %q) = %v, want %v", tt.role, tt.required, got, tt.want)
+		}
+	}
+}
+
+type mockShareStore struct {
+	types.ShareStore
+	roles []string
+}
+
+func (m *mockShareStore) GetBinRoles(binID int, userID int) ([]string, error) {
+	return m.roles, nil
+}
+
+type mockOrganizationStore struct {
+	types.OrganizationStore
+	role string
+}
+
+func (m *mockOrganizationStore) GetMemberRole(orgID int, userID int) (string, error) {
+	return m.role, nil
+}
+
+func TestRole(t *testing.T) {
+	bin := &types.Bin{ID: 1, OwnerID: 1}
+
+	t.Run("should give owners the owner role", func(t *testing.T) {
+		c := NewChecker(nil, nil, &mockShareStore{}, nil, nil)
+		if role, _ := c.Role(1, bin); role != types.RoleOwner {
+			t.Errorf("expected owner, got %q", role)
+		}
+	})
+
+	t.Run("should pick the strongest shared role", func(t *testing.T) {
+		c := NewChecker(nil, nil, &mockShareStore{roles: []string{types.RoleViewer, types.RoleEditor, types.RoleUploader}}, nil, nil)
+		if role, _ := c.Role(2, bin); role != types.RoleEditor {
+			t.Errorf("expected editor, got %q", role)
+		}
+	})
+
+	t.Run("should give strangers no role", func(t *testing.T) {
+		c := NewChecker(nil, nil, &mockShareStore{}, nil, nil)
+		if role, _ := c.Role(2, bin); role != "" {
+			t.Errorf("expected no role, got %q", role)
+		}
+	})
+
+	t.Run("should map organization roles onto its bins", func(t *testing.T) {
+		orgID := 1
+		orgBin := &types.Bin{ID: 2, OrganizationID: &orgID}
+		tests := map[string]string{
+			types.OrgRoleOwner:  types.RoleOwner,
+			types.OrgRoleAdmin:  types.RoleOwner,
+			types.OrgRoleMember: types.RoleEditor,
+			"":                  "",
+		}
+		for orgRole, want := range tests {
+			c := NewChecker(nil, nil, &mockShareStore{}, nil, &mockOrganizationStore{role: orgRole})
+			if role, _ := c.Role(1, orgBin); role != want {
+				t.Errorf("expected %q for %q, got %q", want, orgRole, role)
+			}
+		}
+	})
+
+	t.Run("should keep the stronger of the organization and shared roles", func(t *testing.T) {
+		orgID := 1
+		orgBin := &types.Bin{ID: 2, OrganizationID: &orgID}
+		c := NewChecker(nil, nil, &mockShareStore{roles: []string{types.RoleViewer}}, nil, &mockOrganizationStore{role: types.OrgRoleMember})
+		if role, _ := c.Role(1, orgBin); role != types.RoleEditor {
+			t.Errorf("expected editor, got %q", role)
+		}
+	})
+}
@@ -0,0 +1,56 @@
+package quota
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/LikheKeto/Suraksheet/types"
+)
+
+func TestQuotaExceeded(t *testing.T) {
+	maxBytes, maxDocuments := int64(100), 2
+	limited := &types.Quota{MaxBytes: &maxBytes, MaxDocuments: &maxDocuments}
+	tests := []struct {
+		name          string
+		quota         *types.Quota
+		before, after types.QuotaUsage
+		want          bool
+	}{
+		{"fits", limited, types.QuotaUsage{Documents: 1, Bytes: 40}, types.QuotaUsage{Documents: 2, Bytes: 100}, false},
+		{"too many bytes", limited, types.QuotaUsage{Documents: 1, Bytes: 40}, types.QuotaUsage{Documents: 2, Bytes: 101}, true},
+		{"too many documents", limited, types.QuotaUsage{Documents: 2, Bytes: 40}, types.QuotaUsage{Documents: 3, Bytes: 50}, true},
+		{"nothing added while over", limited, types.QuotaUsage{Documents: 5, Bytes: 500}, types.QuotaUsage{Documents: 5, Bytes: 500}, false},
+		{"unlimited", &types.Quota{}, types.QuotaUsage{}, types.QuotaUsage{Documents: 1000, Bytes: 1 << 40}, false},
+	}
+	for _, tt := range tests {
+		if got := tt.quota.Exceeded(tt.before, tt.after); got != tt.want {
+			t.Errorf("%s: expected %v, got %v", tt.name, tt.want, got)
+		}
+	}
+}
+
+type mockDocumentStore struct {
+	types.DocumentStore
+	usage types.QuotaUsage
+}
+
+func (m *mockDocumentStore) GetStorageUsage(userID int, orgID *int) (*types.QuotaUsage, error) {
+	return &m.usage, nil
+}
+
+func TestCheckRoom(t *testing.T) {
+	maxBytes, maxDocuments := int64(100), 10
+	limited := &types.Quota{MaxBytes: &maxBytes, MaxDocuments: &maxDocuments}
+	documents := &mockDocumentStore{usage: types.QuotaUsage{Documents: 1, Bytes: 60}}
+	bin := &types.Bin{OwnerID: 1}
+
+	if err := CheckRoom(limited, documents, bin, 2, 40); err != nil {
+		t.Errorf("expected room for 40 more bytes, got %v", err)
+	}
+	if err := CheckRoom(limited, documents, bin, 2, 41); !errors.Is(err, types.ErrQuotaExceeded) {
+		t.Errorf("expected the quota to be exceeded, got %v", err)
+	}
+	if err := CheckRoom(nil, documents, bin, 2, 1<<40); err != nil {
+		t.Errorf("expected no quota to leave room, got %v", err)
+	}
+}
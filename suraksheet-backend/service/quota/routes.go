@@ -0,0 +1,215 @@
+package quota
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/LikheKeto/Suraksheet/service/auth"
+	"github.com/LikheKeto/Suraksheet/service/permission"
+	"github.com/LikheKeto/Suraksheet/types"
+	"github.com/LikheKeto/Suraksheet/utils"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-playground/validator/v10"
+)
+
+type Handler struct {
+	store         types.QuotaStore
+	documentStore types.DocumentStore
+	userStore     types.UserStore
+	sessionStore  types.SessionStore
+	apiKeyStore   types.APIKeyStore
+	permissions   *permission.Checker
+}
+
+func NewHandler(store types.QuotaStore, documentStore types.DocumentStore, userStore types.UserStore, sessionStore types.SessionStore, apiKeyStore types.APIKeyStore, permissions *permission.Checker) *Handler {
+	return &Handler{store: store, documentStore: documentStore, userStore: userStore, sessionStore: sessionStore, apiKeyStore: apiKeyStore, permissions: permissions}
+}
+
+func (h *Handler) RegisterRoutes(router chi.Router) {
+	router.MethodFunc(http.MethodGet, "/quota", h.withAuth(h.handleGetQuota, types.APIKeyScopeRead))
+
+	// plans and quotas are managed by admins, from a session only
+	router.MethodFunc(http.MethodGet, "/admin/plans", h.withAdmin(h.handleGetPlans))
+	router.MethodFunc(http.MethodPut, "/admin/plans/{name}", h.withAdmin(h.handleSavePlan))
+	router.MethodFunc(http.MethodGet, "/admin/users/{userID}/quota", h.withAdmin(h.handleGetUserQuota))
+	router.MethodFunc(http.MethodPut, "/admin/users/{userID}/quota", h.withAdmin(h.handleSetUserQuota))
+	router.MethodFunc(http.MethodGet, "/admin/organizations/{orgID}/quota", h.withAdmin(h.handleGetOrganizationQuota))
+	router.MethodFunc(http.MethodPut, "/admin/organizations/{orgID}/quota", h.withAdmin(h.handleSetOrganizationQuota))
+}
+
+func (h *Handler) withAuth(handlerFunc http.HandlerFunc, scope string) http.HandlerFunc {
+	return auth.WithJWTOrAPIKeyAuth(auth.RequireVerifiedEmail(handlerFunc), scope, h.userStore, h.sessionStore, h.apiKeyStore)
+}
+
+func (h *Handler) withAdmin(handlerFunc http.HandlerFunc) http.HandlerFunc {
+	return auth.WithJWTAuth(auth.RequireAdmin(handlerFunc), h.userStore, h.sessionStore)
+}
+
+// handleGetQuota returns the user's quota and usage, or those of the
+// organization given by the organization query parameter.
+func (h *Handler) handleGetQuota(w http.ResponseWriter, r *http.Request) {
+	user, err := auth.ExtractUserFromContext(r)
+	if err != nil {
+		utils.WriteError(w, http.StatusForbidden, err)
+		return
+	}
+	if orgIDStr := r.URL.Query().Get("organization"); orgIDStr != "" {
+		orgID, err := strconv.Atoi(orgIDStr)
+		if err != nil {
+			utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid organization %s", orgIDStr))
+			return
+		}
+		if _, ok := h.permissions.Organization(w, user.ID, orgID, types.OrgRoleMember); !ok {
+			return
+		}
+		h.writeOrganizationQuota(w, orgID)
+		return
+	}
+	h.writeUserQuota(w, user.ID)
+}
+
+func (h *Handler) writeUserQuota(w http.ResponseWriter, userID int) {
+	quota, err := h.store.GetUserQuota(userID)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	usage, err := h.documentStore.GetStorageUsage(userID, nil)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	quota.Used = *usage
+	utils.WriteJSON(w, http.StatusOK, quota)
+}
+
+func (h *Handler) writeOrganizationQuota(w http.ResponseWriter, orgID int) {
+	quota, err := h.store.GetOrganizationQuota(orgID)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	usage, err := h.documentStore.GetStorageUsage(0, &orgID)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	quota.Used = *usage
+	utils.WriteJSON(w, http.StatusOK, quota)
+}
+
+func (h *Handler) handleGetPlans(w http.ResponseWriter, r *http.Request) {
+	plans, err := h.store.GetPlans()
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, plans)
+}
+
+// handleSavePlan creates the plan or changes its limits. Leaving a limit out
+// makes it unlimited.
+func (h *Handler) handleSavePlan(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "name")
+	if name == "" || len(name) > 32 {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid plan %s", name))
+		return
+	}
+	var payload types.PlanPayload
+	if err := utils.ParseJSON(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	if err := utils.Validate.Struct(payload); err != nil {
+		errors := err.(validator.ValidationErrors)
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid payload %v", errors))
+		return
+	}
+	plan := types.Plan{Name: name, MaxBytes: payload.MaxBytes, MaxDocuments: payload.MaxDocuments}
+	if err := h.store.SavePlan(plan); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, plan)
+}
+
+func (h *Handler) handleGetUserQuota(w http.ResponseWriter, r *http.Request) {
+	userID, ok := idParam(w, r, "userID")
+	if !ok {
+		return
+	}
+	if _, err := h.userStore.GetUserByID(userID); err != nil {
+		utils.WriteError(w, http.StatusNotFound, fmt.Errorf("user not found"))
+		return
+	}
+	h.writeUserQuota(w, userID)
+}
+
+func (h *Handler) handleSetUserQuota(w http.ResponseWriter, r *http.Request) {
+	userID, ok := idParam(w, r, "userID")
+	if !ok {
+		return
+	}
+	payload, ok := parseQuota(w, r)
+	if !ok {
+		return
+	}
+	if _, err := h.userStore.GetUserByID(userID); err != nil {
+		utils.WriteError(w, http.StatusNotFound, fmt.Errorf("user not found"))
+		return
+	}
+	if err := h.store.SetUserQuota(userID, *payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("unable to set quota: %v", err))
+		return
+	}
+	h.writeUserQuota(w, userID)
+}
+
+func (h *Handler) handleGetOrganizationQuota(w http.ResponseWriter, r *http.Request) {
+	orgID, ok := idParam(w, r, "orgID")
+	if !ok {
+		return
+	}
+	h.writeOrganizationQuota(w, orgID)
+}
+
+func (h *Handler) handleSetOrganizationQuota(w http.ResponseWriter, r *http.Request) {
+	orgID, ok := idParam(w, r, "orgID")
+	if !ok {
+		return
+	}
+	payload, ok := parseQuota(w, r)
+	if !ok {
+		return
+	}
+	if err := h.store.SetOrganizationQuota(orgID, *payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("unable to set quota: %v", err))
+		return
+	}
+	h.writeOrganizationQuota(w, orgID)
+}
+
+func parseQuota(w http.ResponseWriter, r *http.Request) (*types.SetQuotaPayload, bool) {
+	var payload types.SetQuotaPayload
+	if err := utils.ParseJSON(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return nil, false
+	}
+	if err := utils.Validate.Struct(payload); err != nil {
+		errors := err.(validator.ValidationErrors)
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid payload %v", errors))
+		return nil, false
+	}
+	return &payload, true
+}
+
+func idParam(w http.ResponseWriter, r *http.Request, name string) (int, bool) {
+	idStr := chi.URLParam(r, name)
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid id %s", idStr))
+		return 0, false
+	}
+	return id, true
+}
@@ -0,0 +1,129 @@
+package quota
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/LikheKeto/Suraksheet/config"
+	"github.com/LikheKeto/Suraksheet/types"
+)
+
+type Store struct {
+	db *sql.DB
+}
+
+func NewStore(db *sql.DB) *Store {
+	return &Store{
+		db: db,
+	}
+}
+
+func (s *Store) GetPlans() ([]types.Plan, error) {
+	rows, err := s.db.Query("SELECT * FROM plans ORDER BY name;")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	plans := make([]types.Plan, 0)
+	for rows.Next() {
+		plan := types.Plan{}
+		if err := rows.Scan(&plan.Name, &plan.MaxBytes, &plan.MaxDocuments); err != nil {
+			return nil, err
+		}
+		plans = append(plans, plan)
+	}
+	return plans, nil
+}
+
+func (s *Store) SavePlan(plan types.Plan) error {
+	_, err := s.db.Exec(`
+		INSERT INTO plans (name, maxBytes, maxDocuments) VALUES ($1, $2, $3)
+		ON CONFLICT (name) DO UPDATE SET maxBytes = EXCLUDED.maxBytes, maxDocuments = EXCLUDED.maxDocuments;
+	`, plan.Name, plan.MaxBytes, plan.MaxDocuments)
+	return err
+}
+
+// selectQuota picks the plan of the quota row joined in as q, or the default
+// plan, with the row's own limits taking precedence.
+const selectQuota = `
+	SELECT p.name, COALESCE(q.maxBytes, p.maxBytes), COALESCE(q.maxDocuments, p.maxDocuments)
+	FROM plans p
+`
+
+func (s *Store) GetUserQuota(userID int) (*types.Quota, error) {
+	row := s.db.QueryRow(selectQuota+`
+		LEFT JOIN quotas q ON q.userId = $1
+		WHERE p.name = COALESCE(q.plan, $2);
+	`, userID, config.Envs.DefaultPlan)
+	return scanRowIntoQuota(row)
+}
+
+func (s *Store) GetOrganizationQuota(orgID int) (*types.Quota, error) {
+	row := s.db.QueryRow(selectQuota+`
+		LEFT JOIN quotas q ON q.organization = $1
+		WHERE p.name = COALESCE(q.plan, $2);
+	`, orgID, config.Envs.DefaultPlan)
+	return scanRowIntoQuota(row)
+}
+
+func (s *Store) SetUserQuota(userID int, quota types.SetQuotaPayload) error {
+	_, err := s.db.Exec(`
+		INSERT INTO quotas (userId, plan, maxBytes, maxDocuments) VALUES ($1, $2, $3, $4)
+		ON CONFLICT (userId) DO UPDATE
+		SET plan = EXCLUDED.plan, maxBytes = EXCLUDED.maxBytes, maxDocuments = EXCLUDED.maxDocuments;
+	`, userID, quota.Plan, quota.MaxBytes, quota.MaxDocuments)
+	return err
+}
+
+func (s *Store) SetOrganizationQuota(orgID int, quota types.SetQuotaPayload) error {
+	_, err := s.db.Exec(`
+		INSERT INTO quotas (organization, plan, maxBytes, maxDocuments) VALUES ($1, $2, $3, $4)
+		ON CONFLICT (organization) DO UPDATE
+		SET plan = EXCLUDED.plan, maxBytes = EXCLUDED.maxBytes, maxDocuments = EXCLUDED.maxDocuments;
+	`, orgID, quota.Plan, quota.MaxBytes, quota.MaxDocuments)
+	return err
+}
+
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+func scanRowIntoQuota(row scanner) (*types.Quota, error) {
+	quota := new(types.Quota)
+	err := row.Scan(&quota.Plan, &quota.MaxBytes, &quota.MaxDocuments)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("plan doesn't exist")
+		}
+		return nil, err
+	}
+	return quota, nil
+}
+
+// ForBin returns the quota of whoever owns the bin: its user, or its
+// organization.
+func ForBin(store types.QuotaStore, bin *types.Bin) (*types.Quota, error) {
+	if bin.OrganizationID != nil {
+		return store.GetOrganizationQuota(*bin.OrganizationID)
+	}
+	return store.GetUserQuota(bin.OwnerID)
+}
+
+// CheckRoom fails with ErrQuotaExceeded if adding documents of bytes in all to
+// the bin would take its owner over the quota. It lets uploads be turned
+// away before they are stored; storing them checks the quota again.
+func CheckRoom(quota *types.Quota, documentStore types.DocumentStore, bin *types.Bin, documents int, bytes int64) error {
+	if quota == nil {
+		return nil
+	}
+	before, err := documentStore.GetStorageUsage(bin.OwnerID, bin.OrganizationID)
+	if err != nil {
+		return err
+	}
+	after := types.QuotaUsage{Documents: before.Documents + documents, Bytes: before.Bytes + bytes}
+	if quota.Exceeded(*before, after) {
+		return types.ErrQuotaExceeded
+	}
+	return nil
+}
@@ -0,0 +1,140 @@
+package session
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/LikheKeto/Suraksheet/service/auth"
+	"github.com/LikheKeto/Suraksheet/types"
+	"github.com/LikheKeto/Suraksheet/utils"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-playground/validator/v10"
+)
+
+type Handler struct {
+	store     types.SessionStore
+	userStore types.UserStore
+}
+
+func NewHandler(store types.SessionStore, userStore types.UserStore) *Handler {
+	return &Handler{
+		store:     store,
+		userStore: userStore,
+	}
+}
+
+func (h *Handler) RegisterRoutes(router chi.Router) {
+	router.MethodFunc(http.MethodPost, "/refresh", h.handleRefresh)
+	router.MethodFunc(http.MethodPost, "/logout", h.handleLogout)
+	router.MethodFunc(http.MethodGet, "/sessions", auth.WithJWTAuth(h.handleGetSessions, h.userStore, h.store))
+	router.MethodFunc(http.MethodDelete, "/sessions", auth.WithJWTAuth(h.handleRevokeAllSessions, h.userStore, h.store))
+	router.MethodFunc(http.MethodDelete, "/sessions/{sessionID}", auth.WithJWTAuth(h.handleRevokeSession, h.userStore, h.store))
+}
+
+func (h *Handler) handleRefresh(w http.ResponseWriter, r *http.Request) {
+	var payload types.RefreshTokenPayload
+	if err := utils.ParseJSON(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	if err := utils.Validate.Struct(payload); err != nil {
+		errors := err.(validator.ValidationErrors)
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid payload %v", errors))
+		return
+	}
+	token, refreshToken, err := auth.RefreshSession(h.store, payload.RefreshToken)
+	if err != nil {
+		utils.WriteError(w, http.StatusUnauthorized, err)
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, map[string]string{"token": token, "refreshToken": refreshToken})
+}
+
+func (h *Handler) handleLogout(w http.ResponseWriter, r *http.Request) {
+	var payload types.RefreshTokenPayload
+	if err := utils.ParseJSON(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	if err := utils.Validate.Struct(payload); err != nil {
+		errors := err.(validator.ValidationErrors)
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid payload %v", errors))
+		return
+	}
+	session, err := h.store.GetSessionByRefreshToken(utils.HashString(payload.RefreshToken))
+	if err != nil {
+		utils.WriteError(w, http.StatusUnauthorized, fmt.Errorf("invalid refresh token"))
+		return
+	}
+	if err := h.store.RevokeSession(session.ID); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	utils.WriteJSON(w, http.StatusNoContent, nil)
+}
+
+func (h *Handler) handleGetSessions(w http.ResponseWriter, r *http.Request) {
+	user, err := auth.ExtractUserFromContext(r)
+	if err != nil {
+		utils.WriteError(w, http.StatusForbidden, err)
+		return
+	}
+	current, err := auth.ExtractSessionFromContext(r)
+	if err != nil {
+		utils.WriteError(w, http.StatusForbidden, err)
+		return
+	}
+	sessions, err := h.store.GetActiveSessionsByUser(user.ID)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	for i := range sessions {
+		sessions[i].Current = sessions[i].ID == current.ID
+	}
+	utils.WriteJSON(w, http.StatusOK, sessions)
+}
+
+func (h *Handler) handleRevokeSession(w http.ResponseWriter, r *http.Request) {
+	user, err := auth.ExtractUserFromContext(r)
+	if err != nil {
+		utils.WriteError(w, http.StatusForbidden, err)
+		return
+	}
+	sessionIDStr := chi.URLParam(r, "sessionID")
+	sessionID, err := strconv.Atoi(sessionIDStr)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid session %s", sessionIDStr))
+		return
+	}
+	session, err := h.store.GetSessionByID(sessionID)
+	if err != nil {
+		utils.WriteError(w, http.StatusNotFound, err)
+		return
+	}
+	if session.UserID != user.ID {
+		utils.WriteError(w, http.StatusForbidden, fmt.Errorf("session doesn't belong to user"))
+		return
+	}
+	if err := h.store.RevokeSession(session.ID); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	utils.WriteJSON(w, http.StatusNoContent, nil)
+}
+
+// handleRevokeAllSessions logs the user out everywhere, including the session
+// used to make this request.
+func (h *Handler) handleRevokeAllSessions(w http.ResponseWriter, r *http.Request) {
+	user, err := auth.ExtractUserFromContext(r)
+	if err != nil {
+		utils.WriteError(w, http.StatusForbidden, err)
+		return
+	}
+	if err := h.store.RevokeAllSessions(user.ID); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	utils.WriteJSON(w, http.StatusNoContent, nil)
+}
@@ -0,0 +1,130 @@
+package session
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/LikheKeto/Suraksheet/types"
+)
+
+type Store struct {
+	db *sql.DB
+}
+
+func NewStore(db *sql.DB) *Store {
+	return &Store{
+		db: db,
+	}
+}
+
+func (s *Store) CreateSession(session types.Session) (*types.Session, error) {
+	row := s.db.QueryRow(`
+		INSERT INTO sessions (userId, refreshToken, expiresAt, userAgent, ipAddress)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING *;
+	`, session.UserID, session.RefreshToken, session.ExpiresAt, session.UserAgent, session.IPAddress)
+	return scanRowIntoSession(row)
+}
+
+func (s *Store) GetSessionByID(id int) (*types.Session, error) {
+	row := s.db.QueryRow("SELECT * FROM sessions WHERE id = $1;", id)
+	return scanRowIntoSession(row)
+}
+
+func (s *Store) GetSessionByRefreshToken(refreshToken string) (*types.Session, error) {
+	row := s.db.QueryRow("SELECT * FROM sessions WHERE refreshToken = $1;", refreshToken)
+	return scanRowIntoSession(row)
+}
+
+func (s *Store) GetActiveSessionsByUser(userID int) ([]types.Session, error) {
+	rows, err := s.db.Query(`
+		SELECT * FROM sessions
+		WHERE userId = $1 AND revokedAt IS NULL AND expiresAt > $2
+		ORDER BY lastSeenAt DESC;
+	`, userID, time.Now().UTC())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sessions := make([]types.Session, 0)
+	for rows.Next() {
+		session, err := scanRowIntoSession(rows)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, *session)
+	}
+	return sessions, nil
+}
+
+func (s *Store) RotateRefreshToken(id int, oldToken, newToken string, expiresAt time.Time) error {
+	res, err := s.db.Exec(`
+		UPDATE sessions SET refreshToken = $1, expiresAt = $2, lastSeenAt = CURRENT_TIMESTAMP
+		WHERE id = $3 AND refreshToken = $4 AND revokedAt IS NULL;
+	`, newToken, expiresAt, id, oldToken)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return fmt.Errorf("refresh token has already been used")
+	}
+	return nil
+}
+
+// TouchSession records activity on the session. It is called on every
+// authenticated request, so the write is skipped if it happened recently.
+func (s *Store) TouchSession(id int) error {
+	_, err := s.db.Exec(`
+		UPDATE sessions SET lastSeenAt = CURRENT_TIMESTAMP
+		WHERE id = $1 AND lastSeenAt < CURRENT_TIMESTAMP - INTERVAL '1 minute';
+	`, id)
+	return err
+}
+
+func (s *Store) RevokeSession(id int) error {
+	_, err := s.db.Exec("UPDATE sessions SET revokedAt = CURRENT_TIMESTAMP WHERE id = $1 AND revokedAt IS NULL;", id)
+	return err
+}
+
+func (s *Store) RevokeAllSessions(userID int) error {
+	_, err := s.db.Exec("UPDATE sessions SET revokedAt = CURRENT_TIMESTAMP WHERE userId = $1 AND revokedAt IS NULL;", userID)
+	return err
+}
+
+func (s *Store) RevokeOtherSessions(userID int, currentID int) error {
+	_, err := s.db.Exec(`
+		UPDATE sessions SET revokedAt = CURRENT_TIMESTAMP
+		WHERE userId = $1 AND id <> $2 AND revokedAt IS NULL;
+	`, userID, currentID)
+	return err
+}
+
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+func scanRowIntoSession(row scanner) (*types.Session, error) {
+	session := new(types.Session)
+	err := row.Scan(&session.ID,
+		&session.UserID,
+		&session.RefreshToken,
+		&session.ExpiresAt,
+		&session.RevokedAt,
+		&session.CreatedAt,
+		&session.UserAgent,
+		&session.IPAddress,
+		&session.LastSeenAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("session not found")
+		}
+		return nil, err
+	}
+	return session, nil
+}
@@ -0,0 +1,226 @@
+package share
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/LikheKeto/Suraksheet/service/auth"
+	"github.com/LikheKeto/Suraksheet/service/permission"
+	"github.com/LikheKeto/Suraksheet/types"
+	"github.com/LikheKeto/Suraksheet/utils"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-playground/validator/v10"
+)
+
+type Handler struct {
+	store        types.ShareStore
+	binStore     types.BinStore
+	userStore    types.UserStore
+	sessionStore types.SessionStore
+	permissions  *permission.Checker
+}
+
+func NewHandler(store types.ShareStore, binStore types.BinStore, userStore types.UserStore, sessionStore types.SessionStore, permissions *permission.Checker) *Handler {
+	return &Handler{store: store, binStore: binStore, userStore: userStore, sessionStore: sessionStore, permissions: permissions}
+}
+
+func (h *Handler) RegisterRoutes(router chi.Router) {
+	router.MethodFunc(http.MethodGet, "/bins/{binID}/shares", h.withAuth(h.handleGetShares))
+	router.MethodFunc(http.MethodPost, "/bins/{binID}/shares", h.withAuth(h.handleShareBin))
+	router.MethodFunc(http.MethodDelete, "/bins/{binID}/shares/{shareID}", h.withAuth(h.handleDeleteShare))
+	router.MethodFunc(http.MethodGet, "/invitations", h.withAuth(h.handleGetInvitations))
+	router.MethodFunc(http.MethodPost, "/invitations/{shareID}/accept", h.withAuth(h.handleRespond(types.ShareStatusAccepted)))
+	router.MethodFunc(http.MethodPost, "/invitations/{shareID}/decline", h.withAuth(h.handleRespond(types.ShareStatusDeclined)))
+	router.MethodFunc(http.MethodGet, "/shared", h.withAuth(h.handleGetShared))
+}
+
+func (h *Handler) withAuth(handlerFunc http.HandlerFunc) http.HandlerFunc {
+	return auth.WithJWTAuth(auth.RequireVerifiedEmail(handlerFunc), h.userStore, h.sessionStore)
+}
+
+func urlParamInt(r *http.Request, name string) (int, error) {
+	str := chi.URLParam(r, name)
+	id, err := strconv.Atoi(str)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s %s", name, str)
+	}
+	return id, nil
+}
+
+func (h *Handler) handleGetShares(w http.ResponseWriter, r *http.Request) {
+	user, err := auth.ExtractUserFromContext(r)
+	if err != nil {
+		utils.WriteError(w, http.StatusForbidden, err)
+		return
+	}
+	binID, err := urlParamInt(r, "binID")
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	if _, ok := h.permissions.Bin(w, user.ID, binID, types.RoleOwner); !ok {
+		return
+	}
+	shares, err := h.store.GetSharesByBin(binID)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, shares)
+}
+
+func (h *Handler) handleShareBin(w http.ResponseWriter, r *http.Request) {
+	user, err := auth.ExtractUserFromContext(r)
+	if err != nil {
+		utils.WriteError(w, http.StatusForbidden, err)
+		return
+	}
+	binID, err := urlParamInt(r, "binID")
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	var payload types.ShareBinPayload
+	if err := utils.ParseJSON(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	if err := utils.Validate.Struct(payload); err != nil {
+		errors := err.(validator.ValidationErrors)
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid payload %v", errors))
+		return
+	}
+	bin, ok := h.permissions.Bin(w, user.ID, binID, types.RoleOwner)
+	if !ok {
+		return
+	}
+	invitee, err := h.userStore.GetUserByEmail(payload.Email)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("no user with email %s", payload.Email))
+		return
+	}
+	if invitee.ID == bin.OwnerID {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("a bin cannot be shared with its owner"))
+		return
+	}
+
+	share, err := h.store.CreateShare(types.BinShare{
+		BinID:     bin.ID,
+		UserID:    invitee.ID,
+		Role:      payload.Role,
+		InvitedBy: &user.ID,
+	})
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	utils.WriteJSON(w, http.StatusCreated, share)
+}
+
+// handleDeleteShare lets the owner revoke a share, and the person it was
+// shared with leave it.
+func (h *Handler) handleDeleteShare(w http.ResponseWriter, r *http.Request) {
+	user, err := auth.ExtractUserFromContext(r)
+	if err != nil {
+		utils.WriteError(w, http.StatusForbidden, err)
+		return
+	}
+	binID, err := urlParamInt(r, "binID")
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	shareID, err := urlParamInt(r, "shareID")
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	share, err := h.store.GetShareByID(shareID)
+	if err != nil || share.BinID != binID {
+		utils.WriteError(w, http.StatusNotFound, fmt.Errorf("share not found"))
+		return
+	}
+	if share.UserID != user.ID {
+		if _, ok := h.permissions.Bin(w, user.ID, binID, types.RoleOwner); !ok {
+			return
+		}
+	}
+	if err := h.store.DeleteShare(share.ID); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	utils.WriteJSON(w, http.StatusNoContent, nil)
+}
+
+func (h *Handler) handleGetInvitations(w http.ResponseWriter, r *http.Request) {
+	user, err := auth.ExtractUserFromContext(r)
+	if err != nil {
+		utils.WriteError(w, http.StatusForbidden, err)
+		return
+	}
+	shares, err := h.store.GetSharesByUser(user.ID, types.ShareStatusPending)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, shares)
+}
+
+func (h *Handler) handleRespond(status string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, err := auth.ExtractUserFromContext(r)
+		if err != nil {
+			utils.WriteError(w, http.StatusForbidden, err)
+			return
+		}
+		shareID, err := urlParamInt(r, "shareID")
+		if err != nil {
+			utils.WriteError(w, http.StatusBadRequest, err)
+			return
+		}
+		share, err := h.store.GetShareByID(shareID)
+		if err != nil || share.UserID != user.ID {
+			utils.WriteError(w, http.StatusNotFound, fmt.Errorf("invitation not found"))
+			return
+		}
+		if share.Status != types.ShareStatusPending {
+			utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invitation has already been %s", share.Status))
+			return
+		}
+		if err := h.store.RespondToShare(share.ID, status); err != nil {
+			utils.WriteError(w, http.StatusInternalServerError, err)
+			return
+		}
+		utils.WriteJSON(w, http.StatusNoContent, nil)
+	}
+}
+
+type sharedBin struct {
+	ShareID int       `json:"share"`
+	Role    string    `json:"role"`
+	Bin     types.Bin `json:"bin"`
+}
+
+func (h *Handler) handleGetShared(w http.ResponseWriter, r *http.Request) {
+	user, err := auth.ExtractUserFromContext(r)
+	if err != nil {
+		utils.WriteError(w, http.StatusForbidden, err)
+		return
+	}
+	shares, err := h.store.GetSharesByUser(user.ID, types.ShareStatusAccepted)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	bins := make([]sharedBin, 0, len(shares))
+	for _, share := range shares {
+		bin, err := h.binStore.GetBinById(share.BinID)
+		if err != nil {
+			utils.WriteError(w, http.StatusInternalServerError, err)
+			return
+		}
+		bins = append(bins, sharedBin{ShareID: share.ID, Role: share.Role, Bin: *bin})
+	}
+	utils.WriteJSON(w, http.StatusOK, bins)
+}
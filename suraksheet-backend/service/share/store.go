@@ -0,0 +1,138 @@
+package share
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/LikheKeto/Suraksheet/types"
+)
+
+type Store struct {
+	db *sql.DB
+}
+
+func NewStore(db *sql.DB) *Store {
+	return &Store{
+		db: db,
+	}
+}
+
+// CreateShare keeps the status of an accepted share, so changing its role
+// doesn't make the user accept it again. A declined share becomes a pending
+// invite again, since inviting the user anew is the only way to re-share.
+func (s *Store) CreateShare(share types.BinShare) (*types.BinShare, error) {
+	row := s.db.QueryRow(`
+		INSERT INTO bin_shares (bin, userId, role, invitedBy)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (bin, userId) DO UPDATE SET
+			role = EXCLUDED.role,
+			status = CASE WHEN bin_shares.status = $5 THEN $6 ELSE bin_shares.status END,
+			invitedBy = CASE WHEN bin_shares.status = $5 THEN EXCLUDED.invitedBy ELSE bin_shares.invitedBy END,
+			respondedAt = CASE WHEN bin_shares.status = $5 THEN NULL ELSE bin_shares.respondedAt END
+		RETURNING *;
+	`, share.BinID, share.UserID, share.Role, share.InvitedBy, types.ShareStatusDeclined, types.ShareStatusPending)
+	return scanRowIntoShare(row)
+}
+
+func (s *Store) GetShareByID(id int) (*types.BinShare, error) {
+	row := s.db.QueryRow("SELECT * FROM bin_shares WHERE id = $1;", id)
+	return scanRowIntoShare(row)
+}
+
+func (s *Store) GetSharesByBin(binID int) ([]types.BinShare, error) {
+	rows, err := s.db.Query("SELECT * FROM bin_shares WHERE bin = $1 ORDER BY createdAt;", binID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	return scanRowsIntoShares(rows)
+}
+
+// GetSharesByUser leaves out the shares of bins in the trash, which come back
+// along with their bins.
+func (s *Store) GetSharesByUser(userID int, status string) ([]types.BinShare, error) {
+	rows, err := s.db.Query(`
+		SELECT s.* FROM bin_shares s JOIN bins b ON b.id = s.bin
+		WHERE s.userId = $1 AND s.status = $2 AND b.deletedAt IS NULL
+		ORDER BY s.createdAt DESC;
+	`, userID, status)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	return scanRowsIntoShares(rows)
+}
+
+func (s *Store) RespondToShare(id int, status string) error {
+	_, err := s.db.Exec(`
+		UPDATE bin_shares SET status = $1, respondedAt = $2 WHERE id = $3;
+	`, status, time.Now().UTC(), id)
+	return err
+}
+
+func (s *Store) DeleteShare(id int) error {
+	_, err := s.db.Exec("DELETE FROM bin_shares WHERE id = $1;", id)
+	return err
+}
+
+func (s *Store) GetBinRoles(binID int, userID int) ([]string, error) {
+	rows, err := s.db.Query(`
+		WITH RECURSIVE ancestors AS (
+			SELECT id, parent FROM bins WHERE id = $1
+			UNION
+			SELECT b.id, b.parent FROM bins b JOIN ancestors a ON b.id = a.parent
+		)
+		SELECT s.role FROM bin_shares s JOIN ancestors a ON s.bin = a.id
+		WHERE s.userId = $2 AND s.status = $3;
+	`, binID, userID, types.ShareStatusAccepted)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	roles := make([]string, 0)
+	for rows.Next() {
+		var role string
+		if err := rows.Scan(&role); err != nil {
+			return nil, err
+		}
+		roles = append(roles, role)
+	}
+	return roles, nil
+}
+
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+func scanRowsIntoShares(rows *sql.Rows) ([]types.BinShare, error) {
+	shares := make([]types.BinShare, 0)
+	for rows.Next() {
+		share, err := scanRowIntoShare(rows)
+		if err != nil {
+			return nil, err
+		}
+		shares = append(shares, *share)
+	}
+	return shares, nil
+}
+
+func scanRowIntoShare(row scanner) (*types.BinShare, error) {
+	share := new(types.BinShare)
+	err := row.Scan(&share.ID,
+		&share.BinID,
+		&share.UserID,
+		&share.Role,
+		&share.Status,
+		&share.InvitedBy,
+		&share.CreatedAt,
+		&share.RespondedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("share not found")
+		}
+		return nil, err
+	}
+	return share, nil
+}
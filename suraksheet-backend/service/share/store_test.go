@@ -0,0 +1,61 @@
+package share
+
+import (
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/LikheKeto/Suraksheet/types"
+)
+
+func TestCreateShare(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	store := NewStore(db)
+
+	inviter := 1
+	mock.ExpectQuery(`ON CONFLICT \(bin, userId\) DO UPDATE SET.*status = CASE WHEN bin_shares.status = \$5 THEN \$6`).
+		WithArgs(3, 2, types.RoleViewer, inviter, types.ShareStatusDeclined, types.ShareStatusPending).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "bin", "userId", "role", "status", "invitedBy", "createdAt", "respondedAt"}).
+			AddRow(5, 3, 2, types.RoleViewer, types.ShareStatusPending, inviter, time.Now(), nil))
+
+	share, err := store.CreateShare(types.BinShare{BinID: 3, UserID: 2, Role: types.RoleViewer, InvitedBy: &inviter})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if share.Status != types.ShareStatusPending {
+		t.Errorf("expected a declined share to be pending again, got %s", share.Status)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestGetSharesByUser(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	store := NewStore(db)
+
+	mock.ExpectQuery(`SELECT s.\* FROM bin_shares s JOIN bins b ON b.id = s.bin\s+`+
+		`WHERE s.userId = \$1 AND s.status = \$2 AND b.deletedAt IS NULL`).
+		WithArgs(2, types.ShareStatusAccepted).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "bin", "userId", "role", "status", "invitedBy", "createdAt", "respondedAt"}).
+			AddRow(5, 3, 2, types.RoleViewer, types.ShareStatusAccepted, 1, time.Now(), time.Now()))
+
+	shares, err := store.GetSharesByUser(2, types.ShareStatusAccepted)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(shares) != 1 || shares[0].BinID != 3 {
+		t.Errorf("expected the share of bin 3, got %+v", shares)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,177 @@
+package template
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/LikheKeto/Suraksheet/service/auth"
+	"github.com/LikheKeto/Suraksheet/types"
+	"github.com/LikheKeto/Suraksheet/utils"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-playground/validator/v10"
+)
+
+type Handler struct {
+	store        types.TemplateStore
+	userStore    types.UserStore
+	sessionStore types.SessionStore
+	apiKeyStore  types.APIKeyStore
+}
+
+func NewHandler(store types.TemplateStore, userStore types.UserStore, sessionStore types.SessionStore, apiKeyStore types.APIKeyStore) *Handler {
+	return &Handler{store: store, userStore: userStore, sessionStore: sessionStore, apiKeyStore: apiKeyStore}
+}
+
+func (h *Handler) RegisterRoutes(router chi.Router) {
+	router.MethodFunc(http.MethodGet, "/templates", h.withAuth(h.handleGetTemplates, types.APIKeyScopeRead))
+	router.MethodFunc(http.MethodPost, "/templates", h.withAuth(h.handleCreateTemplate, types.APIKeyScopeFull))
+	router.MethodFunc(http.MethodGet, "/templates/{templateID}", h.withAuth(h.handleGetTemplate, types.APIKeyScopeRead))
+	router.MethodFunc(http.MethodGet, "/templates/{templateID}/export", h.withAuth(h.handleExportTemplate, types.APIKeyScopeRead))
+	router.MethodFunc(http.MethodPut, "/templates/{templateID}", h.withAuth(h.handleUpdateTemplate, types.APIKeyScopeFull))
+	router.MethodFunc(http.MethodDelete, "/templates/{templateID}", h.withAuth(h.handleDeleteTemplate, types.APIKeyScopeFull))
+}
+
+func (h *Handler) withAuth(handlerFunc http.HandlerFunc, scope string) http.HandlerFunc {
+	return auth.WithJWTOrAPIKeyAuth(auth.RequireVerifiedEmail(handlerFunc), scope, h.userStore, h.sessionStore, h.apiKeyStore)
+}
+
+func (h *Handler) handleGetTemplates(w http.ResponseWriter, r *http.Request) {
+	user, err := auth.ExtractUserFromContext(r)
+	if err != nil {
+		utils.WriteError(w, http.StatusForbidden, err)
+		return
+	}
+	templates, err := h.store.GetTemplatesByUser(user.ID)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, templates)
+}
+
+// handleCreateTemplate also takes templates exported with handleExportTemplate.
+func (h *Handler) handleCreateTemplate(w http.ResponseWriter, r *http.Request) {
+	user, err := auth.ExtractUserFromContext(r)
+	if err != nil {
+		utils.WriteError(w, http.StatusForbidden, err)
+		return
+	}
+	payload, ok := parseTemplate(w, r)
+	if !ok {
+		return
+	}
+	template, err := h.store.CreateTemplate(types.BinTemplate{
+		OwnerID:     user.ID,
+		Name:        payload.Name,
+		Description: payload.Description,
+		Slots:       payload.Slots,
+	})
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	utils.WriteJSON(w, http.StatusCreated, template)
+}
+
+func (h *Handler) handleGetTemplate(w http.ResponseWriter, r *http.Request) {
+	template, ok := h.ownTemplate(w, r)
+	if !ok {
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, template)
+}
+
+// handleExportTemplate downloads the template as it would be created again,
+// without what belongs to this copy of it.
+func (h *Handler) handleExportTemplate(w http.ResponseWriter, r *http.Request) {
+	template, ok := h.ownTemplate(w, r)
+	if !ok {
+		return
+	}
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", utils.SafeFileName(template.Name)+".json"))
+	utils.WriteJSON(w, http.StatusOK, types.TemplatePayload{
+		Name:        template.Name,
+		Description: template.Description,
+		Slots:       template.Slots,
+	})
+}
+
+func (h *Handler) handleUpdateTemplate(w http.ResponseWriter, r *http.Request) {
+	template, ok := h.ownTemplate(w, r)
+	if !ok {
+		return
+	}
+	payload, ok := parseTemplate(w, r)
+	if !ok {
+		return
+	}
+	template.Name = payload.Name
+	template.Description = payload.Description
+	template.Slots = payload.Slots
+	if err := h.store.UpdateTemplate(*template); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("unable to update template: %v", err))
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, template)
+}
+
+func (h *Handler) handleDeleteTemplate(w http.ResponseWriter, r *http.Request) {
+	template, ok := h.ownTemplate(w, r)
+	if !ok {
+		return
+	}
+	if err := h.store.DeleteTemplate(template.ID); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	utils.WriteJSON(w, http.StatusNoContent, nil)
+}
+
+// ownTemplate returns the template in the URL if it belongs to the user.
+// Other people's templates are reported as missing.
+func (h *Handler) ownTemplate(w http.ResponseWriter, r *http.Request) (*types.BinTemplate, bool) {
+	user, err := auth.ExtractUserFromContext(r)
+	if err != nil {
+		utils.WriteError(w, http.StatusForbidden, err)
+		return nil, false
+	}
+	templateIDStr := chi.URLParam(r, "templateID")
+	templateID, err := strconv.Atoi(templateIDStr)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid template %s", templateIDStr))
+		return nil, false
+	}
+	template, err := Owned(h.store, user.ID, templateID)
+	if err != nil {
+		utils.WriteError(w, http.StatusNotFound, err)
+		return nil, false
+	}
+	return template, true
+}
+
+// Owned returns the template if it belongs to the user.
+func Owned(store types.TemplateStore, userID, templateID int) (*types.BinTemplate, error) {
+	template, err := store.GetTemplateByID(templateID)
+	if err != nil {
+		return nil, err
+	}
+	if template.OwnerID != userID {
+		return nil, fmt.Errorf("template not found")
+	}
+	return template, nil
+}
+
+func parseTemplate(w http.ResponseWriter, r *http.Request) (*types.TemplatePayload, bool) {
+	var payload types.TemplatePayload
+	if err := utils.ParseJSON(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return nil, false
+	}
+	if err := utils.Validate.Struct(payload); err != nil {
+		errors := err.(validator.ValidationErrors)
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid payload %v", errors))
+		return nil, false
+	}
+	return &payload, true
+}
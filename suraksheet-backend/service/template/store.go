@@ -0,0 +1,96 @@
+package template
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+
+	"github.com/LikheKeto/Suraksheet/types"
+)
+
+type Store struct {
+	db *sql.DB
+}
+
+func NewStore(db *sql.DB) *Store {
+	return &Store{
+		db: db,
+	}
+}
+
+func (s *Store) CreateTemplate(template types.BinTemplate) (*types.BinTemplate, error) {
+	slots, err := json.Marshal(template.Slots)
+	if err != nil {
+		return nil, err
+	}
+	row := s.db.QueryRow(`
+		INSERT INTO bin_templates (owner, name, description, slots)
+		VALUES ($1, $2, $3, $4)
+		RETURNING *;
+	`, template.OwnerID, template.Name, template.Description, slots)
+	return scanRowIntoTemplate(row)
+}
+
+func (s *Store) GetTemplateByID(id int) (*types.BinTemplate, error) {
+	template, err := scanRowIntoTemplate(s.db.QueryRow("SELECT * FROM bin_templates WHERE id = $1;", id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("template not found")
+		}
+		return nil, err
+	}
+	return template, nil
+}
+
+func (s *Store) GetTemplatesByUser(userID int) ([]types.BinTemplate, error) {
+	rows, err := s.db.Query("SELECT * FROM bin_templates WHERE owner = $1 ORDER BY name;", userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	templates := make([]types.BinTemplate, 0)
+	for rows.Next() {
+		template, err := scanRowIntoTemplate(rows)
+		if err != nil {
+			return nil, err
+		}
+		templates = append(templates, *template)
+	}
+	return templates, rows.Err()
+}
+
+// UpdateTemplate replaces the name, description and slots of the template.
+// Bins already created from it keep the slots they were created with.
+func (s *Store) UpdateTemplate(template types.BinTemplate) error {
+	slots, err := json.Marshal(template.Slots)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.Exec(`
+		UPDATE bin_templates SET name = $1, description = $2, slots = $3 WHERE id = $4;
+	`, template.Name, template.Description, slots, template.ID)
+	return err
+}
+
+func (s *Store) DeleteTemplate(id int) error {
+	_, err := s.db.Exec("DELETE FROM bin_templates WHERE id = $1;", id)
+	return err
+}
+
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+func scanRowIntoTemplate(row scanner) (*types.BinTemplate, error) {
+	template := new(types.BinTemplate)
+	var slots []byte
+	err := row.Scan(&template.ID, &template.OwnerID, &template.Name, &template.Description, &slots, &template.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(slots, &template.Slots); err != nil {
+		return nil, err
+	}
+	return template, nil
+}
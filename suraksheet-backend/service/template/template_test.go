@@ -0,0 +1,42 @@
+package template
+
+import (
+	"testing"
+
+	"github.com/LikheKeto/Suraksheet/types"
+	"github.com/LikheKeto/Suraksheet/utils"
+)
+
+func TestTemplatePayloadValidation(t *testing.T) {
+	passport := types.TemplateSlot{Name: "Passport", Required: true}
+	photo := types.TemplateSlot{Name: "Photo", Required: true}
+	tests := []struct {
+		name    string
+		payload types.TemplatePayload
+		valid   bool
+	}{
+		{"visa application", types.TemplatePayload{Name: "Visa application", Slots: []types.TemplateSlot{passport, photo}}, true},
+		{"no slots", types.TemplatePayload{Name: "Visa application"}, false},
+		{"repeated slot", types.TemplatePayload{Name: "Visa application", Slots: []types.TemplateSlot{passport, passport}}, false},
+		{"unnamed slot", types.TemplatePayload{Name: "Visa application", Slots: []types.TemplateSlot{{Required: true}}}, false},
+	}
+	for _, tt := range tests {
+		err := utils.Validate.Struct(tt.payload)
+		if (err == nil) != tt.valid {
+			t.Errorf("%s: expected valid %v, got %v", tt.name, tt.valid, err)
+		}
+	}
+}
+
+func TestMissingSlots(t *testing.T) {
+	docID := 7
+	slots := []types.BinSlot{
+		{Name: "Passport", Required: true, DocumentID: &docID},
+		{Name: "Bank statement", Required: true},
+		{Name: "Cover letter"},
+	}
+	missing := types.MissingSlots(slots)
+	if len(missing) != 1 || missing[0] != "Bank statement" {
+		t.Errorf("expected only the bank statement to be missing, got %v", missing)
+	}
+}
@@ -0,0 +1,133 @@
+package trash
+
+import (
+	"context"
+	"log"
+	"path"
+	"strconv"
+	"time"
+
+	"github.com/LikheKeto/Suraksheet/service/permission"
+	"github.com/LikheKeto/Suraksheet/types"
+	"github.com/LikheKeto/Suraksheet/utils"
+	"github.com/elastic/go-elasticsearch/v8"
+	"github.com/minio/minio-go/v7"
+)
+
+// Purger permanently deletes what has been in the trash for longer than the
+// retention period. Like the account purger, every step can be repeated
+// safely, so a failed purge is simply run again on the next tick.
+type Purger struct {
+	store         types.TrashStore
+	binStore      types.BinStore
+	documentStore types.DocumentStore
+	permissions   *permission.Checker
+	minio         *minio.Client
+	esClient      *elasticsearch.Client
+	retention     time.Duration
+}
+
+func NewPurger(store types.TrashStore, binStore types.BinStore, documentStore types.DocumentStore, permissions *permission.Checker, minio *minio.Client, esClient *elasticsearch.Client, retention time.Duration) *Purger {
+	return &Purger{store: store, binStore: binStore, documentStore: documentStore, permissions: permissions, minio: minio, esClient: esClient, retention: retention}
+}
+
+func (p *Purger) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		p.purgeExpired(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (p *Purger) purgeExpired(ctx context.Context) {
+	entries, err := p.store.GetExpiredTrash(time.Now().UTC().Add(-p.retention))
+	if err != nil {
+		log.Printf("unable to fetch expired trash: %v", err)
+		return
+	}
+	for _, entry := range entries {
+		if err := p.Purge(ctx, entry); err != nil {
+			log.Printf("unable to purge trash entry %d: %v", entry.ID, err)
+		}
+	}
+}
+
+// Purge deletes the entry's document or bin for good, objects and search
+// entries included.
+func (p *Purger) Purge(ctx context.Context, entry types.TrashEntry) error {
+	storageKey, err := p.permissions.StorageKey(&entry.Bin)
+	if err != nil {
+		return err
+	}
+	if entry.DocumentID != nil {
+		err := utils.DeleteObject(ctx, p.minio, utils.TrashedObjectKey(storageKey, entry.Bin.ID, *entry.DocumentID))
+		if err != nil {
+			return err
+		}
+		err = p.removeFromIndex(ctx, []int{*entry.DocumentID})
+		if err != nil {
+			return err
+		}
+		if err := p.removeVersions(ctx, []int{*entry.DocumentID}); err != nil {
+			return err
+		}
+		return p.documentStore.DeleteDocumentByID(*entry.DocumentID)
+	}
+
+	binIDs, err := p.binStore.GetBinDescendantIDs(entry.Bin.ID)
+	if err != nil {
+		return err
+	}
+	for _, binID := range binIDs {
+		if err := utils.DeleteDir(ctx, p.minio, path.Join(storageKey, strconv.Itoa(binID))+"/"); err != nil {
+			return err
+		}
+	}
+	docIDs, err := p.documentStore.GetDocumentIDsInBins(binIDs)
+	if err != nil {
+		return err
+	}
+	if err := p.removeFromIndex(ctx, docIDs); err != nil {
+		return err
+	}
+	if err := p.removeVersions(ctx, docIDs); err != nil {
+		return err
+	}
+	return p.binStore.DeleteBin(entry.Bin.ID)
+}
+
+// removeVersions deletes the objects of the documents' older versions and
+// extra pages, which are kept apart from the bins the documents are in.
+func (p *Purger) removeVersions(ctx context.Context, docIDs []int) error {
+	keys, err := p.documentStore.GetVersionObjectKeys(docIDs)
+	if err != nil {
+		return err
+	}
+	pageKeys, err := p.documentStore.GetPageObjectKeys(docIDs)
+	if err != nil {
+		return err
+	}
+	for _, key := range append(keys, pageKeys...) {
+		if err := utils.DeleteObject(ctx, p.minio, key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// removeFromIndex takes the documents out of search. They were taken out when
+// they were deleted, but an extraction that was still running may have put
+// them back since.
+func (p *Purger) removeFromIndex(ctx context.Context, docIDs []int) error {
+	if len(docIDs) == 0 {
+		return nil
+	}
+	return utils.DeleteFromIndex(ctx, p.esClient, map[string]interface{}{
+		"terms": map[string]interface{}{"document_id": docIDs},
+	})
+}
@@ -0,0 +1,210 @@
+package trash
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"path"
+	"strconv"
+	"time"
+
+	"github.com/LikheKeto/Suraksheet/service/auth"
+	"github.com/LikheKeto/Suraksheet/service/permission"
+	"github.com/LikheKeto/Suraksheet/types"
+	"github.com/LikheKeto/Suraksheet/utils"
+	"github.com/elastic/go-elasticsearch/v8"
+	"github.com/go-chi/chi/v5"
+	"github.com/minio/minio-go/v7"
+)
+
+type Handler struct {
+	store         types.TrashStore
+	documentStore types.DocumentStore
+	userStore     types.UserStore
+	sessionStore  types.SessionStore
+	apiKeyStore   types.APIKeyStore
+	permissions   *permission.Checker
+	purger        *Purger
+	minio         *minio.Client
+	esClient      *elasticsearch.Client
+	retention     time.Duration
+}
+
+func NewHandler(store types.TrashStore, documentStore types.DocumentStore, userStore types.UserStore, sessionStore types.SessionStore, apiKeyStore types.APIKeyStore, permissions *permission.Checker, purger *Purger, minio *minio.Client, esClient *elasticsearch.Client, retention time.Duration) *Handler {
+	return &Handler{store: store, documentStore: documentStore, userStore: userStore, sessionStore: sessionStore, apiKeyStore: apiKeyStore, permissions: permissions, purger: purger, minio: minio, esClient: esClient, retention: retention}
+}
+
+func (h *Handler) RegisterRoutes(router chi.Router) {
+	router.MethodFunc(http.MethodGet, "/trash", h.withAuth(h.handleGetTrash, types.APIKeyScopeRead))
+	router.MethodFunc(http.MethodPost, "/trash/{entryID}/restore", h.withAuth(h.handleRestore, types.APIKeyScopeFull))
+	router.MethodFunc(http.MethodDelete, "/trash/{entryID}", h.withAuth(h.handlePurge, types.APIKeyScopeFull))
+}
+
+func (h *Handler) withAuth(handlerFunc http.HandlerFunc, scope string) http.HandlerFunc {
+	return auth.WithJWTOrAPIKeyAuth(auth.RequireVerifiedEmail(handlerFunc), scope, h.userStore, h.sessionStore, h.apiKeyStore)
+}
+
+func (h *Handler) handleGetTrash(w http.ResponseWriter, r *http.Request) {
+	user, err := auth.ExtractUserFromContext(r)
+	if err != nil {
+		utils.WriteError(w, http.StatusForbidden, err)
+		return
+	}
+	orgIDs, err := h.permissions.OrganizationIDs(user.ID)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	entries, err := h.store.GetTrash(user.ID, orgIDs)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	for i := range entries {
+		entries[i].PurgeAt = entries[i].DeletedAt.Add(h.retention)
+	}
+	utils.WriteJSON(w, http.StatusOK, entries)
+}
+
+// entry loads the trash entry from the URL and checks the user may do what
+// deleting it took: editing documents, or owning bins.
+func (h *Handler) entry(w http.ResponseWriter, r *http.Request, userID int) (*types.TrashEntry, bool) {
+	entryIDStr := chi.URLParam(r, "entryID")
+	entryID, err := strconv.Atoi(entryIDStr)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid trash entry %s", entryIDStr))
+		return nil, false
+	}
+	entry, err := h.store.GetTrashEntry(entryID)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return nil, false
+	}
+	required := types.RoleOwner
+	if entry.DocumentID != nil {
+		required = types.RoleEditor
+	}
+	role, err := h.permissions.Role(userID, &entry.Bin)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return nil, false
+	}
+	if !permission.Allows(role, required) {
+		utils.WriteError(w, http.StatusForbidden, fmt.Errorf("trash entry doesn't belong to user"))
+		return nil, false
+	}
+	return entry, true
+}
+
+func (h *Handler) handleRestore(w http.ResponseWriter, r *http.Request) {
+	user, err := auth.ExtractUserFromContext(r)
+	if err != nil {
+		utils.WriteError(w, http.StatusForbidden, err)
+		return
+	}
+	entry, ok := h.entry(w, r, user.ID)
+	if !ok {
+		return
+	}
+	if entry.InTrashedBin {
+		utils.WriteError(w, http.StatusConflict, fmt.Errorf("the bin it was deleted from is in the trash too and has to be restored first"))
+		return
+	}
+	if entry.DocumentID != nil {
+		h.restoreDocument(w, r, entry)
+		return
+	}
+
+	docIDs, err := h.store.RestoreBin(entry.ID)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("unable to restore bin: %v", err))
+		return
+	}
+	docs, err := h.documentStore.FetchDocumentsFromDB(docIDs)
+	if err != nil {
+		log.Printf("unable to fetch restored documents of bin %d: %v", entry.Bin.ID, err)
+	}
+	for _, doc := range docs {
+		h.reindex(r, doc, &entry.Bin)
+	}
+	utils.WriteJSON(w, http.StatusNoContent, nil)
+}
+
+// restoreDocument brings the document's object back from the trash, under a
+// new reference name if its old one has been taken in the meantime.
+func (h *Handler) restoreDocument(w http.ResponseWriter, r *http.Request, entry *types.TrashEntry) {
+	bin := &entry.Bin
+	names, err := h.documentStore.GetReferenceNamesInBin(bin.ID)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	taken := make(map[string]bool, len(names))
+	for _, name := range names {
+		taken[name] = true
+	}
+	name := entry.Name
+	if taken[name] {
+		name = utils.FreeName(name, taken)
+	}
+
+	storageKey, err := h.permissions.StorageKey(bin)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	trashed := utils.TrashedObjectKey(storageKey, bin.ID, *entry.DocumentID)
+	restored := path.Join(storageKey, strconv.Itoa(bin.ID), utils.HashString(name))
+	if err := utils.CopyObject(r.Context(), h.minio, trashed, restored); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, fmt.Errorf("unable to restore document: %v", err))
+		return
+	}
+	if err := h.store.RestoreDocument(entry.ID, name); err != nil {
+		if err := utils.DeleteObject(r.Context(), h.minio, restored); err != nil {
+			log.Printf("unable to delete file in minio: %v\n", err)
+		}
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("unable to restore document: %v", err))
+		return
+	}
+	if err := utils.DeleteObject(r.Context(), h.minio, trashed); err != nil {
+		log.Printf("unable to delete file in minio: %v\n", err)
+	}
+
+	doc, err := h.documentStore.GetDocumentByID(*entry.DocumentID)
+	if err != nil {
+		log.Printf("unable to fetch restored document %d: %v", *entry.DocumentID, err)
+	} else {
+		h.reindex(r, doc, bin)
+	}
+	utils.WriteJSON(w, http.StatusNoContent, nil)
+}
+
+// reindex puts a restored document back into search. Documents that were
+// still waiting for extraction get indexed by the extractor as usual.
+func (h *Handler) reindex(r *http.Request, doc *types.Document, bin *types.Bin) {
+	if doc.Extract == "" {
+		return
+	}
+	if err := utils.IndexExtractedDocument(r.Context(), h.esClient, doc, bin); err != nil {
+		log.Printf("unable to index restored document %d: %v", doc.ID, err)
+	}
+}
+
+// handlePurge deletes an entry for good without waiting for the retention
+// period to pass.
+func (h *Handler) handlePurge(w http.ResponseWriter, r *http.Request) {
+	user, err := auth.ExtractUserFromContext(r)
+	if err != nil {
+		utils.WriteError(w, http.StatusForbidden, err)
+		return
+	}
+	entry, ok := h.entry(w, r, user.ID)
+	if !ok {
+		return
+	}
+	if err := h.purger.Purge(r.Context(), *entry); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, fmt.Errorf("unable to delete for good: %v", err))
+		return
+	}
+	utils.WriteJSON(w, http.StatusNoContent, nil)
+}
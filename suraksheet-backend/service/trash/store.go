@@ -0,0 +1,220 @@
+package trash
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/LikheKeto/Suraksheet/types"
+	"github.com/LikheKeto/Suraksheet/utils"
+	"github.com/lib/pq"
+)
+
+type Store struct {
+	db *sql.DB
+}
+
+func NewStore(db *sql.DB) *Store {
+	return &Store{
+		db: db,
+	}
+}
+
+// selectEntries joins each entry with its bin, and with the bin around it to
+// tell whether that was deleted too.
+const selectEntries = `
+	SELECT t.id, t.document, COALESCE(d.referenceName, b.name), t.deletedBy, t.deletedAt,
+		b.id, b.name, b.owner, b.createdAt, b.parent, b.organization, b.deletedAt,
+		c.deletedAt IS NOT NULL
+	FROM trash t
+	LEFT JOIN documents d ON d.id = t.document
+	JOIN bins b ON b.id = COALESCE(t.bin, d.bin)
+	LEFT JOIN bins c ON c.id = CASE WHEN t.document IS NULL THEN b.parent ELSE b.id END
+`
+
+func (s *Store) GetTrash(userID int, orgIDs []int) ([]types.TrashEntry, error) {
+	rows, err := s.db.Query(selectEntries+`
+		WHERE b.owner = $1 OR b.organization = ANY($2) OR t.deletedBy = $1
+		ORDER BY t.deletedAt DESC;
+	`, userID, pq.Array(orgIDs))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	return scanRowsIntoEntries(rows)
+}
+
+func (s *Store) GetTrashEntry(id int) (*types.TrashEntry, error) {
+	row := s.db.QueryRow(selectEntries+" WHERE t.id = $1;", id)
+	return scanRowIntoEntry(row)
+}
+
+func (s *Store) GetExpiredTrash(before time.Time) ([]types.TrashEntry, error) {
+	rows, err := s.db.Query(selectEntries+`
+		WHERE t.deletedAt < $1
+		ORDER BY t.deletedAt;
+	`, before)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	return scanRowsIntoEntries(rows)
+}
+
+func (s *Store) RestoreDocument(entryID int, referenceName string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var docID int
+	err = tx.QueryRow(`
+		DELETE FROM trash WHERE id = $1 AND document IS NOT NULL
+		RETURNING document;
+	`, entryID).Scan(&docID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return fmt.Errorf("trash entry not found")
+		}
+		return err
+	}
+	_, err = tx.Exec(`
+		UPDATE documents SET deletedAt = NULL, referenceName = $1 WHERE id = $2;
+	`, referenceName, docID)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *Store) RestoreBin(entryID int) ([]int, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var binID int
+	var deletedAt time.Time
+	err = tx.QueryRow(`
+		DELETE FROM trash WHERE id = $1 AND bin IS NOT NULL
+		RETURNING bin, deletedAt;
+	`, entryID).Scan(&binID, &deletedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("trash entry not found")
+		}
+		return nil, err
+	}
+
+	// another bin may have taken the name in the meantime
+	var name string
+	var ownerID, orgID, parentID *int
+	err = tx.QueryRow(`
+		SELECT name, owner, organization, parent FROM bins WHERE id = $1;
+	`, binID).Scan(&name, &ownerID, &orgID, &parentID)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := tx.Query(`
+		SELECT name FROM bins
+		WHERE owner IS NOT DISTINCT FROM $1 AND organization IS NOT DISTINCT FROM $2
+		AND parent IS NOT DISTINCT FROM $3 AND deletedAt IS NULL;
+	`, ownerID, orgID, parentID)
+	if err != nil {
+		return nil, err
+	}
+	taken := make(map[string]bool)
+	for rows.Next() {
+		var sibling string
+		if err := rows.Scan(&sibling); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		taken[sibling] = true
+	}
+	rows.Close()
+	if taken[name] {
+		name = utils.FreeName(name, taken)
+	}
+
+	// bins and documents deleted on their own before the bin keep their own
+	// entries and stay in the trash
+	rows, err = tx.Query(`
+		WITH RECURSIVE tree AS (
+			SELECT id FROM bins WHERE id = $1
+			UNION
+			SELECT b.id FROM bins b JOIN tree t ON b.parent = t.id WHERE b.deletedAt = $2
+		), restored AS (
+			UPDATE bins SET deletedAt = NULL WHERE id IN (SELECT id FROM tree)
+			RETURNING id
+		)
+		UPDATE documents SET deletedAt = NULL
+		WHERE deletedAt = $2 AND bin IN (SELECT id FROM restored)
+		RETURNING id;
+	`, binID, deletedAt)
+	if err != nil {
+		return nil, err
+	}
+	docIDs := make([]int, 0)
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		docIDs = append(docIDs, id)
+	}
+	rows.Close()
+
+	if _, err := tx.Exec("UPDATE bins SET name = $1 WHERE id = $2;", name, binID); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return docIDs, nil
+}
+
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+func scanRowsIntoEntries(rows *sql.Rows) ([]types.TrashEntry, error) {
+	entries := make([]types.TrashEntry, 0)
+	for rows.Next() {
+		entry, err := scanRowIntoEntry(rows)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, *entry)
+	}
+	return entries, rows.Err()
+}
+
+func scanRowIntoEntry(row scanner) (*types.TrashEntry, error) {
+	entry := new(types.TrashEntry)
+	var ownerID sql.NullInt64
+	err := row.Scan(&entry.ID,
+		&entry.DocumentID,
+		&entry.Name,
+		&entry.DeletedBy,
+		&entry.DeletedAt,
+		&entry.Bin.ID,
+		&entry.Bin.Name,
+		&ownerID,
+		&entry.Bin.CreatedAt,
+		&entry.Bin.ParentID,
+		&entry.Bin.OrganizationID,
+		&entry.Bin.DeletedAt,
+		&entry.InTrashedBin)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("trash entry not found")
+		}
+		return nil, err
+	}
+	entry.Bin.OwnerID = int(ownerID.Int64)
+	return entry, nil
+}
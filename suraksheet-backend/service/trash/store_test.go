@@ -0,0 +1,93 @@
+package trash
+
+import (
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func newMockStore(t *testing.T) (*Store, sqlmock.Sqlmock) {
+	t.Helper()
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		db.Close()
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+	})
+	return NewStore(db), mock
+}
+
+func TestGetExpiredTrash(t *testing.T) {
+	store, mock := newMockStore(t)
+	before := time.Now().UTC().Add(-time.Hour)
+	mock.ExpectQuery(`FROM trash t .* WHERE t.deletedAt < \$1`).WithArgs(before).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "document", "name", "deletedBy", "deletedAt",
+			"binId", "binName", "owner", "binCreatedAt", "parent", "organization", "binDeletedAt", "inTrashedBin"}).
+			AddRow(1, 5, "passport", 2, before.Add(-time.Hour), 3, "Travel", 2, before, nil, nil, nil, false))
+
+	entries, err := store.GetExpiredTrash(before)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || *entries[0].DocumentID != 5 || entries[0].Bin.OwnerID != 2 {
+		t.Errorf("unexpected entries %+v", entries)
+	}
+}
+
+func TestRestoreDocument(t *testing.T) {
+	t.Run("should restore the document under the given name", func(t *testing.T) {
+		store, mock := newMockStore(t)
+		mock.ExpectBegin()
+		mock.ExpectQuery("DELETE FROM trash WHERE id = \\$1 AND document IS NOT NULL").WithArgs(1).
+			WillReturnRows(sqlmock.NewRows([]string{"document"}).AddRow(5))
+		mock.ExpectExec("UPDATE documents SET deletedAt = NULL").WithArgs("passport (2)", 5).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+
+		if err := store.RestoreDocument(1, "passport (2)"); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("should fail for an entry that isn't a document", func(t *testing.T) {
+		store, mock := newMockStore(t)
+		mock.ExpectBegin()
+		mock.ExpectQuery("DELETE FROM trash").WithArgs(1).WillReturnRows(sqlmock.NewRows([]string{"document"}))
+		mock.ExpectRollback()
+
+		if err := store.RestoreDocument(1, "passport"); err == nil {
+			t.Error("expected an error")
+		}
+	})
+}
+
+func TestRestoreBin(t *testing.T) {
+	store, mock := newMockStore(t)
+	deletedAt := time.Now().UTC()
+	owner := 2
+	mock.ExpectBegin()
+	mock.ExpectQuery("DELETE FROM trash WHERE id = \\$1 AND bin IS NOT NULL").WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"bin", "deletedAt"}).AddRow(3, deletedAt))
+	mock.ExpectQuery("SELECT name, owner, organization, parent FROM bins").WithArgs(3).
+		WillReturnRows(sqlmock.NewRows([]string{"name", "owner", "organization", "parent"}).AddRow("Travel", owner, nil, nil))
+	// a bin made since took the name
+	mock.ExpectQuery("SELECT name FROM bins").WithArgs(owner, nil, nil).
+		WillReturnRows(sqlmock.NewRows([]string{"name"}).AddRow("Travel").AddRow("Travel (2)"))
+	mock.ExpectQuery("WITH RECURSIVE tree").WithArgs(3, deletedAt).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(5).AddRow(6))
+	mock.ExpectExec("UPDATE bins SET name").WithArgs("Travel (3)", 3).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	docIDs, err := store.RestoreBin(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(docIDs) != 2 || docIDs[0] != 5 || docIDs[1] != 6 {
+		t.Errorf("expected documents 5 and 6 back, got %v", docIDs)
+	}
+}
@@ -2,9 +2,15 @@ package user
 
 import (
 	"fmt"
+	"log"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/LikheKeto/Suraksheet/config"
+	"github.com/LikheKeto/Suraksheet/service/audit"
 	"github.com/LikheKeto/Suraksheet/service/auth"
 	"github.com/LikheKeto/Suraksheet/types"
 	"github.com/LikheKeto/Suraksheet/utils"
@@ -12,20 +18,52 @@ import (
 	"github.com/go-playground/validator/v10"
 )
 
+const (
+	verifyEmailExpiration   = time.Hour * 24
+	resetPasswordExpiration = time.Hour
+)
+
 type Handler struct {
-	store types.UserStore
+	store          types.UserStore
+	sessionStore   types.SessionStore
+	deletionStore  types.AccountDeletionStore
+	mailer         types.Mailer
+	ipLimiter      types.LoginLimiter
+	accountLimiter types.LoginLimiter
+	auditStore     types.AuditStore
 }
 
-func NewHandler(store types.UserStore) *Handler {
+func NewHandler(store types.UserStore, sessionStore types.SessionStore, deletionStore types.AccountDeletionStore, mailer types.Mailer, ipLimiter, accountLimiter types.LoginLimiter, auditStore types.AuditStore) *Handler {
 	return &Handler{
-		store: store,
+		store:          store,
+		sessionStore:   sessionStore,
+		deletionStore:  deletionStore,
+		mailer:         mailer,
+		ipLimiter:      ipLimiter,
+		accountLimiter: accountLimiter,
+		auditStore:     auditStore,
 	}
 }
 
 func (h *Handler) RegisterRoutes(router chi.Router) {
 	router.MethodFunc("POST", "/login", h.handleLogin)
+	router.MethodFunc("POST", "/login/2fa", h.handleLoginTOTP)
 	router.MethodFunc("POST", "/register", h.handleRegister)
-	router.MethodFunc("GET", "/profile", h.handleProfile)
+	router.MethodFunc("GET", "/profile", auth.WithJWTAuth(h.handleProfile, h.store, h.sessionStore))
+	router.MethodFunc("PATCH", "/profile", auth.WithJWTAuth(h.handleUpdateProfile, h.store, h.sessionStore))
+	router.MethodFunc("POST", "/profile/email", auth.WithJWTAuth(h.handleChangeEmail, h.store, h.sessionStore))
+	router.MethodFunc("GET", "/profile/email/confirm", h.handleConfirmEmailChange)
+	router.MethodFunc("POST", "/profile/password", auth.WithJWTAuth(h.handleChangePassword, h.store, h.sessionStore))
+	router.MethodFunc("DELETE", "/profile", auth.WithJWTAuth(h.handleDeleteAccount, h.store, h.sessionStore))
+	router.MethodFunc("GET", "/profile/deletion", auth.WithJWTAuth(h.handleGetAccountDeletion, h.store, h.sessionStore))
+	router.MethodFunc("DELETE", "/profile/deletion", auth.WithJWTAuth(h.handleCancelAccountDeletion, h.store, h.sessionStore))
+	router.MethodFunc("GET", "/verify-email", h.handleVerifyEmail)
+	router.MethodFunc("POST", "/verify-email/resend", auth.WithJWTAuth(h.handleResendVerification, h.store, h.sessionStore))
+	router.MethodFunc("POST", "/password/forgot", h.handleForgotPassword)
+	router.MethodFunc("POST", "/password/reset", h.handleResetPassword)
+	router.MethodFunc("POST", "/2fa/setup", auth.WithJWTAuth(h.handleSetupTOTP, h.store, h.sessionStore))
+	router.MethodFunc("POST", "/2fa/enable", auth.WithJWTAuth(h.handleEnableTOTP, h.store, h.sessionStore))
+	router.MethodFunc("POST", "/2fa/disable", auth.WithJWTAuth(h.handleDisableTOTP, h.store, h.sessionStore))
 }
 
 func (h *Handler) handleLogin(w http.ResponseWriter, r *http.Request) {
@@ -39,24 +77,167 @@ func (h *Handler) handleLogin(w http.ResponseWriter, r *http.Request) {
 		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid payload %v", errors))
 		return
 	}
+	ip := utils.ClientIP(r)
+	if !h.checkLoginLimits(w, ip, payload.Email) {
+		return
+	}
 	user, err := h.store.GetUserByEmail(payload.Email)
 	if err != nil {
-		utils.WriteError(w, http.StatusUnauthorized, fmt.Errorf("invalid credentials"))
+		h.rejectLogin(w, ip, payload.Email, nil, fmt.Errorf("invalid credentials"))
 		return
 	}
 	if !auth.ComparePassword(user.Password, payload.Password) {
-		utils.WriteError(w, http.StatusUnauthorized, fmt.Errorf("invalid credentials"))
+		h.rejectLogin(w, ip, payload.Email, &user.ID, fmt.Errorf("invalid credentials"))
+		return
+	}
+
+	// users with two-factor authentication have to complete the login with a
+	// code at /login/2fa before they get a session
+	if user.TOTPEnabled {
+		challenge, err := auth.CreateChallengeJWT(user.ID)
+		if err != nil {
+			utils.WriteError(w, http.StatusInternalServerError, err)
+			return
+		}
+		utils.WriteJSON(w, http.StatusOK, map[string]any{"twoFactorRequired": true, "challenge": challenge})
+		return
+	}
+
+	h.startSession(w, r, user)
+}
+
+func (h *Handler) handleLoginTOTP(w http.ResponseWriter, r *http.Request) {
+	var payload types.LoginTOTPPayload
+	if err := utils.ParseJSON(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	if err := utils.Validate.Struct(payload); err != nil {
+		errors := err.(validator.ValidationErrors)
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid payload %v", errors))
 		return
 	}
+	userID, err := auth.ValidateChallengeJWT(payload.Challenge)
+	if err != nil {
+		utils.WriteError(w, http.StatusUnauthorized, err)
+		return
+	}
+	user, err := h.store.GetUserByID(userID)
+	if err != nil || !user.TOTPEnabled {
+		utils.WriteError(w, http.StatusUnauthorized, fmt.Errorf("invalid or expired challenge"))
+		return
+	}
+	ip := utils.ClientIP(r)
+	if !h.checkLoginLimits(w, ip, user.Email) {
+		return
+	}
+	if !h.verifySecondFactor(user, payload.Code) {
+		h.rejectLogin(w, ip, user.Email, &user.ID, fmt.Errorf("invalid code"))
+		return
+	}
+
+	h.startSession(w, r, user)
+}
 
-	secret := []byte(config.Envs.JWTSecret)
-	token, err := auth.CreateJWT(secret, user.ID)
+// startSession completes a login. Failed attempts of the account are only
+// forgotten here, so a known password alone can't reset the count of wrong
+// two-factor codes.
+func (h *Handler) startSession(w http.ResponseWriter, r *http.Request, user *types.User) {
+	token, refreshToken, err := auth.StartSession(h.sessionStore, user.ID, r)
 	if err != nil {
 		utils.WriteError(w, http.StatusInternalServerError, err)
 		return
 	}
+	if err := h.accountLimiter.Reset(accountLimitKey(user.Email)); err != nil {
+		log.Printf("failed to reset login attempts: %v", err)
+	}
+
+	utils.WriteJSON(w, http.StatusOK, map[string]string{"token": token, "refreshToken": refreshToken})
+}
+
+func ipLimitKey(ip string) string {
+	return "ip:" + ip
+}
+
+func accountLimitKey(email string) string {
+	return "account:" + strings.ToLower(email)
+}
+
+// checkLoginLimits writes a 429 and returns false if logins from ip or for
+// the account with the given email are currently held off.
+func (h *Handler) checkLoginLimits(w http.ResponseWriter, ip, email string) bool {
+	ipWait, err := h.ipLimiter.RetryAfter(ipLimitKey(ip))
+	if err != nil {
+		writeLimiterError(w, err)
+		return false
+	}
+	accountWait, err := h.accountLimiter.RetryAfter(accountLimitKey(email))
+	if err != nil {
+		writeLimiterError(w, err)
+		return false
+	}
+	wait := max(ipWait, accountWait)
+	if wait <= 0 {
+		return true
+	}
+	seconds := int((wait + time.Second - 1) / time.Second)
+	w.Header().Set("Retry-After", strconv.Itoa(seconds))
+	utils.WriteError(w, http.StatusTooManyRequests, fmt.Errorf("too many failed login attempts, try again in %d seconds", seconds))
+	return false
+}
+
+// recordLoginFailure counts a failed attempt against both the IP and the
+// account, and writes an audit entry for every lockout it causes. Both counts
+// are attempted even if one fails, so an unreachable limiter store for one of
+// them doesn't stop the other from counting.
+func (h *Handler) recordLoginFailure(ip, email string, userID *int) error {
+	locked, ipErr := h.ipLimiter.RecordFailure(ipLimitKey(ip))
+	if ipErr == nil && locked {
+		h.audit(types.AuditEntry{Event: audit.EventIPLocked, Detail: "too many failed logins from this address", IPAddress: ip})
+	}
+
+	locked, err := h.accountLimiter.RecordFailure(accountLimitKey(email))
+	if err == nil && locked {
+		h.audit(types.AuditEntry{UserID: userID, Event: audit.EventAccountLocked, Detail: "too many failed logins for " + email, IPAddress: ip})
+	}
+	if ipErr != nil {
+		return ipErr
+	}
+	return err
+}
+
+// writeLimiterError answers a login the limiter couldn't account for. Logins
+// fail closed: letting them through would allow unthrottled guessing for as
+// long as the limiter store is down.
+func writeLimiterError(w http.ResponseWriter, err error) {
+	log.Printf("login limiter unavailable: %v", err)
+	w.Header().Set("Retry-After", "30")
+	utils.WriteError(w, http.StatusServiceUnavailable, fmt.Errorf("logins are temporarily unavailable, try again later"))
+}
+
+// rejectLogin writes the 401 for a failed attempt once it has been counted,
+// or a 503 if it couldn't be.
+func (h *Handler) rejectLogin(w http.ResponseWriter, ip, email string, userID *int, reason error) {
+	if err := h.recordLoginFailure(ip, email, userID); err != nil {
+		writeLimiterError(w, err)
+		return
+	}
+	utils.WriteError(w, http.StatusUnauthorized, reason)
+}
+
+func (h *Handler) audit(entry types.AuditEntry) {
+	if err := h.auditStore.CreateAuditEntry(entry); err != nil {
+		log.Printf("failed to write audit entry %s: %v", entry.Event, err)
+	}
+}
 
-	utils.WriteJSON(w, http.StatusOK, map[string]string{"token": token})
+// verifySecondFactor accepts either a current TOTP code that wasn't used
+// before or an unused recovery code.
+func (h *Handler) verifySecondFactor(user *types.User, code string) bool {
+	if step, ok := auth.ValidateTOTP(user.TOTPSecret, code, time.Now()); ok {
+		return h.store.UseTOTPStep(user.ID, step) == nil
+	}
+	return h.store.UseRecoveryCode(user.ID, auth.HashRecoveryCode(code)) == nil
 }
 
 func (h *Handler) handleRegister(w http.ResponseWriter, r *http.Request) {
@@ -88,7 +269,7 @@ func (h *Handler) handleRegister(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = h.store.CreateUser(types.User{
+	userID, err := h.store.CreateUser(types.User{
 		FirstName: payload.FirstName,
 		LastName:  payload.LastName,
 		Email:     payload.Email,
@@ -98,9 +279,452 @@ func (h *Handler) handleRegister(w http.ResponseWriter, r *http.Request) {
 		utils.WriteError(w, http.StatusInternalServerError, err)
 		return
 	}
+	h.sendVerificationEmail(userID, payload.Email)
 	utils.WriteJSON(w, http.StatusCreated, nil)
 }
 
+func (h *Handler) handleVerifyEmail(w http.ResponseWriter, r *http.Request) {
+	token := r.URL.Query().Get("token")
+	if token == "" {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("query parameter 'token' is required"))
+		return
+	}
+	userID, err := auth.ConsumeUserToken(h.store, auth.PurposeVerifyEmail, token)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	if err := h.store.SetEmailVerified(userID); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, map[string]string{"message": "email address verified"})
+}
+
+func (h *Handler) handleResendVerification(w http.ResponseWriter, r *http.Request) {
+	user, err := auth.ExtractUserFromContext(r)
+	if err != nil {
+		utils.WriteError(w, http.StatusForbidden, err)
+		return
+	}
+	if user.EmailVerified {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("email address is already verified"))
+		return
+	}
+	h.sendVerificationEmail(user.ID, user.Email)
+	utils.WriteJSON(w, http.StatusAccepted, nil)
+}
+
+func (h *Handler) handleForgotPassword(w http.ResponseWriter, r *http.Request) {
+	var payload types.ForgotPasswordPayload
+	if err := utils.ParseJSON(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	if err := utils.Validate.Struct(payload); err != nil {
+		errors := err.(validator.ValidationErrors)
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid payload %v", errors))
+		return
+	}
+
+	// respond the same way whether or not the account exists, so this
+	// endpoint can't be used to find out who is registered
+	user, err := h.store.GetUserByEmail(payload.Email)
+	if err == nil {
+		token, err := auth.CreateUserToken(h.store, user.ID, auth.PurposeResetPassword, resetPasswordExpiration)
+		if err != nil {
+			log.Printf("unable to create password reset token: %v", err)
+		} else {
+			link := fmt.Sprintf("%s/password/reset?token=%s", config.Envs.PublicHost, url.QueryEscape(token))
+			h.sendMail(user.Email, "Reset your Suraksheet password",
+				fmt.Sprintf("Someone asked to reset the password of your Suraksheet account.\n\n"+
+					"Open the link below within an hour to choose a new password:\n%s\n\n"+
+					"If it wasn't you, you can ignore this email.", link))
+		}
+	}
+	utils.WriteJSON(w, http.StatusAccepted, nil)
+}
+
+func (h *Handler) handleResetPassword(w http.ResponseWriter, r *http.Request) {
+	var payload types.ResetPasswordPayload
+	if err := utils.ParseJSON(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	if err := utils.Validate.Struct(payload); err != nil {
+		errors := err.(validator.ValidationErrors)
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid payload %v", errors))
+		return
+	}
+	userID, err := auth.ConsumeUserToken(h.store, auth.PurposeResetPassword, payload.Token)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	hashedPassword, err := auth.HashPassword(payload.Password)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if err := h.store.UpdatePassword(userID, hashedPassword); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	// whoever knew the old password shouldn't stay signed in
+	if err := h.sessionStore.RevokeAllSessions(userID); err != nil {
+		log.Printf("unable to revoke sessions after password reset: %v", err)
+	}
+	utils.WriteJSON(w, http.StatusNoContent, nil)
+}
+
+func (h *Handler) sendVerificationEmail(userID int, email string) {
+	token, err := auth.CreateUserToken(h.store, userID, auth.PurposeVerifyEmail, verifyEmailExpiration)
+	if err != nil {
+		log.Printf("unable to create verification token: %v", err)
+		return
+	}
+	link := fmt.Sprintf("%s/api/v1/verify-email?token=%s", config.Envs.PublicHost, url.QueryEscape(token))
+	h.sendMail(email, "Verify your Suraksheet email address",
+		fmt.Sprintf("Welcome to Suraksheet!\n\n"+
+			"Open the link below to verify your email address:\n%s", link))
+}
+
+// sendMail delivers the message in the background so slow mail servers don't
+// hold up the request.
+func (h *Handler) sendMail(to, subject, body string) {
+	go func() {
+		if err := h.mailer.Send(to, subject, body); err != nil {
+			log.Printf("unable to send mail to %s: %v", to, err)
+		}
+	}()
+}
+
 func (h *Handler) handleProfile(w http.ResponseWriter, r *http.Request) {
+	user, err := auth.ExtractUserFromContext(r)
+	if err != nil {
+		utils.WriteError(w, http.StatusForbidden, err)
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, user)
+}
+
+func (h *Handler) handleUpdateProfile(w http.ResponseWriter, r *http.Request) {
+	user, err := auth.ExtractUserFromContext(r)
+	if err != nil {
+		utils.WriteError(w, http.StatusForbidden, err)
+		return
+	}
+	var payload types.UpdateProfilePayload
+	if err := utils.ParseJSON(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	if err := utils.Validate.Struct(payload); err != nil {
+		errors := err.(validator.ValidationErrors)
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid payload %v", errors))
+		return
+	}
+	if err := h.store.UpdateName(user.ID, payload.FirstName, payload.LastName); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	updated, err := h.store.GetUserByID(user.ID)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, updated)
+}
+
+// handleChangeEmail sends a confirmation link to the new address. The account
+// keeps using the old address until the link is opened.
+func (h *Handler) handleChangeEmail(w http.ResponseWriter, r *http.Request) {
+	user, err := auth.ExtractUserFromContext(r)
+	if err != nil {
+		utils.WriteError(w, http.StatusForbidden, err)
+		return
+	}
+	var payload types.ChangeEmailPayload
+	if err := utils.ParseJSON(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	if err := utils.Validate.Struct(payload); err != nil {
+		errors := err.(validator.ValidationErrors)
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid payload %v", errors))
+		return
+	}
+	if !auth.ComparePassword(user.Password, payload.Password) {
+		utils.WriteError(w, http.StatusUnauthorized, fmt.Errorf("invalid credentials"))
+		return
+	}
+	if payload.Email == user.Email {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("this is already your email address"))
+		return
+	}
+	if _, err := h.store.GetUserByEmail(payload.Email); err == nil {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("user with email %s already exists", payload.Email))
+		return
+	}
+	if err := h.store.SetPendingEmail(user.ID, payload.Email); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	token, err := auth.CreateUserToken(h.store, user.ID, auth.PurposeChangeEmail, verifyEmailExpiration)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	link := fmt.Sprintf("%s/api/v1/profile/email/confirm?token=%s", config.Envs.PublicHost, url.QueryEscape(token))
+	h.sendMail(payload.Email, "Confirm your new Suraksheet email address",
+		fmt.Sprintf("Open the link below to start using this address for your Suraksheet account:\n%s", link))
+	utils.WriteJSON(w, http.StatusAccepted, nil)
+}
+
+func (h *Handler) handleConfirmEmailChange(w http.ResponseWriter, r *http.Request) {
+	token := r.URL.Query().Get("token")
+	if token == "" {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("query parameter 'token' is required"))
+		return
+	}
+	userID, err := auth.ConsumeUserToken(h.store, auth.PurposeChangeEmail, token)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	if err := h.store.ConfirmPendingEmail(userID); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("unable to change email: %v", err))
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, map[string]string{"message": "email address changed"})
+}
+
+func (h *Handler) handleChangePassword(w http.ResponseWriter, r *http.Request) {
+	user, err := auth.ExtractUserFromContext(r)
+	if err != nil {
+		utils.WriteError(w, http.StatusForbidden, err)
+		return
+	}
+	session, err := auth.ExtractSessionFromContext(r)
+	if err != nil {
+		utils.WriteError(w, http.StatusForbidden, err)
+		return
+	}
+	var payload types.ChangePasswordPayload
+	if err := utils.ParseJSON(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	if err := utils.Validate.Struct(payload); err != nil {
+		errors := err.(validator.ValidationErrors)
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid payload %v", errors))
+		return
+	}
+	if !auth.ComparePassword(user.Password, payload.OldPassword) {
+		utils.WriteError(w, http.StatusUnauthorized, fmt.Errorf("invalid credentials"))
+		return
+	}
+	hashedPassword, err := auth.HashPassword(payload.NewPassword)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if err := h.store.UpdatePassword(user.ID, hashedPassword); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	// keep this device signed in, log out everywhere else
+	if err := h.sessionStore.RevokeOtherSessions(user.ID, session.ID); err != nil {
+		log.Printf("unable to revoke sessions after password change: %v", err)
+	}
+	utils.WriteJSON(w, http.StatusNoContent, nil)
+}
+
+func (h *Handler) handleSetupTOTP(w http.ResponseWriter, r *http.Request) {
+	user, err := auth.ExtractUserFromContext(r)
+	if err != nil {
+		utils.WriteError(w, http.StatusForbidden, err)
+		return
+	}
+	if user.TOTPEnabled {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("two-factor authentication is already enabled"))
+		return
+	}
+	secret, err := auth.GenerateTOTPSecret()
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if err := h.store.SetTOTPSecret(user.ID, secret); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, map[string]string{"secret": secret, "uri": auth.TOTPURI(secret, user.Email)})
+}
 
+func (h *Handler) handleEnableTOTP(w http.ResponseWriter, r *http.Request) {
+	user, err := auth.ExtractUserFromContext(r)
+	if err != nil {
+		utils.WriteError(w, http.StatusForbidden, err)
+		return
+	}
+	var payload types.TOTPCodePayload
+	if err := utils.ParseJSON(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	if err := utils.Validate.Struct(payload); err != nil {
+		errors := err.(validator.ValidationErrors)
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid payload %v", errors))
+		return
+	}
+	if user.TOTPEnabled {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("two-factor authentication is already enabled"))
+		return
+	}
+	if user.TOTPSecret == "" {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("two-factor authentication has not been set up"))
+		return
+	}
+	step, ok := auth.ValidateTOTP(user.TOTPSecret, payload.Code, time.Now())
+	if !ok {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid code"))
+		return
+	}
+
+	codes, err := auth.GenerateRecoveryCodes(10)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	hashed := make([]string, len(codes))
+	for i, code := range codes {
+		hashed[i] = auth.HashRecoveryCode(code)
+	}
+	if err := h.store.EnableTOTP(user.ID, step, hashed); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, map[string][]string{"recoveryCodes": codes})
+}
+
+func (h *Handler) handleDisableTOTP(w http.ResponseWriter, r *http.Request) {
+	user, err := auth.ExtractUserFromContext(r)
+	if err != nil {
+		utils.WriteError(w, http.StatusForbidden, err)
+		return
+	}
+	var payload types.DisableTOTPPayload
+	if err := utils.ParseJSON(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	if err := utils.Validate.Struct(payload); err != nil {
+		errors := err.(validator.ValidationErrors)
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid payload %v", errors))
+		return
+	}
+	if !user.TOTPEnabled {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("two-factor authentication is not enabled"))
+		return
+	}
+	if !auth.ComparePassword(user.Password, payload.Password) || !h.verifySecondFactor(user, payload.Code) {
+		utils.WriteError(w, http.StatusUnauthorized, fmt.Errorf("invalid credentials"))
+		return
+	}
+	if err := h.store.DisableTOTP(user.ID); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	utils.WriteJSON(w, http.StatusNoContent, nil)
+}
+
+// handleDeleteAccount schedules the account for deletion once the grace
+// period is over. The data is removed in the background by account.Purger.
+func (h *Handler) handleDeleteAccount(w http.ResponseWriter, r *http.Request) {
+	user, err := auth.ExtractUserFromContext(r)
+	if err != nil {
+		utils.WriteError(w, http.StatusForbidden, err)
+		return
+	}
+	session, err := auth.ExtractSessionFromContext(r)
+	if err != nil {
+		utils.WriteError(w, http.StatusForbidden, err)
+		return
+	}
+	var payload types.DeleteAccountPayload
+	if err := utils.ParseJSON(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	if err := utils.Validate.Struct(payload); err != nil {
+		errors := err.(validator.ValidationErrors)
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid payload %v", errors))
+		return
+	}
+	if !auth.ComparePassword(user.Password, payload.Password) {
+		utils.WriteError(w, http.StatusUnauthorized, fmt.Errorf("invalid credentials"))
+		return
+	}
+	if user.TOTPEnabled && !h.verifySecondFactor(user, payload.Code) {
+		utils.WriteError(w, http.StatusUnauthorized, fmt.Errorf("invalid code"))
+		return
+	}
+
+	orgs, err := h.deletionStore.SoleOwnedOrganizations(user.ID)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if len(orgs) > 0 {
+		utils.WriteError(w, http.StatusConflict, fmt.Errorf("you are the only owner of %s; make someone else an owner before deleting your account", strings.Join(orgs, ", ")))
+		return
+	}
+
+	gracePeriod := time.Second * time.Duration(config.Envs.AccountDeletionGracePeriodInSeconds)
+	deletion, err := h.deletionStore.ScheduleDeletion(types.AccountDeletion{
+		UserID:     user.ID,
+		StorageKey: user.StorageKey,
+		PurgeAt:    time.Now().UTC().Add(gracePeriod),
+	})
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("unable to schedule deletion: %v", err))
+		return
+	}
+	if err := h.sessionStore.RevokeOtherSessions(user.ID, session.ID); err != nil {
+		log.Printf("unable to revoke sessions after deletion request: %v", err)
+	}
+	h.sendMail(user.Email, "Your Suraksheet account will be deleted",
+		fmt.Sprintf("Your Suraksheet account and all of its documents will be permanently deleted on %s.\n\n"+
+			"If you change your mind, sign in and cancel the deletion before then.",
+			deletion.PurgeAt.Format(time.RFC1123)))
+	utils.WriteJSON(w, http.StatusAccepted, deletion)
+}
+
+func (h *Handler) handleGetAccountDeletion(w http.ResponseWriter, r *http.Request) {
+	user, err := auth.ExtractUserFromContext(r)
+	if err != nil {
+		utils.WriteError(w, http.StatusForbidden, err)
+		return
+	}
+	deletion, err := h.deletionStore.GetDeletionByUser(user.ID)
+	if err != nil {
+		utils.WriteError(w, http.StatusNotFound, err)
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, deletion)
+}
+
+func (h *Handler) handleCancelAccountDeletion(w http.ResponseWriter, r *http.Request) {
+	user, err := auth.ExtractUserFromContext(r)
+	if err != nil {
+		utils.WriteError(w, http.StatusForbidden, err)
+		return
+	}
+	if err := h.deletionStore.CancelDeletion(user.ID); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("unable to cancel deletion: %v", err))
+		return
+	}
+	utils.WriteJSON(w, http.StatusNoContent, nil)
 }
@@ -7,14 +7,18 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
+	"github.com/LikheKeto/Suraksheet/service/auth"
+	"github.com/LikheKeto/Suraksheet/service/limiter"
 	"github.com/LikheKeto/Suraksheet/types"
 	"github.com/go-chi/chi/v5"
 )
 
 func TestUserServiceHandlers(t *testing.T) {
 	userStore := &mockUserStore{}
-	handler := NewHandler(userStore)
+	policy := limiter.Policy{BaseDelay: time.Minute, MaxDelay: time.Hour, Window: time.Hour, LockoutThreshold: 3, LockoutDuration: time.Hour}
+	handler := NewHandler(userStore, &mockSessionStore{}, nil, &mockMailer{}, limiter.NewMemory(policy), limiter.NewMemory(policy), &mockAuditStore{})
 
 	t.Run("should fail if the user payload is invalid", func(t *testing.T) {
 		payload := types.RegisterUserPayload{
@@ -61,9 +65,123 @@ func TestUserServiceHandlers(t *testing.T) {
 			t.Errorf("expected status code %d, got %d", http.StatusBadRequest, rr.Code)
 		}
 	})
+
+	t.Run("should throttle logins after a failed attempt", func(t *testing.T) {
+		payload := types.LoginUserPayload{
+			Email:    "unknown@email.com",
+			Password: "asd",
+		}
+		router := chi.NewRouter()
+		router.HandleFunc("/login", handler.handleLogin)
+
+		for _, want := range []int{http.StatusUnauthorized, http.StatusTooManyRequests} {
+			marshalled, _ := json.Marshal(payload)
+			req, err := http.NewRequest(http.MethodPost, "/login", bytes.NewBuffer(marshalled))
+			if err != nil {
+				t.Fatal(err)
+			}
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+
+			if rr.Code != want {
+				t.Errorf("expected status code %d, got %d", want, rr.Code)
+			}
+		}
+	})
+
+	t.Run("should throttle the account whatever address the logins come from", func(t *testing.T) {
+		payload := types.LoginUserPayload{
+			Email:    "rotating@email.com",
+			Password: "asd",
+		}
+		router := chi.NewRouter()
+		router.HandleFunc("/login", handler.handleLogin)
+
+		for i, want := range []int{http.StatusUnauthorized, http.StatusTooManyRequests} {
+			marshalled, _ := json.Marshal(payload)
+			req, err := http.NewRequest(http.MethodPost, "/login", bytes.NewBuffer(marshalled))
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.RemoteAddr = fmt.Sprintf("203.0.113.%d:4000", i+1)
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+
+			if rr.Code != want {
+				t.Errorf("expected status code %d, got %d", want, rr.Code)
+			}
+		}
+	})
+}
+
+func TestLoginFailsClosed(t *testing.T) {
+	policy := limiter.Policy{BaseDelay: time.Minute, MaxDelay: time.Hour, Window: time.Hour, LockoutThreshold: 3, LockoutDuration: time.Hour}
+	tests := []struct {
+		name    string
+		limiter *mockLoginLimiter
+	}{
+		{"when the limit can't be checked", &mockLoginLimiter{retryErr: fmt.Errorf("connection refused")}},
+		{"when the failure can't be counted", &mockLoginLimiter{recordErr: fmt.Errorf("connection refused")}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := NewHandler(&mockUserStore{}, &mockSessionStore{}, nil, &mockMailer{}, limiter.NewMemory(policy), tt.limiter, &mockAuditStore{})
+			marshalled, _ := json.Marshal(types.LoginUserPayload{Email: "unknown@email.com", Password: "asd"})
+			req, err := http.NewRequest(http.MethodPost, "/login", bytes.NewBuffer(marshalled))
+			if err != nil {
+				t.Fatal(err)
+			}
+			rr := httptest.NewRecorder()
+			router := chi.NewRouter()
+			router.HandleFunc("/login", handler.handleLogin)
+			router.ServeHTTP(rr, req)
+
+			if rr.Code != http.StatusServiceUnavailable {
+				t.Errorf("expected status code %d, got %d", http.StatusServiceUnavailable, rr.Code)
+			}
+		})
+	}
+}
+
+func TestVerifySecondFactor(t *testing.T) {
+	secret, err := auth.GenerateTOTPSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, err := auth.TOTPCode(secret, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := &Handler{store: &mockUserStore{}}
+	user := &types.User{ID: 1, TOTPSecret: secret, TOTPEnabled: true}
+
+	if !handler.verifySecondFactor(user, code) {
+		t.Fatal("expected the code to be accepted")
+	}
+	if handler.verifySecondFactor(user, code) {
+		t.Error("expected the code to be rejected the second time")
+	}
+}
+
+type mockLoginLimiter struct {
+	retryErr  error
+	recordErr error
+}
+
+func (m *mockLoginLimiter) RetryAfter(key string) (time.Duration, error) {
+	return 0, m.retryErr
+}
+
+func (m *mockLoginLimiter) RecordFailure(key string) (bool, error) {
+	return false, m.recordErr
+}
+
+func (m *mockLoginLimiter) Reset(key string) error {
+	return nil
 }
 
 type mockUserStore struct {
+	totpLastStep int64
 }
 
 func (m *mockUserStore) GetUserByEmail(email string) (*types.User, error) {
@@ -74,6 +192,112 @@ func (m *mockUserStore) GetUserByID(id int) (*types.User, error) {
 	return nil, nil
 }
 
-func (m *mockUserStore) CreateUser(user types.User) error {
+func (m *mockUserStore) CreateUser(user types.User) (int, error) {
+	return 1, nil
+}
+
+func (m *mockUserStore) UpdatePassword(userID int, password string) error {
+	return nil
+}
+
+func (m *mockUserStore) SetEmailVerified(userID int) error {
+	return nil
+}
+
+func (m *mockUserStore) CreateUserToken(userID int, purpose string, token string, expiresAt time.Time) error {
+	return nil
+}
+
+func (m *mockUserStore) UseUserToken(purpose string, token string) (int, error) {
+	return 0, fmt.Errorf("invalid or expired token")
+}
+
+func (m *mockUserStore) UpdateName(userID int, firstName, lastName *string) error {
+	return nil
+}
+
+func (m *mockUserStore) SetPendingEmail(userID int, email string) error {
+	return nil
+}
+
+func (m *mockUserStore) ConfirmPendingEmail(userID int) error {
+	return nil
+}
+
+func (m *mockUserStore) SetTOTPSecret(userID int, secret string) error {
+	return nil
+}
+
+func (m *mockUserStore) EnableTOTP(userID int, step int64, recoveryCodes []string) error {
+	return nil
+}
+
+func (m *mockUserStore) DisableTOTP(userID int) error {
+	return nil
+}
+
+func (m *mockUserStore) UseRecoveryCode(userID int, code string) error {
+	return fmt.Errorf("invalid recovery code")
+}
+
+func (m *mockUserStore) UseTOTPStep(userID int, step int64) error {
+	if step <= m.totpLastStep {
+		return fmt.Errorf("code has already been used")
+	}
+	m.totpLastStep = step
+	return nil
+}
+
+type mockSessionStore struct {
+}
+
+func (m *mockSessionStore) CreateSession(session types.Session) (*types.Session, error) {
+	session.ID = 1
+	return &session, nil
+}
+
+func (m *mockSessionStore) GetSessionByID(id int) (*types.Session, error) {
+	return nil, fmt.Errorf("session not found")
+}
+
+func (m *mockSessionStore) GetSessionByRefreshToken(refreshToken string) (*types.Session, error) {
+	return nil, fmt.Errorf("session not found")
+}
+
+func (m *mockSessionStore) GetActiveSessionsByUser(userID int) ([]types.Session, error) {
+	return []types.Session{}, nil
+}
+
+func (m *mockSessionStore) RotateRefreshToken(id int, oldToken, newToken string, expiresAt time.Time) error {
+	return nil
+}
+
+func (m *mockSessionStore) TouchSession(id int) error {
+	return nil
+}
+
+func (m *mockSessionStore) RevokeSession(id int) error {
+	return nil
+}
+
+func (m *mockSessionStore) RevokeAllSessions(userID int) error {
+	return nil
+}
+
+func (m *mockSessionStore) RevokeOtherSessions(userID int, currentID int) error {
+	return nil
+}
+
+type mockMailer struct {
+}
+
+func (m *mockMailer) Send(to, subject, body string) error {
+	return nil
+}
+
+type mockAuditStore struct {
+}
+
+func (m *mockAuditStore) CreateAuditEntry(entry types.AuditEntry) error {
 	return nil
 }
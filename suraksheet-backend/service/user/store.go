@@ -1,8 +1,11 @@
 package user
 
 import (
+	"crypto/rand"
 	"database/sql"
+	"encoding/hex"
 	"fmt"
+	"time"
 
 	"github.com/LikheKeto/Suraksheet/types"
 )
@@ -54,34 +57,222 @@ func (s *Store) GetUserByID(id int) (*types.User, error) {
 	return u, nil
 }
 
-func (s *Store) CreateUser(user types.User) error {
+func (s *Store) CreateUser(user types.User) (int, error) {
+	// the prefix in MinIO is unrelated to the email address, which can change
+	// and be taken by another account
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return 0, err
+	}
+
 	tx, err := s.db.Begin()
 	if err != nil {
-		return err
+		return 0, err
 	}
 	defer tx.Rollback()
 
 	var createdId int
 	err = tx.QueryRow(`
-		INSERT INTO users (firstName, lastName, email, password)
-		VALUES ($1, $2, $3, $4)
+		INSERT INTO users (firstName, lastName, email, password, storageKey)
+		VALUES ($1, $2, $3, $4, $5)
 		RETURNING id`,
-		user.FirstName, user.LastName, user.Email, user.Password,
+		user.FirstName, user.LastName, user.Email, user.Password, hex.EncodeToString(key),
 	).Scan(&createdId)
+	if err != nil {
+		return 0, err
+	}
+
+	_, err = tx.Exec("INSERT INTO bins (name, owner, isDefault) VALUES ($1, $2, TRUE)", types.DefaultBinName, createdId)
+	if err != nil {
+		return 0, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return 0, err
+	}
+
+	return createdId, nil
+}
+
+func (s *Store) UpdatePassword(userID int, password string) error {
+	_, err := s.db.Exec("UPDATE users SET password = $1 WHERE id = $2;", password, userID)
+	return err
+}
+
+func (s *Store) SetEmailVerified(userID int) error {
+	_, err := s.db.Exec("UPDATE users SET emailVerified = TRUE WHERE id = $1;", userID)
+	return err
+}
+
+// CreateUserToken records a single-use token for the given purpose. Tokens
+// previously issued to the user for the same purpose stop working.
+func (s *Store) CreateUserToken(userID int, purpose string, token string, expiresAt time.Time) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`
+		UPDATE user_tokens SET usedAt = CURRENT_TIMESTAMP
+		WHERE userId = $1 AND purpose = $2 AND usedAt IS NULL;
+	`, userID, purpose)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(`
+		INSERT INTO user_tokens (userId, purpose, token, expiresAt)
+		VALUES ($1, $2, $3, $4);
+	`, userID, purpose, token, expiresAt)
 	if err != nil {
 		return err
 	}
+	return tx.Commit()
+}
 
-	_, err = tx.Exec("INSERT INTO bins (name, owner) VALUES ($1, $2)", "No Bin", createdId)
+// UseUserToken marks an unused, unexpired token as used and returns the ID of
+// the user it was issued to.
+func (s *Store) UseUserToken(purpose string, token string) (int, error) {
+	var userID int
+	err := s.db.QueryRow(`
+		UPDATE user_tokens SET usedAt = CURRENT_TIMESTAMP
+		WHERE purpose = $1 AND token = $2 AND usedAt IS NULL AND expiresAt > $3
+		RETURNING userId;
+	`, purpose, token, time.Now().UTC()).Scan(&userID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return 0, fmt.Errorf("invalid or expired token")
+		}
+		return 0, err
+	}
+	return userID, nil
+}
+
+// SetTOTPSecret stores a secret that is waiting for the user to confirm it
+// with a code. Two-factor authentication stays disabled until EnableTOTP.
+func (s *Store) SetTOTPSecret(userID int, secret string) error {
+	_, err := s.db.Exec("UPDATE users SET totpSecret = $1, totpEnabled = FALSE, totpLastStep = 0 WHERE id = $2;", secret, userID)
+	return err
+}
+
+// EnableTOTP turns on two-factor authentication, recording the time step of
+// the code that confirmed it, and replaces the user's recovery codes with the
+// given hashed codes.
+func (s *Store) EnableTOTP(userID int, step int64, recoveryCodes []string) error {
+	tx, err := s.db.Begin()
 	if err != nil {
 		return err
 	}
+	defer tx.Rollback()
 
-	err = tx.Commit()
+	_, err = tx.Exec("UPDATE users SET totpEnabled = TRUE, totpLastStep = $1 WHERE id = $2 AND totpSecret <> '';", step, userID)
 	if err != nil {
 		return err
 	}
+	_, err = tx.Exec("DELETE FROM recovery_codes WHERE userId = $1;", userID)
+	if err != nil {
+		return err
+	}
+	for _, code := range recoveryCodes {
+		_, err = tx.Exec("INSERT INTO recovery_codes (userId, code) VALUES ($1, $2);", userID, code)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
 
+func (s *Store) DisableTOTP(userID int) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec("UPDATE users SET totpSecret = '', totpEnabled = FALSE, totpLastStep = 0 WHERE id = $1;", userID)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec("DELETE FROM recovery_codes WHERE userId = $1;", userID)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// UseRecoveryCode marks the hashed recovery code as used, failing if it does
+// not belong to the user or was used before.
+func (s *Store) UseRecoveryCode(userID int, code string) error {
+	res, err := s.db.Exec(`
+		UPDATE recovery_codes SET usedAt = CURRENT_TIMESTAMP
+		WHERE userId = $1 AND code = $2 AND usedAt IS NULL;
+	`, userID, code)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return fmt.Errorf("invalid recovery code")
+	}
+	return nil
+}
+
+// UseTOTPStep records the time step of a TOTP code the user gave. It fails
+// for a step at or before the last one used, so a code seen by someone else
+// can't be replayed while it is still valid.
+func (s *Store) UseTOTPStep(userID int, step int64) error {
+	res, err := s.db.Exec(`
+		UPDATE users SET totpLastStep = $1
+		WHERE id = $2 AND totpLastStep < $1;
+	`, step, userID)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return fmt.Errorf("code has already been used")
+	}
+	return nil
+}
+
+// UpdateName changes the names that are not nil.
+func (s *Store) UpdateName(userID int, firstName, lastName *string) error {
+	_, err := s.db.Exec(`
+		UPDATE users SET firstName = COALESCE($1, firstName), lastName = COALESCE($2, lastName)
+		WHERE id = $3;
+	`, firstName, lastName, userID)
+	return err
+}
+
+// SetPendingEmail stores the address the user wants to switch to until they
+// prove they own it.
+func (s *Store) SetPendingEmail(userID int, email string) error {
+	_, err := s.db.Exec("UPDATE users SET pendingEmail = $1 WHERE id = $2;", email, userID)
+	return err
+}
+
+func (s *Store) ConfirmPendingEmail(userID int) error {
+	res, err := s.db.Exec(`
+		UPDATE users SET email = pendingEmail, pendingEmail = '', emailVerified = TRUE
+		WHERE id = $1 AND pendingEmail <> '';
+	`, userID)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return fmt.Errorf("no email change is pending")
+	}
 	return nil
 }
 
@@ -92,7 +283,13 @@ func scanRowIntoUser(rows *sql.Rows) (*types.User, error) {
 		&user.LastName,
 		&user.Email,
 		&user.Password,
-		&user.CreatedAt)
+		&user.CreatedAt,
+		&user.TOTPSecret,
+		&user.TOTPEnabled,
+		&user.EmailVerified,
+		&user.StorageKey,
+		&user.PendingEmail,
+		&user.TOTPLastStep)
 	if err != nil {
 		return nil, err
 	}
@@ -1,59 +1,753 @@
 package types
 
 import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
 	"time"
 )
 
 type UserStore interface {
 	GetUserByEmail(email string) (*User, error)
 	GetUserByID(id int) (*User, error)
-	CreateUser(User) error
+	CreateUser(User) (int, error)
+	UpdatePassword(userID int, password string) error
+	SetEmailVerified(userID int) error
+	CreateUserToken(userID int, purpose string, token string, expiresAt time.Time) error
+	UseUserToken(purpose string, token string) (int, error)
+	UpdateName(userID int, firstName, lastName *string) error
+	SetPendingEmail(userID int, email string) error
+	ConfirmPendingEmail(userID int) error
+	SetTOTPSecret(userID int, secret string) error
+	EnableTOTP(userID int, step int64, recoveryCodes []string) error
+	DisableTOTP(userID int) error
+	UseRecoveryCode(userID int, code string) error
+	// UseTOTPStep records the time step of a TOTP code the user gave, failing
+	// for a step no later than the last one used.
+	UseTOTPStep(userID int, step int64) error
+}
+
+type SessionStore interface {
+	CreateSession(session Session) (*Session, error)
+	GetSessionByID(id int) (*Session, error)
+	GetSessionByRefreshToken(refreshToken string) (*Session, error)
+	GetActiveSessionsByUser(userID int) ([]Session, error)
+	RotateRefreshToken(id int, oldToken, newToken string, expiresAt time.Time) error
+	TouchSession(id int) error
+	RevokeSession(id int) error
+	RevokeAllSessions(userID int) error
+	RevokeOtherSessions(userID int, currentID int) error
+}
+
+type APIKeyStore interface {
+	CreateAPIKey(key APIKey) (*APIKey, error)
+	GetAPIKeysByUser(userID int) ([]APIKey, error)
+	GetAPIKeyByID(id int) (*APIKey, error)
+	GetAPIKeyByKey(key string) (*APIKey, error)
+	TouchAPIKey(id int) error
+	RevokeAPIKey(id int) error
+}
+
+type JWTKeyStore interface {
+	GetJWTKeys() ([]JWTKey, error)
+	CreateJWTKey(key JWTKey) error
+	DeleteJWTKeysCreatedBefore(t time.Time) error
+}
+
+// LoginLimiter throttles login attempts per key, such as an IP or an account.
+type LoginLimiter interface {
+	RetryAfter(key string) (time.Duration, error)
+	// RecordFailure reports whether the failure locked the key out.
+	RecordFailure(key string) (bool, error)
+	Reset(key string) error
+}
+
+type AuditStore interface {
+	CreateAuditEntry(entry AuditEntry) error
+}
+
+type OIDCStore interface {
+	CreateLoginState(state OIDCLoginState) error
+	ConsumeLoginState(state string) (*OIDCLoginState, error)
+	GetIdentity(issuer, subject string) (*OIDCIdentity, error)
+	CreateIdentity(identity OIDCIdentity) error
+}
+
+type AccountDeletionStore interface {
+	ScheduleDeletion(deletion AccountDeletion) (*AccountDeletion, error)
+	GetDeletionByUser(userID int) (*AccountDeletion, error)
+	CancelDeletion(userID int) error
+	GetDueDeletions() ([]AccountDeletion, error)
+	ClaimDeletion(id int) error
+	UpdateDeletionProgress(id int, status, step, errMsg string) error
+	// SoleOwnedOrganizations returns the names of the organizations the user
+	// is the only owner of; the account can't be deleted while there are any.
+	SoleOwnedOrganizations(userID int) ([]string, error)
+	DeleteUser(userID int) error
+}
+
+type QuotaStore interface {
+	GetPlans() ([]Plan, error)
+	SavePlan(plan Plan) error
+	// GetUserQuota and GetOrganizationQuota return the limits, leaving Used
+	// to be filled in.
+	GetUserQuota(userID int) (*Quota, error)
+	GetOrganizationQuota(orgID int) (*Quota, error)
+	SetUserQuota(userID int, quota SetQuotaPayload) error
+	SetOrganizationQuota(orgID int, quota SetQuotaPayload) error
+}
+
+type ImportStore interface {
+	// CreateImport records the import along with the files to import from its
+	// archive.
+	CreateImport(job ImportJob, paths []string) (*ImportJob, error)
+	GetImportByID(id int) (*ImportJob, error)
+	GetImportsByUser(userID int) ([]ImportJob, error)
+	GetImportFiles(importID int) ([]ImportFile, error)
+	GetPendingImports() ([]ImportJob, error)
+	ClaimImport(id int) error
+	UpdateImportFile(id int, status, errMsg string, documentID *int) error
+	CompleteImport(id int, status string) error
+	// RetryImport queues the files of a failed or stalled import that weren't
+	// imported to be tried again.
+	RetryImport(id int) error
+}
+
+type TemplateStore interface {
+	CreateTemplate(template BinTemplate) (*BinTemplate, error)
+	GetTemplateByID(id int) (*BinTemplate, error)
+	GetTemplatesByUser(userID int) ([]BinTemplate, error)
+	UpdateTemplate(template BinTemplate) error
+	DeleteTemplate(id int) error
+}
+
+type Mailer interface {
+	Send(to, subject, body string) error
 }
 
 type BinStore interface {
 	GetBinsByUser(id int) ([]Bin, error)
-	CreateBin(name string, ownerID int) (*Bin, error)
+	GetBinsByOrganization(orgID int) ([]Bin, error)
+	// CreateBin creates a bin owned by either bin.OwnerID or bin.OrganizationID.
+	CreateBin(bin Bin) (*Bin, error)
 	GetBinById(id int) (*Bin, error)
-	UpdateBinName(id int, userID int, name string) error
-	DeleteBin(id int, userID int) error
+	UpdateBin(id int, changes EditBinPayload) error
+	MoveBin(id int, parentID *int) error
+	GetBinPath(id int) ([]Bin, error)
+	GetBinDescendantIDs(id int) ([]int, error)
+	GetChildBins(parentID int) ([]Bin, error)
+	UpdateBinQuery(id int, query SmartBinQuery) error
+	// CreateBinWithSlots creates the bin along with the slots of the
+	// template it is created from.
+	CreateBinWithSlots(bin Bin, slots []TemplateSlot) (*Bin, error)
+	GetBinSlots(binID int) ([]BinSlot, error)
+	// FillBinSlot puts the document in the slot, or empties it when
+	// documentID is nil.
+	FillBinSlot(binID, slotID int, documentID *int) (*BinSlot, error)
+	// TrashBin moves the bin, everything in it and everything nested in it
+	// to the trash.
+	TrashBin(id int, userID int) (*TrashEntry, error)
+	DeleteBin(id int) error
+}
+
+type ShareStore interface {
+	// CreateShare invites the user to the bin, or changes the role of an
+	// existing share; a declined share is pending again.
+	CreateShare(share BinShare) (*BinShare, error)
+	GetShareByID(id int) (*BinShare, error)
+	GetSharesByBin(binID int) ([]BinShare, error)
+	// GetSharesByUser leaves out the shares of bins in the trash.
+	GetSharesByUser(userID int, status string) ([]BinShare, error)
+	RespondToShare(id int, status string) error
+	DeleteShare(id int) error
+	// GetBinRoles returns the roles of the user's accepted shares on the bin
+	// and the bins above it.
+	GetBinRoles(binID int, userID int) ([]string, error)
+}
+
+type OrganizationStore interface {
+	// CreateOrganization creates the organization with the user as its owner.
+	CreateOrganization(name string, ownerID int) (*Organization, error)
+	GetOrganizationByID(id int) (*Organization, error)
+	GetOrganizationsByUser(userID int) ([]Organization, error)
+	UpdateOrganizationName(id int, name string) error
+	DeleteOrganization(id int) error
+
+	GetMember(orgID int, userID int) (*OrganizationMember, error)
+	GetMemberRole(orgID int, userID int) (string, error)
+	GetMembers(orgID int) ([]OrganizationMember, error)
+	UpdateMemberRole(orgID int, userID int, role string) error
+	RemoveMember(orgID int, userID int) error
+
+	CreateInvitation(invitation OrganizationInvitation) (*OrganizationInvitation, error)
+	GetInvitations(orgID int) ([]OrganizationInvitation, error)
+	GetInvitationByToken(token string) (*OrganizationInvitation, error)
+	// AcceptInvitation marks the invitation as used and adds the user as a member.
+	AcceptInvitation(id int, userID int) error
+	DeleteInvitation(id int) error
+
+	CreateProfile(profile ManagedProfile) (*ManagedProfile, error)
+	GetProfileByID(id int) (*ManagedProfile, error)
+	GetProfiles(orgID int) ([]ManagedProfile, error)
+	UpdateProfile(profile ManagedProfile) error
+	DeleteProfile(id int) error
+}
+
+type TrashStore interface {
+	// GetTrash returns what was deleted from the user's bins, from the bins
+	// of the given organizations and by the user themselves.
+	GetTrash(userID int, orgIDs []int) ([]TrashEntry, error)
+	GetTrashEntry(id int) (*TrashEntry, error)
+	GetExpiredTrash(before time.Time) ([]TrashEntry, error)
+	RestoreDocument(entryID int, referenceName string) error
+	// RestoreBin restores the bin with everything that was deleted along
+	// with it, renaming it if the name has been taken since. It returns the
+	// IDs of the restored documents.
+	RestoreBin(entryID int) ([]int, error)
 }
 
 type DocumentStore interface {
-	InsertDocument(doc Document) (*Document, error)
+	// InsertDocument, MoveDocuments and CopyDocuments fail with
+	// ErrQuotaExceeded if the documents don't fit into the quota of the bin's
+	// owner. A nil quota isn't checked.
+	InsertDocument(doc Document, uploadedBy int, quota *Quota) (*Document, error)
 	GetDocumentByID(id int) (*Document, error)
 	UpdateDocumentName(id int, name string) error
+	UpdateDocumentMetadata(id int, meta DocumentMetadata) (*Document, error)
 	ReferenceNameExistsInBin(name string, binID int) error
 	DeleteDocumentByID(id int) error
-	GetDocumentsInBin(binID int) ([]Document, error)
-	GetDocumentOwner(id int) (int, error)
+	// GetDocumentsInBin returns the documents in the bin that pass filter.
+	GetDocumentsInBin(binID int, filter DocumentFilter) ([]Document, error)
 	FetchDocumentsFromDB(docIDs []int) ([]*Document, error)
+	GetDocumentIDsInBins(binIDs []int) ([]int, error)
+	SetDocumentProfile(id int, profileID *int) error
+	TrashDocument(id int, userID int) (*TrashEntry, error)
+	GetReferenceNamesInBin(binID int) ([]string, error)
+	GetDocumentVersions(docID int) ([]DocumentVersion, error)
+	GetDocumentVersion(docID, version int) (*DocumentVersion, error)
+	// AddDocumentVersion makes next the current version of doc, keeping the
+	// current one under archivedKey, and drops the oldest versions beyond
+	// keep. It locks the document and fails if doc is no longer the current
+	// version; otherwise write stores the objects of both versions while the
+	// lock is held, and undo puts them back if next can't be recorded. It
+	// returns the object keys of the dropped versions.
+	AddDocumentVersion(doc Document, archivedKey string, next Document, uploadedBy int, quota *Quota, keep int, write func() error, undo func()) (*Document, []string, error)
+	// GetVersionObjectKeys returns the object keys of the older versions of
+	// the documents.
+	GetVersionObjectKeys(docIDs []int) ([]string, error)
+	// GetDocumentPages returns the pages in order, none for documents of a
+	// single file.
+	GetDocumentPages(docID int) ([]DocumentPage, error)
+	// AddDocumentPages appends the pages to the document, making its own file
+	// the first page if it had none.
+	AddDocumentPages(doc Document, pages []DocumentPage, quota *Quota) ([]DocumentPage, error)
+	// ReorderDocumentPages puts the pages in the order of pageIDs, which has
+	// to list every page of the document.
+	ReorderDocumentPages(docID int, pageIDs []int) ([]DocumentPage, error)
+	RemoveDocumentPage(docID, pageID int) error
+	// GetPageObjectKeys returns the object keys of the documents' pages
+	// besides their own files.
+	GetPageObjectKeys(docIDs []int) ([]string, error)
+	// GetDocumentStats adds up the live documents in the bins.
+	GetDocumentStats(binIDs []int) (*DocumentStats, error)
+	// GetStorageUsage adds up the documents of the user, or of the
+	// organization if orgID is set, the trash included.
+	GetStorageUsage(userID int, orgID *int) (*QuotaUsage, error)
+	GetDocumentsWithoutSize(limit int) ([]Document, error)
+	SetDocumentSize(id int, size int64, contentType string) error
+	// MoveDocuments sets the bin, reference name and profile of every
+	// document, all or nothing. moveObject, if set, is called with the object
+	// of every page and older version of the documents and returns where it
+	// is kept now.
+	MoveDocuments(docs []Document, quota *Quota, moveObject func(docID int, objectKey string) (string, error)) error
+	// CopyDocuments inserts copies of the documents, all or nothing, along
+	// with their pages. copyPage copies the object of a page for the copy
+	// with docID and returns the key of the new object.
+	CopyDocuments(docs []Document, quota *Quota, copyPage func(docID int, objectKey string) (string, error)) ([]Document, error)
+	GetDocumentsByProfile(profileID int, filter DocumentFilter) ([]Document, error)
 }
 
 type User struct {
+	ID            int       `json:"id"`
+	FirstName     string    `json:"firstName"`
+	LastName      string    `json:"lastName"`
+	Email         string    `json:"email"`
+	Password      string    `json:"-"`
+	CreatedAt     time.Time `json:"createdAt"`
+	TOTPSecret    string    `json:"-"`
+	TOTPEnabled   bool      `json:"totpEnabled"`
+	EmailVerified bool      `json:"emailVerified"`
+	StorageKey    string    `json:"-"`
+	PendingEmail  string    `json:"pendingEmail,omitempty"`
+	TOTPLastStep  int64     `json:"-"`
+}
+
+type Session struct {
+	ID           int        `json:"id"`
+	UserID       int        `json:"user"`
+	RefreshToken string     `json:"-"`
+	ExpiresAt    time.Time  `json:"expiresAt"`
+	RevokedAt    *time.Time `json:"revokedAt"`
+	CreatedAt    time.Time  `json:"createdAt"`
+	UserAgent    string     `json:"userAgent"`
+	IPAddress    string     `json:"ipAddress"`
+	LastSeenAt   time.Time  `json:"lastSeenAt"`
+	Current      bool       `json:"current"`
+}
+
+// Active reports whether the session can still be used to authenticate requests.
+func (s *Session) Active() bool {
+	return s.RevokedAt == nil && time.Now().Before(s.ExpiresAt)
+}
+
+// JWTKey is a token signing key as stored, with its private key encrypted.
+type JWTKey struct {
+	ID         string
+	Algorithm  string
+	PrivateKey []byte
+	CreatedAt  time.Time
+}
+
+type AuditEntry struct {
+	ID        int       `json:"id"`
+	UserID    *int      `json:"user"`
+	Event     string    `json:"event"`
+	Detail    string    `json:"detail"`
+	IPAddress string    `json:"ipAddress"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+type OIDCLoginState struct {
+	State        string
+	CodeVerifier string
+	Nonce        string
+	ExpiresAt    time.Time
+}
+
+type OIDCIdentity struct {
 	ID        int       `json:"id"`
-	FirstName string    `json:"firstName"`
-	LastName  string    `json:"lastName"`
+	UserID    int       `json:"user"`
+	Issuer    string    `json:"issuer"`
+	Subject   string    `json:"subject"`
 	Email     string    `json:"email"`
-	Password  string    `json:"password"`
 	CreatedAt time.Time `json:"createdAt"`
 }
 
+const (
+	APIKeyScopeRead   = "read"
+	APIKeyScopeUpload = "upload"
+	APIKeyScopeFull   = "full"
+)
+
+type APIKey struct {
+	ID         int        `json:"id"`
+	UserID     int        `json:"user"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Key        string     `json:"-"`
+	Scope      string     `json:"scope"`
+	ExpiresAt  *time.Time `json:"expiresAt"`
+	LastUsedAt *time.Time `json:"lastUsedAt"`
+	RevokedAt  *time.Time `json:"revokedAt"`
+	CreatedAt  time.Time  `json:"createdAt"`
+}
+
+// Active reports whether the key can still be used to authenticate requests.
+func (k *APIKey) Active() bool {
+	return k.RevokedAt == nil && (k.ExpiresAt == nil || time.Now().Before(*k.ExpiresAt))
+}
+
+// Allows reports whether the key may be used on a route that needs scope.
+func (k *APIKey) Allows(scope string) bool {
+	return k.Scope == APIKeyScopeFull || k.Scope == scope
+}
+
+type AccountDeletion struct {
+	ID          int        `json:"id"`
+	UserID      int        `json:"user"`
+	StorageKey  string     `json:"-"`
+	Status      string     `json:"status"`
+	Step        string     `json:"step"`
+	Error       string     `json:"error,omitempty"`
+	Attempts    int        `json:"attempts"`
+	PurgeAt     time.Time  `json:"purgeAt"`
+	CreatedAt   time.Time  `json:"createdAt"`
+	CompletedAt *time.Time `json:"completedAt"`
+	ClaimedAt   *time.Time `json:"-"`
+}
+
+// DefaultBinName is the name of the bin every user starts with. No other bin
+// can take it, so it always means that one.
+const DefaultBinName = "No Bin"
+
 type Bin struct {
 	ID        int       `json:"id"`
 	Name      string    `json:"name"`
-	OwnerID   int       `json:"owner"`
+	OwnerID   int       `json:"owner,omitempty"`
 	CreatedAt time.Time `json:"createdAt"`
+	ParentID  *int      `json:"parent"`
+	// OrganizationID is set instead of OwnerID for bins owned by an organization
+	OrganizationID *int       `json:"organization,omitempty"`
+	DeletedAt      *time.Time `json:"deletedAt,omitempty"`
+	// Query is set for smart bins, which hold the documents matching it
+	// instead of their own
+	Query *SmartBinQuery `json:"query,omitempty"`
+	// IsDefault marks the bin every user starts with, which can't be
+	// renamed, moved, archived or deleted
+	IsDefault   bool   `json:"isDefault"`
+	Description string `json:"description"`
+	Color       string `json:"color"`
+	Icon        string `json:"icon"`
+	Pinned      bool   `json:"pinned"`
+	Position    int    `json:"position"`
+	Archived    bool   `json:"archived"`
+}
+
+func (b *Bin) IsSmart() bool {
+	return b.Query != nil
+}
+
+// SmartBinQuery picks the documents of a smart bin: those whose extracted text
+// matches Text, narrowed down by language and upload date.
+type SmartBinQuery struct {
+	Text          string     `json:"text" validate:"required,max=255"`
+	Language      string     `json:"language,omitempty" validate:"omitempty,oneof=eng nep"`
+	CreatedAfter  *time.Time `json:"createdAfter,omitempty"`
+	CreatedBefore *time.Time `json:"createdBefore,omitempty"`
+}
+
+const (
+	RoleViewer   = "viewer"
+	RoleUploader = "uploader"
+	RoleEditor   = "editor"
+	RoleOwner    = "owner"
+
+	ShareStatusPending  = "pending"
+	ShareStatusAccepted = "accepted"
+	ShareStatusDeclined = "declined"
+)
+
+const (
+	OrgRoleOwner  = "owner"
+	OrgRoleAdmin  = "admin"
+	OrgRoleMember = "member"
+)
+
+// BinTemplate lists the documents a recurring process needs, so that bins can
+// be created with a slot waiting for each of them.
+type BinTemplate struct {
+	ID          int            `json:"id"`
+	OwnerID     int            `json:"owner"`
+	Name        string         `json:"name"`
+	Description string         `json:"description"`
+	Slots       []TemplateSlot `json:"slots"`
+	CreatedAt   time.Time      `json:"createdAt"`
+}
+
+type TemplateSlot struct {
+	Name        string `json:"name" validate:"required,max=100"`
+	Description string `json:"description" validate:"max=1000"`
+	Required    bool   `json:"required"`
+}
+
+// BinSlot is a document a bin created from a template is expected to hold.
+// DocumentID is nil until a document in the bin fills it.
+type BinSlot struct {
+	ID          int    `json:"id"`
+	BinID       int    `json:"bin"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Required    bool   `json:"required"`
+	Position    int    `json:"position"`
+	DocumentID  *int   `json:"document"`
+}
+
+// BinSlots lists the slots of a bin created from a template and the names of
+// the required ones still empty.
+type BinSlots struct {
+	Slots   []BinSlot `json:"slots"`
+	Missing []string  `json:"missing"`
+}
+
+// MissingSlots returns the names of the required slots with no document.
+func MissingSlots(slots []BinSlot) []string {
+	missing := make([]string, 0)
+	for _, slot := range slots {
+		if slot.Required && slot.DocumentID == nil {
+			missing = append(missing, slot.Name)
+		}
+	}
+	return missing
+}
+
+// Organization is a household or other group whose members share its bins.
+type Organization struct {
+	ID         int       `json:"id"`
+	Name       string    `json:"name"`
+	StorageKey string    `json:"-"`
+	CreatedAt  time.Time `json:"createdAt"`
+	// Role is the role of the user the organization was looked up for
+	Role string `json:"role,omitempty"`
+}
+
+type OrganizationMember struct {
+	OrganizationID int       `json:"organization"`
+	UserID         int       `json:"user"`
+	Role           string    `json:"role"`
+	CreatedAt      time.Time `json:"createdAt"`
+	FirstName      string    `json:"firstName"`
+	LastName       string    `json:"lastName"`
+	Email          string    `json:"email"`
+}
+
+type OrganizationInvitation struct {
+	ID             int        `json:"id"`
+	OrganizationID int        `json:"organization"`
+	Email          string     `json:"email"`
+	Role           string     `json:"role"`
+	Token          string     `json:"-"`
+	InvitedBy      *int       `json:"invitedBy"`
+	ExpiresAt      time.Time  `json:"expiresAt"`
+	AcceptedAt     *time.Time `json:"acceptedAt"`
+	CreatedAt      time.Time  `json:"createdAt"`
+}
+
+// ManagedProfile is a person in an organization who doesn't have a login of
+// their own, such as a child. Documents can be filed under them.
+type ManagedProfile struct {
+	ID             int       `json:"id"`
+	OrganizationID int       `json:"organization"`
+	Name           string    `json:"name"`
+	Relationship   string    `json:"relationship"`
+	CreatedAt      time.Time `json:"createdAt"`
+}
+
+// BinShare gives a user access to a bin and every bin nested in it once they
+// accept it.
+type BinShare struct {
+	ID          int        `json:"id"`
+	BinID       int        `json:"bin"`
+	UserID      int        `json:"user"`
+	Role        string     `json:"role"`
+	Status      string     `json:"status"`
+	InvitedBy   *int       `json:"invitedBy"`
+	CreatedAt   time.Time  `json:"createdAt"`
+	RespondedAt *time.Time `json:"respondedAt"`
 }
 
 type Document struct {
-	ID            int       `json:"id"`
-	Name          string    `json:"name"`
-	ReferenceName string    `json:"referenceName"`
-	BinID         int       `json:"bin"`
-	Url           string    `json:"url"`
-	Extract       string    `json:"extract"`
-	CreatedAt     time.Time `json:"createdAt"`
-	Language      string    `json:"language"`
+	ID            int        `json:"id"`
+	Name          string     `json:"name"`
+	ReferenceName string     `json:"referenceName"`
+	BinID         int        `json:"bin"`
+	Url           string     `json:"url"`
+	Extract       string     `json:"extract"`
+	CreatedAt     time.Time  `json:"createdAt"`
+	Language      string     `json:"language"`
+	ProfileID     *int       `json:"profile"`
+	DeletedAt     *time.Time `json:"deletedAt,omitempty"`
+	// Size is the size of the document's object in bytes, nil until known
+	Size             *int64 `json:"size"`
+	ContentType      string `json:"contentType"`
+	ExtractionStatus string `json:"extractionStatus"`
+	// Version is the number of the current version, counting from 1
+	Version int `json:"version"`
+	DocumentMetadata
+}
+
+// DocumentMetadata describes what a document is and who it belongs to. Its
+// owner fills it in; empty fields are unknown.
+type DocumentMetadata struct {
+	// DocumentType is one of the configured document types
+	DocumentType   string     `json:"documentType"`
+	Issuer         string     `json:"issuer"`
+	DocumentNumber string     `json:"documentNumber"`
+	IssueDate      *time.Time `json:"issueDate"`
+	ExpiryDate     *time.Time `json:"expiryDate"`
+	HolderName     string     `json:"holderName"`
+}
+
+// Validate reports metadata that doesn't make sense: a type that isn't one of
+// documentTypes, or a document that expires before it was issued.
+func (m DocumentMetadata) Validate(documentTypes []string) error {
+	if m.DocumentType != "" && !slices.Contains(documentTypes, m.DocumentType) {
+		return fmt.Errorf("unknown document type %s", m.DocumentType)
+	}
+	if m.IssueDate != nil && m.ExpiryDate != nil && m.ExpiryDate.Before(*m.IssueDate) {
+		return fmt.Errorf("document expires before it is issued")
+	}
+	return nil
+}
+
+// DocumentFilter narrows a listing of documents down by their metadata. The
+// type matches exactly, issuer and holder name match any part of the
+// document's ignoring case, and the document number matches ignoring case.
+// Documents without an expiry date don't pass a filter on it. Empty fields
+// don't filter.
+type DocumentFilter struct {
+	DocumentType   string
+	Issuer         string
+	HolderName     string
+	DocumentNumber string
+	ExpiresAfter   *time.Time
+	ExpiresBefore  *time.Time
+}
+
+// DocumentPage is one of the files a document is made of. Page counts from 1;
+// the page with an empty ObjectKey is the document's own file.
+type DocumentPage struct {
+	ID               int       `json:"id"`
+	DocumentID       int       `json:"document"`
+	Page             int       `json:"page"`
+	Name             string    `json:"name"`
+	Size             *int64    `json:"size"`
+	ContentType      string    `json:"contentType"`
+	Extract          string    `json:"extract"`
+	ExtractionStatus string    `json:"extractionStatus"`
+	CreatedAt        time.Time `json:"createdAt"`
+	ObjectKey        string    `json:"-"`
+}
+
+// DocumentVersion is a file that was uploaded as a document. The current
+// version is the document itself; older ones keep their own object and the
+// text extracted from it.
+type DocumentVersion struct {
+	ID          int       `json:"id"`
+	DocumentID  int       `json:"document"`
+	Version     int       `json:"version"`
+	Name        string    `json:"name"`
+	Size        *int64    `json:"size"`
+	ContentType string    `json:"contentType"`
+	Language    string    `json:"language"`
+	Extract     string    `json:"extract"`
+	UploadedBy  *int      `json:"uploadedBy"`
+	CreatedAt   time.Time `json:"createdAt"`
+	Current     bool      `json:"current"`
+	// ObjectKey is where an older version's object is kept, empty for the
+	// current version
+	ObjectKey string `json:"-"`
+}
+
+// ErrQuotaExceeded is returned when storing documents would take a user or
+// organization over their quota.
+var ErrQuotaExceeded = errors.New("storage quota exceeded")
+
+type Plan struct {
+	Name string `json:"name"`
+	// MaxBytes and MaxDocuments are nil when unlimited
+	MaxBytes     *int64 `json:"maxBytes"`
+	MaxDocuments *int   `json:"maxDocuments"`
+}
+
+// Quota is what a user or organization may store, and how much of it they
+// use. Documents in the trash count until they are purged.
+type Quota struct {
+	Plan         string     `json:"plan"`
+	MaxBytes     *int64     `json:"maxBytes"`
+	MaxDocuments *int       `json:"maxDocuments"`
+	Used         QuotaUsage `json:"used"`
+}
+
+type QuotaUsage struct {
+	Documents int   `json:"documents"`
+	Bytes     int64 `json:"bytes"`
+}
+
+// Exceeded reports whether going from before to after breaks the quota.
+// Changes that don't add anything are fine even over the limit, so lowering
+// a quota doesn't stop people from tidying up.
+func (q *Quota) Exceeded(before, after QuotaUsage) bool {
+	if q.MaxBytes != nil && after.Bytes > *q.MaxBytes && after.Bytes > before.Bytes {
+		return true
+	}
+	if q.MaxDocuments != nil && after.Documents > *q.MaxDocuments && after.Documents > before.Documents {
+		return true
+	}
+	return false
+}
+
+const (
+	ExtractionPending   = "pending"
+	ExtractionCompleted = "completed"
+	ExtractionEmpty     = "empty"
+	ExtractionFailed    = "failed"
+)
+
+// DocumentStats adds up the documents of a bin or a user.
+type DocumentStats struct {
+	Documents          int                    `json:"documents"`
+	Bytes              int64                  `json:"bytes"`
+	ContentTypes       map[string]*UsageCount `json:"contentTypes"`
+	Languages          map[string]int         `json:"languages"`
+	ExtractionStatuses map[string]int         `json:"extractionStatuses"`
+}
+
+type UsageCount struct {
+	Documents int   `json:"documents"`
+	Bytes     int64 `json:"bytes"`
+}
+
+func NewDocumentStats() *DocumentStats {
+	return &DocumentStats{
+		ContentTypes:       map[string]*UsageCount{},
+		Languages:          map[string]int{},
+		ExtractionStatuses: map[string]int{},
+	}
+}
+
+// Add counts documents that share a content type, language and extraction
+// status.
+func (s *DocumentStats) Add(contentType, language, extractionStatus string, documents int, bytes int64) {
+	s.Documents += documents
+	s.Bytes += bytes
+	if s.ContentTypes[contentType] == nil {
+		s.ContentTypes[contentType] = &UsageCount{}
+	}
+	s.ContentTypes[contentType].Documents += documents
+	s.ContentTypes[contentType].Bytes += bytes
+	s.Languages[language] += documents
+	s.ExtractionStatuses[extractionStatus] += documents
+}
+
+// ImportJob unpacks an archive into the bin, creating a bin for every
+// directory in it.
+type ImportJob struct {
+	ID          int          `json:"id"`
+	UserID      int          `json:"user"`
+	BinID       int          `json:"bin"`
+	Name        string       `json:"name"`
+	ArchiveKey  string       `json:"-"`
+	Language    string       `json:"language"`
+	Status      string       `json:"status"`
+	CreatedAt   time.Time    `json:"createdAt"`
+	CompletedAt *time.Time   `json:"completedAt"`
+	ClaimedAt   *time.Time   `json:"-"`
+	Files       []ImportFile `json:"files,omitempty"`
+}
+
+type ImportFile struct {
+	ID         int    `json:"id"`
+	ImportID   int    `json:"import"`
+	Path       string `json:"path"`
+	Status     string `json:"status"`
+	Error      string `json:"error,omitempty"`
+	DocumentID *int   `json:"document"`
+}
+
+// TrashEntry is a document or bin that was deleted and can still be restored.
+type TrashEntry struct {
+	ID         int  `json:"id"`
+	DocumentID *int `json:"document"`
+	// Bin is the deleted bin, or the bin the deleted document is in
+	Bin       Bin       `json:"bin"`
+	Name      string    `json:"name"`
+	DeletedBy *int      `json:"deletedBy"`
+	DeletedAt time.Time `json:"deletedAt"`
+	// InTrashedBin is set when the bin around the entry was deleted too and
+	// has to be restored first
+	InTrashedBin bool      `json:"inTrashedBin"`
+	PurgeAt      time.Time `json:"purgeAt"`
 }
 
 type RegisterUserPayload struct {
@@ -68,20 +762,217 @@ type LoginUserPayload struct {
 	Password string `json:"password" validate:"required"`
 }
 
+type LoginTOTPPayload struct {
+	Challenge string `json:"challenge" validate:"required"`
+	Code      string `json:"code" validate:"required"`
+}
+
+type TOTPCodePayload struct {
+	Code string `json:"code" validate:"required"`
+}
+
+type DisableTOTPPayload struct {
+	Password string `json:"password" validate:"required"`
+	Code     string `json:"code" validate:"required"`
+}
+
+type ForgotPasswordPayload struct {
+	Email string `json:"email" validate:"required,email"`
+}
+
+type ResetPasswordPayload struct {
+	Token    string `json:"token" validate:"required"`
+	Password string `json:"password" validate:"required,min=3,max=120"`
+}
+
+type UpdateProfilePayload struct {
+	FirstName *string `json:"firstName" validate:"omitempty,min=1,max=255"`
+	LastName  *string `json:"lastName" validate:"omitempty,min=1,max=255"`
+}
+
+type ChangeEmailPayload struct {
+	Email    string `json:"email" validate:"required,email"`
+	Password string `json:"password" validate:"required"`
+}
+
+type ChangePasswordPayload struct {
+	OldPassword string `json:"oldPassword" validate:"required"`
+	NewPassword string `json:"newPassword" validate:"required,min=3,max=120"`
+}
+
+type DeleteAccountPayload struct {
+	Password string `json:"password" validate:"required"`
+	Code     string `json:"code"`
+}
+
+type CreateAPIKeyPayload struct {
+	Name      string     `json:"name" validate:"required,min=1,max=100"`
+	Scope     string     `json:"scope" validate:"required,oneof=read upload full"`
+	ExpiresAt *time.Time `json:"expiresAt"`
+}
+
+type RefreshTokenPayload struct {
+	RefreshToken string `json:"refreshToken" validate:"required"`
+}
+
 type CreateBinPayload struct {
-	Name string `json:"name" validate:"required,min=3,max=100"`
+	Name         string `json:"name" validate:"required,min=3,max=100"`
+	Parent       *int   `json:"parent"`
+	Organization *int   `json:"organization"`
+	// Query makes the new bin a smart bin
+	Query *SmartBinQuery `json:"query" validate:"omitempty"`
+	// Template gives the new bin a slot for each document the template lists
+	Template *int `json:"template" validate:"excluded_with=Query"`
+}
+
+// TemplatePayload creates or replaces a template. Exported templates have the
+// same shape, so they can be created again as they are.
+type TemplatePayload struct {
+	Name        string         `json:"name" validate:"required,min=3,max=100"`
+	Description string         `json:"description" validate:"max=1000"`
+	Slots       []TemplateSlot `json:"slots" validate:"required,min=1,max=100,unique=Name,dive"`
+}
+
+type FillSlotPayload struct {
+	Document *int `json:"document"`
+}
+
+type MoveBinPayload struct {
+	Id     int  `json:"id" validate:"required"`
+	Parent *int `json:"parent"`
 }
 
+// EditBinPayload changes the fields that are set and leaves the rest alone.
 type EditBinPayload struct {
-	Id   int    `json:"id" validate:"required"`
-	Name string `json:"name" validate:"required,min=3,max=100"`
+	Id          int     `json:"id" validate:"required"`
+	Name        *string `json:"name" validate:"omitnil,min=3,max=100"`
+	Description *string `json:"description" validate:"omitnil,max=1000"`
+	Color       *string `json:"color" validate:"omitnil,hexcolor|eq="`
+	Icon        *string `json:"icon" validate:"omitnil,max=64"`
+	Pinned      *bool   `json:"pinned"`
+	Position    *int    `json:"position"`
+	Archived    *bool   `json:"archived"`
 }
 
 type DeleteBinDocPayload struct {
 	Id int `json:"id" validate:"required"`
 }
 
+type OrganizationPayload struct {
+	Name string `json:"name" validate:"required,min=1,max=255"`
+}
+
+type InviteMemberPayload struct {
+	Email string `json:"email" validate:"required,email"`
+	Role  string `json:"role" validate:"required,oneof=admin member"`
+}
+
+type AcceptInvitationPayload struct {
+	Token string `json:"token" validate:"required"`
+}
+
+type UpdateMemberPayload struct {
+	Role string `json:"role" validate:"required,oneof=owner admin member"`
+}
+
+// SetQuotaPayload puts a user or organization on a plan. MaxBytes and
+// MaxDocuments override the plan's limits when set.
+type SetQuotaPayload struct {
+	Plan         string `json:"plan" validate:"required,max=32"`
+	MaxBytes     *int64 `json:"maxBytes" validate:"omitempty,min=0"`
+	MaxDocuments *int   `json:"maxDocuments" validate:"omitempty,min=0"`
+}
+
+type PlanPayload struct {
+	MaxBytes     *int64 `json:"maxBytes" validate:"omitempty,min=0"`
+	MaxDocuments *int   `json:"maxDocuments" validate:"omitempty,min=0"`
+}
+
+type ProfilePayload struct {
+	Name         string `json:"name" validate:"required,min=1,max=255"`
+	Relationship string `json:"relationship" validate:"max=64"`
+}
+
+const (
+	ConflictFail   = "fail"
+	ConflictRename = "rename"
+)
+
+// TransferDocumentPayload moves or copies one document into another bin.
+// OnConflict decides what happens when the bin already has a document with
+// the same reference name: fail (the default) or rename the new one.
+type TransferDocumentPayload struct {
+	Bin        int    `json:"bin" validate:"required"`
+	OnConflict string `json:"onConflict" validate:"omitempty,oneof=fail rename"`
+}
+
+type TransferDocumentsPayload struct {
+	Ids        []int  `json:"ids" validate:"required,min=1,max=100,dive,required"`
+	Bin        int    `json:"bin" validate:"required"`
+	OnConflict string `json:"onConflict" validate:"omitempty,oneof=fail rename"`
+}
+
+type ReorderPagesPayload struct {
+	Pages []int `json:"pages" validate:"required,min=1,unique"`
+}
+
+type SetDocumentProfilePayload struct {
+	Id      int  `json:"id" validate:"required"`
+	Profile *int `json:"profile"`
+}
+
+type ShareBinPayload struct {
+	Email string `json:"email" validate:"required,email"`
+	Role  string `json:"role" validate:"required,oneof=viewer uploader editor"`
+}
+
+// EditDocumentPayload renames a document and fills in its metadata. Fields
+// left out are kept as they are; an empty string empties a field, and Clear
+// names the dates to empty.
 type EditDocumentPayload struct {
-	Id            int    `json:"id" validate:"required"`
-	ReferenceName string `json:"referenceName" validate:"required"`
+	Id             int        `json:"id" validate:"required"`
+	ReferenceName  *string    `json:"referenceName" validate:"omitnil,min=1"`
+	DocumentType   *string    `json:"documentType" validate:"omitnil,max=64"`
+	Issuer         *string    `json:"issuer" validate:"omitnil,max=255"`
+	DocumentNumber *string    `json:"documentNumber" validate:"omitnil,max=100"`
+	IssueDate      *time.Time `json:"issueDate"`
+	ExpiryDate     *time.Time `json:"expiryDate"`
+	HolderName     *string    `json:"holderName" validate:"omitnil,max=255"`
+	Clear          []string   `json:"clear" validate:"dive,oneof=issueDate expiryDate"`
+}
+
+// EditsMetadata reports whether the payload changes any metadata.
+func (p EditDocumentPayload) EditsMetadata() bool {
+	return p.DocumentType != nil || p.Issuer != nil || p.DocumentNumber != nil ||
+		p.IssueDate != nil || p.ExpiryDate != nil || p.HolderName != nil || len(p.Clear) > 0
+}
+
+// ApplyTo returns meta with the payload's changes.
+func (p EditDocumentPayload) ApplyTo(meta DocumentMetadata) DocumentMetadata {
+	set := func(field *string, value *string) {
+		if value != nil {
+			*field = strings.TrimSpace(*value)
+		}
+	}
+	set(&meta.DocumentType, p.DocumentType)
+	set(&meta.Issuer, p.Issuer)
+	set(&meta.DocumentNumber, p.DocumentNumber)
+	set(&meta.HolderName, p.HolderName)
+	if slices.Contains(p.Clear, "issueDate") {
+		meta.IssueDate = nil
+	} else if p.IssueDate != nil {
+		meta.IssueDate = dateOf(*p.IssueDate)
+	}
+	if slices.Contains(p.Clear, "expiryDate") {
+		meta.ExpiryDate = nil
+	} else if p.ExpiryDate != nil {
+		meta.ExpiryDate = dateOf(*p.ExpiryDate)
+	}
+	return meta
+}
+
+// dateOf drops the time of day, which the dates of a document don't have.
+func dateOf(t time.Time) *time.Time {
+	date := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	return &date
 }
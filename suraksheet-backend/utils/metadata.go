@@ -0,0 +1,50 @@
+package utils
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/LikheKeto/Suraksheet/config"
+	"github.com/LikheKeto/Suraksheet/types"
+)
+
+// DocumentTypes returns the types a document can be given, in the configured
+// order.
+func DocumentTypes() []string {
+	documentTypes := make([]string, 0)
+	for _, documentType := range strings.Split(config.Envs.DocumentTypes, ",") {
+		if documentType = strings.TrimSpace(documentType); documentType != "" {
+			documentTypes = append(documentTypes, documentType)
+		}
+	}
+	return documentTypes
+}
+
+// ParseDocumentFilter reads a DocumentFilter from the type, issuer, holder,
+// number, expiresAfter and expiresBefore query parameters. Dates are given
+// like 2024-12-31.
+func ParseDocumentFilter(query url.Values) (types.DocumentFilter, error) {
+	filter := types.DocumentFilter{
+		DocumentType:   query.Get("type"),
+		Issuer:         query.Get("issuer"),
+		HolderName:     query.Get("holder"),
+		DocumentNumber: query.Get("number"),
+	}
+	for param, date := range map[string]**time.Time{
+		"expiresAfter":  &filter.ExpiresAfter,
+		"expiresBefore": &filter.ExpiresBefore,
+	} {
+		value := query.Get(param)
+		if value == "" {
+			continue
+		}
+		t, err := time.Parse(time.DateOnly, value)
+		if err != nil {
+			return filter, fmt.Errorf("invalid %s %s", param, value)
+		}
+		*date = &t
+	}
+	return filter, nil
+}
@@ -0,0 +1,78 @@
+package utils
+
+import (
+	"encoding/json"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/LikheKeto/Suraksheet/types"
+)
+
+func TestParseDocumentFilter(t *testing.T) {
+	query, _ := url.ParseQuery("type=passport&holder=SITA&number=27-01-74-0512&expiresBefore=2031-01-01")
+	filter, err := ParseDocumentFilter(query)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expiresBefore := time.Date(2031, 1, 1, 0, 0, 0, 0, time.UTC)
+	want := types.DocumentFilter{DocumentType: "passport", HolderName: "SITA", DocumentNumber: "27-01-74-0512", ExpiresBefore: &expiresBefore}
+	if filter.ExpiresBefore == nil || !filter.ExpiresBefore.Equal(expiresBefore) {
+		t.Fatalf("expected expiresBefore %v, got %v", expiresBefore, filter.ExpiresBefore)
+	}
+	filter.ExpiresBefore = want.ExpiresBefore
+	if filter != want {
+		t.Errorf("expected %+v, got %+v", want, filter)
+	}
+
+	if _, err := ParseDocumentFilter(url.Values{"expiresBefore": {"next year"}}); err == nil {
+		t.Error("expected an error for an invalid date")
+	}
+}
+
+func TestMetadataFilters(t *testing.T) {
+	b, err := json.Marshal(MetadataFilters(types.DocumentFilter{DocumentNumber: "27-01-74-0512", Issuer: "passports"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		`{"term":{"document_number.keyword":{"case_insensitive":true,"value":"27-01-74-0512"}}}`,
+		`{"match":{"issuer":{"operator":"and","query":"passports"}}}`,
+	} {
+		if !strings.Contains(string(b), want) {
+			t.Errorf("expected %s in %s", want, b)
+		}
+	}
+}
+
+func TestEditDocumentMetadata(t *testing.T) {
+	issued := time.Date(2020, 6, 1, 15, 4, 5, 0, time.UTC)
+	expires := time.Date(2019, 6, 1, 0, 0, 0, 0, time.UTC)
+	meta := types.DocumentMetadata{Issuer: "DoTM", ExpiryDate: &expires}
+	documentTypes := []string{"passport", "driving_license"}
+
+	documentType, holder := "driving_license", " Ram Thapa "
+	payload := types.EditDocumentPayload{DocumentType: &documentType, HolderName: &holder, IssueDate: &issued}
+	edited := payload.ApplyTo(meta)
+	if edited.HolderName != "Ram Thapa" || edited.Issuer != "DoTM" || edited.IssueDate.Hour() != 0 {
+		t.Errorf("unexpected metadata %+v", edited)
+	}
+	if err := edited.Validate(documentTypes); err == nil {
+		t.Error("expected an error for a document that expires before it is issued")
+	}
+
+	payload = types.EditDocumentPayload{Clear: []string{"expiryDate"}}
+	if edited = payload.ApplyTo(edited); edited.ExpiryDate != nil {
+		t.Error("expected the expiry date to be cleared")
+	}
+	if err := edited.Validate(documentTypes); err != nil {
+		t.Error(err)
+	}
+
+	documentType = "library_card"
+	payload = types.EditDocumentPayload{DocumentType: &documentType}
+	if err := payload.ApplyTo(edited).Validate(documentTypes); err == nil {
+		t.Error("expected an error for an unknown document type")
+	}
+}
@@ -3,8 +3,12 @@ package utils
 import (
 	"context"
 	"fmt"
+	"io"
 	"log"
 	"mime/multipart"
+	"path"
+	"strconv"
+	"strings"
 
 	"github.com/LikheKeto/Suraksheet/config"
 	"github.com/minio/minio-go/v7"
@@ -19,6 +23,23 @@ var allowedContentTypes = map[string]bool{
 	"application/vnd.openxmlformats-officedocument.wordprocessingml.document": true,
 }
 
+// contentTypesByExtension maps the extensions of allowed files to their
+// content types, for files that come without one.
+var contentTypesByExtension = map[string]string{
+	".jpg":  "image/jpeg",
+	".jpeg": "image/jpeg",
+	".png":  "image/png",
+	".gif":  "image/gif",
+	".pdf":  "application/pdf",
+	".docx": "application/vnd.openxmlformats-officedocument.wordprocessingml.document",
+}
+
+// ContentTypeByExtension returns the content type of the file, or "" if files
+// like it are not allowed.
+func ContentTypeByExtension(filename string) string {
+	return contentTypesByExtension[strings.ToLower(path.Ext(filename))]
+}
+
 func GetObject(ctx context.Context, minioClient *minio.Client, objectName string) (*minio.Object, error) {
 	obj, err := minioClient.GetObject(ctx, config.Envs.MinioBucketName, objectName, minio.GetObjectOptions{})
 	if err != nil {
@@ -27,21 +48,27 @@ func GetObject(ctx context.Context, minioClient *minio.Client, objectName string
 	return obj, err
 }
 
+func StatObject(ctx context.Context, minioClient *minio.Client, objectName string) (minio.ObjectInfo, error) {
+	return minioClient.StatObject(ctx, config.Envs.MinioBucketName, objectName, minio.StatObjectOptions{})
+}
+
 func DeleteObject(ctx context.Context, minioClient *minio.Client, object string) error {
 	return minioClient.RemoveObject(ctx, config.Envs.MinioBucketName, object, minio.RemoveObjectOptions{})
 }
 
 func DeleteDir(ctx context.Context, minioClient *minio.Client, dir string) error {
 	toDeleteChan := make(chan minio.ObjectInfo)
+	var listErr error
 	// Send object names that are needed to be removed to objectsCh
 	go func() {
 		defer close(toDeleteChan)
-		for object := range minioClient.ListObjects(context.Background(), config.Envs.MinioBucketName, minio.ListObjectsOptions{
+		for object := range minioClient.ListObjects(ctx, config.Envs.MinioBucketName, minio.ListObjectsOptions{
 			Prefix:    dir,
 			Recursive: true,
 		}) {
 			if object.Err != nil {
-				log.Fatalln(object.Err)
+				listErr = object.Err
+				return
 			}
 			toDeleteChan <- object
 		}
@@ -49,19 +76,57 @@ func DeleteDir(ctx context.Context, minioClient *minio.Client, dir string) error
 	opts := minio.RemoveObjectsOptions{
 		GovernanceBypass: true,
 	}
+	var removeErr error
 	for rErr := range minioClient.RemoveObjects(ctx, config.Envs.MinioBucketName, toDeleteChan, opts) {
-		fmt.Println("Error detected during deletion: ", rErr)
+		log.Println("Error detected during deletion: ", rErr)
+		removeErr = rErr.Err
+	}
+	if listErr != nil {
+		return listErr
 	}
-	return nil
+	return removeErr
+}
+
+// TrashedObjectKey is where the object of a document is kept while the
+// document is in the trash, out of the way of new documents with its name.
+func TrashedObjectKey(storageKey string, binID int, docID int) string {
+	return path.Join(storageKey, strconv.Itoa(binID), "trash", strconv.Itoa(docID))
+}
+
+// VersionObjectKey is where the object of an older version of a document is
+// kept. It doesn't depend on the document's bin or name, so it stays put when
+// the document is renamed or moved to another bin of the same owner.
+func VersionObjectKey(storageKey string, docID int, version int) string {
+	return path.Join(storageKey, "versions", strconv.Itoa(docID), strconv.Itoa(version))
+}
+
+// PageObjectKey is where a page added to a document is kept. Like older
+// versions, pages stay put when the document is renamed or moved to another
+// bin of the same owner.
+func PageObjectKey(storageKey string, docID int, name string) string {
+	return path.Join(storageKey, "pages", strconv.Itoa(docID), name)
+}
+
+// MovedObjectKey is where a page or older version kept under objectKey goes
+// when its document moves to the storage key of another owner.
+func MovedObjectKey(objectKey string, storageKey string) string {
+	_, rest, _ := strings.Cut(objectKey, "/")
+	return path.Join(storageKey, rest)
 }
 
+// RenameObject copies old to new. Callers delete old once the new name has
+// been recorded.
 func RenameObject(ctx context.Context, minioClient *minio.Client, old, new string) error {
+	return CopyObject(ctx, minioClient, old, new)
+}
+
+func CopyObject(ctx context.Context, minioClient *minio.Client, src, dst string) error {
 	_, err := minioClient.CopyObject(ctx, minio.CopyDestOptions{
 		Bucket: config.Envs.MinioBucketName,
-		Object: new,
+		Object: dst,
 	}, minio.CopySrcOptions{
 		Bucket: config.Envs.MinioBucketName,
-		Object: old,
+		Object: src,
 	})
 	return err
 }
@@ -86,3 +151,8 @@ func UploadToMinio(ctx context.Context, minioClient *minio.Client,
 		minio.PutObjectOptions{ContentType: contentType})
 	return err
 }
+
+func PutObject(ctx context.Context, minioClient *minio.Client, reader io.Reader, size int64, contentType string, objectName string) error {
+	_, err := minioClient.PutObject(ctx, config.Envs.MinioBucketName, objectName, reader, size, minio.PutObjectOptions{ContentType: contentType})
+	return err
+}
@@ -0,0 +1,243 @@
+package utils
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/LikheKeto/Suraksheet/types"
+	"github.com/elastic/go-elasticsearch/v8"
+)
+
+// DeleteFromIndex removes every extracted document matching query from the
+// search index.
+func DeleteFromIndex(ctx context.Context, esClient *elasticsearch.Client, query map[string]interface{}) error {
+	var buf bytes.Buffer
+	if err := json.NewEncoder(&buf).Encode(map[string]interface{}{"query": query}); err != nil {
+		return err
+	}
+	res, err := esClient.DeleteByQuery([]string{"documents"}, &buf,
+		esClient.DeleteByQuery.WithContext(ctx),
+		esClient.DeleteByQuery.WithConflicts("proceed"),
+	)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	// the index doesn't exist until the first document has been extracted
+	if res.IsError() && res.StatusCode != 404 {
+		return fmt.Errorf("error from elasticsearch: %s", res.Status())
+	}
+	return nil
+}
+
+// IndexDocument adds an extracted document to the search index, replacing any
+// earlier entry for the same document.
+func IndexDocument(ctx context.Context, esClient *elasticsearch.Client, docID int, body map[string]interface{}) error {
+	var buf bytes.Buffer
+	if err := json.NewEncoder(&buf).Encode(body); err != nil {
+		return err
+	}
+	res, err := esClient.Index("documents", &buf,
+		esClient.Index.WithContext(ctx),
+		esClient.Index.WithDocumentID(strconv.Itoa(docID)),
+	)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.IsError() {
+		return fmt.Errorf("error from elasticsearch: %s", res.Status())
+	}
+	return nil
+}
+
+// UpdateIndexedDocument sets fields on the search entry of a document. Documents
+// that haven't been extracted yet have no entry, which is not an error.
+func UpdateIndexedDocument(ctx context.Context, esClient *elasticsearch.Client, docID int, fields map[string]interface{}) error {
+	var buf bytes.Buffer
+	if err := json.NewEncoder(&buf).Encode(map[string]interface{}{"doc": fields}); err != nil {
+		return err
+	}
+	res, err := esClient.Update("documents", strconv.Itoa(docID), &buf,
+		esClient.Update.WithContext(ctx),
+	)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.IsError() && res.StatusCode != 404 {
+		return fmt.Errorf("error from elasticsearch: %s", res.Status())
+	}
+	return nil
+}
+
+// SearchOwner returns the fields of a search entry that decide who finds the
+// documents of the bin: its owner, or the members of its organization.
+func SearchOwner(bin *types.Bin) map[string]interface{} {
+	return map[string]interface{}{
+		"user_id":         bin.OwnerID,
+		"organization_id": bin.OrganizationID,
+	}
+}
+
+// IndexExtractedDocument indexes the text already extracted from a document
+// in the bin, the same way the extractor does.
+func IndexExtractedDocument(ctx context.Context, esClient *elasticsearch.Client, doc *types.Document, bin *types.Bin) error {
+	body := SearchOwner(bin)
+	body["document_id"] = doc.ID
+	body["text"] = doc.Extract
+	body["language"] = doc.Language
+	body["created_at"] = doc.CreatedAt.Format(time.RFC3339)
+	for field, value := range MetadataFields(doc) {
+		body[field] = value
+	}
+	return IndexDocument(ctx, esClient, doc.ID, body)
+}
+
+// MetadataFields returns the fields of a search entry that hold the
+// document's metadata, named the way the extractor names them.
+func MetadataFields(doc *types.Document) map[string]interface{} {
+	date := func(t *time.Time) interface{} {
+		if t == nil {
+			return nil
+		}
+		return t.Format(time.DateOnly)
+	}
+	return map[string]interface{}{
+		"document_type":   doc.DocumentType,
+		"issuer":          doc.Issuer,
+		"document_number": doc.DocumentNumber,
+		"issue_date":      date(doc.IssueDate),
+		"expiry_date":     date(doc.ExpiryDate),
+		"holder_name":     doc.HolderName,
+	}
+}
+
+// MetadataFilters returns the search filters that match the documents
+// passing filter.
+func MetadataFilters(filter types.DocumentFilter) []map[string]interface{} {
+	filters := make([]map[string]interface{}, 0)
+	if filter.DocumentType != "" {
+		filters = append(filters, map[string]interface{}{
+			"term": map[string]interface{}{"document_type.keyword": filter.DocumentType},
+		})
+	}
+	if filter.DocumentNumber != "" {
+		filters = append(filters, map[string]interface{}{
+			"term": map[string]interface{}{"document_number.keyword": map[string]interface{}{"value": filter.DocumentNumber, "case_insensitive": true}},
+		})
+	}
+	for field, value := range map[string]string{
+		"issuer":      filter.Issuer,
+		"holder_name": filter.HolderName,
+	} {
+		if value != "" {
+			filters = append(filters, map[string]interface{}{
+				"match": map[string]interface{}{field: map[string]interface{}{"query": value, "operator": "and"}},
+			})
+		}
+	}
+	if filter.ExpiresAfter != nil || filter.ExpiresBefore != nil {
+		expiry := map[string]interface{}{}
+		if filter.ExpiresAfter != nil {
+			expiry["gte"] = filter.ExpiresAfter.Format(time.DateOnly)
+		}
+		if filter.ExpiresBefore != nil {
+			expiry["lt"] = filter.ExpiresBefore.Format(time.DateOnly)
+		}
+		filters = append(filters, map[string]interface{}{
+			"range": map[string]interface{}{"expiry_date": expiry},
+		})
+	}
+	return filters
+}
+
+// SearchDocuments returns the IDs of at most size extracted documents whose
+// text or metadata matches text, best match first, among those matching
+// filter.
+func SearchDocuments(ctx context.Context, esClient *elasticsearch.Client, text string, filter map[string]interface{}, size int) ([]int, error) {
+	searchQuery := map[string]interface{}{
+		"size": size,
+		"query": map[string]interface{}{
+			"bool": map[string]interface{}{
+				"must": []map[string]interface{}{
+					{"multi_match": map[string]interface{}{
+						"query":  text,
+						"fields": []string{"text", "issuer", "holder_name", "document_number"},
+					}},
+				},
+				"filter": []map[string]interface{}{filter},
+			},
+		},
+	}
+	return searchIDs(ctx, esClient, searchQuery)
+}
+
+// IndexedWithout returns the IDs of at most size extracted documents whose
+// search entry lacks field, for entries indexed before the field was added.
+func IndexedWithout(ctx context.Context, esClient *elasticsearch.Client, field string, size int) ([]int, error) {
+	return searchIDs(ctx, esClient, map[string]interface{}{
+		"size": size,
+		"query": map[string]interface{}{
+			"bool": map[string]interface{}{
+				"must_not": []map[string]interface{}{
+					{"exists": map[string]interface{}{"field": field}},
+				},
+			},
+		},
+	})
+}
+
+func searchIDs(ctx context.Context, esClient *elasticsearch.Client, searchQuery map[string]interface{}) ([]int, error) {
+	var buf bytes.Buffer
+	if err := json.NewEncoder(&buf).Encode(searchQuery); err != nil {
+		return nil, fmt.Errorf("failed to encode search query: %v", err)
+	}
+	res, err := esClient.Search(
+		esClient.Search.WithContext(ctx),
+		esClient.Search.WithIndex("documents"),
+		esClient.Search.WithBody(&buf),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("search query failed: %v", err)
+	}
+	defer res.Body.Close()
+	// the index doesn't exist until the first document has been extracted
+	if res.StatusCode == 404 {
+		return []int{}, nil
+	}
+	if res.IsError() {
+		return nil, fmt.Errorf("error from elasticsearch: %s", res.Status())
+	}
+
+	var esRes struct {
+		Hits struct {
+			Hits []struct {
+				Source struct {
+					DocumentID int `json:"document_id"`
+				} `json:"_source"`
+			} `json:"hits"`
+		} `json:"hits"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&esRes); err != nil {
+		return nil, err
+	}
+	docIDs := make([]int, 0, len(esRes.Hits.Hits))
+	for _, hit := range esRes.Hits.Hits {
+		docIDs = append(docIDs, hit.Source.DocumentID)
+	}
+	return docIDs, nil
+}
+
+// OwnerFilter restricts a search to the documents of the bin's owner, or of
+// its organization.
+func OwnerFilter(bin *types.Bin) map[string]interface{} {
+	if bin.OrganizationID != nil {
+		return map[string]interface{}{"term": map[string]interface{}{"organization_id": *bin.OrganizationID}}
+	}
+	return map[string]interface{}{"term": map[string]interface{}{"user_id": bin.OwnerID}}
+}
@@ -6,7 +6,9 @@ import (
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"net"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/LikheKeto/Suraksheet/config"
@@ -17,11 +19,18 @@ import (
 var Validate = validator.New()
 
 type ExtractionArgs struct {
-	DocID     int    `json:"documentID"`
-	UserID    int    `json:"userID"`
-	FileKey   string `json:"fileKey"`
-	Extension string `json:"extension"`
-	Language  string `json:"language"`
+	DocID  int `json:"documentID"`
+	UserID int `json:"userID"`
+	// OrganizationID is set for documents in organization bins
+	OrganizationID *int   `json:"organizationID"`
+	FileKey        string `json:"fileKey"`
+	Extension      string `json:"extension"`
+	Language       string `json:"language"`
+	// Version keeps the text of a version that has since been replaced from
+	// being saved over its successor's
+	Version int `json:"version"`
+	// PageID is set to extract one page of a document made of several files
+	PageID *int `json:"pageID"`
 }
 
 func QueueForExtraction(ch *amqp.Channel, q amqp.Queue, args ExtractionArgs) error {
@@ -29,12 +38,15 @@ func QueueForExtraction(ch *amqp.Channel, q amqp.Queue, args ExtractionArgs) err
 	defer cancel()
 
 	jsonb, err := json.Marshal(map[string]any{
-		"documentID": args.DocID,
-		"fileKey":    args.FileKey,
-		"bucket":     config.Envs.MinioBucketName,
-		"extension":  args.Extension,
-		"language":   args.Language,
-		"userID":     args.UserID,
+		"documentID":     args.DocID,
+		"fileKey":        args.FileKey,
+		"bucket":         config.Envs.MinioBucketName,
+		"extension":      args.Extension,
+		"language":       args.Language,
+		"userID":         args.UserID,
+		"organizationID": args.OrganizationID,
+		"version":        args.Version,
+		"pageID":         args.PageID,
 	})
 	if err != nil {
 		return err
@@ -70,3 +82,91 @@ func HashString(str string) string {
 	hash.Write([]byte(str))
 	return hex.EncodeToString(hash.Sum(nil))
 }
+
+// FreeName returns name with the lowest counter that isn't taken, like
+// "Passport (2)".
+func FreeName(name string, taken map[string]bool) string {
+	for i := 2; ; i++ {
+		candidate := fmt.Sprintf("%s (%d)", name, i)
+		if !taken[candidate] {
+			return candidate
+		}
+	}
+}
+
+// SafeFileName replaces the characters that can't appear in a file name
+// offered for download.
+func SafeFileName(name string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '/' || r == '\\' || r == '"' || r < ' ' {
+			return '_'
+		}
+		return r
+	}, name)
+}
+
+// ClientIP returns the address of the client that sent r. Requests from a
+// trusted proxy are traced back through X-Forwarded-For, from the right, to
+// the first address that isn't a trusted proxy; anything further left can be
+// made up by the client.
+func ClientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return ""
+	}
+	proxies := trustedProxies()
+	if !isTrusted(ip, proxies) {
+		return ip.String()
+	}
+	hops := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := net.ParseIP(strings.TrimSpace(hops[i]))
+		if hop == nil {
+			break
+		}
+		ip = hop
+		if !isTrusted(ip, proxies) {
+			break
+		}
+	}
+	return ip.String()
+}
+
+// trustedProxies parses the configured trusted proxies, skipping any entry
+// that is neither an address nor a CIDR range.
+func trustedProxies() []*net.IPNet {
+	proxies := make([]*net.IPNet, 0)
+	for _, entry := range strings.Split(config.Envs.TrustedProxies, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if !strings.Contains(entry, "/") {
+			if ip := net.ParseIP(entry); ip != nil {
+				bits := 8 * len(ip.To16())
+				if ip.To4() != nil {
+					ip, bits = ip.To4(), 32
+				}
+				proxies = append(proxies, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			}
+			continue
+		}
+		if _, network, err := net.ParseCIDR(entry); err == nil {
+			proxies = append(proxies, network)
+		}
+	}
+	return proxies
+}
+
+func isTrusted(ip net.IP, proxies []*net.IPNet) bool {
+	for _, proxy := range proxies {
+		if proxy.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
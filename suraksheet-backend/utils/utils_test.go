@@ -0,0 +1,54 @@
+package utils
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/LikheKeto/Suraksheet/config"
+)
+
+func TestFreeName(t *testing.T) {
+	taken := map[string]bool{"Passport": true, "Passport (2)": true}
+	if got := FreeName("Passport", taken); got != "Passport (3)" {
+		t.Errorf("expected Passport (3), got %q", got)
+	}
+}
+
+func TestMovedObjectKey(t *testing.T) {
+	for key, want := range map[string]string{
+		PageObjectKey("old", 7, "a1"): PageObjectKey("new", 7, "a1"),
+		VersionObjectKey("old", 7, 2): VersionObjectKey("new", 7, 2),
+	} {
+		if got := MovedObjectKey(key, "new"); got != want {
+			t.Errorf("expected %s, got %s", want, got)
+		}
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	defer func(proxies string) { config.Envs.TrustedProxies = proxies }(config.Envs.TrustedProxies)
+	config.Envs.TrustedProxies = "10.0.0.0/8, 192.168.1.1"
+	tests := []struct {
+		name, remote, forwarded, want string
+	}{
+		{"direct client", "203.0.113.7:5000", "", "203.0.113.7"},
+		{"spoofed header from an untrusted client", "203.0.113.7:5000", "1.2.3.4", "203.0.113.7"},
+		{"behind a trusted proxy", "192.168.1.1:5000", "1.2.3.4, 203.0.113.7", "203.0.113.7"},
+		{"behind a chain of trusted proxies", "192.168.1.1:5000", "203.0.113.7, 10.1.2.3", "203.0.113.7"},
+		{"overlong garbage from the client", "192.168.1.1:5000", strings.Repeat("x", 100) + ", 203.0.113.7", "203.0.113.7"},
+		{"garbage added by nobody trusted", "192.168.1.1:5000", "203.0.113.7, not-an-ip", "192.168.1.1"},
+		{"trusted proxy without header", "10.0.0.2:5000", "", "10.0.0.2"},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.RemoteAddr = tt.remote
+		if tt.forwarded != "" {
+			r.Header.Set("X-Forwarded-For", tt.forwarded)
+		}
+		if got := ClientIP(r); got != tt.want {
+			t.Errorf("%s: expected %s, got %s", tt.name, tt.want, got)
+		}
+	}
+}
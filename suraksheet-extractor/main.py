@@ -82,26 +82,121 @@ def upload_image_to_minio(client, bucket_name, object_name, file_path):
     client.fput_object(bucket_name, object_name, file_path)
 
 
-def update_postgres_and_elasticsearch(conn, doc_id, ocr_text, user_id):
+# keep in step with joinPages in the backend's document store
+JOIN_PAGES_SQL = """
+    UPDATE documents d SET extract = p.text, extractionStatus = p.status
+    FROM (
+        SELECT COALESCE(string_agg(extract, E'\\n\\n' ORDER BY position)
+                        FILTER (WHERE extract <> ''), '') AS text,
+            CASE
+                WHEN bool_or(extractionStatus = 'pending') THEN 'pending'
+                WHEN bool_or(extractionStatus = 'completed') THEN 'completed'
+                WHEN bool_or(extractionStatus = 'failed') THEN 'failed'
+                ELSE 'empty'
+            END AS status
+        FROM document_pages WHERE document = %(doc_id)s
+        HAVING COUNT(*) > 0
+    ) p
+    WHERE d.id = %(doc_id)s
+"""
+
+
+def save_extraction(cursor, doc_id, status, text=None, version=None,
+                    page_id=None):
+    """Records the outcome of extracting a document, or one of its pages, and
+    returns whether it is still there to record it on."""
+    fields = "extractionStatus=%s"
+    values = (status,)
+    if text is not None:
+        fields += ", extract=%s"
+        values += (text,)
+
+    if page_id:
+        cursor.execute(
+            f"UPDATE document_pages SET {fields} WHERE id=%s AND document=%s",
+            values + (page_id, doc_id))
+        if cursor.rowcount == 0:
+            return False
+    else:
+        sql = f"UPDATE documents SET {fields} WHERE id=%s"
+        params = values + (doc_id,)
+        # text of a version that has been replaced since is dropped
+        if version:
+            sql += " AND version=%s"
+            params += (version,)
+        cursor.execute(sql, params)
+        if cursor.rowcount == 0:
+            return False
+        # the document's own file is one of its pages if it has any
+        cursor.execute(
+            f"UPDATE document_pages SET {fields} "
+            "WHERE document=%s AND objectKey=''",
+            values + (doc_id,))
+
+    cursor.execute(JOIN_PAGES_SQL, {"doc_id": doc_id})
+    return True
+
+
+def update_postgres_and_elasticsearch(conn, doc_id, ocr_text, user_id,
+                                      organization_id=None, version=None,
+                                      page_id=None):
     try:
         with conn.cursor() as cursor:
-            sql = "UPDATE documents SET extract=%s WHERE id=%s"
-            cursor.execute(sql, (ocr_text, doc_id))
+            saved = save_extraction(cursor, doc_id, "completed", ocr_text,
+                                    version, page_id)
+            # documents of several pages are searched by all of their text,
+            # and every document by its metadata too
+            if saved:
+                cursor.execute(
+                    "SELECT extract, language, createdAt, documentType, issuer, "
+                    "documentNumber, issueDate, expiryDate, holderName "
+                    "FROM documents WHERE id=%s", (doc_id,))
+                (text, language, created_at, document_type, issuer,
+                 document_number, issue_date, expiry_date,
+                 holder_name) = cursor.fetchone()
         conn.commit()
+        if not saved:
+            logger.info(f"Document {doc_id} has changed, skipping indexing")
+            return
 
         # Indexing in Elasticsearch
-        es.index(index="documents", id=doc_id, body={
+        body = {
             "document_id": doc_id,
             "user_id": user_id,
-            "text": ocr_text
-        })
+            "text": text,
+            # smart bins filter on these
+            "language": language,
+            "created_at": created_at.isoformat(),
+            "document_type": document_type,
+            "issuer": issuer,
+            "document_number": document_number,
+            "issue_date": issue_date.isoformat() if issue_date else None,
+            "expiry_date": expiry_date.isoformat() if expiry_date else None,
+            "holder_name": holder_name,
+        }
+        # documents in organization bins are searchable by every member
+        if organization_id is not None:
+            body["organization_id"] = organization_id
+        es.index(index="documents", id=doc_id, body=body)
 
         logger.info(f"Indexed document {doc_id} in Elasticsearch")
 
     except Exception as e:
+        conn.rollback()
         logger.error(f"Failed to update PostgreSQL or Elasticsearch: {e}")
 
 
+def set_extraction_status(conn, doc_id, status, version=None, page_id=None):
+    try:
+        with conn.cursor() as cursor:
+            save_extraction(cursor, doc_id, status, version=version,
+                            page_id=page_id)
+        conn.commit()
+    except Exception as e:
+        conn.rollback()
+        logger.error(f"Failed to update extraction status: {e}")
+
+
 def process_message(ch, method, properties, body):
     if shutdown:
         return
@@ -113,6 +208,9 @@ def process_message(ch, method, properties, body):
     extension = message["extension"]
     language = message['language']
     user_id = message['userID']
+    organization_id = message.get('organizationID')
+    version = message.get('version')
+    page_id = message.get('pageID')
 
     file_path = f"/tmp/{os.path.basename(file_key)}.{extension}"
 
@@ -124,6 +222,7 @@ def process_message(ch, method, properties, body):
             minio_client, bucket_name, file_key, file_path)
     except Exception as e:
         logger.error(f"Failed to download image: {e}")
+        set_extraction_status(db_conn, doc_id, "failed", version, page_id)
         ch.basic_nack(delivery_tag=method.delivery_tag, requeue=False)
         return
 
@@ -133,10 +232,12 @@ def process_message(ch, method, properties, body):
         if preprocessed_path is None:
             logger.warning(
                 "Skipping OCR due to lack of detectable text areas.")
+            set_extraction_status(db_conn, doc_id, "empty", version, page_id)
             ch.basic_nack(delivery_tag=method.delivery_tag, requeue=False)
             return
     except Exception as e:
         logger.error(f"Failed to preprocess image: {e}")
+        set_extraction_status(db_conn, doc_id, "failed", version, page_id)
         ch.basic_nack(delivery_tag=method.delivery_tag, requeue=False)
         return
 
@@ -147,6 +248,7 @@ def process_message(ch, method, properties, body):
         logger.info(f"OCR Result: {text}")
     except Exception as e:
         logger.error(f"Failed to perform OCR: {e}")
+        set_extraction_status(db_conn, doc_id, "failed", version, page_id)
         ch.basic_nack(delivery_tag=method.delivery_tag, requeue=False)
         return
     finally:
@@ -158,11 +260,14 @@ def process_message(ch, method, properties, body):
         try:
             cleaned_text = clean_text(text)
             update_postgres_and_elasticsearch(
-                db_conn, doc_id, cleaned_text, user_id)
+                db_conn, doc_id, cleaned_text, user_id, organization_id,
+                version, page_id)
         except Exception as e:
             logger.error(f"Failed to update PostgreSQL: {e}")
             ch.basic_nack(delivery_tag=method.delivery_tag, requeue=False)
             return
+    else:
+        set_extraction_status(db_conn, doc_id, "empty", version, page_id)
 
     ch.basic_ack(delivery_tag=method.delivery_tag)
     logger.info("Done")
@@ -2,6 +2,8 @@ export type Bin = {
 	id: number;
 	name: string;
 	owner: number;
+	isDefault: boolean;
+	archived: boolean;
 	createdAt: Date;
 };
 
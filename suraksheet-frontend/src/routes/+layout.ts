@@ -32,7 +32,7 @@ async function fetchData(tok: string, fetch: typeof window.fetch) {
 		binsStore.set(bins);
 		loadingBins.set(false);
 
-		const noBin = bins.find((bin) => bin.name === 'No Bin');
+		const noBin = bins.find((bin) => bin.isDefault);
 		if (noBin) {
 			let docsRes = await fetch(PUBLIC_SERVER_URL + '/bins/' + noBin.id, {
 				headers: {